@@ -0,0 +1,52 @@
+// Command alert-receiver is a local webhook endpoint for trying alert rules: it verifies the signature of each
+// delivery (when a secret is given) and logs the notification.
+//
+//	go run ./cmd/alert-receiver -addr :9000 -secret "$ALERT_WEBHOOK_SECRET"
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/challenge-github-events/internal/alert"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	secret := flag.String("secret", "", "webhook secret; unsigned or badly signed deliveries are rejected when set")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "read body", http.StatusBadRequest)
+			return
+		}
+		delivery := r.Header.Get(alert.DeliveryHeader)
+		if *secret != "" && !alert.Verify(*secret, body, r.Header.Get(alert.SignatureHeader)) {
+			slog.Warn("invalid signature", "delivery", delivery)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		var n alert.Notification
+		if err := json.Unmarshal(body, &n); err != nil {
+			http.Error(w, "invalid notification", http.StatusBadRequest)
+			return
+		}
+		slog.Info("alert received", "delivery", delivery, "rule", n.Rule, "status", n.Status, "value", n.Value, "message", n.Message)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	slog.Info("alert receiver listening", "addr", *addr, "signed", *secret != "")
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		slog.Error("alert receiver", "err", err)
+		os.Exit(1)
+	}
+}
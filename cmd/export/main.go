@@ -0,0 +1,82 @@
+// Command export writes commits or push events from the store (DATABASE_URL) as NDJSON, CSV or Parquet.
+//
+//	go run ./cmd/export -table commits -format parquet -from 2025-01-01 -to 2025-02-01 -repo golang/go -out commits.parquet
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/challenge-github-events/internal/config"
+	"github.com/challenge-github-events/internal/export"
+	"github.com/challenge-github-events/internal/store"
+)
+
+func main() {
+	table := flag.String("table", export.TableCommits, "table to export: commits or push_events")
+	formatFlag := flag.String("format", string(export.NDJSON), "output format: ndjson, csv or parquet")
+	from := flag.String("from", "", "first time included (RFC 3339 or YYYY-MM-DD)")
+	to := flag.String("to", "", "first time excluded (RFC 3339 or YYYY-MM-DD)")
+	repo := flag.String("repo", "", "only rows of this owner/repo")
+	author := flag.String("author", "", "only commits of this author (push events: actor login)")
+	out := flag.String("out", "-", "output file (- for stdout)")
+	flag.Parse()
+
+	if err := run(*table, *formatFlag, *from, *to, *repo, *author, *out); err != nil {
+		slog.Error("export", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(table, formatFlag, from, to, repo, author, out string) error {
+	cfg := config.Load()
+	if cfg.DatabaseURL == "" {
+		return fmt.Errorf("DATABASE_URL is required")
+	}
+	if err := export.CheckTable(table); err != nil {
+		return err
+	}
+	format, err := export.ParseFormat(formatFlag)
+	if err != nil {
+		return err
+	}
+	filter, err := export.ParseFilter(from, to, repo, author)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	st, closeStore, err := store.Open(ctx, cfg.DatabaseURL, cfg.DefaultBranches)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	defer closeStore()
+
+	var w io.Writer = os.Stdout
+	if out != "-" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := export.Export(ctx, st, table, filter, format, w)
+	if err != nil {
+		return err
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	slog.Info("exported", "table", table, "format", format, "rows", n, "out", out)
+	return nil
+}
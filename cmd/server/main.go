@@ -6,16 +6,22 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
+	"github.com/challenge-github-events/internal/alert"
+	"github.com/challenge-github-events/internal/anomaly"
+	"github.com/challenge-github-events/internal/botclass"
 	"github.com/challenge-github-events/internal/config"
 	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/identity"
+	"github.com/challenge-github-events/internal/pathclass"
 	"github.com/challenge-github-events/internal/pubsub"
+	"github.com/challenge-github-events/internal/repometa"
+	"github.com/challenge-github-events/internal/retention"
 	"github.com/challenge-github-events/internal/server"
 	"github.com/challenge-github-events/internal/store"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/challenge-github-events/internal/trending"
 )
 
 func main() {
@@ -25,45 +31,184 @@ func main() {
 		os.Exit(1)
 	}
 
-	slog.Info("starting", "poll_interval_sec", cfg.PollIntervalSec, "consumer_workers", cfg.ConsumerWorkers, "channel_size", cfg.ChannelSize, "http_addr", cfg.HTTPAddr)
+	slog.Info("starting", "poll_interval_sec", cfg.PollIntervalSec, "consumer_workers", cfg.ConsumerWorkers, "channel_size", cfg.ChannelSize, "http_addr", cfg.HTTPAddr, "merge_policy", cfg.MergePolicy)
 
 	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	st, closeStore, err := store.Open(ctx, cfg.DatabaseURL, cfg.DefaultBranches)
 	if err != nil {
 		slog.Error("connect to database", "err", err)
 		os.Exit(1)
 	}
-	defer pool.Close()
+	defer closeStore()
 	slog.Info("database connected")
 
-	st := store.NewPostgres(pool)
 	gh := github.NewClient(cfg.GHToken)
+	gh.FirstParentMerges = cfg.MergePolicy == config.MergePolicyFirstParent
 
-	// Bounded channel for backpressure
-	jobs := make(chan pubsub.CommitJob, cfg.ChannelSize)
-	defer close(jobs)
+	// Bounded jobs queue; BACKPRESSURE picks what happens when it is full
+	queue, err := pubsub.NewQueue(cfg.ChannelSize, cfg.Backpressure, st)
+	if err != nil {
+		slog.Error("BACKPRESSURE", "err", err)
+		os.Exit(1)
+	}
+	jobs := queue.Jobs()
 
-	// Consumer workers
-	cons := pubsub.NewConsumer(st, gh, jobs)
-	var wg sync.WaitGroup
-	for i := 0; i < cfg.ConsumerWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			cons.Run(ctx)
-		}()
+	// Files excluded from adjusted net lines
+	rules := cfg.ExcludePaths
+	if cfg.ExcludeDefaultPaths {
+		rules = append(append([]string{}, pathclass.DefaultRules...), rules...)
+	}
+	paths := pathclass.New(rules)
+
+	// Author identity overrides
+	var mailmap *identity.Mailmap
+	if cfg.MailmapFile != "" {
+		if mailmap, err = identity.LoadMailmap(cfg.MailmapFile); err != nil {
+			slog.Error("MAILMAP_FILE", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Bot and automation accounts
+	botRules := cfg.BotLogins
+	if cfg.BotDefaultRules {
+		botRules = append(append([]string{}, botclass.DefaultRules...), botRules...)
+	}
+	bots := botclass.New(botRules, cfg.HumanLogins, cfg.BotBurstEvents, time.Duration(cfg.BotBurstWindowSec)*time.Second)
+	// Rows stored before the burst gave a login away are flagged by botFlags, off the producer's path
+	botFlags := pubsub.NewBotFlagger(st)
+	bots.OnFlag = botFlags.Enqueue
+
+	// Outlier commits
+	var anoms *anomaly.Detector
+	if cfg.AnomalyDetection != config.AnomalyOff {
+		if anoms, err = anomaly.New(cfg.AnomalyDetection, cfg.AnomalyThreshold, cfg.AnomalyWindow, cfg.AnomalyMinLines); err != nil {
+			slog.Error("ANOMALY_DETECTION", "err", err)
+			os.Exit(1)
+		}
+		anoms.Cap = cfg.AnomalyCap
+	}
+
+	// Consumer workers (batching when CONSUMER_BATCH_SIZE > 0)
+	consOpts := pubsub.ConsumerOptions{Paths: paths, Mailmap: mailmap, Bots: bots, Anomalies: anoms}
+	var cons pubsub.Worker
+	if cfg.BatchSize > 0 {
+		cons = pubsub.NewBatchConsumer(st, gh, jobs, cfg.BatchSize, time.Duration(cfg.BatchWaitMs)*time.Millisecond, consOpts)
+	} else {
+		cons = pubsub.NewConsumer(st, gh, jobs, consOpts)
 	}
-	slog.Info("consumer workers started", "workers", cfg.ConsumerWorkers)
 
 	// Producer
 	pollInterval := time.Duration(cfg.PollIntervalSec) * time.Second
-	prod := pubsub.NewProducer(st, gh, jobs, pollInterval)
+	var forcePushes *pubsub.ForcePushDetector
+	if cfg.ForcePushDetection != config.ForcePushOff {
+		forcePushes = pubsub.NewForcePushDetector(st, gh, cfg.ForcePushDetection == config.ForcePushCompare, cfg.OrphanForcePushed)
+	}
+	sources := make([]pubsub.Source, 0, len(cfg.EventSources))
+	for _, spec := range cfg.EventSources {
+		src, err := pubsub.ParseSource(spec, pollInterval)
+		if err != nil {
+			slog.Error("EVENT_SOURCES", "err", err)
+			os.Exit(1)
+		}
+		sources = append(sources, src)
+	}
+	prod := pubsub.NewProducer(st, gh, queue, pollInterval, forcePushes)
+	prod.SetSources(sources...)
+	prod.SetBots(bots)
+	enabled := make(map[string]bool, len(cfg.EventTypes))
+	for _, t := range cfg.EventTypes {
+		enabled[t] = true
+	}
+	if !enabled[github.PushEventType] {
+		prod.Handlers().Unregister(github.PushEventType)
+	}
+	for typ, h := range pubsub.NewActivityHandlers(st) {
+		if enabled[typ] {
+			prod.Handlers().Register(typ, h)
+		}
+	}
+	// Producer and consumer workers run under a controller (paused, scaled and drained via /admin)
+	workers := cfg.ConsumerWorkers
+	if cfg.ConsumerWorkersMax > 0 {
+		if cfg.ConsumerWorkersMin > cfg.ConsumerWorkersMax {
+			slog.Error("CONSUMER_WORKERS_MIN must not exceed CONSUMER_WORKERS_MAX", "min", cfg.ConsumerWorkersMin, "max", cfg.ConsumerWorkersMax)
+			os.Exit(1)
+		}
+		workers = min(max(workers, cfg.ConsumerWorkersMin), cfg.ConsumerWorkersMax)
+	}
+	pipeline := pubsub.NewController(prod, cons, queue)
+	pipeline.Start(ctx, workers)
+	slog.Info("pipeline started", "poll_interval", pollInterval, "sources", len(sources), "workers", workers, "batch_size", cfg.BatchSize, "backpressure", cfg.Backpressure)
 	runCtx, cancel := context.WithCancel(ctx)
-	go prod.Run(runCtx)
-	slog.Info("producer started", "poll_interval", pollInterval)
+
+	// Stored rows of logins flagged as bots by the producer
+	go botFlags.Run(runCtx)
+
+	// Force-push checks queued by the producer (FORCE_PUSH_DETECTION=off disables)
+	if forcePushes != nil {
+		go forcePushes.Run(runCtx)
+	}
+
+	// Worker pool autoscaling (CONSUMER_WORKERS_MAX=0 disables); workers share gh's rate limit
+	var autoscaler *pubsub.Autoscaler
+	if cfg.ConsumerWorkersMax > 0 {
+		autoscaler = pubsub.NewAutoscaler(pipeline, gh, cfg.ConsumerWorkersMin, cfg.ConsumerWorkersMax, time.Duration(cfg.AutoscaleIntervalSec)*time.Second)
+		go autoscaler.Run(runCtx)
+	}
+
+	// Partition maintenance and retention (partitioned stores only)
+	if r, ok := st.(store.Retainer); ok {
+		day := 24 * time.Hour
+		job := retention.NewJob(r, time.Duration(cfg.RetentionDays)*day, cfg.RetentionArchive, time.Duration(cfg.StripPayloadDays)*day)
+		go job.Run(runCtx)
+	} else if cfg.RetentionDays > 0 || cfg.StripPayloadDays > 0 {
+		slog.Warn("retention needs a partitioned store (postgres); RETENTION_DAYS and STRIP_PAYLOAD_DAYS ignored")
+	}
+
+	statsFilter := store.StatsFilter{
+		ExcludeMerges:   cfg.MergePolicy == config.MergePolicySkip,
+		ExcludeOrphaned: true,
+		ExcludeBots:     cfg.ExcludeBots,
+	}
+
+	// Alert rules and webhooks
+	if cfg.AlertRulesFile != "" {
+		rules, err := alert.LoadConfig(cfg.AlertRulesFile)
+		if err != nil {
+			slog.Error("ALERT_RULES_FILE", "err", err)
+			os.Exit(1)
+		}
+		engine := alert.NewEngine(st, statsFilter, prod.Handlers().Counts, rules, alert.NewSender(nil), time.Duration(cfg.AlertIntervalSec)*time.Second)
+		go engine.Run(runCtx)
+	}
+
+	// Trending repos (TRENDING_INTERVAL_SEC=0 disables)
+	if cfg.TrendingIntervalSec > 0 {
+		windows, err := trending.ParseWindows(cfg.TrendingWindows)
+		if err != nil {
+			slog.Error("TRENDING_WINDOWS", "err", err)
+			os.Exit(1)
+		}
+		job := trending.NewJob(st, statsFilter, windows, time.Duration(cfg.TrendingIntervalSec)*time.Second)
+		go job.Run(runCtx)
+	}
+
+	// Repository metadata (REPO_METADATA_INTERVAL_SEC=0 disables); shares gh's rate limit with the producer and workers
+	if cfg.RepoMetadataIntervalSec > 0 {
+		enricher := repometa.NewEnricher(st, gh, time.Duration(cfg.RepoMetadataTTLHours)*time.Hour, time.Duration(cfg.RepoMetadataIntervalSec)*time.Second)
+		go enricher.Run(runCtx)
+	}
 
 	// HTTP server
-	srv := server.NewServer(cfg.HTTPAddr, st)
+	srv := server.NewServer(cfg.HTTPAddr, st, statsFilter)
+	if cfg.AdminToken != "" {
+		srv.SetAdmin(pipeline, cfg.AdminToken)
+	}
+	if autoscaler != nil {
+		srv.SetAutoscaler(autoscaler)
+	}
+	srv.SetQueue(queue)
 	go func() {
 		slog.Info("http server listening", "addr", cfg.HTTPAddr)
 		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
@@ -77,9 +222,7 @@ func main() {
 	slog.Info("shutting down", "signal", "received")
 
 	cancel()
-	close(jobs)
-	wg.Wait()
-	slog.Info("consumer workers stopped")
+	pipeline.Stop()
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 	if err := srv.Shutdown(shutdownCtx); err != nil {
@@ -0,0 +1,13 @@
+-- commit_files: per-file line stats of each commit (idempotent on sha + filename)
+CREATE TABLE IF NOT EXISTS commit_files (
+    sha               TEXT NOT NULL,
+    filename          TEXT NOT NULL,
+    previous_filename TEXT,
+    status            TEXT,
+    additions         BIGINT NOT NULL DEFAULT 0,
+    deletions         BIGINT NOT NULL DEFAULT 0,
+    changes           BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (sha, filename)
+);
+
+CREATE INDEX IF NOT EXISTS idx_commit_files_filename ON commit_files (filename);
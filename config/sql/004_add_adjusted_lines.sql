@@ -0,0 +1,11 @@
+-- Adjusted line stats exclude generated, vendored and lockfile changes (see internal/pathclass).
+ALTER TABLE commit_stats ADD COLUMN IF NOT EXISTS adjusted_additions BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE commit_stats ADD COLUMN IF NOT EXISTS adjusted_deletions BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE commit_stats ADD COLUMN IF NOT EXISTS adjusted_net BIGINT NOT NULL DEFAULT 0;
+
+-- Rows recorded before classification count fully towards adjusted lines.
+UPDATE commit_stats
+SET adjusted_additions = additions, adjusted_deletions = deletions, adjusted_net = net
+WHERE adjusted_additions = 0 AND adjusted_deletions = 0;
+
+ALTER TABLE commit_files ADD COLUMN IF NOT EXISTS excluded BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,13 @@
+-- commit_languages: per-commit line stats by programming language (idempotent on sha + language)
+CREATE TABLE IF NOT EXISTS commit_languages (
+    sha                TEXT NOT NULL,
+    language           TEXT NOT NULL,
+    files              INT NOT NULL DEFAULT 0,
+    additions          BIGINT NOT NULL DEFAULT 0,
+    deletions          BIGINT NOT NULL DEFAULT 0,
+    adjusted_additions BIGINT NOT NULL DEFAULT 0,
+    adjusted_deletions BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (sha, language)
+);
+
+CREATE INDEX IF NOT EXISTS idx_commit_languages_language ON commit_languages (language);
@@ -0,0 +1,5 @@
+-- Merge commits (more than one parent) can be skipped by aggregates (see MERGE_POLICY).
+ALTER TABLE commit_stats ADD COLUMN IF NOT EXISTS parent_count INT NOT NULL DEFAULT 0;
+ALTER TABLE commit_stats ADD COLUMN IF NOT EXISTS is_merge BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_commit_stats_is_merge ON commit_stats (is_merge) WHERE is_merge;
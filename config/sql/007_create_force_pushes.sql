@@ -0,0 +1,16 @@
+-- force_pushes: pushes that rewrote history (idempotent on event id)
+CREATE TABLE IF NOT EXISTS force_pushes (
+    event_id     TEXT PRIMARY KEY,
+    repo         TEXT NOT NULL,
+    before_sha   TEXT NOT NULL,
+    head_sha     TEXT NOT NULL,
+    detected_via TEXT NOT NULL,
+    status       TEXT,
+    orphaned     INT NOT NULL DEFAULT 0,
+    detected_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_force_pushes_repo ON force_pushes (repo);
+
+-- Commits discarded by a force push are marked orphaned and can be excluded from aggregates.
+ALTER TABLE commit_stats ADD COLUMN IF NOT EXISTS orphaned BOOLEAN NOT NULL DEFAULT FALSE;
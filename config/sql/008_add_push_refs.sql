@@ -0,0 +1,19 @@
+-- Ref and size details of each push event.
+ALTER TABLE gh_push_events ADD COLUMN IF NOT EXISTS ref TEXT;
+ALTER TABLE gh_push_events ADD COLUMN IF NOT EXISTS ref_type TEXT;
+ALTER TABLE gh_push_events ADD COLUMN IF NOT EXISTS push_id BIGINT;
+ALTER TABLE gh_push_events ADD COLUMN IF NOT EXISTS size INT;
+ALTER TABLE gh_push_events ADD COLUMN IF NOT EXISTS distinct_size INT;
+
+CREATE INDEX IF NOT EXISTS idx_gh_push_events_ref ON gh_push_events (repo, ref);
+
+-- commit_refs: every ref a commit was pushed to (idempotent on sha + repo + ref)
+CREATE TABLE IF NOT EXISTS commit_refs (
+    sha      TEXT NOT NULL,
+    repo     TEXT NOT NULL,
+    ref      TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    PRIMARY KEY (sha, repo, ref)
+);
+
+CREATE INDEX IF NOT EXISTS idx_commit_refs_ref ON commit_refs (ref);
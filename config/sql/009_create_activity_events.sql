@@ -0,0 +1,65 @@
+-- Non-push GitHub events (idempotent on event id). Each keeps the raw payload and its typed columns.
+CREATE TABLE IF NOT EXISTS gh_pull_request_events (
+    id            TEXT PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    actor_login   TEXT,
+    repo          TEXT NOT NULL,
+    action        TEXT,
+    number        INT,
+    title         TEXT,
+    state         TEXT,
+    merged        BOOLEAN NOT NULL DEFAULT FALSE,
+    additions     BIGINT NOT NULL DEFAULT 0,
+    deletions     BIGINT NOT NULL DEFAULT 0,
+    changed_files INT NOT NULL DEFAULT 0,
+    raw_payload   JSONB
+);
+
+CREATE TABLE IF NOT EXISTS gh_create_events (
+    id            TEXT PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    actor_login   TEXT,
+    repo          TEXT NOT NULL,
+    ref           TEXT,
+    ref_type      TEXT,
+    master_branch TEXT,
+    raw_payload   JSONB
+);
+
+CREATE TABLE IF NOT EXISTS gh_delete_events (
+    id          TEXT PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    actor_login TEXT,
+    repo        TEXT NOT NULL,
+    ref         TEXT,
+    ref_type    TEXT,
+    raw_payload JSONB
+);
+
+CREATE TABLE IF NOT EXISTS gh_release_events (
+    id          TEXT PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    actor_login TEXT,
+    repo        TEXT NOT NULL,
+    action      TEXT,
+    tag_name    TEXT,
+    name        TEXT,
+    draft       BOOLEAN NOT NULL DEFAULT FALSE,
+    prerelease  BOOLEAN NOT NULL DEFAULT FALSE,
+    raw_payload JSONB
+);
+
+CREATE TABLE IF NOT EXISTS gh_watch_events (
+    id          TEXT PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    actor_login TEXT,
+    repo        TEXT NOT NULL,
+    action      TEXT,
+    raw_payload JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_gh_pull_request_events_created_at ON gh_pull_request_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_gh_create_events_created_at ON gh_create_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_gh_delete_events_created_at ON gh_delete_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_gh_release_events_created_at ON gh_release_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_gh_watch_events_created_at ON gh_watch_events (created_at);
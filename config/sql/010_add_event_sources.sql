@@ -0,0 +1,9 @@
+-- Events stream each event was polled from (global, org:NAME, repo:OWNER/NAME, user:NAME).
+ALTER TABLE gh_push_events ADD COLUMN IF NOT EXISTS source TEXT;
+ALTER TABLE gh_pull_request_events ADD COLUMN IF NOT EXISTS source TEXT;
+ALTER TABLE gh_create_events ADD COLUMN IF NOT EXISTS source TEXT;
+ALTER TABLE gh_delete_events ADD COLUMN IF NOT EXISTS source TEXT;
+ALTER TABLE gh_release_events ADD COLUMN IF NOT EXISTS source TEXT;
+ALTER TABLE gh_watch_events ADD COLUMN IF NOT EXISTS source TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_gh_push_events_source ON gh_push_events (source);
@@ -0,0 +1,9 @@
+-- Polling state per event source, so restarts resume with the last ETag and cursor.
+CREATE TABLE IF NOT EXISTS poller_state (
+    source        TEXT PRIMARY KEY,
+    etag          TEXT,
+    last_event_id TEXT,
+    last_poll_at  TIMESTAMPTZ,
+    last_status   TEXT,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,81 @@
+-- Monthly range partitioning of gh_push_events (by created_at) and commit_stats (by committed_at).
+-- Rows start in each table's DEFAULT partition; the retention job (internal/retention) creates the monthly
+-- partitions ahead of time, moving matching rows out of the default partition, and drops or detaches
+-- partitions past RETENTION_DAYS after rolling them up below.
+--
+-- The partition key must be part of every unique key, so:
+--   gh_push_events is keyed by (id, created_at); an event id always has the same created_at.
+--   commit_stats is keyed by (sha, committed_at) and SHAs are claimed in commit_shas (unpartitioned, never
+--   expired), which keeps inserts idempotent on sha alone, even for commits whose partition was dropped.
+
+-- gh_push_events
+ALTER TABLE gh_push_events RENAME TO gh_push_events_unpartitioned;
+UPDATE gh_push_events_unpartitioned SET created_at = 'epoch' WHERE created_at IS NULL;
+
+CREATE TABLE gh_push_events (LIKE gh_push_events_unpartitioned INCLUDING DEFAULTS) PARTITION BY RANGE (created_at);
+ALTER TABLE gh_push_events ALTER COLUMN created_at SET NOT NULL;
+CREATE TABLE gh_push_events_default PARTITION OF gh_push_events DEFAULT;
+
+INSERT INTO gh_push_events SELECT * FROM gh_push_events_unpartitioned;
+DROP TABLE gh_push_events_unpartitioned;
+ALTER TABLE gh_push_events ADD PRIMARY KEY (id, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_gh_push_events_created_at ON gh_push_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_gh_push_events_ref ON gh_push_events (repo, ref);
+CREATE INDEX IF NOT EXISTS idx_gh_push_events_source ON gh_push_events (source);
+
+-- commit_stats
+ALTER TABLE commit_stats RENAME TO commit_stats_unpartitioned;
+UPDATE commit_stats_unpartitioned SET committed_at = 'epoch' WHERE committed_at IS NULL;
+
+CREATE TABLE commit_stats (LIKE commit_stats_unpartitioned INCLUDING DEFAULTS) PARTITION BY RANGE (committed_at);
+ALTER TABLE commit_stats ALTER COLUMN committed_at SET NOT NULL;
+CREATE TABLE commit_stats_default PARTITION OF commit_stats DEFAULT;
+
+INSERT INTO commit_stats SELECT * FROM commit_stats_unpartitioned;
+DROP TABLE commit_stats_unpartitioned;
+ALTER TABLE commit_stats ADD PRIMARY KEY (sha, committed_at);
+
+CREATE INDEX IF NOT EXISTS idx_commit_stats_sha ON commit_stats (sha);
+CREATE INDEX IF NOT EXISTS idx_commit_stats_repo ON commit_stats (repo);
+CREATE INDEX IF NOT EXISTS idx_commit_stats_committed_at ON commit_stats (committed_at);
+CREATE INDEX IF NOT EXISTS idx_commit_stats_is_merge ON commit_stats (is_merge) WHERE is_merge;
+
+-- commit_shas: every SHA ever inserted into commit_stats (idempotency across partitions and retention)
+CREATE TABLE IF NOT EXISTS commit_shas (
+    sha TEXT PRIMARY KEY
+);
+INSERT INTO commit_shas (sha) SELECT sha FROM commit_stats ON CONFLICT DO NOTHING;
+
+-- Rollups of expired partitions, added to the aggregates so dropping data does not change them.
+CREATE TABLE IF NOT EXISTS commit_stats_rollups (
+    month              DATE NOT NULL,
+    is_merge           BOOLEAN NOT NULL,
+    orphaned           BOOLEAN NOT NULL,
+    commits            BIGINT NOT NULL DEFAULT 0,
+    additions          BIGINT NOT NULL DEFAULT 0,
+    deletions          BIGINT NOT NULL DEFAULT 0,
+    net                BIGINT NOT NULL DEFAULT 0,
+    adjusted_additions BIGINT NOT NULL DEFAULT 0,
+    adjusted_deletions BIGINT NOT NULL DEFAULT 0,
+    adjusted_net       BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (month, is_merge, orphaned)
+);
+
+CREATE TABLE IF NOT EXISTS commit_language_rollups (
+    month              DATE NOT NULL,
+    language           TEXT NOT NULL,
+    is_merge           BOOLEAN NOT NULL,
+    orphaned           BOOLEAN NOT NULL,
+    commits            BIGINT NOT NULL DEFAULT 0,
+    additions          BIGINT NOT NULL DEFAULT 0,
+    deletions          BIGINT NOT NULL DEFAULT 0,
+    adjusted_additions BIGINT NOT NULL DEFAULT 0,
+    adjusted_deletions BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (month, language, is_merge, orphaned)
+);
+
+CREATE TABLE IF NOT EXISTS push_event_rollups (
+    month  DATE PRIMARY KEY,
+    events BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,30 @@
+-- Canonical authors. Commit authors and committers (commit_identities) are linked to an author through
+-- merge keys (author_aliases): login:LOGIN, email:EMAIL or name:NAME, normalized by internal/identity after
+-- MAILMAP_FILE overrides. Identities sharing any key with an author are linked to it.
+CREATE TABLE IF NOT EXISTS authors (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT NOT NULL,
+    email      TEXT,
+    login      TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS author_aliases (
+    key       TEXT PRIMARY KEY,
+    author_id BIGINT NOT NULL REFERENCES authors (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_author_aliases_author_id ON author_aliases (author_id);
+
+-- Identities as recorded by git (name, email) and GitHub (login) for each commit and role (author, committer).
+CREATE TABLE IF NOT EXISTS commit_identities (
+    sha       TEXT NOT NULL,
+    role      TEXT NOT NULL,
+    name      TEXT,
+    email     TEXT,
+    login     TEXT,
+    author_id BIGINT NOT NULL REFERENCES authors (id),
+    PRIMARY KEY (sha, role)
+);
+
+CREATE INDEX IF NOT EXISTS idx_commit_identities_author_id ON commit_identities (author_id);
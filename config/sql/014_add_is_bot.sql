@@ -0,0 +1,28 @@
+-- Bot and automation flags (internal/botclass): events whose actor is a bot and commits authored by one.
+-- Stats endpoints include or exclude them with ?bots=include|exclude.
+ALTER TABLE gh_push_events ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE gh_pull_request_events ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE gh_create_events ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE gh_delete_events ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE gh_release_events ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE gh_watch_events ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE commit_stats ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_commit_stats_is_bot ON commit_stats (is_bot) WHERE is_bot;
+
+-- Archive tables receive rows with SELECT *, so they need the same columns.
+ALTER TABLE IF EXISTS gh_push_events_archive ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE IF EXISTS commit_stats_archive ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Rollups keep the flag, so excluding bots still works for expired partitions.
+ALTER TABLE commit_stats_rollups ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE commit_stats_rollups DROP CONSTRAINT IF EXISTS commit_stats_rollups_pkey;
+ALTER TABLE commit_stats_rollups ADD PRIMARY KEY (month, is_merge, orphaned, is_bot);
+
+ALTER TABLE commit_language_rollups ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE commit_language_rollups DROP CONSTRAINT IF EXISTS commit_language_rollups_pkey;
+ALTER TABLE commit_language_rollups ADD PRIMARY KEY (month, language, is_merge, orphaned, is_bot);
+
+ALTER TABLE push_event_rollups ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE push_event_rollups DROP CONSTRAINT IF EXISTS push_event_rollups_pkey;
+ALTER TABLE push_event_rollups ADD PRIMARY KEY (month, is_bot);
@@ -0,0 +1,19 @@
+-- anomalies: outlier commits by size against a rolling baseline (internal/anomaly), idempotent on sha
+CREATE TABLE IF NOT EXISTS anomalies (
+    sha          TEXT PRIMARY KEY,
+    repo         TEXT NOT NULL,
+    author       TEXT,
+    committed_at TIMESTAMPTZ,
+    detected_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    additions    BIGINT NOT NULL DEFAULT 0,
+    deletions    BIGINT NOT NULL DEFAULT 0,
+    method       TEXT NOT NULL,             -- zscore or percentile
+    baseline     TEXT NOT NULL,             -- repo or global
+    samples      INT NOT NULL DEFAULT 0,    -- commits in the baseline
+    score        DOUBLE PRECISION NOT NULL, -- z-score of the commit size (log scale)
+    limit_lines  BIGINT NOT NULL,           -- size above which commits are outliers
+    capped       BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS idx_anomalies_committed_at ON anomalies (committed_at);
+CREATE INDEX IF NOT EXISTS idx_anomalies_repo ON anomalies (repo);
@@ -0,0 +1,13 @@
+-- trending_repos: the latest trending snapshot per window (internal/trending), replaced on every run
+CREATE TABLE IF NOT EXISTS trending_repos (
+    window_sec  BIGINT NOT NULL,           -- window length in seconds
+    repo        TEXT NOT NULL,
+    rank        INT NOT NULL,              -- 1 is the top trending repo
+    score       DOUBLE PRECISION NOT NULL, -- decayed activity of the window minus that of the window before
+    velocity    DOUBLE PRECISION NOT NULL, -- pushes and commits per hour over the window
+    pushes      BIGINT NOT NULL DEFAULT 0,
+    commits     BIGINT NOT NULL DEFAULT 0,
+    samples     JSONB,                     -- recent commits: sha, author, committed_at, additions, deletions
+    computed_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (window_sec, repo)
+);
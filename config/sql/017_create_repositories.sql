@@ -0,0 +1,15 @@
+-- repositories: GitHub metadata of the repos seen in commit_stats (internal/repometa), refreshed after a TTL
+CREATE TABLE IF NOT EXISTS repositories (
+    repo           TEXT PRIMARY KEY,              -- owner/repo as named by the events
+    found          BOOLEAN NOT NULL DEFAULT TRUE, -- false when GitHub answered 404 (deleted, private or renamed)
+    language       TEXT,                          -- primary language
+    stars          INT NOT NULL DEFAULT 0,
+    fork           BOOLEAN NOT NULL DEFAULT FALSE,
+    parent         TEXT,                          -- owner/repo a fork was forked from
+    default_branch TEXT,
+    archived       BOOLEAN NOT NULL DEFAULT FALSE,
+    license        TEXT,                          -- SPDX id
+    fetched_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_repositories_fetched_at ON repositories (fetched_at);
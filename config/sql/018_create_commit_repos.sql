@@ -0,0 +1,15 @@
+-- commit_repos: every repo a commit was seen in (e.g. pushed to a fork and its upstream);
+-- commit_stats.repo is the canonical one, preferring upstreams once repositories has their metadata
+CREATE TABLE IF NOT EXISTS commit_repos (
+    sha           TEXT NOT NULL,
+    repo          TEXT NOT NULL,
+    first_seen_at TIMESTAMPTZ NOT NULL, -- created_at of the first push event the commit was seen in for this repo
+    PRIMARY KEY (sha, repo)
+);
+
+CREATE INDEX IF NOT EXISTS idx_commit_repos_repo ON commit_repos (repo);
+
+-- Commits stored before commit_repos was seen in their own repo.
+INSERT INTO commit_repos (sha, repo, first_seen_at)
+SELECT sha, repo, committed_at FROM commit_stats
+ON CONFLICT (sha, repo) DO NOTHING;
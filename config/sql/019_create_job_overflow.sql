@@ -0,0 +1,10 @@
+-- job_overflow: commit jobs that did not fit in the bounded jobs queue (BACKPRESSURE=spill), replayed
+-- oldest first once there is room again
+CREATE TABLE IF NOT EXISTS job_overflow (
+    id         BIGSERIAL PRIMARY KEY,
+    event_id   TEXT,                   -- push event that enqueued the job
+    owner      TEXT NOT NULL,
+    repo       TEXT NOT NULL,
+    sha        TEXT NOT NULL,
+    spilled_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,16 @@
+-- Capped lines of outlier commits (ANOMALY_CAP): aggregates of raw lines count these instead of additions and
+-- deletions, so one huge commit does not skew them. NULL for commits that are not capped.
+ALTER TABLE commit_stats ADD COLUMN IF NOT EXISTS capped_additions BIGINT;
+ALTER TABLE commit_stats ADD COLUMN IF NOT EXISTS capped_deletions BIGINT;
+
+-- Archive tables receive rows with SELECT *, so they need the same columns.
+ALTER TABLE IF EXISTS commit_stats_archive ADD COLUMN IF NOT EXISTS capped_additions BIGINT;
+ALTER TABLE IF EXISTS commit_stats_archive ADD COLUMN IF NOT EXISTS capped_deletions BIGINT;
+
+-- Outliers capped before this migration only had their adjusted lines capped: cap their raw lines at the
+-- recorded limit too.
+UPDATE commit_stats cs
+SET capped_additions = ROUND(a.additions * a.limit_lines::numeric / (a.additions + a.deletions)),
+    capped_deletions = a.limit_lines - ROUND(a.additions * a.limit_lines::numeric / (a.additions + a.deletions))
+FROM anomalies a
+WHERE a.sha = cs.sha AND a.capped AND a.additions + a.deletions > a.limit_lines;
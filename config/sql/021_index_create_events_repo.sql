@@ -0,0 +1,3 @@
+-- branch=default resolves a repo's default branch from the master_branch of its latest CreateEvent when
+-- repositories has no metadata for it.
+CREATE INDEX IF NOT EXISTS idx_gh_create_events_repo ON gh_create_events (repo, created_at);
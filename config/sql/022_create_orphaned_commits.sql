@@ -0,0 +1,6 @@
+-- orphaned_commits: commits discarded by a force push, recorded so those not fetched yet are marked
+-- orphaned when they are inserted into commit_stats.
+CREATE TABLE IF NOT EXISTS orphaned_commits (
+    sha       TEXT PRIMARY KEY,
+    marked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,211 @@
+// Package alert evaluates alert rules periodically against store aggregates and runtime counters and notifies
+// HTTP webhooks when a rule starts firing (at most once per cooldown) and when it resolves.
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+)
+
+// DefaultInterval is how often Run evaluates the rules when no interval is given.
+const DefaultInterval = time.Minute
+
+// Engine evaluates rules and delivers their notifications. Depends only on the store interface.
+type Engine struct {
+	store    store.Store
+	defaults store.StatsFilter
+	counters func() map[string]int64
+	rules    []Rule
+	webhooks []Webhook
+	sender   *Sender
+	states   map[string]*ruleState
+	interval time.Duration
+	now      func() time.Time
+	log      *slog.Logger
+}
+
+// ruleState tracks a rule across evaluations. Only used by the goroutine running the engine.
+type ruleState struct {
+	firing     bool
+	notified   bool      // a firing notification was sent for the current firing period
+	lastSent   time.Time // last firing notification, for the cooldown
+	count      int64     // KindStall: counter total at the last change
+	lastChange time.Time // KindStall: when the counter total last changed
+}
+
+// NewEngine returns an engine evaluating cfg every interval (DefaultInterval when <= 0). Aggregates use the
+// defaults filter (e.g. merge, orphan and bot exclusion) with the rule window and repo applied on top.
+// counters returns the runtime event counters used by KindStall rules (e.g. the pubsub registry counts).
+func NewEngine(s store.Store, defaults store.StatsFilter, counters func() map[string]int64, cfg *Config, sender *Sender, interval time.Duration) *Engine {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Engine{
+		store:    s,
+		defaults: defaults,
+		counters: counters,
+		rules:    cfg.Rules,
+		webhooks: cfg.Webhooks,
+		sender:   sender,
+		states:   make(map[string]*ruleState, len(cfg.Rules)),
+		interval: interval,
+		now:      time.Now,
+		log:      slog.Default(),
+	}
+}
+
+// Run evaluates the rules at start and then every interval until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context) {
+	e.log.Info("alert engine running", "rules", len(e.rules), "webhooks", len(e.webhooks), "interval", e.interval)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		if err := e.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			e.log.Warn("alert", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			e.log.Info("alert engine stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce evaluates every rule and sends the notifications due. A failing rule does not stop the others.
+func (e *Engine) RunOnce(ctx context.Context) error {
+	var errs []error
+	for i := range e.rules {
+		r := &e.rules[i]
+		st, ok := e.states[r.Name]
+		if !ok {
+			st = &ruleState{}
+			e.states[r.Name] = st
+		}
+		firing, value, err := e.evaluate(ctx, r, st)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", r.Name, err))
+			continue
+		}
+		if err := e.update(ctx, r, st, firing, value); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", r.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// evaluate returns whether r holds now and the value it was checked on.
+func (e *Engine) evaluate(ctx context.Context, r *Rule, st *ruleState) (bool, int64, error) {
+	now := e.now()
+	switch r.Kind {
+	case KindNetSwing, KindRepoNet:
+		filter := e.defaults
+		if r.Window > 0 {
+			filter.Since = now.Add(-time.Duration(r.Window))
+		}
+		filter.Repo = r.Repo
+		net, err := e.store.GlobalNetLines(ctx, filter)
+		if err != nil {
+			return false, 0, err
+		}
+		switch {
+		case r.Kind == KindNetSwing:
+			return net >= r.Threshold || net <= -r.Threshold, net, nil
+		case r.Threshold < 0:
+			return net <= r.Threshold, net, nil
+		default:
+			return net >= r.Threshold, net, nil
+		}
+	case KindStall:
+		if e.counters == nil {
+			return false, 0, fmt.Errorf("no runtime counters")
+		}
+		var total int64
+		for name, n := range e.counters() {
+			if r.Counter == "" || name == r.Counter {
+				total += n
+			}
+		}
+		if st.lastChange.IsZero() || total != st.count {
+			st.count, st.lastChange = total, now
+		}
+		idle := now.Sub(st.lastChange)
+		return idle >= time.Duration(r.Window), int64(idle / time.Second), nil
+	}
+	return false, 0, fmt.Errorf("invalid kind %q", r.Kind)
+}
+
+// update moves st to firing and notifies on the transition, at most once per cooldown; a rule firing again within
+// its cooldown stays silent, including when it resolves. Rules keep firing silently until they resolve.
+func (e *Engine) update(ctx context.Context, r *Rule, st *ruleState, firing bool, value int64) error {
+	now := e.now()
+	switch {
+	case firing && !st.firing:
+		st.firing = true
+		if !st.lastSent.IsZero() && now.Sub(st.lastSent) < r.cooldown() {
+			e.log.Info("alert firing within cooldown, not notified", "rule", r.Name, "value", value)
+			return nil
+		}
+		if err := e.notify(ctx, r, StatusFiring, value); err != nil {
+			// Fire again on the next evaluation.
+			st.firing = false
+			return err
+		}
+		st.notified, st.lastSent = true, now
+	case !firing && st.firing:
+		st.firing = false
+		if st.notified {
+			st.notified = false
+			return e.notify(ctx, r, StatusResolved, value)
+		}
+	}
+	return nil
+}
+
+// notify sends a notification of r to its webhooks.
+func (e *Engine) notify(ctx context.Context, r *Rule, status string, value int64) error {
+	n := &Notification{
+		Rule:      r.Name,
+		Kind:      r.Kind,
+		Status:    status,
+		Value:     value,
+		Threshold: r.Threshold,
+		Repo:      r.Repo,
+		Message:   message(r, status, value),
+		At:        e.now().UTC(),
+	}
+	if r.Window > 0 {
+		n.Window = time.Duration(r.Window).String()
+	}
+	e.log.Info("alert "+status, "rule", r.Name, "value", value)
+	var errs []error
+	for _, w := range e.webhooks {
+		if len(r.Webhooks) > 0 && !slices.Contains(r.Webhooks, w.Name) {
+			continue
+		}
+		if err := e.sender.Send(ctx, w, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func message(r *Rule, status string, value int64) string {
+	if status == StatusResolved {
+		return fmt.Sprintf("%s resolved", r.Name)
+	}
+	switch r.Kind {
+	case KindNetSwing:
+		return fmt.Sprintf("net lines over the last %s are %d (threshold ±%d)", time.Duration(r.Window), value, r.Threshold)
+	case KindRepoNet:
+		return fmt.Sprintf("net lines of %s are %d (threshold %d)", r.Repo, value, r.Threshold)
+	default:
+		return fmt.Sprintf("no events processed for %s", time.Duration(value)*time.Second)
+	}
+}
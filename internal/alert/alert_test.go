@@ -0,0 +1,188 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+func testEngine(t *testing.T, s store.Store, counters func() map[string]int64, rules string, hooks ...*receiver) *Engine {
+	t.Helper()
+	var ws []string
+	for i, rc := range hooks {
+		ws = append(ws, `{"name":"hook`+string(rune('a'+i))+`","url":"`+rc.URL+`","secret":"`+rc.secret+`"}`)
+	}
+	cfg, err := ParseConfig(strings.NewReader(`{"webhooks":[` + strings.Join(ws, ",") + `],"rules":[` + rules + `]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEngine(s, store.StatsFilter{ExcludeMerges: true}, counters, cfg, testSender(), 0)
+}
+
+func TestEngine_NetSwingNotifiesOnceAndResolves(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mockStore := store.NewMockStore(ctrl)
+	want := store.StatsFilter{ExcludeMerges: true, Since: now.Add(-time.Hour)}
+	gomock.InOrder(
+		mockStore.EXPECT().GlobalNetLines(gomock.Any(), want).Return(int64(-60_000), nil),
+		mockStore.EXPECT().GlobalNetLines(gomock.Any(), want).Return(int64(-70_000), nil),
+		mockStore.EXPECT().GlobalNetLines(gomock.Any(), want).Return(int64(10), nil),
+	)
+	rc := newReceiver(t, "k")
+	e := testEngine(t, mockStore, nil, `{"name":"swing","kind":"net_swing","window":"1h","threshold":50000}`, rc)
+	e.now = func() time.Time { return now }
+	for i := 0; i < 3; i++ {
+		if err := e.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := rc.notifications()
+	if len(got) != 2 || got[0].Status != StatusFiring || got[0].Value != -60_000 || got[0].Window != "1h0m0s" || got[1].Status != StatusResolved {
+		t.Errorf("want one firing and one resolved notification got %+v", got)
+	}
+}
+
+func TestEngine_CooldownSuppressesRefiring(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mockStore := store.NewMockStore(ctrl)
+	var net int64
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), store.StatsFilter{ExcludeMerges: true, Repo: "o/r"}).
+		DoAndReturn(func(context.Context, store.StatsFilter) (int64, error) { return net, nil }).AnyTimes()
+	rc := newReceiver(t, "")
+	e := testEngine(t, mockStore, nil, `{"name":"big","kind":"repo_net","repo":"o/r","threshold":1000,"cooldown":"30m"}`, rc)
+	e.now = func() time.Time { return now }
+	step := func(lines int64, after time.Duration) {
+		t.Helper()
+		net, now = lines, now.Add(after)
+		if err := e.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	step(1500, 0)              // fires
+	step(500, 5*time.Minute)   // resolves
+	step(1500, 5*time.Minute)  // fires again within the cooldown: silent
+	step(500, 5*time.Minute)   // resolves silently
+	step(2000, 30*time.Minute) // fires after the cooldown
+	var statuses []string
+	for _, n := range rc.notifications() {
+		statuses = append(statuses, n.Status)
+	}
+	if strings.Join(statuses, ",") != "firing,resolved,firing" {
+		t.Errorf("unexpected notifications %v", statuses)
+	}
+}
+
+func TestEngine_StallUsesCounters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	counts := map[string]int64{"PushEvent": 10, "CreateEvent": 3}
+	rc := newReceiver(t, "")
+	e := testEngine(t, store.NewMockStore(ctrl), func() map[string]int64 { return counts },
+		`{"name":"stalled","kind":"stall","window":"10m","counter":"PushEvent"}`, rc)
+	e.now = func() time.Time { return now }
+	step := func(after time.Duration) {
+		t.Helper()
+		now = now.Add(after)
+		if err := e.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	step(0)
+	counts["CreateEvent"]++ // other counters do not count
+	step(9 * time.Minute)
+	if n := len(rc.notifications()); n != 0 {
+		t.Fatalf("want no notification before the window got %d", n)
+	}
+	step(2 * time.Minute)
+	counts["PushEvent"]++
+	step(time.Minute)
+
+	got := rc.notifications()
+	if len(got) != 2 || got[0].Status != StatusFiring || got[0].Value != 660 || got[1].Status != StatusResolved {
+		t.Errorf("unexpected notifications %+v", got)
+	}
+}
+
+func TestEngine_RetriesFailedNotificationOnNextRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), gomock.Any()).Return(int64(5000), nil).Times(2)
+	rc := newReceiver(t, "", 503, 503, 503, 503)
+	e := testEngine(t, mockStore, nil, `{"name":"big","kind":"repo_net","repo":"o/r","threshold":1000}`, rc)
+	if err := e.RunOnce(context.Background()); err == nil {
+		t.Fatal("undeliverable notification want error")
+	}
+	if err := e.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := rc.notifications(); len(got) != 1 || got[0].Status != StatusFiring {
+		t.Errorf("want firing notification delivered on the next run got %+v", got)
+	}
+}
+
+func TestEngine_StoreErrorDoesNotStopOtherRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), gomock.Any()).Return(int64(0), errors.New("boom"))
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), gomock.Any()).Return(int64(5000), nil)
+	rc := newReceiver(t, "")
+	e := testEngine(t, mockStore, nil, `{"name":"a","kind":"repo_net","repo":"o/a","threshold":1000},
+		{"name":"b","kind":"repo_net","repo":"o/b","threshold":1000,"webhooks":["hooka"]}`, rc)
+	if err := e.RunOnce(context.Background()); err == nil || !strings.Contains(err.Error(), "rule a") {
+		t.Fatalf("want rule a error got %v", err)
+	}
+	if got := rc.notifications(); len(got) != 1 || got[0].Rule != "b" {
+		t.Errorf("want rule b notified got %+v", got)
+	}
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	hook := `"webhooks":[{"name":"h","url":"http://localhost:9000/hook"}]`
+	for _, cfg := range []string{
+		`{"rules":[]}`,
+		`{"webhooks":[{"name":"h","url":"localhost:9000"}],"rules":[]}`,
+		`{` + hook + `,"rules":[{"name":"r","kind":"net_swing","threshold":10}]}`,
+		`{` + hook + `,"rules":[{"name":"r","kind":"repo_net","repo":"r","threshold":10}]}`,
+		`{` + hook + `,"rules":[{"name":"r","kind":"stall","window":"5"}]}`,
+		`{` + hook + `,"rules":[{"name":"r","kind":"spike","window":"5m"}]}`,
+		`{` + hook + `,"rules":[{"name":"r","kind":"stall","window":"5m","webhooks":["other"]}]}`,
+		`{` + hook + `,"rules":[{"name":"r","kind":"stall","window":"5m","windw":"1h"}]}`,
+		`{` + hook + `,"rules":[{"name":"r","kind":"stall","window":"5m"},{"name":"r","kind":"stall","window":"5m"}]}`,
+	} {
+		if _, err := ParseConfig(strings.NewReader(cfg)); err == nil {
+			t.Errorf("ParseConfig(%s) want error", cfg)
+		}
+	}
+}
+
+func TestParseConfig_ExpandsSecrets(t *testing.T) {
+	t.Setenv("ALERT_TEST_SECRET", "from-env")
+	cfg, err := ParseConfig(strings.NewReader(`{"webhooks":[{"name":"h","url":"https://example.com/hook","secret":"${ALERT_TEST_SECRET}"}],
+		"rules":[{"name":"r","kind":"stall","window":"15m"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Webhooks[0].Secret != "from-env" || time.Duration(cfg.Rules[0].Window) != 15*time.Minute || cfg.Rules[0].cooldown() != DefaultCooldown {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
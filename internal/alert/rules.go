@@ -0,0 +1,165 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Rule kinds.
+const (
+	// KindNetSwing fires when the net lines of the commits of the last Window reach Threshold in either direction.
+	KindNetSwing = "net_swing"
+	// KindRepoNet fires when the net lines of Repo (over the last Window, or all time when unset) reach Threshold;
+	// a negative Threshold fires when they drop to it.
+	KindRepoNet = "repo_net"
+	// KindStall fires when the runtime event counters have not moved for Window.
+	KindStall = "stall"
+)
+
+// DefaultCooldown is the minimum time between two firing notifications of a rule when Rule.Cooldown is unset.
+const DefaultCooldown = time.Hour
+
+// Duration is a time.Duration read from JSON as a Go duration string (e.g. "15m", "24h").
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return fmt.Errorf("negative duration %q", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Webhook is an HTTP endpoint notifications are POSTed to.
+type Webhook struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Secret signs the payloads with HMAC-SHA256 when set. ${VAR} references are expanded from the environment.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Rule is a condition evaluated periodically by the Engine.
+type Rule struct {
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	Repo      string   `json:"repo,omitempty"`   // owner/repo, KindRepoNet only
+	Window    Duration `json:"window,omitempty"` // lookback for KindNetSwing and KindRepoNet, idle time for KindStall
+	Threshold int64    `json:"threshold,omitempty"`
+	// Counter limits KindStall to one event type counter; all counters are summed when unset.
+	Counter  string   `json:"counter,omitempty"`
+	Cooldown Duration `json:"cooldown,omitempty"`
+	// Webhooks lists the names of the webhooks notified; all webhooks when empty.
+	Webhooks []string `json:"webhooks,omitempty"`
+}
+
+// Config holds the webhooks and rules of an alert rules file.
+type Config struct {
+	Webhooks []Webhook `json:"webhooks"`
+	Rules    []Rule    `json:"rules"`
+}
+
+// LoadConfig reads and validates the JSON rules file at path.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig decodes and validates a JSON rules file. Unknown fields are rejected to catch typos.
+func ParseConfig(r io.Reader) (*Config, error) {
+	var cfg Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	for i := range cfg.Webhooks {
+		cfg.Webhooks[i].Secret = os.ExpandEnv(cfg.Webhooks[i].Secret)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Webhooks) == 0 {
+		return fmt.Errorf("no webhooks")
+	}
+	hooks := make(map[string]bool, len(c.Webhooks))
+	for _, w := range c.Webhooks {
+		if w.Name == "" || hooks[w.Name] {
+			return fmt.Errorf("webhook names must be set and unique, got %q", w.Name)
+		}
+		hooks[w.Name] = true
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %s: invalid url %q", w.Name, w.URL)
+		}
+	}
+	rules := make(map[string]bool, len(c.Rules))
+	for _, r := range c.Rules {
+		if r.Name == "" || rules[r.Name] {
+			return fmt.Errorf("rule names must be set and unique, got %q", r.Name)
+		}
+		rules[r.Name] = true
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		for _, name := range r.Webhooks {
+			if !hooks[name] {
+				return fmt.Errorf("rule %s: unknown webhook %q", r.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	switch r.Kind {
+	case KindNetSwing:
+		if r.Window <= 0 || r.Threshold <= 0 {
+			return fmt.Errorf("%s needs a window and a positive threshold", r.Kind)
+		}
+	case KindRepoNet:
+		if strings.Count(r.Repo, "/") != 1 || r.Threshold == 0 {
+			return fmt.Errorf("%s needs an owner/repo and a non-zero threshold", r.Kind)
+		}
+	case KindStall:
+		if r.Window <= 0 {
+			return fmt.Errorf("%s needs a window", r.Kind)
+		}
+	default:
+		return fmt.Errorf("invalid kind %q: want %s, %s or %s", r.Kind, KindNetSwing, KindRepoNet, KindStall)
+	}
+	return nil
+}
+
+// cooldown returns the rule cooldown or DefaultCooldown.
+func (r *Rule) cooldown() time.Duration {
+	if r.Cooldown > 0 {
+		return time.Duration(r.Cooldown)
+	}
+	return DefaultCooldown
+}
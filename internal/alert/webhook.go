@@ -0,0 +1,145 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Headers set on webhook deliveries.
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body keyed with the webhook secret.
+	SignatureHeader = "X-Signature-256"
+	// DeliveryHeader carries an id unique per notification, the same across retries, so receivers can dedupe.
+	DeliveryHeader = "X-Alert-Delivery"
+)
+
+// Notification statuses.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+const (
+	// DefaultAttempts is the number of delivery attempts of a notification.
+	DefaultAttempts = 4
+	// DefaultBackoff is the wait before the first retry, doubled on every further retry.
+	DefaultBackoff = time.Second
+	// deliveryTimeout bounds each delivery attempt.
+	deliveryTimeout = 10 * time.Second
+)
+
+// Notification is the JSON payload POSTed to webhooks.
+type Notification struct {
+	Rule      string    `json:"rule"`
+	Kind      string    `json:"kind"`
+	Status    string    `json:"status"`    // StatusFiring or StatusResolved
+	Value     int64     `json:"value"`     // net lines, or idle seconds for KindStall
+	Threshold int64     `json:"threshold"` // 0 for KindStall
+	Window    string    `json:"window,omitempty"`
+	Repo      string    `json:"repo,omitempty"`
+	Message   string    `json:"message"`
+	At        time.Time `json:"at"`
+}
+
+// Sender delivers notifications to webhooks, retrying network errors, 429 and 5xx responses with exponential backoff.
+type Sender struct {
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+	log      *slog.Logger
+}
+
+// NewSender returns a sender using client, or a client with a per-attempt timeout when nil.
+func NewSender(client *http.Client) *Sender {
+	if client == nil {
+		client = &http.Client{Timeout: deliveryTimeout}
+	}
+	return &Sender{client: client, attempts: DefaultAttempts, backoff: DefaultBackoff, log: slog.Default()}
+}
+
+// Send POSTs n to w, signed when w has a secret. Returns the last error once all attempts failed.
+func (s *Sender) Send(ctx context.Context, w Webhook, n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	id := deliveryID()
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, w, id, body)
+		if err == nil {
+			s.log.Debug("webhook delivered", "webhook", w.Name, "rule", n.Rule, "status", n.Status, "delivery", id, "attempt", attempt)
+			return nil
+		}
+		if !retry || attempt >= s.attempts {
+			return fmt.Errorf("webhook %s: delivery %s failed after %d attempts: %w", w.Name, id, attempt, err)
+		}
+		s.log.Warn("webhook delivery failed, retrying", "webhook", w.Name, "delivery", id, "attempt", attempt, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth retrying.
+func (s *Sender) post(ctx context.Context, w Webhook, id string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "github-events-alerts")
+	req.Header.Set(DeliveryHeader, id)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// Sign returns the SignatureHeader value of body for secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the SignatureHeader value of body for secret, in constant time.
+func Verify(secret string, body []byte, signature string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func deliveryID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a local webhook endpoint recording the verified deliveries, answering statuses in turn
+// (200 once they run out).
+type receiver struct {
+	*httptest.Server
+	secret string
+
+	mu         sync.Mutex
+	statuses   []int
+	attempts   int
+	deliveries []string
+	got        []Notification
+}
+
+func newReceiver(t *testing.T, secret string, statuses ...int) *receiver {
+	rc := &receiver{secret: secret, statuses: statuses}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		rc.attempts++
+		if rc.secret != "" && !Verify(rc.secret, body, r.Header.Get(SignatureHeader)) {
+			t.Errorf("bad signature %q", r.Header.Get(SignatureHeader))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rc.deliveries = append(rc.deliveries, r.Header.Get(DeliveryHeader))
+		if len(rc.statuses) > 0 {
+			status := rc.statuses[0]
+			rc.statuses = rc.statuses[1:]
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		var n Notification
+		if err := json.Unmarshal(body, &n); err != nil {
+			t.Errorf("decode notification: %v", err)
+		}
+		rc.got = append(rc.got, n)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) notifications() []Notification {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Notification(nil), rc.got...)
+}
+
+func testSender() *Sender {
+	s := NewSender(nil)
+	s.backoff = time.Millisecond
+	return s
+}
+
+func TestSender_SignsAndRetriesServerErrors(t *testing.T) {
+	rc := newReceiver(t, "s3cret", http.StatusInternalServerError, http.StatusTooManyRequests)
+	n := &Notification{Rule: "swing", Status: StatusFiring, Value: 42}
+	if err := testSender().Send(context.Background(), Webhook{Name: "ops", URL: rc.URL, Secret: "s3cret"}, n); err != nil {
+		t.Fatal(err)
+	}
+	if rc.attempts != 3 {
+		t.Errorf("attempts want 3 got %d", rc.attempts)
+	}
+	if rc.deliveries[0] == "" || rc.deliveries[0] != rc.deliveries[2] {
+		t.Errorf("delivery id want stable across retries got %v", rc.deliveries)
+	}
+	if got := rc.notifications(); len(got) != 1 || got[0].Rule != "swing" || got[0].Value != 42 {
+		t.Errorf("unexpected notifications %+v", got)
+	}
+}
+
+func TestSender_GivesUp(t *testing.T) {
+	rc := newReceiver(t, "", http.StatusBadRequest)
+	if err := testSender().Send(context.Background(), Webhook{Name: "ops", URL: rc.URL}, &Notification{}); err == nil {
+		t.Fatal("400 want error")
+	}
+	if rc.attempts != 1 {
+		t.Errorf("client errors want no retry got %d attempts", rc.attempts)
+	}
+
+	rc = newReceiver(t, "", 502, 502, 502, 502, 502)
+	if err := testSender().Send(context.Background(), Webhook{Name: "ops", URL: rc.URL}, &Notification{}); err == nil {
+		t.Fatal("persistent 502 want error")
+	}
+	if rc.attempts != DefaultAttempts {
+		t.Errorf("attempts want %d got %d", DefaultAttempts, rc.attempts)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"rule":"swing"}`)
+	sig := Sign("k", body)
+	if !Verify("k", body, sig) {
+		t.Error("own signature want valid")
+	}
+	for _, bad := range []string{"", sig[len("sha256="):], Sign("other", body), "sha256=zz"} {
+		if Verify("k", body, bad) {
+			t.Errorf("signature %q want invalid", bad)
+		}
+	}
+	if Verify("k", []byte(`{"rule":"other"}`), sig) {
+		t.Error("tampered body want invalid")
+	}
+}
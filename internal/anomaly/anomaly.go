@@ -0,0 +1,200 @@
+// Package anomaly flags outlier commits (e.g. a single commit adding two million lines) against rolling
+// baselines of recent commit sizes, per repo and globally, so they can be reported and capped.
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Detection methods.
+const (
+	// MethodZScore flags commits whose size is more than threshold standard deviations above the baseline mean.
+	MethodZScore = "zscore"
+	// MethodPercentile flags commits larger than the threshold percentile (e.g. 99.9) of the baseline.
+	MethodPercentile = "percentile"
+)
+
+// Baselines a commit is compared against.
+const (
+	BaselineRepo   = "repo"
+	BaselineGlobal = "global"
+)
+
+// MinSamples is the number of commits a baseline needs before it flags outliers.
+const MinSamples = 30
+
+// maxRepos bounds the repo baselines kept; the least recently used ones are evicted past it.
+const maxRepos = 5000
+
+// minStdDev keeps z-scores finite when every commit of a baseline has the same size.
+const minStdDev = 0.1
+
+// Finding describes an outlier commit.
+type Finding struct {
+	Method   string  // MethodZScore or MethodPercentile
+	Baseline string  // BaselineRepo or BaselineGlobal
+	Samples  int     // commits in the baseline
+	Score    float64 // z-score of the commit size against the baseline (log scale)
+	Limit    int64   // lines above which commits are outliers; the cap of capped commits
+}
+
+// Detector compares commit sizes (additions + deletions) with rolling baselines of the last window commits
+// of the same repo, or of all repos while the repo has fewer than MinSamples. Sizes are compared on a log
+// scale, since commit sizes span orders of magnitude. Commits of at most minLines lines are never outliers.
+// Safe for concurrent use; the nil Detector flags nothing.
+type Detector struct {
+	// Cap makes consumers count outliers with at most Finding.Limit lines, raw and adjusted. Set before use.
+	Cap bool
+
+	method    string
+	threshold float64
+	window    int
+	minLines  int64
+
+	mu     sync.Mutex
+	global *baseline
+	repos  map[string]*baseline
+	clock  uint64 // increments on every Observe, for LRU eviction
+}
+
+// New returns a detector. threshold is a z-score for MethodZScore or a percentile (0-100) for MethodPercentile.
+func New(method string, threshold float64, window int, minLines int64) (*Detector, error) {
+	switch method {
+	case MethodZScore:
+		if threshold <= 0 {
+			return nil, fmt.Errorf("invalid z-score threshold %v: must be positive", threshold)
+		}
+	case MethodPercentile:
+		if threshold <= 0 || threshold >= 100 {
+			return nil, fmt.Errorf("invalid percentile threshold %v: want 0 to 100", threshold)
+		}
+	default:
+		return nil, fmt.Errorf("invalid anomaly method %q: want %s or %s", method, MethodZScore, MethodPercentile)
+	}
+	if window < MinSamples {
+		window = MinSamples
+	}
+	return &Detector{
+		method:    method,
+		threshold: threshold,
+		window:    window,
+		minLines:  minLines,
+		global:    newBaseline(window),
+		repos:     make(map[string]*baseline),
+	}, nil
+}
+
+// Check returns the finding for a commit of lines changed lines in repo, or nil when it is not an outlier.
+// Check does not update the baselines; call Observe for commits that should count towards them.
+func (d *Detector) Check(repo string, lines int64) *Finding {
+	if d == nil || lines <= d.minLines {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b, name := d.repos[repo], BaselineRepo
+	if b == nil || len(b.values) < MinSamples {
+		b, name = d.global, BaselineGlobal
+	}
+	if len(b.values) < MinSamples {
+		return nil
+	}
+	mean, std := b.meanStdDev()
+	var limit float64
+	if d.method == MethodZScore {
+		limit = math.Expm1(mean + d.threshold*std)
+	} else {
+		limit = math.Expm1(b.percentile(d.threshold))
+	}
+	limitLines := max(int64(math.Round(limit)), d.minLines)
+	if lines <= limitLines {
+		return nil
+	}
+	return &Finding{
+		Method:   d.method,
+		Baseline: name,
+		Samples:  len(b.values),
+		Score:    (math.Log1p(float64(lines)) - mean) / std,
+		Limit:    limitLines,
+	}
+}
+
+// Observe adds a commit of lines changed lines in repo to the repo and global baselines.
+func (d *Detector) Observe(repo string, lines int64) {
+	if d == nil {
+		return
+	}
+	v := math.Log1p(float64(max(lines, 0)))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock++
+	d.global.add(v)
+	b, ok := d.repos[repo]
+	if !ok {
+		if len(d.repos) >= maxRepos {
+			d.evict()
+		}
+		b = newBaseline(d.window)
+		d.repos[repo] = b
+	}
+	b.add(v)
+	b.used = d.clock
+}
+
+// evict forgets the least recently used tenth of the repo baselines. Caller holds d.mu.
+func (d *Detector) evict() {
+	used := make([]uint64, 0, len(d.repos))
+	for _, b := range d.repos {
+		used = append(used, b.used)
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i] < used[j] })
+	cutoff := used[len(used)/10]
+	for repo, b := range d.repos {
+		if b.used <= cutoff {
+			delete(d.repos, repo)
+		}
+	}
+}
+
+// baseline is a ring buffer of the log sizes of the last commits.
+type baseline struct {
+	values []float64
+	size   int
+	next   int
+	used   uint64
+}
+
+func newBaseline(size int) *baseline {
+	return &baseline{size: size}
+}
+
+func (b *baseline) add(v float64) {
+	if len(b.values) < b.size {
+		b.values = append(b.values, v)
+		return
+	}
+	b.values[b.next] = v
+	b.next = (b.next + 1) % b.size
+}
+
+func (b *baseline) meanStdDev() (mean, std float64) {
+	for _, v := range b.values {
+		mean += v
+	}
+	mean /= float64(len(b.values))
+	for _, v := range b.values {
+		std += (v - mean) * (v - mean)
+	}
+	return mean, max(math.Sqrt(std/float64(len(b.values))), minStdDev)
+}
+
+// percentile returns the nearest-rank p-th percentile of the values.
+func (b *baseline) percentile(p float64) float64 {
+	sorted := append([]float64(nil), b.values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
@@ -0,0 +1,131 @@
+package anomaly
+
+import (
+	"fmt"
+	"testing"
+)
+
+// observe adds n commits of sizes cycling through sizes to repo.
+func observe(d *Detector, repo string, n int, sizes ...int64) {
+	for i := 0; i < n; i++ {
+		d.Observe(repo, sizes[i%len(sizes)])
+	}
+}
+
+func TestDetector_ZScore(t *testing.T) {
+	d, err := New(MethodZScore, 4, 100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := d.Check("o/r", 2_000_000); f != nil {
+		t.Errorf("empty baseline want no finding got %+v", f)
+	}
+	observe(d, "o/r", 50, 10, 40, 100, 300)
+
+	f := d.Check("o/r", 2_000_000)
+	if f == nil {
+		t.Fatal("2M line commit want outlier")
+	}
+	if f.Method != MethodZScore || f.Baseline != BaselineRepo || f.Samples != 50 || f.Score <= 4 || f.Limit < 1000 || f.Limit >= 2_000_000 {
+		t.Errorf("unexpected finding %+v", f)
+	}
+	if f := d.Check("o/r", 900); f != nil {
+		t.Errorf("commit under min lines want no finding got %+v", f)
+	}
+	if f := d.Check("o/r", 1500); f != nil {
+		t.Errorf("1500 line commit want within limit got %+v", f)
+	}
+}
+
+func TestDetector_FallsBackToGlobalBaseline(t *testing.T) {
+	d, err := New(MethodZScore, 4, 100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observe(d, "o/busy", 40, 20, 50)
+	observe(d, "o/new", 5, 20)
+	if f := d.Check("o/new", 500_000); f == nil || f.Baseline != BaselineGlobal || f.Samples != 45 {
+		t.Errorf("repo with few commits want global baseline got %+v", f)
+	}
+
+	// A repo whose commits are usually large is judged by its own baseline.
+	observe(d, "o/generated", 40, 50_000, 80_000)
+	if f := d.Check("o/generated", 90_000); f != nil {
+		t.Errorf("usual commit of a large-commit repo want no finding got %+v", f)
+	}
+}
+
+func TestDetector_Percentile(t *testing.T) {
+	d, err := New(MethodPercentile, 90, 100, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 100; i++ {
+		d.Observe("o/r", i*10)
+	}
+	f := d.Check("o/r", 950)
+	if f == nil || f.Method != MethodPercentile || f.Limit != 900 {
+		t.Errorf("commit above the 90th percentile want finding with limit 900 got %+v", f)
+	}
+	if f := d.Check("o/r", 900); f != nil {
+		t.Errorf("commit at the 90th percentile want no finding got %+v", f)
+	}
+}
+
+func TestDetector_WindowRolls(t *testing.T) {
+	d, err := New(MethodZScore, 3, 30, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observe(d, "o/r", 30, 10, 20)
+	if d.Check("o/r", 100_000) == nil {
+		t.Fatal("100k line commit want outlier among small commits")
+	}
+	// The small commits roll out of the window.
+	observe(d, "o/r", 30, 80_000, 120_000)
+	if f := d.Check("o/r", 100_000); f != nil {
+		t.Errorf("100k line commit want usual after the window rolled got %+v", f)
+	}
+}
+
+func TestDetector_EvictsLeastRecentlyUsedRepos(t *testing.T) {
+	d, err := New(MethodZScore, 4, 30, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= maxRepos; i++ {
+		d.Observe(fmt.Sprintf("o/r%d", i), 10)
+	}
+	if len(d.repos) > maxRepos {
+		t.Errorf("repos want at most %d got %d", maxRepos, len(d.repos))
+	}
+	if _, ok := d.repos["o/r0"]; ok {
+		t.Error("least recently used repo want evicted")
+	}
+	if _, ok := d.repos[fmt.Sprintf("o/r%d", maxRepos)]; !ok {
+		t.Error("latest repo want kept")
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		method    string
+		threshold float64
+	}{
+		{"mad", 3},
+		{MethodZScore, 0},
+		{MethodPercentile, 100},
+	} {
+		if _, err := New(tt.method, tt.threshold, 100, 0); err == nil {
+			t.Errorf("New(%q, %v) want error", tt.method, tt.threshold)
+		}
+	}
+}
+
+func TestDetector_NilFlagsNothing(t *testing.T) {
+	var d *Detector
+	d.Observe("o/r", 10)
+	if f := d.Check("o/r", 1<<40); f != nil {
+		t.Errorf("nil detector want no finding got %+v", f)
+	}
+}
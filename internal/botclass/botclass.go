@@ -0,0 +1,207 @@
+// Package botclass flags bot and automation accounts (Dependabot, Renovate, CI bots) among event
+// actors and commit authors, so stats can include or exclude the activity they generate.
+package botclass
+
+import (
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/challenge-github-events/internal/identity"
+)
+
+// DefaultRules are login patterns of automation accounts that do not carry the "[bot]" suffix of GitHub Apps.
+var DefaultRules = []string{
+	"dependabot*",
+	"renovate*",
+	"github-actions*",
+	"greenkeeper*",
+	"snyk-bot",
+	"imgbot*",
+	"codecov*",
+	"pre-commit-ci*",
+	"mergify*",
+	"allcontributors*",
+	"depfu*",
+	"pyup-bot",
+	"whitesource*",
+	"*-bot",
+	"*_bot",
+}
+
+// appSuffix ends the login (and git author name) of GitHub App accounts, e.g. dependabot[bot].
+const appSuffix = "[bot]"
+
+// typeBot is the GitHub account type of bots.
+const typeBot = "Bot"
+
+// maxTracked bounds the logins kept for the burst heuristic; idle ones are pruned past it.
+const maxTracked = 100000
+
+// maxFlagged bounds the logins flagged by burst rate; the least recently seen tenth is forgotten past it.
+const maxFlagged = 10000
+
+// Classifier flags bots by account type, the "[bot]" suffix, login rules (path.Match patterns,
+// case-insensitive) and burst rate: a login with more than burst events within window is flagged
+// until it is among the least recently seen once more than maxFlagged logins are. Humans are never
+// flagged. Safe for concurrent use; the nil Classifier flags nothing.
+//
+// OnFlag, when set, is called with each login burst rate flags, so rows stored before can be flagged too.
+type Classifier struct {
+	OnFlag func(login string)
+
+	rules  []string
+	humans map[string]bool
+	burst  int
+	window time.Duration
+
+	mu      sync.Mutex
+	recent  map[string][]time.Time // login -> event times within window
+	flagged map[string]time.Time   // logins flagged by burst rate -> last event time
+}
+
+// New returns a classifier for the given login rules and human logins. burst <= 0 disables the burst heuristic.
+func New(rules, humans []string, burst int, window time.Duration) *Classifier {
+	c := &Classifier{
+		humans:  make(map[string]bool, len(humans)),
+		burst:   burst,
+		window:  window,
+		recent:  make(map[string][]time.Time),
+		flagged: make(map[string]time.Time),
+	}
+	for _, r := range rules {
+		if r = strings.ToLower(strings.TrimSpace(r)); r != "" {
+			c.rules = append(c.rules, r)
+		}
+	}
+	for _, h := range humans {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			c.humans[h] = true
+		}
+	}
+	return c
+}
+
+// Event reports whether the actor of an event created at at is a bot, and records the event for the burst heuristic.
+// accountType is the actor's GitHub account type when known (e.g. User, Bot).
+func (c *Classifier) Event(login, accountType string, at time.Time) bool {
+	if c == nil {
+		return false
+	}
+	login = strings.ToLower(login)
+	if login == "" || c.humans[login] {
+		return false
+	}
+	if accountType == typeBot || c.matches(login) {
+		return true
+	}
+	bot, first := c.observe(login, at)
+	if first && c.OnFlag != nil {
+		c.OnFlag(login)
+	}
+	return bot
+}
+
+// Author reports whether a commit author is a bot, by its GitHub account (login and type) or,
+// for commits GitHub matched to no account, by its git name and noreply email.
+func (c *Classifier) Author(name, email, login, accountType string) bool {
+	if c == nil {
+		return false
+	}
+	if login == "" {
+		login = identity.NoreplyLogin(email)
+	}
+	login = strings.ToLower(login)
+	if c.humans[login] {
+		return false
+	}
+	if accountType == typeBot || c.matches(strings.ToLower(strings.TrimSpace(name))) {
+		return true
+	}
+	if login == "" {
+		return false
+	}
+	if c.matches(login) {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.flagged[login]
+	return ok
+}
+
+// matches reports whether the lowercase login (or name) ends in "[bot]" or matches a rule.
+func (c *Classifier) matches(login string) bool {
+	if login == "" {
+		return false
+	}
+	if strings.HasSuffix(login, appSuffix) {
+		return true
+	}
+	for _, r := range c.rules {
+		if ok, _ := path.Match(r, login); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// observe records an event of login at at and reports whether login is flagged by burst rate, and whether
+// this event flagged it.
+func (c *Classifier) observe(login string, at time.Time) (bot, first bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if last, ok := c.flagged[login]; ok {
+		if at.After(last) {
+			c.flagged[login] = at
+		}
+		return true, false
+	}
+	if c.burst <= 0 {
+		return false, false
+	}
+	since := at.Add(-c.window)
+	times := c.recent[login][:0]
+	for _, t := range c.recent[login] {
+		if t.After(since) {
+			times = append(times, t)
+		}
+	}
+	times = append(times, at)
+	if len(times) > c.burst {
+		c.flagged[login] = at
+		delete(c.recent, login)
+		if len(c.flagged) > maxFlagged {
+			c.forgetFlagged()
+		}
+		return true, true
+	}
+	c.recent[login] = times
+	if len(c.recent) > maxTracked {
+		c.prune(since)
+	}
+	return false, false
+}
+
+// forgetFlagged forgets the least recently seen tenth of the flagged logins. Caller holds c.mu.
+func (c *Classifier) forgetFlagged() {
+	logins := make([]string, 0, len(c.flagged))
+	for login := range c.flagged {
+		logins = append(logins, login)
+	}
+	slices.SortFunc(logins, func(a, b string) int { return c.flagged[a].Compare(c.flagged[b]) })
+	for _, login := range logins[:len(logins)/10] {
+		delete(c.flagged, login)
+	}
+}
+
+// prune forgets logins without events after since. Caller holds c.mu.
+func (c *Classifier) prune(since time.Time) {
+	for login, times := range c.recent {
+		if !times[len(times)-1].After(since) {
+			delete(c.recent, login)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package botclass
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClassifier_Event(t *testing.T) {
+	c := New(append(DefaultRules, "ci-runner"), []string{"Ada_Bot"}, 0, time.Minute)
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	bots := []struct{ login, typ string }{
+		{"dependabot[bot]", ""},
+		{"github-actions[bot]", "Bot"},
+		{"some-app", "Bot"},
+		{"renovate-bot", ""},
+		{"Dependabot-Preview", ""},
+		{"release_bot", ""},
+		{"CI-Runner", ""},
+	}
+	for _, b := range bots {
+		if !c.Event(b.login, b.typ, at) {
+			t.Errorf("Event(%q, %q) want bot", b.login, b.typ)
+		}
+	}
+	humans := []string{"octocat", "robotics-fan", "ada_bot", ""}
+	for _, login := range humans {
+		if c.Event(login, "User", at) {
+			t.Errorf("Event(%q) want human", login)
+		}
+	}
+}
+
+func TestClassifier_Author(t *testing.T) {
+	c := New(DefaultRules, nil, 0, time.Minute)
+	tests := []struct {
+		name, email, login, typ string
+		want                    bool
+	}{
+		{"dependabot[bot]", "49699333+dependabot[bot]@users.noreply.github.com", "dependabot[bot]", "Bot", true},
+		{"Renovate Bot", "bot@renovateapp.com", "", "", true},
+		{"someone", "1+github-actions[bot]@users.noreply.github.com", "", "", true},
+		{"Mona", "mona@example.com", "mona", "User", false},
+		{"Mona", "mona@example.com", "", "", false},
+	}
+	for _, tt := range tests {
+		if got := c.Author(tt.name, tt.email, tt.login, tt.typ); got != tt.want {
+			t.Errorf("Author(%q, %q, %q, %q) want %v got %v", tt.name, tt.email, tt.login, tt.typ, tt.want, got)
+		}
+	}
+}
+
+func TestClassifier_Burst(t *testing.T) {
+	c := New(nil, []string{"busy-human"}, 3, time.Minute)
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if c.Event("pusher", "", at.Add(time.Duration(i)*10*time.Second)) {
+			t.Fatalf("event %d within burst limit flagged", i)
+		}
+	}
+	// Events older than the window no longer count.
+	if c.Event("pusher", "", at.Add(75*time.Second)) || c.Event("pusher", "", at.Add(78*time.Second)) {
+		t.Error("events after the window slid flagged")
+	}
+	if !c.Event("pusher", "", at.Add(79*time.Second)) {
+		t.Error("4th event within a minute want flagged")
+	}
+	if !c.Event("pusher", "", at.Add(time.Hour)) || !c.Author("Pusher", "", "Pusher", "") {
+		t.Error("flagged login want bot for later events and commits")
+	}
+	for i := 0; i < 10; i++ {
+		if c.Event("busy-human", "", at) {
+			t.Fatal("human login flagged by burst rate")
+		}
+	}
+}
+
+func TestClassifier_OnFlag(t *testing.T) {
+	c := New(nil, nil, 1, time.Minute)
+	var flagged []string
+	c.OnFlag = func(login string) { flagged = append(flagged, login) }
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		c.Event("Pusher", "", at.Add(time.Duration(i)*time.Second))
+	}
+	c.Event("dependabot[bot]", "", at)
+	if len(flagged) != 1 || flagged[0] != "pusher" {
+		t.Errorf("OnFlag want called once with pusher got %v", flagged)
+	}
+}
+
+func TestClassifier_ForgetsLeastRecentlySeenFlagged(t *testing.T) {
+	c := New(nil, nil, 1, time.Minute)
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	flag := func(login string, at time.Time) {
+		c.Event(login, "", at)
+		c.Event(login, "", at)
+	}
+	flag("old", at)
+	flag("active", at)
+	for i := 0; i < maxFlagged-2; i++ {
+		flag(fmt.Sprintf("login-%d", i), at.Add(time.Minute))
+	}
+	c.Event("active", "", at.Add(time.Hour)) // seen again: now the most recently seen
+	flag("new", at.Add(time.Hour))
+
+	if len(c.flagged) > maxFlagged {
+		t.Errorf("flagged logins want at most %d got %d", maxFlagged, len(c.flagged))
+	}
+	if c.Author("", "", "old", "") {
+		t.Error("least recently seen login want forgotten")
+	}
+	if !c.Author("", "", "active", "") || !c.Author("", "", "new", "") {
+		t.Error("recently seen logins want still flagged")
+	}
+}
+
+func TestClassifier_NilFlagsNothing(t *testing.T) {
+	var c *Classifier
+	if c.Event("dependabot[bot]", "Bot", time.Now()) || c.Author("dependabot[bot]", "", "dependabot[bot]", "Bot") {
+		t.Error("nil classifier want no bots")
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config holds application configuration from environment.
@@ -13,26 +14,162 @@ type Config struct {
 	HTTPAddr        string
 	ConsumerWorkers int
 	ChannelSize     int
+	BatchSize       int
+	BatchWaitMs     int
+	// ExcludePaths are extra glob rules for files excluded from adjusted net lines.
+	ExcludePaths        []string
+	ExcludeDefaultPaths bool
+	// MergePolicy is how merge commits count towards net lines: count, skip or first-parent.
+	MergePolicy string
+	// ForcePushDetection is off, flag (payload forced flag) or compare (flag or compare API status).
+	ForcePushDetection string
+	OrphanForcePushed  bool
+	// DefaultBranches are the branch names ?branch=default selects for repos whose default branch is unknown.
+	DefaultBranches []string
+	// EventTypes are the GitHub event types ingested (PushEvent, PullRequestEvent, ...).
+	EventTypes []string
+	// EventSources are the polled event streams: global, org:NAME, repo:OWNER/NAME or user:NAME, each optionally @INTERVAL.
+	EventSources []string
+	// RetentionDays expires partitioned data older than this many days (0 keeps it forever).
+	RetentionDays    int
+	RetentionArchive bool
+	// StripPayloadDays clears raw_payload of events older than this many days (0 keeps payloads).
+	StripPayloadDays int
+	// MailmapFile is a .mailmap-style file of author identity overrides (empty for none).
+	MailmapFile string
+	// BotLogins are extra login patterns of bot accounts; HumanLogins are never classified as bots.
+	BotLogins       []string
+	BotDefaultRules bool
+	HumanLogins     []string
+	// BotBurstEvents flags an actor with more than this many events within BotBurstWindowSec as a bot (0 disables).
+	BotBurstEvents    int
+	BotBurstWindowSec int
+	// ExcludeBots leaves bot activity out of stats unless a request sets bots=include.
+	ExcludeBots bool
+	// AnomalyDetection is off, zscore or percentile: how outlier commits are flagged against rolling baselines
+	// of the last AnomalyWindow commits. AnomalyThreshold is the z-score or percentile; commits of at most
+	// AnomalyMinLines changed lines are never outliers. AnomalyCap caps the lines aggregates count for outliers.
+	AnomalyDetection string
+	AnomalyThreshold float64
+	AnomalyWindow    int
+	AnomalyMinLines  int64
+	AnomalyCap       bool
+	// AlertRulesFile is a JSON file of alert rules and webhooks (empty disables alerting), evaluated every
+	// AlertIntervalSec.
+	AlertRulesFile   string
+	AlertIntervalSec int
+	// TrendingWindows are the windows (e.g. 1h, 7d) trending repos are scored over every TrendingIntervalSec
+	// (0 disables trending).
+	TrendingWindows     []string
+	TrendingIntervalSec int
+	// RepoMetadataTTLHours is how long repository metadata is used before it is fetched again; enrichment
+	// fetches a batch of missing or stale repos every RepoMetadataIntervalSec (0 disables enrichment).
+	RepoMetadataTTLHours    int
+	RepoMetadataIntervalSec int
+	// ConsumerWorkersMin and ConsumerWorkersMax bound the worker pool when autoscaling, which evaluates it every
+	// AutoscaleIntervalSec (ConsumerWorkersMax 0 disables autoscaling: ConsumerWorkers run).
+	ConsumerWorkersMin   int
+	ConsumerWorkersMax   int
+	AutoscaleIntervalSec int
+	// Backpressure is what the producer does when the jobs channel is full: block, skip, drop-oldest or spill.
+	Backpressure string
+	// AdminToken is the bearer token of the /admin endpoints (empty disables them).
+	AdminToken string
 }
 
+// DefaultEventTypes are the event types ingested when EVENT_TYPES is unset.
+var DefaultEventTypes = []string{"PushEvent", "PullRequestEvent", "CreateEvent", "DeleteEvent", "ReleaseEvent", "WatchEvent"}
+
+// DefaultTrendingWindows are the trending windows when TRENDING_WINDOWS is unset.
+var DefaultTrendingWindows = []string{"1h", "24h", "7d"}
+
+// Force push detection modes (FORCE_PUSH_DETECTION).
+const (
+	ForcePushOff     = "off"
+	ForcePushFlag    = "flag"
+	ForcePushCompare = "compare"
+)
+
+// Anomaly detection methods (ANOMALY_DETECTION); zscore and percentile match the anomaly package's methods.
+const (
+	AnomalyOff        = "off"
+	AnomalyZScore     = "zscore"
+	AnomalyPercentile = "percentile"
+)
+
+// Merge commit policies (MERGE_POLICY).
+const (
+	// MergePolicyCount counts merge commits with the stats reported by the commit API.
+	MergePolicyCount = "count"
+	// MergePolicySkip leaves merge commits out of the global counter and all aggregates.
+	MergePolicySkip = "skip"
+	// MergePolicyFirstParent counts only the lines merge commits changed themselves, not those of the merged branch.
+	MergePolicyFirstParent = "first-parent"
+)
+
+// Backpressure strategies (BACKPRESSURE); they match the pubsub package's strategies.
+const (
+	BackpressureBlock      = "block"
+	BackpressureSkip       = "skip"
+	BackpressureDropOldest = "drop-oldest"
+	BackpressureSpill      = "spill"
+)
+
 // Default values when env vars are unset.
 const (
 	DefaultPollIntervalSec = 60
-	DefaultHTTPAddr       = ":8080"
+	DefaultHTTPAddr        = ":8080"
 	DefaultConsumerWorkers = 3
-	DefaultChannelSize    = 1000
+	DefaultChannelSize     = 1000
+	DefaultBatchWaitMs     = 500
+	DefaultBotBurstEvents  = 30
+	DefaultBotBurstWindow  = 60
+	// DefaultAnomalyZScore and DefaultAnomalyPercentile are the ANOMALY_THRESHOLD defaults of each method.
+	DefaultAnomalyZScore        = 4.0
+	DefaultAnomalyPercentile    = 99.9
+	DefaultAnomalyWindow        = 500
+	DefaultAnomalyMinLines      = 1000
+	DefaultAlertIntervalSec     = 60
+	DefaultTrendingInterval     = 300
+	DefaultRepoMetadataTTL      = 24
+	DefaultRepoMetadataInterval = 60
+	DefaultConsumerWorkersMin   = 1
+	DefaultAutoscaleInterval    = 10
 )
 
 // Load reads configuration from the environment.
 // Uses defaults for optional values when unset.
 func Load() *Config {
 	c := &Config{
-		GHToken:         os.Getenv("GH_TOKEN"),
-		DatabaseURL:     os.Getenv("DATABASE_URL"),
-		PollIntervalSec: DefaultPollIntervalSec,
-		HTTPAddr:        DefaultHTTPAddr,
-		ConsumerWorkers: DefaultConsumerWorkers,
-		ChannelSize:     DefaultChannelSize,
+		GHToken:                 os.Getenv("GH_TOKEN"),
+		DatabaseURL:             os.Getenv("DATABASE_URL"),
+		PollIntervalSec:         DefaultPollIntervalSec,
+		HTTPAddr:                DefaultHTTPAddr,
+		ConsumerWorkers:         DefaultConsumerWorkers,
+		ChannelSize:             DefaultChannelSize,
+		BatchWaitMs:             DefaultBatchWaitMs,
+		ExcludeDefaultPaths:     true,
+		MergePolicy:             MergePolicyCount,
+		ForcePushDetection:      ForcePushFlag,
+		DefaultBranches:         []string{"main", "master"},
+		EventTypes:              DefaultEventTypes,
+		EventSources:            []string{"global"},
+		BotDefaultRules:         true,
+		BotBurstEvents:          DefaultBotBurstEvents,
+		BotBurstWindowSec:       DefaultBotBurstWindow,
+		AnomalyDetection:        AnomalyZScore,
+		AnomalyWindow:           DefaultAnomalyWindow,
+		AnomalyMinLines:         DefaultAnomalyMinLines,
+		AlertRulesFile:          os.Getenv("ALERT_RULES_FILE"),
+		AlertIntervalSec:        DefaultAlertIntervalSec,
+		TrendingWindows:         DefaultTrendingWindows,
+		TrendingIntervalSec:     DefaultTrendingInterval,
+		RepoMetadataTTLHours:    DefaultRepoMetadataTTL,
+		RepoMetadataIntervalSec: DefaultRepoMetadataInterval,
+		ConsumerWorkersMin:      DefaultConsumerWorkersMin,
+		AutoscaleIntervalSec:    DefaultAutoscaleInterval,
+		Backpressure:            BackpressureBlock,
+		AdminToken:              os.Getenv("ADMIN_TOKEN"),
 	}
 	if v := os.Getenv("POLL_INTERVAL_SEC"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
@@ -52,5 +189,166 @@ func Load() *Config {
 			c.ChannelSize = n
 		}
 	}
+	if v := os.Getenv("CONSUMER_BATCH_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			c.BatchSize = n
+		}
+	}
+	if v := os.Getenv("CONSUMER_BATCH_WAIT_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.BatchWaitMs = n
+		}
+	}
+	if v := os.Getenv("EXCLUDE_PATHS"); v != "" {
+		c.ExcludePaths = splitList(v)
+	}
+	if v := os.Getenv("EXCLUDE_DEFAULT_PATHS"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.ExcludeDefaultPaths = b
+		}
+	}
+	switch v := os.Getenv("MERGE_POLICY"); v {
+	case MergePolicyCount, MergePolicySkip, MergePolicyFirstParent:
+		c.MergePolicy = v
+	}
+	switch v := os.Getenv("FORCE_PUSH_DETECTION"); v {
+	case ForcePushOff, ForcePushFlag, ForcePushCompare:
+		c.ForcePushDetection = v
+	}
+	if v := splitList(os.Getenv("DEFAULT_BRANCHES")); len(v) > 0 {
+		c.DefaultBranches = v
+	}
+	if v := splitList(os.Getenv("EVENT_TYPES")); len(v) > 0 {
+		c.EventTypes = v
+	}
+	if v := splitList(os.Getenv("EVENT_SOURCES")); len(v) > 0 {
+		c.EventSources = v
+	}
+	if v := os.Getenv("RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			c.RetentionDays = n
+		}
+	}
+	if v := os.Getenv("RETENTION_ARCHIVE"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.RetentionArchive = b
+		}
+	}
+	if v := os.Getenv("STRIP_PAYLOAD_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			c.StripPayloadDays = n
+		}
+	}
+	c.MailmapFile = os.Getenv("MAILMAP_FILE")
+	c.BotLogins = splitList(os.Getenv("BOT_LOGINS"))
+	c.HumanLogins = splitList(os.Getenv("HUMAN_LOGINS"))
+	if v := os.Getenv("BOT_DEFAULT_RULES"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.BotDefaultRules = b
+		}
+	}
+	if v := os.Getenv("BOT_BURST_EVENTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			c.BotBurstEvents = n
+		}
+	}
+	if v := os.Getenv("BOT_BURST_WINDOW_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.BotBurstWindowSec = n
+		}
+	}
+	if v := os.Getenv("EXCLUDE_BOTS"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.ExcludeBots = b
+		}
+	}
+	if v := os.Getenv("ORPHAN_FORCE_PUSHED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.OrphanForcePushed = b
+		}
+	}
+	switch v := os.Getenv("ANOMALY_DETECTION"); v {
+	case AnomalyOff, AnomalyZScore, AnomalyPercentile:
+		c.AnomalyDetection = v
+	}
+	if v := os.Getenv("ANOMALY_THRESHOLD"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 && (f < 100 || c.AnomalyDetection != AnomalyPercentile) {
+			c.AnomalyThreshold = f
+		}
+	}
+	if c.AnomalyThreshold == 0 {
+		c.AnomalyThreshold = DefaultAnomalyZScore
+		if c.AnomalyDetection == AnomalyPercentile {
+			c.AnomalyThreshold = DefaultAnomalyPercentile
+		}
+	}
+	if v := os.Getenv("ANOMALY_WINDOW"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.AnomalyWindow = n
+		}
+	}
+	if v := os.Getenv("ANOMALY_MIN_LINES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			c.AnomalyMinLines = n
+		}
+	}
+	if v := os.Getenv("ANOMALY_CAP"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.AnomalyCap = b
+		}
+	}
+	if v := os.Getenv("ALERT_INTERVAL_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.AlertIntervalSec = n
+		}
+	}
+	if v := splitList(os.Getenv("TRENDING_WINDOWS")); len(v) > 0 {
+		c.TrendingWindows = v
+	}
+	if v := os.Getenv("TRENDING_INTERVAL_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			c.TrendingIntervalSec = n
+		}
+	}
+	if v := os.Getenv("REPO_METADATA_TTL_HOURS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.RepoMetadataTTLHours = n
+		}
+	}
+	if v := os.Getenv("REPO_METADATA_INTERVAL_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			c.RepoMetadataIntervalSec = n
+		}
+	}
+	if v := os.Getenv("CONSUMER_WORKERS_MIN"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			c.ConsumerWorkersMin = n
+		}
+	}
+	if v := os.Getenv("CONSUMER_WORKERS_MAX"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			c.ConsumerWorkersMax = n
+		}
+	}
+	if v := os.Getenv("AUTOSCALE_INTERVAL_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.AutoscaleIntervalSec = n
+		}
+	}
+	switch v := os.Getenv("BACKPRESSURE"); v {
+	case BackpressureBlock, BackpressureSkip, BackpressureDropOldest, BackpressureSpill:
+		c.Backpressure = v
+	}
 	return c
 }
+
+// splitList splits a comma-separated env value, dropping empty items.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
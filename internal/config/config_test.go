@@ -20,6 +20,63 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.ChannelSize != DefaultChannelSize {
 		t.Errorf("ChannelSize want %d got %d", DefaultChannelSize, cfg.ChannelSize)
 	}
+	if cfg.BatchSize != 0 {
+		t.Errorf("BatchSize want 0 got %d", cfg.BatchSize)
+	}
+	if cfg.BatchWaitMs != DefaultBatchWaitMs {
+		t.Errorf("BatchWaitMs want %d got %d", DefaultBatchWaitMs, cfg.BatchWaitMs)
+	}
+	if !cfg.ExcludeDefaultPaths || len(cfg.ExcludePaths) != 0 {
+		t.Errorf("exclude paths want defaults only got default=%v extra=%v", cfg.ExcludeDefaultPaths, cfg.ExcludePaths)
+	}
+	if cfg.MergePolicy != MergePolicyCount {
+		t.Errorf("MergePolicy want %s got %s", MergePolicyCount, cfg.MergePolicy)
+	}
+	if cfg.ForcePushDetection != ForcePushFlag || cfg.OrphanForcePushed {
+		t.Errorf("force push want flag without orphaning got %s orphan=%v", cfg.ForcePushDetection, cfg.OrphanForcePushed)
+	}
+	if len(cfg.DefaultBranches) != 2 || cfg.DefaultBranches[0] != "main" || cfg.DefaultBranches[1] != "master" {
+		t.Errorf("DefaultBranches want [main master] got %v", cfg.DefaultBranches)
+	}
+	if len(cfg.EventTypes) != len(DefaultEventTypes) {
+		t.Errorf("EventTypes want %v got %v", DefaultEventTypes, cfg.EventTypes)
+	}
+	if len(cfg.EventSources) != 1 || cfg.EventSources[0] != "global" {
+		t.Errorf("EventSources want [global] got %v", cfg.EventSources)
+	}
+	if cfg.RetentionDays != 0 || cfg.RetentionArchive || cfg.StripPayloadDays != 0 {
+		t.Errorf("retention want disabled got days=%d archive=%v strip=%d", cfg.RetentionDays, cfg.RetentionArchive, cfg.StripPayloadDays)
+	}
+	if !cfg.BotDefaultRules || cfg.BotBurstEvents != DefaultBotBurstEvents || cfg.BotBurstWindowSec != DefaultBotBurstWindow || cfg.ExcludeBots {
+		t.Errorf("bots want default rules, burst %d/%ds, included got rules=%v burst=%d/%ds exclude=%v", DefaultBotBurstEvents, DefaultBotBurstWindow,
+			cfg.BotDefaultRules, cfg.BotBurstEvents, cfg.BotBurstWindowSec, cfg.ExcludeBots)
+	}
+	if cfg.AnomalyDetection != AnomalyZScore || cfg.AnomalyThreshold != DefaultAnomalyZScore || cfg.AnomalyWindow != DefaultAnomalyWindow ||
+		cfg.AnomalyMinLines != DefaultAnomalyMinLines || cfg.AnomalyCap {
+		t.Errorf("anomalies want zscore %v, window %d, min lines %d, uncapped got %s %v, window %d, min lines %d, cap=%v",
+			DefaultAnomalyZScore, DefaultAnomalyWindow, DefaultAnomalyMinLines,
+			cfg.AnomalyDetection, cfg.AnomalyThreshold, cfg.AnomalyWindow, cfg.AnomalyMinLines, cfg.AnomalyCap)
+	}
+	if cfg.AlertRulesFile != "" || cfg.AlertIntervalSec != DefaultAlertIntervalSec {
+		t.Errorf("alerts want disabled every %ds got file=%q every %ds", DefaultAlertIntervalSec, cfg.AlertRulesFile, cfg.AlertIntervalSec)
+	}
+	if len(cfg.TrendingWindows) != 3 || cfg.TrendingWindows[2] != "7d" || cfg.TrendingIntervalSec != DefaultTrendingInterval {
+		t.Errorf("trending want %v every %ds got %v every %ds", DefaultTrendingWindows, DefaultTrendingInterval, cfg.TrendingWindows, cfg.TrendingIntervalSec)
+	}
+	if cfg.RepoMetadataTTLHours != DefaultRepoMetadataTTL || cfg.RepoMetadataIntervalSec != DefaultRepoMetadataInterval {
+		t.Errorf("repo metadata want ttl %dh every %ds got ttl %dh every %ds",
+			DefaultRepoMetadataTTL, DefaultRepoMetadataInterval, cfg.RepoMetadataTTLHours, cfg.RepoMetadataIntervalSec)
+	}
+	if cfg.AdminToken != "" {
+		t.Errorf("admin want disabled got token %q", cfg.AdminToken)
+	}
+	if cfg.ConsumerWorkersMin != DefaultConsumerWorkersMin || cfg.ConsumerWorkersMax != 0 || cfg.AutoscaleIntervalSec != DefaultAutoscaleInterval {
+		t.Errorf("autoscaling want disabled (min %d, every %ds) got %d-%d every %ds",
+			DefaultConsumerWorkersMin, DefaultAutoscaleInterval, cfg.ConsumerWorkersMin, cfg.ConsumerWorkersMax, cfg.AutoscaleIntervalSec)
+	}
+	if cfg.Backpressure != BackpressureBlock {
+		t.Errorf("Backpressure want %s got %s", BackpressureBlock, cfg.Backpressure)
+	}
 }
 
 func TestLoad_FromEnv(t *testing.T) {
@@ -30,6 +87,42 @@ func TestLoad_FromEnv(t *testing.T) {
 	os.Setenv("CHANNEL_SIZE", "500")
 	os.Setenv("GH_TOKEN", "secret")
 	os.Setenv("DATABASE_URL", "postgres://local/db")
+	os.Setenv("CONSUMER_BATCH_SIZE", "50")
+	os.Setenv("CONSUMER_BATCH_WAIT_MS", "250")
+	os.Setenv("EXCLUDE_PATHS", "docs/, *.snap ,")
+	os.Setenv("EXCLUDE_DEFAULT_PATHS", "false")
+	os.Setenv("MERGE_POLICY", "skip")
+	os.Setenv("FORCE_PUSH_DETECTION", "compare")
+	os.Setenv("ORPHAN_FORCE_PUSHED", "true")
+	os.Setenv("DEFAULT_BRANCHES", "trunk")
+	os.Setenv("EVENT_TYPES", "PushEvent,WatchEvent")
+	os.Setenv("EVENT_SOURCES", "org:golang@30s, repo:golang/go")
+	os.Setenv("RETENTION_DAYS", "365")
+	os.Setenv("RETENTION_ARCHIVE", "true")
+	os.Setenv("STRIP_PAYLOAD_DAYS", "30")
+	os.Setenv("MAILMAP_FILE", "/etc/github-events/mailmap")
+	os.Setenv("BOT_LOGINS", "ci-*,deploy-robot")
+	os.Setenv("BOT_DEFAULT_RULES", "false")
+	os.Setenv("HUMAN_LOGINS", "ada_bot")
+	os.Setenv("BOT_BURST_EVENTS", "0")
+	os.Setenv("BOT_BURST_WINDOW_SEC", "300")
+	os.Setenv("EXCLUDE_BOTS", "true")
+	os.Setenv("ANOMALY_DETECTION", "percentile")
+	os.Setenv("ANOMALY_THRESHOLD", "99.5")
+	os.Setenv("ANOMALY_WINDOW", "2000")
+	os.Setenv("ANOMALY_MIN_LINES", "5000")
+	os.Setenv("ANOMALY_CAP", "true")
+	os.Setenv("ALERT_RULES_FILE", "/etc/github-events/alerts.json")
+	os.Setenv("ALERT_INTERVAL_SEC", "15")
+	os.Setenv("TRENDING_WINDOWS", "6h, 30d")
+	os.Setenv("TRENDING_INTERVAL_SEC", "0")
+	os.Setenv("REPO_METADATA_TTL_HOURS", "168")
+	os.Setenv("REPO_METADATA_INTERVAL_SEC", "0")
+	os.Setenv("ADMIN_TOKEN", "s3cret")
+	os.Setenv("CONSUMER_WORKERS_MIN", "2")
+	os.Setenv("CONSUMER_WORKERS_MAX", "16")
+	os.Setenv("AUTOSCALE_INTERVAL_SEC", "5")
+	os.Setenv("BACKPRESSURE", "spill")
 	cfg := Load()
 	if cfg.PollIntervalSec != 120 {
 		t.Errorf("PollIntervalSec want 120 got %d", cfg.PollIntervalSec)
@@ -49,6 +142,71 @@ func TestLoad_FromEnv(t *testing.T) {
 	if cfg.DatabaseURL != "postgres://local/db" {
 		t.Errorf("DatabaseURL want postgres://local/db got %s", cfg.DatabaseURL)
 	}
+	if cfg.BatchSize != 50 {
+		t.Errorf("BatchSize want 50 got %d", cfg.BatchSize)
+	}
+	if cfg.BatchWaitMs != 250 {
+		t.Errorf("BatchWaitMs want 250 got %d", cfg.BatchWaitMs)
+	}
+	if cfg.ExcludeDefaultPaths {
+		t.Error("ExcludeDefaultPaths want false")
+	}
+	if len(cfg.ExcludePaths) != 2 || cfg.ExcludePaths[0] != "docs/" || cfg.ExcludePaths[1] != "*.snap" {
+		t.Errorf("ExcludePaths want [docs/ *.snap] got %v", cfg.ExcludePaths)
+	}
+	if cfg.MergePolicy != MergePolicySkip {
+		t.Errorf("MergePolicy want skip got %s", cfg.MergePolicy)
+	}
+	if cfg.ForcePushDetection != ForcePushCompare || !cfg.OrphanForcePushed {
+		t.Errorf("force push want compare with orphaning got %s orphan=%v", cfg.ForcePushDetection, cfg.OrphanForcePushed)
+	}
+	if len(cfg.DefaultBranches) != 1 || cfg.DefaultBranches[0] != "trunk" {
+		t.Errorf("DefaultBranches want [trunk] got %v", cfg.DefaultBranches)
+	}
+	if len(cfg.EventTypes) != 2 || cfg.EventTypes[1] != "WatchEvent" {
+		t.Errorf("EventTypes want [PushEvent WatchEvent] got %v", cfg.EventTypes)
+	}
+	if len(cfg.EventSources) != 2 || cfg.EventSources[1] != "repo:golang/go" {
+		t.Errorf("EventSources want [org:golang@30s repo:golang/go] got %v", cfg.EventSources)
+	}
+	if cfg.RetentionDays != 365 || !cfg.RetentionArchive || cfg.StripPayloadDays != 30 {
+		t.Errorf("retention want days=365 archive=true strip=30 got days=%d archive=%v strip=%d", cfg.RetentionDays, cfg.RetentionArchive, cfg.StripPayloadDays)
+	}
+	if cfg.MailmapFile != "/etc/github-events/mailmap" {
+		t.Errorf("MailmapFile want /etc/github-events/mailmap got %s", cfg.MailmapFile)
+	}
+	if len(cfg.BotLogins) != 2 || cfg.BotLogins[1] != "deploy-robot" || cfg.BotDefaultRules {
+		t.Errorf("bot logins want [ci-* deploy-robot] without defaults got %v default=%v", cfg.BotLogins, cfg.BotDefaultRules)
+	}
+	if len(cfg.HumanLogins) != 1 || cfg.HumanLogins[0] != "ada_bot" {
+		t.Errorf("HumanLogins want [ada_bot] got %v", cfg.HumanLogins)
+	}
+	if cfg.BotBurstEvents != 0 || cfg.BotBurstWindowSec != 300 || !cfg.ExcludeBots {
+		t.Errorf("bots want burst 0/300s excluded got burst=%d/%ds exclude=%v", cfg.BotBurstEvents, cfg.BotBurstWindowSec, cfg.ExcludeBots)
+	}
+	if cfg.AnomalyDetection != AnomalyPercentile || cfg.AnomalyThreshold != 99.5 || cfg.AnomalyWindow != 2000 ||
+		cfg.AnomalyMinLines != 5000 || !cfg.AnomalyCap {
+		t.Errorf("anomalies want percentile 99.5, window 2000, min lines 5000, capped got %s %v, window %d, min lines %d, cap=%v",
+			cfg.AnomalyDetection, cfg.AnomalyThreshold, cfg.AnomalyWindow, cfg.AnomalyMinLines, cfg.AnomalyCap)
+	}
+	if cfg.AlertRulesFile != "/etc/github-events/alerts.json" || cfg.AlertIntervalSec != 15 {
+		t.Errorf("alerts want /etc/github-events/alerts.json every 15s got %q every %ds", cfg.AlertRulesFile, cfg.AlertIntervalSec)
+	}
+	if len(cfg.TrendingWindows) != 2 || cfg.TrendingWindows[1] != "30d" || cfg.TrendingIntervalSec != 0 {
+		t.Errorf("trending want [6h 30d] disabled got %v every %ds", cfg.TrendingWindows, cfg.TrendingIntervalSec)
+	}
+	if cfg.RepoMetadataTTLHours != 168 || cfg.RepoMetadataIntervalSec != 0 {
+		t.Errorf("repo metadata want ttl 168h disabled got ttl %dh every %ds", cfg.RepoMetadataTTLHours, cfg.RepoMetadataIntervalSec)
+	}
+	if cfg.AdminToken != "s3cret" {
+		t.Errorf("AdminToken want s3cret got %q", cfg.AdminToken)
+	}
+	if cfg.ConsumerWorkersMin != 2 || cfg.ConsumerWorkersMax != 16 || cfg.AutoscaleIntervalSec != 5 {
+		t.Errorf("autoscaling want 2-16 every 5s got %d-%d every %ds", cfg.ConsumerWorkersMin, cfg.ConsumerWorkersMax, cfg.AutoscaleIntervalSec)
+	}
+	if cfg.Backpressure != BackpressureSpill {
+		t.Errorf("Backpressure want spill got %s", cfg.Backpressure)
+	}
 }
 
 func TestLoad_InvalidValuesUseDefaults(t *testing.T) {
@@ -56,6 +214,10 @@ func TestLoad_InvalidValuesUseDefaults(t *testing.T) {
 	os.Setenv("POLL_INTERVAL_SEC", "invalid")
 	os.Setenv("CONSUMER_WORKERS", "0")
 	os.Setenv("CHANNEL_SIZE", "-1")
+	os.Setenv("MERGE_POLICY", "sometimes")
+	os.Setenv("BACKPRESSURE", "panic")
+	os.Setenv("ANOMALY_DETECTION", "percentile")
+	os.Setenv("ANOMALY_THRESHOLD", "150")
 	cfg := Load()
 	if cfg.PollIntervalSec != DefaultPollIntervalSec {
 		t.Errorf("PollIntervalSec want default %d got %d", DefaultPollIntervalSec, cfg.PollIntervalSec)
@@ -66,4 +228,13 @@ func TestLoad_InvalidValuesUseDefaults(t *testing.T) {
 	if cfg.ChannelSize != DefaultChannelSize {
 		t.Errorf("ChannelSize want default %d got %d", DefaultChannelSize, cfg.ChannelSize)
 	}
+	if cfg.MergePolicy != MergePolicyCount {
+		t.Errorf("MergePolicy want default %s got %s", MergePolicyCount, cfg.MergePolicy)
+	}
+	if cfg.Backpressure != BackpressureBlock {
+		t.Errorf("Backpressure want default %s got %s", BackpressureBlock, cfg.Backpressure)
+	}
+	if cfg.AnomalyThreshold != DefaultAnomalyPercentile {
+		t.Errorf("AnomalyThreshold want percentile default %v got %v", DefaultAnomalyPercentile, cfg.AnomalyThreshold)
+	}
 }
@@ -0,0 +1,313 @@
+// Package export streams store rows as NDJSON, CSV or Parquet. Rows are written as the store yields them,
+// so memory stays bounded by the store's fetch size (and one Parquet row group) however many rows match.
+// Import reads NDJSON and CSV dumps back into a store.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format is an export file format.
+type Format string
+
+// Export formats.
+const (
+	NDJSON  Format = "ndjson"
+	CSV     Format = "csv"
+	Parquet Format = "parquet"
+)
+
+// Exportable tables.
+const (
+	TableCommits    = "commits"
+	TablePushEvents = "push_events"
+)
+
+// RowGroupSize is the number of rows buffered per Parquet row group.
+const RowGroupSize = 10000
+
+// ParseFormat parses ndjson, csv or parquet (empty means ndjson).
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case "":
+		return NDJSON, nil
+	case NDJSON, CSV, Parquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid format %q: want ndjson, csv or parquet", s)
+}
+
+// ContentType returns the MIME type of f.
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv"
+	case Parquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+// ParseTime parses an RFC 3339 timestamp or a YYYY-MM-DD date (UTC midnight). Empty means the zero time.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// ParseFilter builds a store.ExportFilter from the textual from/to bounds (see ParseTime), repo and author.
+func ParseFilter(from, to, repo, author string) (store.ExportFilter, error) {
+	f := store.ExportFilter{Repo: repo, Author: author}
+	var err error
+	if f.From, err = ParseTime(from); err != nil {
+		return f, err
+	}
+	if f.To, err = ParseTime(to); err != nil {
+		return f, err
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, fmt.Errorf("invalid range: from %s is not before to %s", from, to)
+	}
+	return f, nil
+}
+
+// CheckTable returns an error unless table is exportable.
+func CheckTable(table string) error {
+	if table != TableCommits && table != TablePushEvents {
+		return fmt.Errorf("invalid table %q: want %s or %s", table, TableCommits, TablePushEvents)
+	}
+	return nil
+}
+
+// Export writes the rows of table (TableCommits or TablePushEvents) matched by filter to w in format.
+// Returns the number of rows written.
+func Export(ctx context.Context, s store.Store, table string, filter store.ExportFilter, format Format, w io.Writer) (int64, error) {
+	switch table {
+	case TableCommits:
+		return write(w, format, func(emit func(CommitRecord) error) error {
+			return s.ExportCommitStats(ctx, filter, func(r *store.CommitStatsRow) error { return emit(commitRecord(r)) })
+		})
+	case TablePushEvents:
+		return write(w, format, func(emit func(PushEventRecord) error) error {
+			return s.ExportPushEvents(ctx, filter, func(r *store.PushEventRow) error { return emit(pushEventRecord(r)) })
+		})
+	}
+	return 0, CheckTable(table)
+}
+
+// record is an exported row type.
+type record interface {
+	CommitRecord | PushEventRecord
+	csvHeader() []string
+	csvRow() []string
+}
+
+// rowWriter encodes records of one type; Close flushes buffered output.
+type rowWriter[T record] interface {
+	Write(T) error
+	Close() error
+}
+
+// write streams the records yielded by stream to w through a rowWriter for format.
+func write[T record](w io.Writer, format Format, stream func(emit func(T) error) error) (int64, error) {
+	var rw rowWriter[T]
+	switch format {
+	case NDJSON:
+		rw = &ndjsonWriter[T]{enc: json.NewEncoder(w)}
+	case CSV:
+		cw := csv.NewWriter(w)
+		var zero T
+		if err := cw.Write(zero.csvHeader()); err != nil {
+			return 0, err
+		}
+		rw = &csvWriter[T]{w: cw}
+	case Parquet:
+		rw = &parquetWriter[T]{w: parquet.NewGenericWriter[T](w, parquet.MaxRowsPerRowGroup(RowGroupSize))}
+	default:
+		return 0, fmt.Errorf("invalid format %q", format)
+	}
+	var n int64
+	err := stream(func(rec T) error {
+		if err := rw.Write(rec); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if cerr := rw.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+type ndjsonWriter[T record] struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter[T]) Write(rec T) error { return w.enc.Encode(rec) }
+func (w *ndjsonWriter[T]) Close() error      { return nil }
+
+type csvWriter[T record] struct {
+	w *csv.Writer
+}
+
+func (w *csvWriter[T]) Write(rec T) error { return w.w.Write(rec.csvRow()) }
+
+func (w *csvWriter[T]) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type parquetWriter[T record] struct {
+	w *parquet.GenericWriter[T]
+}
+
+func (w *parquetWriter[T]) Write(rec T) error {
+	_, err := w.w.Write([]T{rec})
+	return err
+}
+
+func (w *parquetWriter[T]) Close() error { return w.w.Close() }
+
+// CommitRecord is an exported commit_stats row.
+type CommitRecord struct {
+	Sha               string    `json:"sha" parquet:"sha"`
+	Repo              string    `json:"repo" parquet:"repo"`
+	Author            string    `json:"author" parquet:"author"`
+	CommittedAt       time.Time `json:"committed_at" parquet:"committed_at,timestamp(microsecond)"`
+	Additions         int64     `json:"additions" parquet:"additions"`
+	Deletions         int64     `json:"deletions" parquet:"deletions"`
+	Total             int64     `json:"total" parquet:"total"`
+	Net               int64     `json:"net" parquet:"net"`
+	AdjustedAdditions int64     `json:"adjusted_additions" parquet:"adjusted_additions"`
+	AdjustedDeletions int64     `json:"adjusted_deletions" parquet:"adjusted_deletions"`
+	AdjustedNet       int64     `json:"adjusted_net" parquet:"adjusted_net"`
+	ParentCount       int64     `json:"parent_count" parquet:"parent_count"`
+	IsMerge           bool      `json:"is_merge" parquet:"is_merge"`
+	IsBot             bool      `json:"is_bot" parquet:"is_bot"`
+	Orphaned          bool      `json:"orphaned" parquet:"orphaned"`
+	// Capped* are the lines aggregates count for an outlier capped by ANOMALY_CAP; null when not capped.
+	CappedAdditions *int64 `json:"capped_additions" parquet:"capped_additions,optional"`
+	CappedDeletions *int64 `json:"capped_deletions" parquet:"capped_deletions,optional"`
+}
+
+func commitRecord(r *store.CommitStatsRow) CommitRecord {
+	rec := CommitRecord{
+		Sha:               r.Sha,
+		Repo:              r.Repo,
+		Author:            r.Author,
+		CommittedAt:       r.CommittedAt.UTC(),
+		Additions:         r.Additions,
+		Deletions:         r.Deletions,
+		Total:             r.Total,
+		Net:               r.Net,
+		AdjustedAdditions: r.AdjustedAdditions,
+		AdjustedDeletions: r.AdjustedDeletions,
+		AdjustedNet:       r.AdjustedNet,
+		ParentCount:       int64(r.ParentCount),
+		IsMerge:           r.IsMerge,
+		IsBot:             r.IsBot,
+		Orphaned:          r.Orphaned,
+	}
+	if r.Capped {
+		rec.CappedAdditions, rec.CappedDeletions = &r.CappedAdditions, &r.CappedDeletions
+	}
+	return rec
+}
+
+func (CommitRecord) csvHeader() []string {
+	return []string{"sha", "repo", "author", "committed_at", "additions", "deletions", "total", "net",
+		"adjusted_additions", "adjusted_deletions", "adjusted_net", "parent_count", "is_merge", "is_bot",
+		"orphaned", "capped_additions", "capped_deletions"}
+}
+
+func (c CommitRecord) csvRow() []string {
+	return []string{c.Sha, c.Repo, c.Author, csvTime(c.CommittedAt),
+		strconv.FormatInt(c.Additions, 10), strconv.FormatInt(c.Deletions, 10),
+		strconv.FormatInt(c.Total, 10), strconv.FormatInt(c.Net, 10),
+		strconv.FormatInt(c.AdjustedAdditions, 10), strconv.FormatInt(c.AdjustedDeletions, 10),
+		strconv.FormatInt(c.AdjustedNet, 10), strconv.FormatInt(c.ParentCount, 10), strconv.FormatBool(c.IsMerge),
+		strconv.FormatBool(c.IsBot), strconv.FormatBool(c.Orphaned), csvOptionalInt(c.CappedAdditions),
+		csvOptionalInt(c.CappedDeletions)}
+}
+
+// PushEventRecord is an exported gh_push_events row. A RawPayload stripped by retention is omitted
+// (NDJSON), empty (CSV) or JSON null (Parquet).
+type PushEventRecord struct {
+	ID           string          `json:"id" parquet:"id"`
+	Type         string          `json:"type" parquet:"type"`
+	CreatedAt    time.Time       `json:"created_at" parquet:"created_at,timestamp(microsecond)"`
+	ActorLogin   string          `json:"actor_login" parquet:"actor_login"`
+	Repo         string          `json:"repo" parquet:"repo"`
+	Ref          string          `json:"ref" parquet:"ref"`
+	RefType      string          `json:"ref_type" parquet:"ref_type"`
+	PushID       int64           `json:"push_id" parquet:"push_id"`
+	Size         int64           `json:"size" parquet:"size"`
+	DistinctSize int64           `json:"distinct_size" parquet:"distinct_size"`
+	Source       string          `json:"source" parquet:"source"`
+	IsBot        bool            `json:"is_bot" parquet:"is_bot"`
+	RawPayload   json.RawMessage `json:"raw_payload,omitempty" parquet:"raw_payload,json"`
+}
+
+func pushEventRecord(r *store.PushEventRow) PushEventRecord {
+	return PushEventRecord{
+		ID:           r.ID,
+		Type:         r.Type,
+		CreatedAt:    r.CreatedAt.UTC(),
+		ActorLogin:   r.ActorLogin,
+		Repo:         r.Repo,
+		Ref:          r.Ref,
+		RefType:      r.RefType,
+		PushID:       r.PushID,
+		Size:         int64(r.Size),
+		DistinctSize: int64(r.DistinctSize),
+		Source:       r.Source,
+		IsBot:        r.IsBot,
+		RawPayload:   r.RawPayload,
+	}
+}
+
+func (PushEventRecord) csvHeader() []string {
+	return []string{"id", "type", "created_at", "actor_login", "repo", "ref", "ref_type",
+		"push_id", "size", "distinct_size", "source", "is_bot", "raw_payload"}
+}
+
+func (e PushEventRecord) csvRow() []string {
+	return []string{e.ID, e.Type, csvTime(e.CreatedAt), e.ActorLogin, e.Repo, e.Ref, e.RefType,
+		strconv.FormatInt(e.PushID, 10), strconv.FormatInt(e.Size, 10), strconv.FormatInt(e.DistinctSize, 10),
+		e.Source, strconv.FormatBool(e.IsBot), string(e.RawPayload)}
+}
+
+// csvTime formats t as RFC 3339 with sub-second precision, or empty for the zero time.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// csvOptionalInt formats *n, or empty for nil.
+func csvOptionalInt(n *int64) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.FormatInt(*n, 10)
+}
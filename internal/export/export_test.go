@@ -0,0 +1,156 @@
+package export_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/export"
+	"github.com/challenge-github-events/internal/store"
+	"github.com/parquet-go/parquet-go"
+)
+
+var base = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func seeded(t *testing.T) store.Store {
+	t.Helper()
+	ctx := context.Background()
+	s := store.NewMemory()
+	_, err := s.InsertCommitStatsBatch(ctx, []*store.CommitStatsRow{
+		{Sha: "a", Repo: "o/r", Author: "dev", CommittedAt: base, Additions: 10, Deletions: 3, Total: 13, Net: 7, ParentCount: 1},
+		{Sha: "b", Repo: "o/r", Author: "dev", CommittedAt: base.Add(time.Hour), Additions: 1, Total: 1, Net: 1, ParentCount: 2, IsMerge: true},
+		{Sha: "c", Repo: "o/other", Author: "someone", CommittedAt: base.Add(2 * time.Hour), Additions: 5, Total: 5, Net: 5, ParentCount: 1,
+			Capped: true, CappedAdditions: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MarkCommitsOrphaned(ctx, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InsertPushEvent(ctx, &store.PushEventRow{ID: "e1", Type: "PushEvent", CreatedAt: base, ActorLogin: "dev",
+		Repo: "o/r", RawPayload: []byte(`{"size":2}`), Ref: "refs/heads/main", RefType: "branch", PushID: 9, Size: 2, DistinctSize: 2, Source: "global"}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestExportNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := export.Export(context.Background(), seeded(t), export.TableCommits, store.ExportFilter{Repo: "o/r"}, export.NDJSON, &buf)
+	if err != nil || n != 2 {
+		t.Fatalf("want 2 rows got %d (%v)", n, err)
+	}
+	var got []export.CommitRecord
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var rec export.CommitRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec)
+	}
+	if len(got) != 2 || got[0].Sha != "a" || got[0].Net != 7 || !got[0].CommittedAt.Equal(base) || got[1].Sha != "b" || !got[1].IsMerge ||
+		got[0].Orphaned || !got[1].Orphaned || got[0].CappedAdditions != nil {
+		t.Errorf("unexpected records %+v", got)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := export.Export(context.Background(), seeded(t), export.TablePushEvents, store.ExportFilter{}, export.CSV, &buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("want header and 1 row got %d rows", len(rows))
+	}
+	if rows[0][0] != "id" || rows[0][11] != "is_bot" || rows[0][12] != "raw_payload" {
+		t.Errorf("unexpected header %v", rows[0])
+	}
+	if rows[1][0] != "e1" || rows[1][2] != "2025-03-01T12:00:00Z" || rows[1][7] != "9" || rows[1][12] != `{"size":2}` {
+		t.Errorf("unexpected row %v", rows[1])
+	}
+}
+
+func TestExportCommitsCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := export.Export(context.Background(), seeded(t), export.TableCommits, store.ExportFilter{}, export.CSV, &buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("want header and 3 rows got %d rows", len(rows))
+	}
+	if h := rows[0]; h[14] != "orphaned" || h[15] != "capped_additions" || h[16] != "capped_deletions" {
+		t.Errorf("unexpected header %v", h)
+	}
+	if b, c := rows[2], rows[3]; b[14] != "true" || b[15] != "" || c[14] != "false" || c[15] != "2" || c[16] != "0" {
+		t.Errorf("unexpected rows %v %v", b, c)
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := export.Export(context.Background(), seeded(t), export.TableCommits, store.ExportFilter{From: base.Add(time.Hour)}, export.Parquet, &buf)
+	if err != nil || n != 2 {
+		t.Fatalf("want 2 rows got %d (%v)", n, err)
+	}
+	got, err := parquet.Read[export.CommitRecord](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Sha != "b" || got[1].Sha != "c" || got[1].Author != "someone" || !got[1].CommittedAt.Equal(base.Add(2*time.Hour)) ||
+		!got[0].Orphaned || got[0].CappedAdditions != nil || got[1].CappedAdditions == nil || *got[1].CappedAdditions != 2 {
+		t.Errorf("unexpected records %+v", got)
+	}
+
+	buf.Reset()
+	if _, err := export.Export(context.Background(), seeded(t), export.TablePushEvents, store.ExportFilter{}, export.Parquet, &buf); err != nil {
+		t.Fatal(err)
+	}
+	events, err := parquet.Read[export.PushEventRecord](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].ID != "e1" || string(events[0].RawPayload) != `{"size":2}` {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestExportInvalidTable(t *testing.T) {
+	if _, err := export.Export(context.Background(), store.NewMemory(), "users", store.ExportFilter{}, export.NDJSON, &bytes.Buffer{}); err == nil {
+		t.Error("want error for unknown table")
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	f, err := export.ParseFilter("2025-03-01", "2025-03-02T06:00:00Z", "o/r", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.From.Equal(base.Add(-12*time.Hour)) || !f.To.Equal(base.Add(18*time.Hour)) || f.Repo != "o/r" || f.Author != "dev" {
+		t.Errorf("unexpected filter %+v", f)
+	}
+	for _, tc := range [][2]string{{"yesterday", ""}, {"2025-03-02", "2025-03-01"}} {
+		if _, err := export.ParseFilter(tc[0], tc[1], "", ""); err == nil {
+			t.Errorf("ParseFilter(%q, %q) want error", tc[0], tc[1])
+		}
+	}
+	if f, err := export.ParseFormat("CSV"); err != nil || f != export.CSV {
+		t.Errorf("ParseFormat(CSV) want csv got %q (%v)", f, err)
+	}
+	if _, err := export.ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(xml) want error")
+	}
+}
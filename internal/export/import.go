@@ -0,0 +1,392 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+)
+
+// ImportBatchSize is the number of commits inserted per InsertCommitStatsBatch call.
+const ImportBatchSize = 500
+
+// ImportResult counts the records of an import.
+type ImportResult struct {
+	Inserted   int64
+	Duplicates int64
+	Rejected   int64
+}
+
+// Rejection is a record that failed to decode or validate. Line is 1-based and counts the CSV header.
+type Rejection struct {
+	Line int
+	Err  error
+}
+
+func (r Rejection) Error() string {
+	return fmt.Sprintf("line %d: %v", r.Line, r.Err)
+}
+
+// Import reads an NDJSON or CSV dump of table written by Export from r and inserts it through s.
+// Inserts are idempotent, so rows already stored count as duplicates. Derived columns (total, net,
+// adjusted_net, is_merge) are recomputed from the imported ones; orphaned commits are marked again
+// through MarkCommitsOrphaned. A record that does not decode or
+// validate is rejected and passed to onReject (when set), and the import goes on.
+// The returned error is a read or store error; the import stops there.
+func Import(ctx context.Context, s store.Store, table string, format Format, r io.Reader, onReject func(Rejection)) (ImportResult, error) {
+	var res ImportResult
+	reject := func(line int, err error) {
+		res.Rejected++
+		if onReject != nil {
+			onReject(Rejection{Line: line, Err: err})
+		}
+	}
+	switch table {
+	case TableCommits:
+		var batch []*store.CommitStatsRow
+		var orphaned []string // SHAs of the batch discarded by a force push
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			inserted, err := s.InsertCommitStatsBatch(ctx, batch)
+			if err != nil {
+				return err
+			}
+			if _, err := s.MarkCommitsOrphaned(ctx, orphaned); err != nil {
+				return err
+			}
+			orphaned = nil
+			for _, ok := range inserted {
+				if ok {
+					res.Inserted++
+				} else {
+					res.Duplicates++
+				}
+			}
+			batch = nil
+			return nil
+		}
+		err := read(r, format, parseCommitCSV, func(line int, rec CommitRecord) error {
+			row, err := rec.row()
+			if err != nil {
+				reject(line, err)
+				return nil
+			}
+			if rec.Orphaned {
+				orphaned = append(orphaned, row.Sha)
+			}
+			if batch = append(batch, row); len(batch) == ImportBatchSize {
+				return flush()
+			}
+			return nil
+		}, reject)
+		if err == nil {
+			err = flush()
+		}
+		return res, err
+	case TablePushEvents:
+		err := read(r, format, parsePushEventCSV, func(line int, rec PushEventRecord) error {
+			row, err := rec.row()
+			if err != nil {
+				reject(line, err)
+				return nil
+			}
+			ok, err := s.InsertPushEvent(ctx, row)
+			if err != nil {
+				return err
+			}
+			if ok {
+				res.Inserted++
+			} else {
+				res.Duplicates++
+			}
+			return nil
+		}, reject)
+		return res, err
+	}
+	return res, CheckTable(table)
+}
+
+// read decodes the records of r and passes them to emit with their line; records that fail to decode go to reject.
+func read[T record](r io.Reader, format Format, fromCSV func(csvRecord) (T, error), emit func(line int, rec T) error, reject func(int, error)) error {
+	switch format {
+	case NDJSON:
+		br := bufio.NewReader(r)
+		for line := 1; ; line++ {
+			b, err := br.ReadBytes('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if b = bytes.TrimSpace(b); len(b) > 0 {
+				var rec T
+				dec := json.NewDecoder(bytes.NewReader(b))
+				dec.DisallowUnknownFields()
+				if derr := dec.Decode(&rec); derr != nil {
+					reject(line, derr)
+				} else if eerr := emit(line, rec); eerr != nil {
+					return eerr
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+		}
+	case CSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		header, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var zero T
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[name] = i
+		}
+		for _, name := range zero.csvHeader() {
+			if _, ok := columns[name]; !ok && !csvOptionalColumns[name] {
+				return fmt.Errorf("csv header: missing column %q", name)
+			}
+		}
+		for {
+			fields, err := cr.Read()
+			if err == io.EOF {
+				return nil
+			}
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				reject(perr.StartLine, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			line, _ := cr.FieldPos(0)
+			if len(fields) != len(header) {
+				reject(line, fmt.Errorf("want %d fields got %d", len(header), len(fields)))
+				continue
+			}
+			rec, err := fromCSV(csvRecord{columns: columns, fields: fields})
+			if err != nil {
+				reject(line, err)
+				continue
+			}
+			if err := emit(line, rec); err != nil {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("import from %s not supported: want ndjson or csv", format)
+}
+
+// csvOptionalColumns were added to the dump format later; dumps without them import with the zero value.
+var csvOptionalColumns = map[string]bool{"is_bot": true, "orphaned": true, "capped_additions": true, "capped_deletions": true}
+
+// csvRecord is a CSV row addressed by header name. Parse errors are kept in err; the first one is reported.
+type csvRecord struct {
+	columns map[string]int
+	fields  []string
+	err     error
+}
+
+func (c *csvRecord) str(name string) string {
+	i, ok := c.columns[name]
+	if !ok {
+		return ""
+	}
+	return c.fields[i]
+}
+
+func (c *csvRecord) int(name string) int64 {
+	v := c.str(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil && c.err == nil {
+		c.err = fmt.Errorf("%s: invalid integer %q", name, v)
+	}
+	return n
+}
+
+// optionalInt is int, or nil for an empty or missing field.
+func (c *csvRecord) optionalInt(name string) *int64 {
+	if c.str(name) == "" {
+		return nil
+	}
+	n := c.int(name)
+	return &n
+}
+
+func (c *csvRecord) bool(name string) bool {
+	v := c.str(name)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil && c.err == nil {
+		c.err = fmt.Errorf("%s: invalid boolean %q", name, v)
+	}
+	return b
+}
+
+func (c *csvRecord) time(name string) time.Time {
+	v := c.str(name)
+	if v == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil && c.err == nil {
+		c.err = fmt.Errorf("%s: invalid time %q", name, v)
+	}
+	return t
+}
+
+func parseCommitCSV(c csvRecord) (CommitRecord, error) {
+	rec := CommitRecord{
+		Sha:               c.str("sha"),
+		Repo:              c.str("repo"),
+		Author:            c.str("author"),
+		CommittedAt:       c.time("committed_at"),
+		Additions:         c.int("additions"),
+		Deletions:         c.int("deletions"),
+		Total:             c.int("total"),
+		Net:               c.int("net"),
+		AdjustedAdditions: c.int("adjusted_additions"),
+		AdjustedDeletions: c.int("adjusted_deletions"),
+		AdjustedNet:       c.int("adjusted_net"),
+		ParentCount:       c.int("parent_count"),
+		IsMerge:           c.bool("is_merge"),
+		IsBot:             c.bool("is_bot"),
+		Orphaned:          c.bool("orphaned"),
+		CappedAdditions:   c.optionalInt("capped_additions"),
+		CappedDeletions:   c.optionalInt("capped_deletions"),
+	}
+	return rec, c.err
+}
+
+func parsePushEventCSV(c csvRecord) (PushEventRecord, error) {
+	rec := PushEventRecord{
+		ID:           c.str("id"),
+		Type:         c.str("type"),
+		CreatedAt:    c.time("created_at"),
+		ActorLogin:   c.str("actor_login"),
+		Repo:         c.str("repo"),
+		Ref:          c.str("ref"),
+		RefType:      c.str("ref_type"),
+		PushID:       c.int("push_id"),
+		Size:         c.int("size"),
+		DistinctSize: c.int("distinct_size"),
+		Source:       c.str("source"),
+		IsBot:        c.bool("is_bot"),
+	}
+	if v := c.str("raw_payload"); v != "" {
+		rec.RawPayload = json.RawMessage(v)
+	}
+	return rec, c.err
+}
+
+// row validates c and returns it as a commit_stats row with its derived columns recomputed.
+func (c CommitRecord) row() (*store.CommitStatsRow, error) {
+	switch {
+	case !validSHA(c.Sha):
+		return nil, fmt.Errorf("sha %q: want 40 or 64 hex digits", c.Sha)
+	case !validRepo(c.Repo):
+		return nil, fmt.Errorf("commit %s: repo %q: want owner/name", c.Sha, c.Repo)
+	case c.CommittedAt.IsZero():
+		return nil, fmt.Errorf("commit %s: committed_at is required", c.Sha)
+	case c.Additions < 0 || c.Deletions < 0 || c.AdjustedAdditions < 0 || c.AdjustedDeletions < 0 || c.ParentCount < 0:
+		return nil, fmt.Errorf("commit %s: negative line or parent count", c.Sha)
+	case c.AdjustedAdditions > c.Additions || c.AdjustedDeletions > c.Deletions:
+		return nil, fmt.Errorf("commit %s: adjusted lines exceed raw lines", c.Sha)
+	case (c.CappedAdditions == nil) != (c.CappedDeletions == nil):
+		return nil, fmt.Errorf("commit %s: capped_additions and capped_deletions must be set together", c.Sha)
+	case c.CappedAdditions != nil && (*c.CappedAdditions < 0 || *c.CappedDeletions < 0):
+		return nil, fmt.Errorf("commit %s: negative capped lines", c.Sha)
+	}
+	row := &store.CommitStatsRow{
+		Sha:               c.Sha,
+		Repo:              c.Repo,
+		Author:            c.Author,
+		CommittedAt:       c.CommittedAt,
+		Additions:         c.Additions,
+		Deletions:         c.Deletions,
+		Total:             c.Additions + c.Deletions,
+		Net:               c.Additions - c.Deletions,
+		AdjustedAdditions: c.AdjustedAdditions,
+		AdjustedDeletions: c.AdjustedDeletions,
+		AdjustedNet:       c.AdjustedAdditions - c.AdjustedDeletions,
+		ParentCount:       int(c.ParentCount),
+		IsMerge:           c.ParentCount > 1,
+		IsBot:             c.IsBot,
+	}
+	if c.CappedAdditions != nil {
+		row.Capped, row.CappedAdditions, row.CappedDeletions = true, *c.CappedAdditions, *c.CappedDeletions
+	}
+	return row, nil
+}
+
+// row validates e and returns it as a gh_push_events row.
+func (e PushEventRecord) row() (*store.PushEventRow, error) {
+	switch {
+	case e.ID == "":
+		return nil, errors.New("id is required")
+	case e.Type != "" && e.Type != "PushEvent":
+		return nil, fmt.Errorf("event %s: type %q: want PushEvent", e.ID, e.Type)
+	case !validRepo(e.Repo):
+		return nil, fmt.Errorf("event %s: repo %q: want owner/name", e.ID, e.Repo)
+	case e.CreatedAt.IsZero():
+		return nil, fmt.Errorf("event %s: created_at is required", e.ID)
+	case e.Size < 0 || e.DistinctSize < 0 || e.DistinctSize > e.Size:
+		return nil, fmt.Errorf("event %s: invalid size %d or distinct_size %d", e.ID, e.Size, e.DistinctSize)
+	case len(e.RawPayload) > 0 && !json.Valid(e.RawPayload):
+		return nil, fmt.Errorf("event %s: raw_payload is not valid JSON", e.ID)
+	}
+	payload := e.RawPayload
+	if string(payload) == "null" {
+		payload = nil
+	}
+	return &store.PushEventRow{
+		ID:           e.ID,
+		Type:         "PushEvent",
+		CreatedAt:    e.CreatedAt,
+		ActorLogin:   e.ActorLogin,
+		Repo:         e.Repo,
+		RawPayload:   payload,
+		Ref:          e.Ref,
+		RefType:      e.RefType,
+		PushID:       e.PushID,
+		Size:         int(e.Size),
+		DistinctSize: int(e.DistinctSize),
+		Source:       e.Source,
+		IsBot:        e.IsBot,
+	}, nil
+}
+
+// validSHA reports whether sha is a full SHA-1 or SHA-256 object name.
+func validSHA(sha string) bool {
+	if len(sha) != 40 && len(sha) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(sha)
+	return err == nil
+}
+
+func validRepo(repo string) bool {
+	owner, name, ok := strings.Cut(repo, "/")
+	return ok && owner != "" && name != "" && !strings.Contains(name, "/")
+}
@@ -0,0 +1,152 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/challenge-github-events/internal/export"
+	"github.com/challenge-github-events/internal/store"
+)
+
+const (
+	shaA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	shaB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	shaC = "cccccccccccccccccccccccccccccccccccccccc"
+)
+
+func TestImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for _, format := range []export.Format{export.NDJSON, export.CSV} {
+		for _, table := range []string{export.TableCommits, export.TablePushEvents} {
+			src := store.NewMemory()
+			if _, err := src.InsertCommitStatsBatch(ctx, []*store.CommitStatsRow{
+				{Sha: shaA, Repo: "o/r", Author: "dev", CommittedAt: base, Additions: 10, Deletions: 3, Total: 13, Net: 7,
+					AdjustedAdditions: 8, AdjustedDeletions: 3, AdjustedNet: 5, ParentCount: 1},
+				{Sha: shaB, Repo: "o/r", CommittedAt: base, Additions: 1, Total: 1, Net: 1, ParentCount: 2, IsMerge: true},
+				{Sha: shaC, Repo: "o/r", CommittedAt: base, Additions: 9000, Total: 9000, Net: 9000, ParentCount: 1,
+					AdjustedAdditions: 9000, AdjustedNet: 9000, Capped: true, CappedAdditions: 40},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := src.MarkCommitsOrphaned(ctx, []string{shaB}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := src.InsertPushEvent(ctx, &store.PushEventRow{ID: "e1", Type: "PushEvent", CreatedAt: base,
+				ActorLogin: "dev", Repo: "o/r", RawPayload: []byte(`{"size":1}`), Size: 1, DistinctSize: 1}); err != nil {
+				t.Fatal(err)
+			}
+			var dump bytes.Buffer
+			n, err := export.Export(ctx, src, table, store.ExportFilter{}, format, &dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dst := store.NewMemory()
+			res, err := export.Import(ctx, dst, table, format, bytes.NewReader(dump.Bytes()), nil)
+			if err != nil || res != (export.ImportResult{Inserted: n}) {
+				t.Fatalf("%s %s: first import want %d inserted got %+v (%v)", format, table, n, res, err)
+			}
+			res, err = export.Import(ctx, dst, table, format, bytes.NewReader(dump.Bytes()), nil)
+			if err != nil || res != (export.ImportResult{Duplicates: n}) {
+				t.Errorf("%s %s: second import want %d duplicates got %+v (%v)", format, table, n, res, err)
+			}
+
+			var again bytes.Buffer
+			if _, err := export.Export(ctx, dst, table, store.ExportFilter{}, format, &again); err != nil {
+				t.Fatal(err)
+			}
+			if again.String() != dump.String() {
+				t.Errorf("%s %s: re-export differs\nwant %s\ngot  %s", format, table, dump.String(), again.String())
+			}
+			if table != export.TableCommits {
+				continue
+			}
+			// Capped lines and orphaned commits are restored, so aggregates match the source.
+			for _, filter := range []store.StatsFilter{{}, {ExcludeOrphaned: true}} {
+				want, err := src.GlobalNetLines(ctx, filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, err := dst.GlobalNetLines(ctx, filter); err != nil || got != want {
+					t.Errorf("%s: GlobalNetLines %+v want %d got %d (%v)", format, filter, want, got, err)
+				}
+			}
+		}
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	ctx := context.Background()
+	in := strings.Join([]string{
+		`{"sha":"` + shaA + `","repo":"o/r","committed_at":"2025-03-01T12:00:00Z","additions":4,"deletions":1,"net":999,"parent_count":1}`,
+		`{"sha":"short","repo":"o/r","committed_at":"2025-03-01T12:00:00Z"}`,
+		`{"sha":"` + shaB + `","repo":"norepo","committed_at":"2025-03-01T12:00:00Z"}`,
+		`{"sha":"` + shaB + `","repo":"o/r"}`,
+		`{"sha":"` + shaB + `","repo":"o/r","committed_at":"2025-03-01T12:00:00Z","additions":1,"adjusted_additions":2}`,
+		`{"sha":"` + shaB + `","unknown":1}`,
+		`{"sha":"` + shaB + `","repo":"o/r","committed_at":"2025-03-01T12:00:00Z","additions":1,"capped_additions":1}`,
+		`not json`,
+		``,
+		`{"sha":"` + shaB + `","repo":"o/r","committed_at":"2025-03-01T12:00:00Z","additions":5,"parent_count":2}`,
+	}, "\n")
+	s := store.NewMemory()
+	var lines []int
+	res, err := export.Import(ctx, s, export.TableCommits, export.NDJSON, strings.NewReader(in), func(r export.Rejection) {
+		lines = append(lines, r.Line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (export.ImportResult{Inserted: 2, Rejected: 7}) {
+		t.Errorf("want 2 inserted, 7 rejected got %+v", res)
+	}
+	if want := "[2 3 4 5 6 7 8]"; fmt.Sprint(lines) != want {
+		t.Errorf("rejected lines want %s got %v", want, lines)
+	}
+	// Derived columns are recomputed: net from additions - deletions, is_merge from parent_count.
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != 8 {
+		t.Errorf("GlobalNetLines want 8 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{ExcludeMerges: true}); err != nil || net != 3 {
+		t.Errorf("GlobalNetLines without merges want 3 got %d (%v)", net, err)
+	}
+}
+
+func TestImportCSVRejects(t *testing.T) {
+	in := "id,type,created_at,actor_login,repo,ref,ref_type,push_id,size,distinct_size,source,raw_payload\n" +
+		"e1,PushEvent,2025-03-01T12:00:00Z,dev,o/r,refs/heads/main,branch,1,1,1,global,{}\n" +
+		"e2,PushEvent,yesterday,dev,o/r,,,,,,,\n" +
+		"e3,PushEvent,2025-03-01T12:00:00Z,dev,o/r,,,x,,,,\n" +
+		"e4,PushEvent,2025-03-01T12:00:00Z,dev,o/r,,,,,,,{broken\n" +
+		"e5,WatchEvent,2025-03-01T12:00:00Z,dev,o/r,,,,,,,\n" +
+		"e6,PushEvent\n"
+	var lines []int
+	res, err := export.Import(context.Background(), store.NewMemory(), export.TablePushEvents, export.CSV, strings.NewReader(in), func(r export.Rejection) {
+		lines = append(lines, r.Line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (export.ImportResult{Inserted: 1, Rejected: 5}) {
+		t.Errorf("want 1 inserted, 5 rejected got %+v", res)
+	}
+	if want := "[3 4 5 6 7]"; fmt.Sprint(lines) != want {
+		t.Errorf("rejected lines want %s got %v", want, lines)
+	}
+
+	// Dumps written before orphaned and the capped columns were exported still import.
+	old := "sha,repo,author,committed_at,additions,deletions,total,net,adjusted_additions,adjusted_deletions,adjusted_net,parent_count,is_merge\n" +
+		shaA + ",o/r,dev,2025-03-01T12:00:00Z,4,1,5,3,4,1,3,1,false\n"
+	if res, err := export.Import(context.Background(), store.NewMemory(), export.TableCommits, export.CSV, strings.NewReader(old), nil); err != nil || res != (export.ImportResult{Inserted: 1}) {
+		t.Errorf("old dump want 1 inserted got %+v (%v)", res, err)
+	}
+	if _, err := export.Import(context.Background(), store.NewMemory(), export.TablePushEvents, export.CSV, strings.NewReader("id,type\n"), nil); err == nil {
+		t.Error("want error for missing CSV columns")
+	}
+	if _, err := export.Import(context.Background(), store.NewMemory(), export.TableCommits, export.Parquet, strings.NewReader(""), nil); err == nil {
+		t.Error("want error for parquet import")
+	}
+}
@@ -1,6 +1,6 @@
 package github
 
-//go:generate go run go.uber.org/mock/mockgen -destination client_mock.gen.go -package github . EventsFetcher,CommitStatsFetcher
+//go:generate go run go.uber.org/mock/mockgen -destination client_mock.gen.go -package github . EventsFetcher,CommitStatsFetcher,CommitComparer,RepositoryFetcher
 
 import (
 	"context"
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,13 +22,18 @@ const (
 )
 
 var (
-	ErrNotFound   = errors.New("not found")
+	ErrNotFound    = errors.New("not found")
 	ErrRateLimited = errors.New("rate limited")
 )
 
 // EventsFetcher fetches GitHub events (used by producer).
 type EventsFetcher interface {
-	FetchEvents(ctx context.Context, etag string) (events []Event, newEtag string, err error)
+	FetchEvents(ctx context.Context, path, etag string) (events []Event, newEtag string, err error)
+}
+
+// RateLimiter reports the remaining API budget (used to share it between pollers and workers).
+type RateLimiter interface {
+	RateLimit() RateLimit
 }
 
 // CommitStatsFetcher fetches commit stats for a given repo/ref (used by consumer).
@@ -35,29 +41,59 @@ type CommitStatsFetcher interface {
 	GetCommitStats(ctx context.Context, owner, repo, ref string) (*CommitStats, error)
 }
 
-// Client implements EventsFetcher and CommitStatsFetcher using the GitHub API.
+// CommitComparer compares two commits of a repo (used for merge and force-push handling).
+type CommitComparer interface {
+	CompareCommits(ctx context.Context, owner, repo, base, head string) (*Comparison, error)
+	CompareAllCommits(ctx context.Context, owner, repo, base, head string) (*Comparison, error)
+}
+
+// RepositoryFetcher fetches the metadata of a repo (used for repository enrichment).
+type RepositoryFetcher interface {
+	GetRepository(ctx context.Context, owner, repo string) (*Repository, error)
+}
+
+// Client implements EventsFetcher, CommitStatsFetcher, CommitComparer and RepositoryFetcher using the GitHub API.
 // BaseURL is optional; when set (e.g. in tests) it replaces the default API host.
+// FirstParentMerges makes GetCommitStats report merge commits with only the lines they changed themselves, not
+// those of the merged branch.
 type Client struct {
-	httpClient *http.Client
-	token      string
-	BaseURL    string // for tests: e.g. httptest.Server.URL
-	log        *slog.Logger
+	httpClient        *http.Client
+	token             string
+	BaseURL           string // for tests: e.g. httptest.Server.URL
+	FirstParentMerges bool
+	retryBackoff      time.Duration // before the first retry of a 5xx; doubles with each retry
+	log               *slog.Logger
+
+	mu        sync.Mutex
+	rateLimit RateLimit
 }
 
 // NewClient returns a GitHub API client. token is optional (PAT for higher rate limits).
 func NewClient(token string) *Client {
 	return &Client{
-		httpClient: &http.Client{Timeout: 30 * time.Second},
-		token:      token,
-		log:        slog.Default(),
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		token:        token,
+		retryBackoff: time.Second,
+		log:          slog.Default(),
+	}
+}
+
+func (c *Client) eventsURL(path string) string {
+	if path == "" || path == GlobalEventsPath {
+		if c.BaseURL != "" {
+			return strings.TrimSuffix(c.BaseURL, "/") + "/events"
+		}
+		return eventsURL
 	}
+	return c.apiURL("%s", path)
 }
 
-func (c *Client) eventsURL() string {
+func (c *Client) apiURL(format string, args ...any) string {
+	base := "https://api.github.com"
 	if c.BaseURL != "" {
-		return strings.TrimSuffix(c.BaseURL, "/") + "/events"
+		base = strings.TrimSuffix(c.BaseURL, "/")
 	}
-	return eventsURL
+	return base + fmt.Sprintf(format, args...)
 }
 
 func (c *Client) commitURL(owner, repo, ref string) string {
@@ -67,145 +103,312 @@ func (c *Client) commitURL(owner, repo, ref string) string {
 	return fmt.Sprintf(commitAPIFmt, owner, repo, ref)
 }
 
-// FetchEvents fetches global events. If etag is non-empty, sends If-None-Match; on 304 returns nil, newEtag, nil.
-func (c *Client) FetchEvents(ctx context.Context, etag string) ([]Event, string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.eventsURL(), nil)
+// FetchEvents fetches the events at path (e.g. GlobalEventsPath, "/orgs/{org}/events"; empty means global).
+// If etag is non-empty, sends If-None-Match; on 304 returns nil, newEtag, nil.
+func (c *Client) FetchEvents(ctx context.Context, path, etag string) ([]Event, string, error) {
+	resp, body, err := c.get(ctx, c.eventsURL(path), etag)
 	if err != nil {
 		return nil, "", err
 	}
-	c.setAuth(req)
-	if etag != "" {
-		req.Header.Set("If-None-Match", etag)
+	newEtag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, newEtag, nil
+	}
+	var events []Event
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, newEtag, err
 	}
-	resp, err := c.httpClient.Do(req)
+	return events, newEtag, nil
+}
+
+// GetCommitStats fetches commit stats for the given repo/ref. Returns ErrNotFound on 404.
+func (c *Client) GetCommitStats(ctx context.Context, owner, repo, ref string) (*CommitStats, error) {
+	resp, body, err := c.get(ctx, c.commitURL(owner, repo, ref), "")
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
-	newEtag := resp.Header.Get("ETag")
-	newEtag = strings.Trim(newEtag, `"`)
-
-	switch resp.StatusCode {
-	case http.StatusNotModified:
-		return nil, newEtag, nil
-	case http.StatusForbidden:
-		if reset := resp.Header.Get("X-RateLimit-Reset"); reset != "" {
-			if ts, _ := strconv.ParseInt(reset, 10, 64); ts > 0 {
-				until := time.Until(time.Unix(ts, 0))
-				if until > 0 && until < 5*time.Minute {
-					c.log.Info("rate limited, backing off", "until", time.Unix(ts, 0))
-					time.Sleep(until)
-					return c.FetchEvents(ctx, etag) // retry once after backoff
-				}
-			}
+	var api CommitAPIResponse
+	if err := json.Unmarshal(body, &api); err != nil {
+		return nil, err
+	}
+	// The files of large commits come in pages of 300, linked by the Link header.
+	for next := nextPage(resp.Header); next != ""; {
+		var page CommitAPIResponse
+		if next, err = c.getPage(ctx, next, &page); err != nil {
+			return nil, fmt.Errorf("commit files: %w", err)
 		}
-		return nil, newEtag, ErrRateLimited
-	case http.StatusOK:
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, newEtag, err
-		}
-		var events []Event
-		if err := json.Unmarshal(body, &events); err != nil {
-			return nil, newEtag, err
-		}
-		return events, newEtag, nil
-	default:
-		if resp.StatusCode >= 500 {
-			for attempt := 0; attempt < 3; attempt++ {
-				backoff := time.Duration(1<<uint(attempt)) * time.Second
-				time.Sleep(backoff)
-				out, et, err := c.FetchEvents(ctx, etag)
-				if err == nil {
-					return out, et, nil
-				}
-				if attempt == 2 {
-					return nil, newEtag, err
-				}
-			}
+		api.Files = append(api.Files, page.Files...)
+	}
+	additions := int64(0)
+	deletions := int64(0)
+	total := int64(0)
+	if api.Stats != nil {
+		if api.Stats.Additions != nil {
+			additions = int64(*api.Stats.Additions)
+		}
+		if api.Stats.Deletions != nil {
+			deletions = int64(*api.Stats.Deletions)
+		}
+		if api.Stats.Total != nil {
+			total = int64(*api.Stats.Total)
 		}
-		return nil, newEtag, fmt.Errorf("events API: %s", resp.Status)
 	}
+	parents := make([]string, 0, len(api.Parents))
+	for _, p := range api.Parents {
+		parents = append(parents, p.SHA)
+	}
+	files := api.Files
+	if c.FirstParentMerges && len(parents) > 1 {
+		if files, err = c.mergeOwnFiles(ctx, owner, repo, parents, files); err != nil {
+			return nil, fmt.Errorf("merged branch diff: %w", err)
+		}
+		additions, deletions, total = 0, 0, 0
+		for _, f := range files {
+			additions += f.Additions
+			deletions += f.Deletions
+			total += f.Changes
+		}
+	}
+	net := additions - deletions
+	return &CommitStats{
+		SHA:         api.SHA,
+		Additions:   additions,
+		Deletions:   deletions,
+		Total:       total,
+		Net:         net,
+		Author:      api.Commit.Author.Name,
+		CommittedAt: api.Commit.Author.Date,
+		Files:       files,
+		Parents:     parents,
+		AuthorIdentity: CommitIdentity{
+			Name:  api.Commit.Author.Name,
+			Email: api.Commit.Author.Email,
+			Login: actorLogin(api.Author),
+			Type:  actorType(api.Author),
+		},
+		Committer: CommitIdentity{
+			Name:  api.Commit.Committer.Name,
+			Email: api.Commit.Committer.Email,
+			Login: actorLogin(api.Committer),
+			Type:  actorType(api.Committer),
+		},
+	}, nil
 }
 
-// GetCommitStats fetches commit stats for the given repo/ref. Returns ErrNotFound on 404.
-func (c *Client) GetCommitStats(ctx context.Context, owner, repo, ref string) (*CommitStats, error) {
-	url := c.commitURL(owner, repo, ref)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// compareFilesLimit is the most files the compare API lists; longer diffs are cut off.
+const compareFilesLimit = 300
+
+// mergeOwnFiles returns the lines a merge changed itself (e.g. conflict resolutions): its files, diffed
+// against the first parent, less the changes of the merged branch (parents[0]...parents[1]), which its own
+// commits count already. A merged branch beyond compareFilesLimit files cannot be subtracted reliably, so
+// the merge then counts no lines.
+func (c *Client) mergeOwnFiles(ctx context.Context, owner, repo string, parents []string, files []CommitFile) ([]CommitFile, error) {
+	branch, err := c.CompareCommits(ctx, owner, repo, parents[0], parents[1])
 	if err != nil {
 		return nil, err
 	}
-	c.setAuth(req)
-	req.Header.Set("Accept", "application/vnd.github+json")
-	resp, err := c.httpClient.Do(req)
+	if len(branch.Files) >= compareFilesLimit {
+		c.log.Warn("merged branch diff cut off, counting the merge as empty", "repo", owner+"/"+repo, "parents", parents)
+		return nil, nil
+	}
+	merged := make(map[string]CommitFile, len(branch.Files))
+	for _, f := range branch.Files {
+		merged[f.Filename] = f
+	}
+	var own []CommitFile
+	for _, f := range files {
+		m := merged[f.Filename]
+		f.Additions = max(f.Additions-m.Additions, 0)
+		f.Deletions = max(f.Deletions-m.Deletions, 0)
+		f.Changes = f.Additions + f.Deletions
+		if f.Changes > 0 {
+			own = append(own, f)
+		}
+	}
+	return own, nil
+}
+
+// actorLogin returns a's login, or "" when GitHub matched no account.
+func actorLogin(a *Actor) string {
+	if a == nil {
+		return ""
+	}
+	return a.Login
+}
+
+// actorType returns a's account type, or "" when GitHub matched no account.
+func actorType(a *Actor) string {
+	if a == nil {
+		return ""
+	}
+	return a.Type
+}
+
+// CompareCommits compares base...head. Returns ErrNotFound on 404 (e.g. base no longer exists).
+func (c *Client) CompareCommits(ctx context.Context, owner, repo, base, head string) (*Comparison, error) {
+	var cmp Comparison
+	if err := c.getJSON(ctx, c.apiURL("/repos/%s/%s/compare/%s...%s", owner, repo, base, head), &cmp); err != nil {
+		return nil, err
+	}
+	return &cmp, nil
+}
+
+// compareCommitsPerPage is the page size CompareAllCommits requests.
+const compareCommitsPerPage = 100
+
+// CompareAllCommits is CompareCommits listing all the commits of base...head, following the Link header a
+// page of compareCommitsPerPage at a time, where CompareCommits lists the first 250 only. Files are those of
+// the first page. Returns ErrNotFound on 404.
+func (c *Client) CompareAllCommits(ctx context.Context, owner, repo, base, head string) (*Comparison, error) {
+	var cmp Comparison
+	next, err := c.getPage(ctx, c.apiURL("/repos/%s/%s/compare/%s...%s?per_page=%d", owner, repo, base, head, compareCommitsPerPage), &cmp)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	switch resp.StatusCode {
-	case http.StatusNotFound:
-		return nil, ErrNotFound
-	case http.StatusForbidden:
-		if reset := resp.Header.Get("X-RateLimit-Reset"); reset != "" {
-			if ts, _ := strconv.ParseInt(reset, 10, 64); ts > 0 {
-				until := time.Until(time.Unix(ts, 0))
-				if until > 0 && until < 5*time.Minute {
-					time.Sleep(until)
-					return c.GetCommitStats(ctx, owner, repo, ref)
-				}
-			}
+	for next != "" {
+		var page Comparison
+		if next, err = c.getPage(ctx, next, &page); err != nil {
+			return nil, fmt.Errorf("compare commits: %w", err)
+		}
+		cmp.Commits = append(cmp.Commits, page.Commits...)
+	}
+	return &cmp, nil
+}
+
+// GetRepository fetches the metadata of owner/repo. Returns ErrNotFound on 404 (deleted or private repo).
+func (c *Client) GetRepository(ctx context.Context, owner, repo string) (*Repository, error) {
+	var r Repository
+	if err := c.getJSON(ctx, c.apiURL("/repos/%s/%s", owner, repo), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// getJSON GETs url and decodes the JSON body into out, with the errors and retries of get.
+func (c *Client) getJSON(ctx context.Context, url string, out any) error {
+	_, err := c.getPage(ctx, url, out)
+	return err
+}
+
+// getPage is getJSON also returning the URL of the next page (from the Link header), or "" on the last one.
+func (c *Client) getPage(ctx context.Context, url string, out any) (next string, err error) {
+	resp, body, err := c.get(ctx, url, "")
+	if err != nil {
+		return "", err
+	}
+	return nextPage(resp.Header), json.Unmarshal(body, out)
+}
+
+// maxRetries is the number of times a request answered with a 5xx status is retried.
+const maxRetries = 3
+
+// maxRateLimitWait is the longest a request waits for the rate limit to reset before failing with ErrRateLimited.
+const maxRateLimitWait = 5 * time.Minute
+
+// get GETs url, sending If-None-Match when etag is set, and returns the response with its body read. Every
+// API request goes through it: 5xx responses are retried maxRetries times with exponential backoff, and a
+// 403 whose rate limit resets within maxRateLimitWait is retried once after the reset. Returns ErrNotFound
+// on 404, ErrRateLimited on 403 and an error for any other status but 200 and 304.
+func (c *Client) get(ctx context.Context, url, etag string) (*http.Response, []byte, error) {
+	waitedReset := false
+	for retries := 0; ; {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.setAuth(req)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, nil, err
 		}
-		return nil, ErrRateLimited
-	case http.StatusOK:
 		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
-			return nil, err
-		}
-		var api CommitAPIResponse
-		if err := json.Unmarshal(body, &api); err != nil {
-			return nil, err
-		}
-		additions := int64(0)
-		deletions := int64(0)
-		total := int64(0)
-		if api.Stats != nil {
-			if api.Stats.Additions != nil {
-				additions = int64(*api.Stats.Additions)
+			return nil, nil, err
+		}
+		c.trackRateLimit(resp)
+		switch {
+		case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotModified:
+			return resp, body, nil
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, nil, ErrNotFound
+		case resp.StatusCode == http.StatusForbidden:
+			until := rateLimitWait(resp)
+			if waitedReset || until <= 0 || until >= maxRateLimitWait {
+				return nil, nil, ErrRateLimited
 			}
-			if api.Stats.Deletions != nil {
-				deletions = int64(*api.Stats.Deletions)
+			waitedReset = true
+			c.log.Info("rate limited, backing off", "until", time.Now().Add(until))
+			if err := sleep(ctx, until); err != nil {
+				return nil, nil, err
 			}
-			if api.Stats.Total != nil {
-				total = int64(*api.Stats.Total)
+		case resp.StatusCode >= 500 && retries < maxRetries:
+			if err := sleep(ctx, c.retryBackoff<<retries); err != nil {
+				return nil, nil, err
 			}
+			retries++
+		default:
+			return nil, nil, fmt.Errorf("GET %s: %s", url, resp.Status)
 		}
-		net := additions - deletions
-		return &CommitStats{
-			SHA:         api.SHA,
-			Additions:   additions,
-			Deletions:   deletions,
-			Total:       total,
-			Net:         net,
-			Author:      api.Commit.Author.Name,
-			CommittedAt: api.Commit.Author.Date,
-		}, nil
-	default:
-		if resp.StatusCode >= 500 {
-			for attempt := 0; attempt < 3; attempt++ {
-				backoff := time.Duration(1<<uint(attempt)) * time.Second
-				time.Sleep(backoff)
-				out, err := c.GetCommitStats(ctx, owner, repo, ref)
-				if err == nil {
-					return out, nil
-				}
-				if attempt == 2 {
-					return nil, err
-				}
-			}
+	}
+}
+
+// sleep waits for d, or returns ctx.Err() when ctx is cancelled first.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// nextPage returns the rel="next" URL of the Link header h, or "".
+func nextPage(h http.Header) string {
+	for _, link := range strings.Split(h.Get("Link"), ",") {
+		url, params, ok := strings.Cut(link, ";")
+		if ok && strings.Contains(params, `rel="next"`) {
+			return strings.Trim(strings.TrimSpace(url), "<>")
+		}
+	}
+	return ""
+}
+
+// RateLimit returns the rate limit reported by the most recent API response (zero before the first one).
+func (c *Client) RateLimit() RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rateLimit
+}
+
+// trackRateLimit records the X-RateLimit-* headers of resp, when present.
+func (c *Client) trackRateLimit(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	rl := RateLimit{Remaining: remaining}
+	rl.Limit, _ = strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if ts, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); ts > 0 {
+		rl.Reset = time.Unix(ts, 0)
+	}
+	c.mu.Lock()
+	c.rateLimit = rl
+	c.mu.Unlock()
+}
+
+// rateLimitWait returns the time until X-RateLimit-Reset, or 0 when absent.
+func rateLimitWait(resp *http.Response) time.Duration {
+	if reset := resp.Header.Get("X-RateLimit-Reset"); reset != "" {
+		if ts, _ := strconv.ParseInt(reset, 10, 64); ts > 0 {
+			return time.Until(time.Unix(ts, 0))
 		}
-		return nil, fmt.Errorf("commit API: %s", resp.Status)
 	}
+	return 0
 }
 
 func (c *Client) setAuth(req *http.Request) {
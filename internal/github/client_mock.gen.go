@@ -1,9 +1,9 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/challenge-github-events/internal/github (interfaces: EventsFetcher,CommitStatsFetcher)
+// Source: github.com/challenge-github-events/internal/github (interfaces: EventsFetcher,CommitStatsFetcher,CommitComparer,RepositoryFetcher)
 //
 // Generated by this command:
 //
-//	mockgen -destination client_mock.gen.go -package github . EventsFetcher,CommitStatsFetcher
+//	mockgen -destination client_mock.gen.go -package github . EventsFetcher,CommitStatsFetcher,CommitComparer,RepositoryFetcher
 //
 
 // Package github is a generated GoMock package.
@@ -41,9 +41,9 @@ func (m *MockEventsFetcher) EXPECT() *MockEventsFetcherMockRecorder {
 }
 
 // FetchEvents mocks base method.
-func (m *MockEventsFetcher) FetchEvents(ctx context.Context, etag string) ([]Event, string, error) {
+func (m *MockEventsFetcher) FetchEvents(ctx context.Context, path, etag string) ([]Event, string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FetchEvents", ctx, etag)
+	ret := m.ctrl.Call(m, "FetchEvents", ctx, path, etag)
 	ret0, _ := ret[0].([]Event)
 	ret1, _ := ret[1].(string)
 	ret2, _ := ret[2].(error)
@@ -51,9 +51,9 @@ func (m *MockEventsFetcher) FetchEvents(ctx context.Context, etag string) ([]Eve
 }
 
 // FetchEvents indicates an expected call of FetchEvents.
-func (mr *MockEventsFetcherMockRecorder) FetchEvents(ctx, etag any) *gomock.Call {
+func (mr *MockEventsFetcherMockRecorder) FetchEvents(ctx, path, etag any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchEvents", reflect.TypeOf((*MockEventsFetcher)(nil).FetchEvents), ctx, etag)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchEvents", reflect.TypeOf((*MockEventsFetcher)(nil).FetchEvents), ctx, path, etag)
 }
 
 // MockCommitStatsFetcher is a mock of CommitStatsFetcher interface.
@@ -94,3 +94,96 @@ func (mr *MockCommitStatsFetcherMockRecorder) GetCommitStats(ctx, owner, repo, r
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommitStats", reflect.TypeOf((*MockCommitStatsFetcher)(nil).GetCommitStats), ctx, owner, repo, ref)
 }
+
+// MockCommitComparer is a mock of CommitComparer interface.
+type MockCommitComparer struct {
+	ctrl     *gomock.Controller
+	recorder *MockCommitComparerMockRecorder
+	isgomock struct{}
+}
+
+// MockCommitComparerMockRecorder is the mock recorder for MockCommitComparer.
+type MockCommitComparerMockRecorder struct {
+	mock *MockCommitComparer
+}
+
+// NewMockCommitComparer creates a new mock instance.
+func NewMockCommitComparer(ctrl *gomock.Controller) *MockCommitComparer {
+	mock := &MockCommitComparer{ctrl: ctrl}
+	mock.recorder = &MockCommitComparerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCommitComparer) EXPECT() *MockCommitComparerMockRecorder {
+	return m.recorder
+}
+
+// CompareAllCommits mocks base method.
+func (m *MockCommitComparer) CompareAllCommits(ctx context.Context, owner, repo, base, head string) (*Comparison, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareAllCommits", ctx, owner, repo, base, head)
+	ret0, _ := ret[0].(*Comparison)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareAllCommits indicates an expected call of CompareAllCommits.
+func (mr *MockCommitComparerMockRecorder) CompareAllCommits(ctx, owner, repo, base, head any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAllCommits", reflect.TypeOf((*MockCommitComparer)(nil).CompareAllCommits), ctx, owner, repo, base, head)
+}
+
+// CompareCommits mocks base method.
+func (m *MockCommitComparer) CompareCommits(ctx context.Context, owner, repo, base, head string) (*Comparison, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareCommits", ctx, owner, repo, base, head)
+	ret0, _ := ret[0].(*Comparison)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareCommits indicates an expected call of CompareCommits.
+func (mr *MockCommitComparerMockRecorder) CompareCommits(ctx, owner, repo, base, head any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareCommits", reflect.TypeOf((*MockCommitComparer)(nil).CompareCommits), ctx, owner, repo, base, head)
+}
+
+// MockRepositoryFetcher is a mock of RepositoryFetcher interface.
+type MockRepositoryFetcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockRepositoryFetcherMockRecorder
+	isgomock struct{}
+}
+
+// MockRepositoryFetcherMockRecorder is the mock recorder for MockRepositoryFetcher.
+type MockRepositoryFetcherMockRecorder struct {
+	mock *MockRepositoryFetcher
+}
+
+// NewMockRepositoryFetcher creates a new mock instance.
+func NewMockRepositoryFetcher(ctrl *gomock.Controller) *MockRepositoryFetcher {
+	mock := &MockRepositoryFetcher{ctrl: ctrl}
+	mock.recorder = &MockRepositoryFetcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRepositoryFetcher) EXPECT() *MockRepositoryFetcherMockRecorder {
+	return m.recorder
+}
+
+// GetRepository mocks base method.
+func (m *MockRepositoryFetcher) GetRepository(ctx context.Context, owner, repo string) (*Repository, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRepository", ctx, owner, repo)
+	ret0, _ := ret[0].(*Repository)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRepository indicates an expected call of GetRepository.
+func (mr *MockRepositoryFetcherMockRecorder) GetRepository(ctx, owner, repo any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRepository", reflect.TypeOf((*MockRepositoryFetcher)(nil).GetRepository), ctx, owner, repo)
+}
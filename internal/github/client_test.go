@@ -0,0 +1,278 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClient_GetCommitStats_FirstParentMerges(t *testing.T) {
+	mux := http.NewServeMux()
+	// The commit API diffs a merge against its first parent: the merged branch's lines plus a conflict fix.
+	mux.HandleFunc("/repos/o/r/commits/merge", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha":"merge","stats":{"additions":107,"deletions":52,"total":159},
+			"files":[{"filename":"a.go","additions":104,"deletions":51,"changes":155},
+				{"filename":"b.go","additions":3,"deletions":1,"changes":4}],
+			"parents":[{"sha":"p1"},{"sha":"p2"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/compare/p1...p2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"diverged","files":[{"filename":"a.go","additions":100,"deletions":50,"changes":150}]}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+
+	count, err := c.GetCommitStats(context.Background(), "o", "r", "merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !count.IsMerge() || count.Additions != 107 || count.Deletions != 52 || count.Net != 55 {
+		t.Errorf("count want merge add=107 del=52 net=55 got merge=%v add=%d del=%d net=%d", count.IsMerge(), count.Additions, count.Deletions, count.Net)
+	}
+
+	c.FirstParentMerges = true
+	own, err := c.GetCommitStats(context.Background(), "o", "r", "merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if own.Additions != 7 || own.Deletions != 2 || own.Total != 9 || own.Net != 5 || len(own.Parents) != 2 || len(own.Files) != 2 {
+		t.Errorf("first-parent want add=7 del=2 total=9 net=5 parents=2 files=2 got add=%d del=%d total=%d net=%d parents=%d files=%d",
+			own.Additions, own.Deletions, own.Total, own.Net, len(own.Parents), len(own.Files))
+	}
+}
+
+func TestClient_GetCommitStats_FirstParentMergeOfLargeBranch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/commits/merge", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha":"merge","stats":{"additions":500,"deletions":0,"total":500},
+			"files":[{"filename":"a.go","additions":500,"changes":500}],"parents":[{"sha":"p1"},{"sha":"p2"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/compare/p1...p2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"diverged","files":[`)
+		for i := range compareFilesLimit {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"filename":"f%d.go","additions":1,"changes":1}`, i)
+		}
+		fmt.Fprint(w, `]}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+	c.FirstParentMerges = true
+
+	stats, err := c.GetCommitStats(context.Background(), "o", "r", "merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 0 || len(stats.Files) != 0 || !stats.IsMerge() {
+		t.Errorf("want an empty merge when the branch diff is cut off got total=%d files=%d", stats.Total, len(stats.Files))
+	}
+}
+
+func TestClient_GetCommitStats_FollowsFilePages(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/o/r/commits/big?page=2>; rel="next", <%s/repos/o/r/commits/big?page=2>; rel="last"`, ts.URL, ts.URL))
+			fmt.Fprint(w, `{"sha":"big","stats":{"additions":3,"deletions":0,"total":3},"files":[{"filename":"a.go","additions":1,"changes":1}]}`)
+		case "2":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/o/r/commits/big?page=1>; rel="prev", <%s/repos/o/r/commits/big?page=1>; rel="first"`, ts.URL, ts.URL))
+			fmt.Fprint(w, `{"sha":"big","stats":{"additions":3,"deletions":0,"total":3},"files":[{"filename":"b.go","additions":2,"changes":2}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+
+	stats, err := c.GetCommitStats(context.Background(), "o", "r", "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Files) != 2 || stats.Files[0].Filename != "a.go" || stats.Files[1].Filename != "b.go" || stats.Additions != 3 {
+		t.Errorf("want files a.go and b.go of both pages and 3 additions got %+v (%d additions)", stats.Files, stats.Additions)
+	}
+}
+
+func TestClient_GetCommitStats_Identities(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha":"abc","stats":{"additions":1,"deletions":0,"total":1},"parents":[{"sha":"p1"}],
+			"commit":{"author":{"name":"Mona","email":"mona@example.com","date":"2025-03-01T12:00:00Z"},
+				"committer":{"name":"GitHub","email":"noreply@github.com","date":"2025-03-01T12:01:00Z"}},
+			"author":{"login":"mona","type":"User"},"committer":null}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+
+	stats, err := c.GetCommitStats(context.Background(), "o", "r", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (CommitIdentity{Name: "Mona", Email: "mona@example.com", Login: "mona", Type: "User"}); stats.AuthorIdentity != want || stats.Author != "Mona" {
+		t.Errorf("author want %+v got %+v (%q)", want, stats.AuthorIdentity, stats.Author)
+	}
+	if want := (CommitIdentity{Name: "GitHub", Email: "noreply@github.com"}); stats.Committer != want {
+		t.Errorf("committer want %+v got %+v", want, stats.Committer)
+	}
+}
+
+func TestClient_CompareAllCommits_FollowsPages(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/compare/new...old" || r.URL.Query().Get("per_page") != "100" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/o/r/compare/new...old?per_page=100&page=2>; rel="next"`, ts.URL))
+			fmt.Fprint(w, `{"status":"diverged","total_commits":3,"commits":[{"sha":"c1"},{"sha":"c2"}],"files":[{"filename":"a.go"}]}`)
+		case "2":
+			fmt.Fprint(w, `{"status":"diverged","total_commits":3,"commits":[{"sha":"c3"}],"files":[{"filename":"a.go"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+
+	cmp, err := c.CompareAllCommits(context.Background(), "o", "r", "new", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmp.Commits) != 3 || cmp.Commits[2].SHA != "c3" || cmp.TotalCommits != 3 || len(cmp.Files) != 1 {
+		t.Errorf("want the 3 commits of both pages and the files of the first got %+v", cmp)
+	}
+}
+
+func TestClient_CompareCommits_NotFound(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+
+	if _, err := c.CompareCommits(context.Background(), "o", "r", "a", "b"); err != ErrNotFound {
+		t.Errorf("want ErrNotFound got %v", err)
+	}
+}
+
+func TestClient_GetRepository(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"full_name":"o/r","language":"Go","stargazers_count":42,"fork":true,"parent":{"full_name":"up/r"},
+			"default_branch":"trunk","archived":true,"license":{"spdx_id":"MIT"}}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+
+	r, err := c.GetRepository(context.Background(), "o", "r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Language != "Go" || r.Stars != 42 || !r.Fork || r.Parent == nil || r.Parent.FullName != "up/r" ||
+		r.DefaultBranch != "trunk" || !r.Archived || r.License == nil || r.License.SPDXID != "MIT" {
+		t.Errorf("unexpected repository %+v", r)
+	}
+	if _, err := c.GetRepository(context.Background(), "o", "gone"); err != ErrNotFound {
+		t.Errorf("want ErrNotFound got %v", err)
+	}
+}
+
+func TestClient_RetriesServerErrors(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			http.Error(w, "unavailable", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"full_name":"o/r"}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+	c.retryBackoff = time.Millisecond
+
+	if _, err := c.GetRepository(context.Background(), "o", "r"); err != nil || calls != 3 {
+		t.Errorf("want success on the third call got %v after %d calls", err, calls)
+	}
+}
+
+func TestClient_GivesUpAfterMaxRetries(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+	c.retryBackoff = time.Millisecond
+
+	if _, _, err := c.FetchEvents(context.Background(), GlobalEventsPath, ""); err == nil || calls != maxRetries+1 {
+		t.Errorf("want an error after %d calls got %v after %d calls", maxRetries+1, err, calls)
+	}
+}
+
+func TestClient_WaitsForRateLimitResetOnce(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+
+	if _, err := c.GetCommitStats(context.Background(), "o", "r", "sha"); !errors.Is(err, ErrRateLimited) || calls != 2 {
+		t.Errorf("want ErrRateLimited after 2 calls got %v after %d calls", err, calls)
+	}
+}
+
+func TestClient_FetchEvents_NotModified(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "v1" {
+			t.Errorf("If-None-Match want v1 got %q", r.Header.Get("If-None-Match"))
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer ts.Close()
+
+	c := NewClient("")
+	c.BaseURL = ts.URL
+
+	events, etag, err := c.FetchEvents(context.Background(), GlobalEventsPath, "v1")
+	if err != nil || events != nil || etag != "v1" {
+		t.Errorf("want (nil, v1, nil) got (%v, %q, %v)", events, etag, err)
+	}
+}
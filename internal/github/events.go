@@ -0,0 +1,60 @@
+package github
+
+// Event types handled by the producer.
+const (
+	PushEventType        = "PushEvent"
+	PullRequestEventType = "PullRequestEvent"
+	CreateEventType      = "CreateEvent"
+	DeleteEventType      = "DeleteEvent"
+	ReleaseEventType     = "ReleaseEvent"
+	WatchEventType       = "WatchEvent"
+)
+
+// PullRequestEventPayload is the payload for type PullRequestEvent.
+type PullRequestEventPayload struct {
+	Action      string      `json:"action"`
+	Number      int         `json:"number"`
+	PullRequest PullRequest `json:"pull_request"`
+}
+
+// PullRequest holds the pull request fields we keep.
+type PullRequest struct {
+	Title        string `json:"title"`
+	State        string `json:"state"`
+	Merged       bool   `json:"merged"`
+	Additions    int64  `json:"additions"`
+	Deletions    int64  `json:"deletions"`
+	ChangedFiles int    `json:"changed_files"`
+}
+
+// CreateEventPayload is the payload for type CreateEvent (branch, tag or repository created).
+type CreateEventPayload struct {
+	Ref          string `json:"ref"`
+	RefType      string `json:"ref_type"`
+	MasterBranch string `json:"master_branch"`
+}
+
+// DeleteEventPayload is the payload for type DeleteEvent (branch or tag deleted).
+type DeleteEventPayload struct {
+	Ref     string `json:"ref"`
+	RefType string `json:"ref_type"`
+}
+
+// ReleaseEventPayload is the payload for type ReleaseEvent.
+type ReleaseEventPayload struct {
+	Action  string  `json:"action"`
+	Release Release `json:"release"`
+}
+
+// Release holds the release fields we keep.
+type Release struct {
+	TagName    string `json:"tag_name"`
+	Name       string `json:"name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// WatchEventPayload is the payload for type WatchEvent (a repository starred).
+type WatchEventPayload struct {
+	Action string `json:"action"`
+}
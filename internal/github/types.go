@@ -2,9 +2,20 @@ package github
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 )
 
+// GlobalEventsPath is the API path of the global public events stream.
+const GlobalEventsPath = "/events"
+
+// RateLimit is the API budget reported by the X-RateLimit-* headers.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
 // Event is a minimal shape for GitHub API events (we only use PushEvent).
 type Event struct {
 	ID         string          `json:"id"`
@@ -13,11 +24,16 @@ type Event struct {
 	Actor      *Actor          `json:"actor"`
 	Repo       *Repo           `json:"repo"`
 	RawPayload json.RawMessage `json:"payload"`
+	// Source is the name of the stream the event was polled from (set by the producer, not GitHub).
+	Source string `json:"-"`
+	// IsBot reports whether the actor is a bot (set by the producer's bot classifier, not GitHub).
+	IsBot bool `json:"-"`
 }
 
-// Actor holds actor login.
+// Actor holds actor login and, when GitHub reports it, the account type (User, Bot, Organization).
 type Actor struct {
 	Login string `json:"login"`
+	Type  string `json:"type"`
 }
 
 // Repo holds full name (owner/repo).
@@ -28,10 +44,40 @@ type Repo struct {
 // PushEventPayload is the payload for type PushEvent.
 // Head is set by the public /events API when Commits is omitted.
 type PushEventPayload struct {
-	Before  string       `json:"before"`
-	After   string       `json:"after"`
-	Head    string       `json:"head"`
-	Commits []PushCommit `json:"commits"`
+	PushID       int64        `json:"push_id"`
+	Ref          string       `json:"ref"`
+	Size         int          `json:"size"`
+	DistinctSize int          `json:"distinct_size"`
+	Before       string       `json:"before"`
+	After        string       `json:"after"`
+	Head         string       `json:"head"`
+	Forced       bool         `json:"forced"`
+	Commits      []PushCommit `json:"commits"`
+}
+
+// Ref prefixes of branch and tag pushes.
+const (
+	BranchRefPrefix = "refs/heads/"
+	TagRefPrefix    = "refs/tags/"
+)
+
+// RefType returns "branch", "tag" or "" (unknown) for the pushed ref.
+func (p *PushEventPayload) RefType() string {
+	switch {
+	case strings.HasPrefix(p.Ref, BranchRefPrefix):
+		return "branch"
+	case strings.HasPrefix(p.Ref, TagRefPrefix):
+		return "tag"
+	}
+	return ""
+}
+
+// Tip returns the SHA the ref points to after the push (head, or after when head is omitted).
+func (p *PushEventPayload) Tip() string {
+	if p.Head != "" {
+		return p.Head
+	}
+	return p.After
 }
 
 // PushCommit has sha for each commit in a push.
@@ -48,6 +94,35 @@ type CommitStats struct {
 	Net         int64
 	Author      string
 	CommittedAt time.Time
+	Files       []CommitFile
+	Parents     []string
+	// AuthorIdentity and Committer are the git identities of the commit (AuthorIdentity.Name is Author).
+	AuthorIdentity CommitIdentity
+	Committer      CommitIdentity
+}
+
+// CommitIdentity is a commit author or committer: the git name and email, and the login and type
+// of the GitHub account GitHub matched the email to (empty when none).
+type CommitIdentity struct {
+	Name  string
+	Email string
+	Login string
+	Type  string
+}
+
+// IsMerge reports whether the commit has more than one parent.
+func (s *CommitStats) IsMerge() bool {
+	return len(s.Parents) > 1
+}
+
+// CommitFile is the per-file line stats of a commit.
+type CommitFile struct {
+	Filename         string `json:"filename"`
+	PreviousFilename string `json:"previous_filename"`
+	Status           string `json:"status"`
+	Additions        int64  `json:"additions"`
+	Deletions        int64  `json:"deletions"`
+	Changes          int64  `json:"changes"`
 }
 
 // CommitAPIResponse is the relevant part of the commit API JSON.
@@ -59,13 +134,56 @@ type CommitAPIResponse struct {
 		Deletions *int `json:"deletions"`
 		Total     *int `json:"total"`
 	} `json:"stats"`
+	Files   []CommitFile `json:"files"`
+	Parents []struct {
+		SHA string `json:"sha"`
+	} `json:"parents"`
+	// Author and Committer are the GitHub accounts matched to the git identities; null when unmatched.
+	Author    *Actor `json:"author"`
+	Committer *Actor `json:"committer"`
+}
+
+// Comparison is the relevant part of the compare API JSON (GET /repos/{owner}/{repo}/compare/{base}...{head}).
+// Status is one of "identical", "ahead", "behind" or "diverged".
+type Comparison struct {
+	Status       string       `json:"status"`
+	AheadBy      int          `json:"ahead_by"`
+	BehindBy     int          `json:"behind_by"`
+	TotalCommits int          `json:"total_commits"`
+	Commits      []PushCommit `json:"commits"`
+	Files        []CommitFile `json:"files"`
+}
+
+// Repository is the relevant part of the repository API JSON (GET /repos/{owner}/{repo}).
+// Parent is set for forks; License is null when GitHub detected none.
+type Repository struct {
+	FullName      string   `json:"full_name"`
+	Language      string   `json:"language"`
+	Stars         int      `json:"stargazers_count"`
+	Fork          bool     `json:"fork"`
+	Parent        *Repo    `json:"parent"`
+	DefaultBranch string   `json:"default_branch"`
+	Archived      bool     `json:"archived"`
+	License       *License `json:"license"`
+}
+
+// License is the license GitHub detected for a repository.
+type License struct {
+	SPDXID string `json:"spdx_id"`
 }
 
-// CommitDetail has author and date.
+// ZeroSHA is the before/head value of a push that creates or deletes a ref.
+const ZeroSHA = "0000000000000000000000000000000000000000"
+
+// CommitDetail has the git author and committer.
 type CommitDetail struct {
-	Author struct {
-		Name  string    `json:"name"`
-		Email string    `json:"email"`
-		Date  time.Time `json:"date"`
-	} `json:"author"`
+	Author    GitIdentity `json:"author"`
+	Committer GitIdentity `json:"committer"`
+}
+
+// GitIdentity is a git author or committer line.
+type GitIdentity struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Date  time.Time `json:"date"`
 }
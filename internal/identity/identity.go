@@ -0,0 +1,181 @@
+// Package identity normalizes commit author and committer identities and derives the keys
+// that merge them into one canonical author, so per-author stats don't fragment across
+// emails, GitHub noreply addresses and name spellings.
+package identity
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Identity is a git name and email, with the GitHub login when known.
+type Identity struct {
+	Name  string
+	Email string
+	Login string
+}
+
+// noreplyDomain is the domain of GitHub's private commit emails: LOGIN@ or ID+LOGIN@.
+const noreplyDomain = "users.noreply.github.com"
+
+// NoreplyLogin returns the GitHub login of a noreply email (e.g. 123+octocat@users.noreply.github.com), or "".
+func NoreplyLogin(email string) string {
+	local, domain, ok := strings.Cut(strings.ToLower(email), "@")
+	if !ok || domain != noreplyDomain {
+		return ""
+	}
+	if _, login, ok := strings.Cut(local, "+"); ok {
+		return login
+	}
+	return local
+}
+
+// Normalize trims id, lowercases the email and login, and fills Login from a noreply email.
+func (id Identity) Normalize() Identity {
+	id.Name = strings.Join(strings.Fields(id.Name), " ")
+	id.Email = strings.ToLower(strings.TrimSpace(id.Email))
+	id.Login = strings.ToLower(strings.TrimSpace(id.Login))
+	if id.Login == "" {
+		id.Login = NoreplyLogin(id.Email)
+	}
+	return id
+}
+
+// Keys returns the merge keys of a normalized identity, strongest first: "login:LOGIN", then
+// "email:EMAIL" unless the email is a placeholder. "name:NAME" is used only when neither
+// identifies the person, since names alone are shared by different people. Identities that
+// share any key belong to the same author.
+func (id Identity) Keys() []string {
+	var keys []string
+	if id.Login != "" {
+		keys = append(keys, "login:"+id.Login)
+	}
+	if id.Email != "" && !placeholderEmail(id.Email) {
+		keys = append(keys, "email:"+id.Email)
+	}
+	if len(keys) == 0 && id.Name != "" {
+		keys = append(keys, "name:"+strings.ToLower(id.Name))
+	}
+	return keys
+}
+
+// placeholderEmail reports whether email identifies no one: no domain, a local host, or a shared no-reply mailbox.
+func placeholderEmail(email string) bool {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" || domain == "" {
+		return true
+	}
+	if domain == "localhost" || strings.HasSuffix(domain, ".local") || strings.HasSuffix(domain, ".localdomain") || !strings.Contains(domain, ".") {
+		return true
+	}
+	switch local {
+	case "noreply", "no-reply", "none", "nobody", "root", "unknown":
+		return domain != noreplyDomain
+	}
+	return false
+}
+
+// Mailmap rewrites identities like git's .mailmap: each line maps a commit email (optionally with
+// a commit name) to a proper name and/or email. Lookups ignore case. The nil Mailmap maps nothing.
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+type Mailmap struct {
+	byEmail     map[string]mailmapEntry
+	byNameEmail map[[2]string]mailmapEntry
+}
+
+type mailmapEntry struct {
+	name  string
+	email string
+}
+
+// LoadMailmap parses the mailmap file at path.
+func LoadMailmap(path string) (*Mailmap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMailmap(f)
+}
+
+// ParseMailmap parses mailmap lines from r. Blank lines and # comments are ignored.
+func ParseMailmap(r io.Reader) (*Mailmap, error) {
+	m := &Mailmap{byEmail: make(map[string]mailmapEntry), byNameEmail: make(map[[2]string]mailmapEntry)}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		properName, properEmail, rest, ok := parseNameEmail(line)
+		if !ok {
+			return nil, fmt.Errorf("mailmap line %d: want [name] <email>", n)
+		}
+		entry := mailmapEntry{name: properName, email: properEmail}
+		if strings.TrimSpace(rest) == "" {
+			// "Proper Name <commit@email>": the only email is the commit email.
+			entry.email = ""
+			m.byEmail[strings.ToLower(properEmail)] = entry
+			continue
+		}
+		commitName, commitEmail, rest, ok := parseNameEmail(rest)
+		if !ok || strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("mailmap line %d: want [name] <email> [name] <email>", n)
+		}
+		if commitName == "" {
+			m.byEmail[strings.ToLower(commitEmail)] = entry
+		} else {
+			m.byNameEmail[[2]string{strings.ToLower(commitName), strings.ToLower(commitEmail)}] = entry
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseNameEmail parses "[name] <email>" at the start of s and returns the remainder.
+func parseNameEmail(s string) (name, email, rest string, ok bool) {
+	open := strings.IndexByte(s, '<')
+	if open < 0 {
+		return "", "", "", false
+	}
+	end := strings.IndexByte(s[open:], '>')
+	if end < 0 {
+		return "", "", "", false
+	}
+	return strings.TrimSpace(s[:open]), strings.TrimSpace(s[open+1 : open+end]), s[open+end+1:], true
+}
+
+// Apply returns id with its name and email replaced by the mailmap entry for (name, email), or for email alone.
+func (m *Mailmap) Apply(id Identity) Identity {
+	if m == nil {
+		return id
+	}
+	email := strings.ToLower(id.Email)
+	entry, ok := m.byNameEmail[[2]string{strings.ToLower(id.Name), email}]
+	if !ok {
+		if entry, ok = m.byEmail[email]; !ok {
+			return id
+		}
+	}
+	if entry.name != "" {
+		id.Name = entry.name
+	}
+	if entry.email != "" {
+		id.Email = entry.email
+	}
+	return id
+}
+
+// Canonical applies m to id and normalizes the result.
+func (m *Mailmap) Canonical(id Identity) Identity {
+	return m.Apply(id).Normalize()
+}
@@ -0,0 +1,76 @@
+package identity
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNoreplyLogin(t *testing.T) {
+	tests := map[string]string{
+		"583231+octocat@users.noreply.github.com": "octocat",
+		"Octocat@users.noreply.github.com":        "octocat",
+		"octocat@github.com":                      "",
+		"noreply@github.com":                      "",
+		"not-an-email":                            "",
+	}
+	for email, want := range tests {
+		if got := NoreplyLogin(email); got != want {
+			t.Errorf("NoreplyLogin(%q) want %q got %q", email, want, got)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	tests := []struct {
+		id   Identity
+		want []string
+	}{
+		{Identity{Name: "Mona", Email: "Mona@Example.com", Login: "Mona"}, []string{"login:mona", "email:mona@example.com"}},
+		{Identity{Name: "Mona", Email: "1+mona@users.noreply.github.com"}, []string{"login:mona", "email:1+mona@users.noreply.github.com"}},
+		{Identity{Name: "GitHub", Email: "noreply@github.com", Login: "web-flow"}, []string{"login:web-flow"}},
+		{Identity{Name: "  Jane   Doe ", Email: "root@localhost"}, []string{"name:jane doe"}},
+		{Identity{Name: "Jane Doe", Email: "jane"}, []string{"name:jane doe"}},
+		{Identity{}, nil},
+	}
+	for _, tt := range tests {
+		if got := tt.id.Normalize().Keys(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Keys(%+v) want %v got %v", tt.id, tt.want, got)
+		}
+	}
+}
+
+func TestMailmap(t *testing.T) {
+	m, err := ParseMailmap(strings.NewReader(`
+# comment
+Jane Doe <jane@example.com>
+<jane@example.com> <jane@old.example.com>
+Jane Doe <jane@example.com> jd <JD@laptop.example.com>
+Joe <joe@example.com> <joe@example.org> # trailing comment
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in, want Identity
+	}{
+		{Identity{Name: "jane", Email: "jane@example.com"}, Identity{Name: "Jane Doe", Email: "jane@example.com"}},
+		{Identity{Name: "J", Email: "Jane@Old.example.com"}, Identity{Name: "J", Email: "jane@example.com"}},
+		{Identity{Name: "JD", Email: "jd@laptop.example.com"}, Identity{Name: "Jane Doe", Email: "jane@example.com"}},
+		{Identity{Name: "someone", Email: "jd@laptop.example.com"}, Identity{Name: "someone", Email: "jd@laptop.example.com"}},
+		{Identity{Name: "joe", Email: "joe@example.org", Login: "joe1"}, Identity{Name: "Joe", Email: "joe@example.com", Login: "joe1"}},
+	}
+	for _, tt := range tests {
+		if got := m.Apply(tt.in); got != tt.want {
+			t.Errorf("Apply(%+v) want %+v got %+v", tt.in, tt.want, got)
+		}
+	}
+
+	var none *Mailmap
+	if got := none.Canonical(Identity{Name: "A", Email: "A@B.C"}); got != (Identity{Name: "A", Email: "a@b.c"}) {
+		t.Errorf("nil mailmap Canonical want normalized identity got %+v", got)
+	}
+	if _, err := ParseMailmap(strings.NewReader("Jane Doe jane@example.com\n")); err == nil {
+		t.Error("want error for line without <email>")
+	}
+}
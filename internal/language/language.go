@@ -0,0 +1,121 @@
+// Package language maps changed file paths to programming languages by file name and extension.
+package language
+
+import (
+	"path"
+	"strings"
+)
+
+// Other is returned for files whose language is not recognised.
+const Other = "Other"
+
+// byName maps well-known file names (without directory) to a language.
+var byName = map[string]string{
+	"Dockerfile":       "Dockerfile",
+	"Makefile":         "Makefile",
+	"GNUmakefile":      "Makefile",
+	"CMakeLists.txt":   "CMake",
+	"Rakefile":         "Ruby",
+	"Gemfile":          "Ruby",
+	"Vagrantfile":      "Ruby",
+	"Jenkinsfile":      "Groovy",
+	"BUILD":            "Starlark",
+	"BUILD.bazel":      "Starlark",
+	"WORKSPACE":        "Starlark",
+	"go.mod":           "Go Module",
+	"go.sum":           "Go Module",
+	"package.json":     "JSON",
+	"requirements.txt": "Text",
+}
+
+// byExt maps lower-case file extensions (with dot) to a language.
+var byExt = map[string]string{
+	".go":         "Go",
+	".py":         "Python",
+	".pyi":        "Python",
+	".ipynb":      "Jupyter Notebook",
+	".js":         "JavaScript",
+	".mjs":        "JavaScript",
+	".cjs":        "JavaScript",
+	".jsx":        "JavaScript",
+	".ts":         "TypeScript",
+	".tsx":        "TypeScript",
+	".java":       "Java",
+	".kt":         "Kotlin",
+	".kts":        "Kotlin",
+	".scala":      "Scala",
+	".groovy":     "Groovy",
+	".gradle":     "Groovy",
+	".c":          "C",
+	".h":          "C",
+	".cc":         "C++",
+	".cpp":        "C++",
+	".cxx":        "C++",
+	".hh":         "C++",
+	".hpp":        "C++",
+	".cs":         "C#",
+	".fs":         "F#",
+	".rs":         "Rust",
+	".swift":      "Swift",
+	".m":          "Objective-C",
+	".mm":         "Objective-C++",
+	".rb":         "Ruby",
+	".php":        "PHP",
+	".pl":         "Perl",
+	".pm":         "Perl",
+	".lua":        "Lua",
+	".r":          "R",
+	".jl":         "Julia",
+	".dart":       "Dart",
+	".ex":         "Elixir",
+	".exs":        "Elixir",
+	".erl":        "Erlang",
+	".hs":         "Haskell",
+	".clj":        "Clojure",
+	".ml":         "OCaml",
+	".zig":        "Zig",
+	".nim":        "Nim",
+	".sol":        "Solidity",
+	".sh":         "Shell",
+	".bash":       "Shell",
+	".zsh":        "Shell",
+	".ps1":        "PowerShell",
+	".sql":        "SQL",
+	".html":       "HTML",
+	".htm":        "HTML",
+	".css":        "CSS",
+	".scss":       "SCSS",
+	".sass":       "Sass",
+	".less":       "Less",
+	".vue":        "Vue",
+	".svelte":     "Svelte",
+	".json":       "JSON",
+	".yaml":       "YAML",
+	".yml":        "YAML",
+	".toml":       "TOML",
+	".xml":        "XML",
+	".proto":      "Protocol Buffer",
+	".graphql":    "GraphQL",
+	".tf":         "HCL",
+	".hcl":        "HCL",
+	".md":         "Markdown",
+	".markdown":   "Markdown",
+	".rst":        "reStructuredText",
+	".tex":        "TeX",
+	".txt":        "Text",
+	".csv":        "CSV",
+	".dockerfile": "Dockerfile",
+}
+
+// Detect returns the language of filename, or Other when unknown.
+// Well-known file names take precedence over extensions.
+func Detect(filename string) string {
+	name := path.Base(filename)
+	if lang, ok := byName[name]; ok {
+		return lang
+	}
+	if lang, ok := byExt[strings.ToLower(path.Ext(name))]; ok {
+		return lang
+	}
+	return Other
+}
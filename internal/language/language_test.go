@@ -0,0 +1,23 @@
+package language
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	cases := map[string]string{
+		"main.go":                   "Go",
+		"internal/server/x_test.go": "Go",
+		"web/src/App.TSX":           "TypeScript",
+		"scripts/build.sh":          "Shell",
+		"Dockerfile":                "Dockerfile",
+		"deploy/Dockerfile":         "Dockerfile",
+		"go.mod":                    "Go Module",
+		"docs/README.md":            "Markdown",
+		"LICENSE":                   Other,
+		"assets/logo.png":           Other,
+	}
+	for filename, want := range cases {
+		if got := Detect(filename); got != want {
+			t.Errorf("Detect(%q) want %s got %s", filename, want, got)
+		}
+	}
+}
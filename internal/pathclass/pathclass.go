@@ -0,0 +1,95 @@
+// Package pathclass classifies changed file paths as generated, vendored or lockfiles
+// so their lines can be excluded from the adjusted net lines metric.
+package pathclass
+
+import (
+	"path"
+	"strings"
+)
+
+// DefaultRules are linguist-style patterns for vendored, generated and lock files.
+var DefaultRules = []string{
+	// Vendored dependencies
+	"vendor/",
+	"node_modules/",
+	"third_party/",
+	"bower_components/",
+	"Godeps/",
+	"Pods/",
+	// Build output
+	"dist/",
+	"*.min.js",
+	"*.min.css",
+	"*.map",
+	// Lockfiles
+	"*.lock",
+	"package-lock.json",
+	"npm-shrinkwrap.json",
+	"pnpm-lock.yaml",
+	"go.sum",
+	// Generated sources
+	"*.pb.go",
+	"*.pb.gw.go",
+	"*.gen.go",
+	"*_generated.go",
+	"*.generated.*",
+	"zz_generated*.go",
+	"*_pb2.py",
+	"*_pb2_grpc.py",
+	"*.designer.cs",
+}
+
+// Classifier matches file paths against glob rules. A rule ending in "/" matches any directory
+// component (e.g. "vendor/"), a rule containing "/" matches the full path, and any other rule
+// matches the base name. Rules use path.Match syntax. The zero value excludes nothing.
+type Classifier struct {
+	dirs  []string
+	paths []string
+	names []string
+}
+
+// New returns a classifier for the given rules. Empty rules are ignored.
+func New(rules []string) *Classifier {
+	c := &Classifier{}
+	for _, r := range rules {
+		r = strings.TrimSpace(r)
+		switch {
+		case r == "":
+		case strings.HasSuffix(r, "/"):
+			c.dirs = append(c.dirs, strings.TrimSuffix(r, "/"))
+		case strings.Contains(r, "/"):
+			c.paths = append(c.paths, strings.TrimPrefix(r, "/"))
+		default:
+			c.names = append(c.names, r)
+		}
+	}
+	return c
+}
+
+// Excluded reports whether filename is generated, vendored or a lockfile.
+func (c *Classifier) Excluded(filename string) bool {
+	if c == nil {
+		return false
+	}
+	for _, p := range c.paths {
+		if ok, _ := path.Match(p, filename); ok {
+			return true
+		}
+	}
+	dir, name := path.Split(filename)
+	for _, p := range c.names {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	if len(c.dirs) > 0 && dir != "" {
+		for _, part := range strings.Split(strings.TrimSuffix(dir, "/"), "/") {
+			for _, p := range c.dirs {
+				if ok, _ := path.Match(p, part); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
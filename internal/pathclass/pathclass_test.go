@@ -0,0 +1,58 @@
+package pathclass
+
+import "testing"
+
+func TestClassifier_DefaultRules(t *testing.T) {
+	c := New(DefaultRules)
+	excluded := []string{
+		"vendor/github.com/x/y.go",
+		"web/node_modules/react/index.js",
+		"package-lock.json",
+		"frontend/yarn.lock",
+		"Cargo.lock",
+		"go.sum",
+		"static/app.min.js",
+		"api/v1/service.pb.go",
+		"pkg/apis/zz_generated.deepcopy.go",
+	}
+	for _, f := range excluded {
+		if !c.Excluded(f) {
+			t.Errorf("%s want excluded", f)
+		}
+	}
+	included := []string{
+		"main.go",
+		"internal/vendorlib/x.go",
+		"src/lock.go",
+		"docs/package.json",
+		"static/app.js",
+	}
+	for _, f := range included {
+		if c.Excluded(f) {
+			t.Errorf("%s want included", f)
+		}
+	}
+}
+
+func TestClassifier_CustomRules(t *testing.T) {
+	c := New([]string{"docs/*.md", " testdata/ ", "*.snap", ""})
+	if !c.Excluded("docs/README.md") {
+		t.Error("docs/README.md want excluded by full-path rule")
+	}
+	if c.Excluded("docs/api/README.md") {
+		t.Error("docs/api/README.md want included (full-path rule does not cross directories)")
+	}
+	if !c.Excluded("pkg/x/testdata/golden.json") {
+		t.Error("testdata file want excluded by directory rule")
+	}
+	if !c.Excluded("ui/__snapshots__/button.snap") {
+		t.Error(".snap want excluded by name rule")
+	}
+}
+
+func TestClassifier_NilExcludesNothing(t *testing.T) {
+	var c *Classifier
+	if c.Excluded("vendor/x.go") {
+		t.Error("nil classifier want nothing excluded")
+	}
+}
@@ -0,0 +1,111 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+)
+
+// NewActivityHandlers returns the handlers for the non-push event types, keyed by event type.
+// Each parses its typed payload and stores the event in its own table.
+func NewActivityHandlers(s store.Store) map[string]EventHandler {
+	return map[string]EventHandler{
+		github.PullRequestEventType: NewPullRequestHandler(s),
+		github.CreateEventType:      NewCreateHandler(s),
+		github.DeleteEventType:      NewDeleteHandler(s),
+		github.ReleaseEventType:     NewReleaseHandler(s),
+		github.WatchEventType:       NewWatchHandler(s),
+	}
+}
+
+// NewPullRequestHandler returns a handler storing PullRequestEvents.
+func NewPullRequestHandler(s store.Store) EventHandler {
+	return activityHandler(func(ctx context.Context, e *github.Event, base store.EventRow) (bool, error) {
+		var p github.PullRequestEventPayload
+		if err := json.Unmarshal(e.RawPayload, &p); err != nil {
+			return false, err
+		}
+		return s.InsertPullRequestEvent(ctx, &store.PullRequestEventRow{
+			EventRow:     base,
+			Action:       p.Action,
+			Number:       p.Number,
+			Title:        p.PullRequest.Title,
+			State:        p.PullRequest.State,
+			Merged:       p.PullRequest.Merged,
+			Additions:    p.PullRequest.Additions,
+			Deletions:    p.PullRequest.Deletions,
+			ChangedFiles: p.PullRequest.ChangedFiles,
+		})
+	})
+}
+
+// NewCreateHandler returns a handler storing CreateEvents.
+func NewCreateHandler(s store.Store) EventHandler {
+	return activityHandler(func(ctx context.Context, e *github.Event, base store.EventRow) (bool, error) {
+		var p github.CreateEventPayload
+		if err := json.Unmarshal(e.RawPayload, &p); err != nil {
+			return false, err
+		}
+		return s.InsertCreateEvent(ctx, &store.CreateEventRow{EventRow: base, Ref: p.Ref, RefType: p.RefType, MasterBranch: p.MasterBranch})
+	})
+}
+
+// NewDeleteHandler returns a handler storing DeleteEvents.
+func NewDeleteHandler(s store.Store) EventHandler {
+	return activityHandler(func(ctx context.Context, e *github.Event, base store.EventRow) (bool, error) {
+		var p github.DeleteEventPayload
+		if err := json.Unmarshal(e.RawPayload, &p); err != nil {
+			return false, err
+		}
+		return s.InsertDeleteEvent(ctx, &store.DeleteEventRow{EventRow: base, Ref: p.Ref, RefType: p.RefType})
+	})
+}
+
+// NewReleaseHandler returns a handler storing ReleaseEvents.
+func NewReleaseHandler(s store.Store) EventHandler {
+	return activityHandler(func(ctx context.Context, e *github.Event, base store.EventRow) (bool, error) {
+		var p github.ReleaseEventPayload
+		if err := json.Unmarshal(e.RawPayload, &p); err != nil {
+			return false, err
+		}
+		return s.InsertReleaseEvent(ctx, &store.ReleaseEventRow{
+			EventRow:   base,
+			Action:     p.Action,
+			TagName:    p.Release.TagName,
+			Name:       p.Release.Name,
+			Draft:      p.Release.Draft,
+			Prerelease: p.Release.Prerelease,
+		})
+	})
+}
+
+// NewWatchHandler returns a handler storing WatchEvents.
+func NewWatchHandler(s store.Store) EventHandler {
+	return activityHandler(func(ctx context.Context, e *github.Event, base store.EventRow) (bool, error) {
+		var p github.WatchEventPayload
+		if err := json.Unmarshal(e.RawPayload, &p); err != nil {
+			return false, err
+		}
+		return s.InsertWatchEvent(ctx, &store.WatchEventRow{EventRow: base, Action: p.Action})
+	})
+}
+
+// activityHandler builds the shared event columns and wraps insert errors with the event type.
+func activityHandler(insert func(ctx context.Context, e *github.Event, base store.EventRow) (bool, error)) EventHandler {
+	return EventHandlerFunc(func(ctx context.Context, e *github.Event) error {
+		base := store.EventRow{ID: e.ID, CreatedAt: e.CreatedAt, RawPayload: e.RawPayload, Source: e.Source, IsBot: e.IsBot}
+		if e.Repo != nil {
+			base.Repo = e.Repo.FullName
+		}
+		if e.Actor != nil {
+			base.ActorLogin = e.Actor.Login
+		}
+		if _, err := insert(ctx, e, base); err != nil {
+			return fmt.Errorf("store %s: %w", e.Type, err)
+		}
+		return nil
+	})
+}
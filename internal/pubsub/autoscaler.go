@@ -0,0 +1,267 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAutoscaleInterval is how often the autoscaler evaluates the pool when no interval is given.
+	DefaultAutoscaleInterval = 10 * time.Second
+	// LowBudget is the remaining rate-limit budget below which the pool shrinks: more workers would only
+	// run into the rate limit sooner.
+	LowBudget = 2 * RateLimitReserve
+	// Queue fill ratios above which the pool grows and below which it may shrink.
+	scaleUpFill   = 0.5
+	scaleDownFill = 0.1
+	// Estimated times for the pool to empty the queue above which it grows and below which it may shrink.
+	scaleUpBacklog   = 10 * time.Second
+	scaleDownBacklog = 2 * time.Second
+	// Consecutive evaluations a condition must hold before the pool grows or shrinks.
+	scaleUpAfter   = 2
+	scaleDownAfter = 6
+	// recentDecisions is the number of scaling decisions kept in the metrics.
+	recentDecisions = 20
+)
+
+// LatencyReporter reports the average time a worker takes to process a job (e.g. Consumer, BatchConsumer).
+type LatencyReporter interface {
+	JobLatency() time.Duration
+}
+
+// ScaleDecision is a change of the worker pool size made by the autoscaler.
+type ScaleDecision struct {
+	At     time.Time
+	From   int
+	To     int
+	Reason string
+}
+
+// AutoscalerMetrics are the inputs of the last evaluation and the scaling decisions made since startup.
+type AutoscalerMetrics struct {
+	Min, Max      int
+	Workers       int
+	QueueDepth    int
+	QueueCapacity int
+	JobLatency    time.Duration
+	// RateRemaining is the remaining rate-limit budget, or -1 when unknown.
+	RateRemaining int
+	Restarts      int64
+	// Suspended is set while a manual scale keeps the autoscaler from resizing the pool.
+	Suspended  bool
+	ScaleUps   int64
+	ScaleDowns int64
+	// Decisions are the most recent decisions, oldest first.
+	Decisions   []ScaleDecision
+	EvaluatedAt time.Time
+}
+
+// Autoscaler resizes the worker pool of a Controller between min and max workers. The pool grows when the
+// queue fills up or would take long to empty at the current job latency, and shrinks when the queue stays
+// nearly empty or the rate-limit budget runs low. A condition must hold for several evaluations in a row
+// (more to shrink than to grow), so the pool does not flap.
+type Autoscaler struct {
+	ctrl     *Controller
+	limiter  RateLimiter
+	min, max int
+	interval time.Duration
+	now      func() time.Time
+	log      *slog.Logger
+
+	up, down int // consecutive evaluations wanting to grow or shrink
+
+	mu      sync.Mutex
+	metrics AutoscalerMetrics
+}
+
+// NewAutoscaler returns an autoscaler keeping ctrl's pool between minWorkers and maxWorkers, evaluated every
+// interval (DefaultAutoscaleInterval when <= 0). limiter reports the remaining API budget of the workers'
+// fetcher; nil ignores it.
+func NewAutoscaler(ctrl *Controller, limiter RateLimiter, minWorkers, maxWorkers int, interval time.Duration) *Autoscaler {
+	if interval <= 0 {
+		interval = DefaultAutoscaleInterval
+	}
+	maxWorkers = min(max(maxWorkers, 1), MaxWorkers)
+	minWorkers = min(max(minWorkers, 0), maxWorkers)
+	return &Autoscaler{
+		ctrl:     ctrl,
+		limiter:  limiter,
+		min:      minWorkers,
+		max:      maxWorkers,
+		interval: interval,
+		now:      time.Now,
+		log:      slog.Default(),
+		metrics:  AutoscalerMetrics{Min: minWorkers, Max: maxWorkers},
+	}
+}
+
+// Run evaluates the pool every interval until ctx is cancelled.
+func (a *Autoscaler) Run(ctx context.Context) {
+	a.log.Info("autoscaler running", "min", a.min, "max", a.max, "interval", a.interval)
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			a.log.Info("autoscaler stopping")
+			return
+		case <-ticker.C:
+			a.RunOnce()
+		}
+	}
+}
+
+// RunOnce evaluates the pool once and resizes it when a condition has held long enough. Returns the decision
+// made, if any. The pool is left alone while the producer is paused, the pipeline drained or autoscaling is
+// suspended by a manual scale.
+func (a *Autoscaler) RunOnce() *ScaleDecision {
+	st := a.ctrl.Status()
+	var latency time.Duration
+	if lr, ok := a.ctrl.worker.(LatencyReporter); ok {
+		latency = lr.JobLatency()
+	}
+	remaining := a.budget()
+	a.mu.Lock()
+	m := &a.metrics
+	m.Workers, m.QueueDepth, m.QueueCapacity = st.Workers, st.QueueDepth, st.QueueCapacity
+	m.JobLatency, m.RateRemaining, m.Restarts = latency, remaining, st.Restarts
+	m.Suspended = st.AutoscaleSuspended
+	m.EvaluatedAt = a.now()
+	a.mu.Unlock()
+	if st.Producer != ProducerRunning || st.Draining || st.Drained || st.AutoscaleSuspended {
+		a.up, a.down = 0, 0
+		return nil
+	}
+
+	workers := st.Workers
+	var fill float64
+	if st.QueueCapacity > 0 {
+		fill = float64(st.QueueDepth) / float64(st.QueueCapacity)
+	}
+	backlog := time.Duration(0)
+	if workers > 0 {
+		backlog = latency * time.Duration(st.QueueDepth+st.QueuePending) / time.Duration(workers)
+	}
+	to, reason := workers, ""
+	switch {
+	case workers < a.min:
+		to, reason = a.min, "below min"
+	case workers > a.max:
+		to, reason = a.max, "above max"
+	case remaining >= 0 && remaining < LowBudget:
+		to, reason = a.shrink(workers), "rate limit budget low"
+	case workers == 0 && st.QueueDepth > 0:
+		to, reason = a.grow(workers), "queue waiting"
+	case fill >= scaleUpFill:
+		to, reason = a.grow(workers), "queue filling up"
+	case backlog >= scaleUpBacklog:
+		to, reason = a.grow(workers), "queue backlog"
+	case fill <= scaleDownFill && backlog <= scaleDownBacklog:
+		to, reason = a.shrink(workers), "queue idle"
+	default:
+		a.up, a.down = 0, 0
+	}
+	if to == workers {
+		return nil
+	}
+	if err := a.ctrl.Autoscale(workers, to); err != nil {
+		// An operator paused, drained or resized the pool since Status: their action wins.
+		a.up, a.down = 0, 0
+		if errors.Is(err, ErrAutoscaleSuspended) || errors.Is(err, ErrPoolChanged) {
+			a.log.Debug("autoscale skipped", "from", workers, "to", to, "err", err)
+		} else {
+			a.log.Warn("autoscale", "from", workers, "to", to, "err", err)
+		}
+		return nil
+	}
+	d := ScaleDecision{At: a.now(), From: workers, To: to, Reason: reason}
+	a.log.Info("consumer workers autoscaled", "from", workers, "to", to, "reason", reason,
+		"queue_depth", st.QueueDepth, "job_latency", latency, "rate_remaining", remaining)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if to > workers {
+		m.ScaleUps++
+	} else {
+		m.ScaleDowns++
+	}
+	m.Workers = to
+	m.Decisions = append(m.Decisions, d)
+	if len(m.Decisions) > recentDecisions {
+		m.Decisions = m.Decisions[len(m.Decisions)-recentDecisions:]
+	}
+	return &d
+}
+
+// grow returns the pool size after scaleUpAfter evaluations in a row wanting to grow: half as many
+// workers again (at least one more), up to max.
+func (a *Autoscaler) grow(workers int) int {
+	a.up++
+	a.down = 0
+	if a.up < scaleUpAfter || workers >= a.max {
+		return workers
+	}
+	a.up = 0
+	return min(workers+max(workers/2, 1), a.max)
+}
+
+// shrink returns the pool size after scaleDownAfter evaluations in a row wanting to shrink: one worker
+// less, down to min.
+func (a *Autoscaler) shrink(workers int) int {
+	a.down++
+	a.up = 0
+	if a.down < scaleDownAfter || workers <= a.min {
+		return workers
+	}
+	a.down = 0
+	return workers - 1
+}
+
+// budget returns the remaining rate-limit budget, or -1 when unknown or past its reset.
+func (a *Autoscaler) budget() int {
+	if a.limiter == nil {
+		return -1
+	}
+	limit := a.limiter.RateLimit()
+	if limit.Reset.IsZero() || !limit.Reset.After(a.now()) {
+		return -1
+	}
+	return limit.Remaining
+}
+
+// Metrics returns the inputs of the last evaluation and the scaling decisions made so far.
+func (a *Autoscaler) Metrics() AutoscalerMetrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m := a.metrics
+	m.Decisions = append([]ScaleDecision(nil), m.Decisions...)
+	return m
+}
+
+// ewma is an exponentially weighted moving average of durations, safe for concurrent use.
+type ewma struct {
+	mu  sync.Mutex
+	avg float64
+	set bool
+}
+
+// ewmaWeight is the weight of a new observation.
+const ewmaWeight = 0.2
+
+func (e *ewma) observe(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.set {
+		e.avg, e.set = float64(d), true
+		return
+	}
+	e.avg += ewmaWeight * (float64(d) - e.avg)
+}
+
+func (e *ewma) value() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(e.avg)
+}
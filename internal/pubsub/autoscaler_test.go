@@ -0,0 +1,207 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+// idleWorker takes no jobs, so the queue depth is left to the test; it reports a fixed job latency.
+type idleWorker struct {
+	latency time.Duration
+}
+
+func (w *idleWorker) RunUntil(ctx context.Context, stop <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+	case <-stop:
+	}
+}
+
+func (w *idleWorker) JobLatency() time.Duration { return w.latency }
+
+type fixedLimit github.RateLimit
+
+func (l fixedLimit) RateLimit() github.RateLimit { return github.RateLimit(l) }
+
+// testAutoscaler returns an autoscaler of a pool of workers idle workers reading from queue.
+func testAutoscaler(t *testing.T, queue *Queue, latency time.Duration, workers int, limiter RateLimiter) *Autoscaler {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
+	prod := NewProducer(mockStore, github.NewMockEventsFetcher(ctrl), queue, time.Hour, nil)
+	prod.SetSources()
+	c := NewController(prod, &idleWorker{latency: latency}, queue)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Start(ctx, workers)
+	t.Cleanup(c.Stop)
+	t.Cleanup(cancel) // idle workers stop on ctx only; runs before Stop
+	return NewAutoscaler(c, limiter, 1, 6, 0)
+}
+
+func TestAutoscaler_GrowsAndShrinksWithHysteresis(t *testing.T) {
+	queue := testQueue(t, 20)
+	a := testAutoscaler(t, queue, 100*time.Millisecond, 2, nil)
+	for i := 0; i < 15; i++ {
+		queue.jobs <- CommitJob{}
+	}
+
+	if d := a.RunOnce(); d != nil {
+		t.Fatalf("first full evaluation want no decision got %+v", d)
+	}
+	if d := a.RunOnce(); d == nil || d.From != 2 || d.To != 3 || d.Reason != "queue filling up" {
+		t.Fatalf("want 2 -> 3 workers got %+v", d)
+	}
+	a.RunOnce()
+	if d := a.RunOnce(); d == nil || d.To != 4 {
+		t.Fatalf("want 3 -> 4 workers got %+v", d)
+	}
+
+	for queue.Len() > 0 {
+		<-queue.Jobs()
+	}
+	for i := 1; i < scaleDownAfter; i++ {
+		if d := a.RunOnce(); d != nil {
+			t.Fatalf("evaluation %d of an idle queue want no decision got %+v", i, d)
+		}
+	}
+	if d := a.RunOnce(); d == nil || d.From != 4 || d.To != 3 || d.Reason != "queue idle" {
+		t.Fatalf("want 4 -> 3 workers got %+v", d)
+	}
+
+	m := a.Metrics()
+	if m.ScaleUps != 2 || m.ScaleDowns != 1 || len(m.Decisions) != 3 || m.Workers != 3 || m.JobLatency != 100*time.Millisecond || m.RateRemaining != -1 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+}
+
+func TestAutoscaler_BacklogGrowsPool(t *testing.T) {
+	queue := testQueue(t, 100)
+	a := testAutoscaler(t, queue, 2*time.Second, 2, nil)
+	for i := 0; i < 20; i++ { // 20% full, but 20s of work for 2 workers
+		queue.jobs <- CommitJob{}
+	}
+	a.RunOnce()
+	if d := a.RunOnce(); d == nil || d.To != 3 || d.Reason != "queue backlog" {
+		t.Fatalf("want 2 -> 3 workers on backlog got %+v", d)
+	}
+}
+
+func TestAutoscaler_LowBudgetShrinksPool(t *testing.T) {
+	queue := testQueue(t, 10)
+	for i := 0; i < 10; i++ {
+		queue.jobs <- CommitJob{}
+	}
+	a := testAutoscaler(t, queue, time.Second, 3, fixedLimit{Remaining: 50, Reset: time.Now().Add(time.Hour)})
+	var d *ScaleDecision
+	for i := 0; i < scaleDownAfter; i++ {
+		d = a.RunOnce()
+	}
+	if d == nil || d.To != 2 || d.Reason != "rate limit budget low" {
+		t.Fatalf("full queue with a low budget want 3 -> 2 workers got %+v", d)
+	}
+	if m := a.Metrics(); m.RateRemaining != 50 || m.ScaleUps != 0 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+}
+
+func TestAutoscaler_LeavesPausedPipelineAlone(t *testing.T) {
+	queue := testQueue(t, 10)
+	a := testAutoscaler(t, queue, time.Second, 3, nil)
+	a.ctrl.Pause()
+	for i := 0; i < 2*scaleDownAfter; i++ {
+		if d := a.RunOnce(); d != nil {
+			t.Fatalf("paused producer want no decision got %+v", d)
+		}
+	}
+	if err := a.ctrl.Scale(8); err != nil {
+		t.Fatal(err)
+	}
+	a.ctrl.Resume()
+	if d := a.RunOnce(); d != nil {
+		t.Fatalf("manual scale want no decision got %+v", d)
+	}
+	a.ctrl.ResumeAutoscaling()
+	if d := a.RunOnce(); d == nil || d.To != 6 || d.Reason != "above max" {
+		t.Fatalf("want 8 -> 6 workers got %+v", d)
+	}
+}
+
+func TestAutoscaler_ManualScaleSuspendsAutoscaling(t *testing.T) {
+	queue := testQueue(t, 20)
+	a := testAutoscaler(t, queue, 100*time.Millisecond, 2, nil)
+	for i := 0; i < 15; i++ {
+		queue.jobs <- CommitJob{}
+	}
+	if err := a.ctrl.Scale(0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*scaleDownAfter; i++ {
+		if d := a.RunOnce(); d != nil {
+			t.Fatalf("manual scale to 0 want no decision got %+v", d)
+		}
+	}
+	if st := a.ctrl.Status(); st.Workers != 0 || !st.AutoscaleSuspended {
+		t.Fatalf("want 0 workers with autoscaling suspended got %+v", st)
+	}
+	if m := a.Metrics(); !m.Suspended {
+		t.Errorf("want suspended metrics got %+v", m)
+	}
+
+	a.ctrl.ResumeAutoscaling()
+	if d := a.RunOnce(); d == nil || d.From != 0 || d.To != 1 || d.Reason != "below min" {
+		t.Fatalf("want 0 -> 1 workers once autoscaling resumes got %+v", d)
+	}
+	if m := a.Metrics(); m.Suspended {
+		t.Errorf("want metrics no longer suspended got %+v", m)
+	}
+}
+
+func TestController_AutoscaleYieldsToOperator(t *testing.T) {
+	queue := testQueue(t, 10)
+	a := testAutoscaler(t, queue, time.Second, 2, nil)
+	c := a.ctrl
+
+	// The pool was resized between Status and Autoscale.
+	if err := c.Autoscale(5, 6); !errors.Is(err, ErrPoolChanged) {
+		t.Fatalf("stale pool size want ErrPoolChanged got %v", err)
+	}
+
+	// A drain started between Status and Autoscale.
+	c.Drain()
+	if err := c.Autoscale(2, 3); !errors.Is(err, ErrPoolChanged) {
+		t.Fatalf("draining want ErrPoolChanged got %v", err)
+	}
+	waitFor(t, "drained", func() bool { return c.Status().Drained })
+	if err := c.Autoscale(0, 1); !errors.Is(err, ErrPoolChanged) {
+		t.Fatalf("drained want ErrPoolChanged got %v", err)
+	}
+	if st := c.Status(); !st.Drained || st.Workers != 0 {
+		t.Fatalf("autoscale undid the drain: %+v", st)
+	}
+
+	// A manual scale wins over the autoscaler until autoscaling is resumed.
+	c.Resume()
+	if err := c.Scale(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Autoscale(4, 5); !errors.Is(err, ErrAutoscaleSuspended) {
+		t.Fatalf("manual scale want ErrAutoscaleSuspended got %v", err)
+	}
+	if st := c.Status(); st.Workers != 4 {
+		t.Fatalf("autoscale undid the manual scale: %+v", st)
+	}
+	c.ResumeAutoscaling()
+	if err := c.Autoscale(4, 5); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.Status(); st.Workers != 5 || st.AutoscaleSuspended {
+		t.Fatalf("want 5 workers autoscaled got %+v", st)
+	}
+}
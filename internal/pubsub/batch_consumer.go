@@ -0,0 +1,130 @@
+package pubsub
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+)
+
+// ShutdownFlushTimeout bounds the writes of pending work on shutdown: a BatchConsumer's pending batch once its
+// context is cancelled, and the spilled jobs a Queue has not written yet when it is closed.
+const ShutdownFlushTimeout = 5 * time.Second
+
+// BatchConsumer accumulates commit jobs, fetches their stats concurrently and persists them
+// with a single InsertCommits call. Depends only on Store interface.
+type BatchConsumer struct {
+	commitPipeline
+	jobs    <-chan CommitJob
+	size    int
+	wait    time.Duration
+	latency ewma
+}
+
+// NewBatchConsumer returns a consumer that flushes every size jobs or after wait, whichever comes first.
+func NewBatchConsumer(s store.Store, f CommitStatsFetcher, jobs <-chan CommitJob, size int, wait time.Duration, opts ConsumerOptions) *BatchConsumer {
+	if size < 1 {
+		size = 1
+	}
+	return &BatchConsumer{commitPipeline: commitPipeline{store: s, fetcher: f, opts: opts, log: slog.Default()},
+		jobs: jobs, size: size, wait: wait}
+}
+
+// Run starts one batching worker. Call N times for N workers.
+// Pending jobs are flushed when the jobs channel is closed, and within ShutdownFlushTimeout when ctx is cancelled.
+func (c *BatchConsumer) Run(ctx context.Context) {
+	c.RunUntil(ctx, nil)
+}
+
+// RunUntil runs one batching worker like Run until stop is closed; pending jobs are flushed first.
+func (c *BatchConsumer) RunUntil(ctx context.Context, stop <-chan struct{}) {
+	batch := make([]CommitJob, 0, c.size)
+	timer := time.NewTimer(c.wait)
+	timer.Stop()
+	defer timer.Stop()
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		start := time.Now()
+		c.processBatch(ctx, batch)
+		c.latency.observe(time.Since(start) / time.Duration(len(batch)))
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			// The batch's jobs have left the queue: flush them with a context that outlives ctx briefly.
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ShutdownFlushTimeout)
+			flush(flushCtx)
+			cancel()
+			c.log.Debug("batch consumer worker stopping")
+			return
+		case <-stop:
+			flush(ctx)
+			c.log.Debug("batch consumer worker stopped")
+			return
+		case job, ok := <-c.jobs:
+			if !ok {
+				flush(ctx)
+				c.log.Debug("batch consumer jobs channel closed")
+				return
+			}
+			batch = append(batch, job)
+			if len(batch) == 1 {
+				timer.Reset(c.wait)
+			}
+			if len(batch) >= c.size {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				flush(ctx)
+			}
+		case <-timer.C:
+			flush(ctx)
+		}
+	}
+}
+
+// JobLatency returns the moving average of the time its workers take per job (a batch's processing time
+// divided by its size).
+func (c *BatchConsumer) JobLatency() time.Duration {
+	return c.latency.value()
+}
+
+func (c *BatchConsumer) processBatch(ctx context.Context, batch []CommitJob) {
+	commits := make([]*store.CommitRow, len(batch))
+	anoms := make([]*store.AnomalyRow, len(batch))
+	var wg sync.WaitGroup
+	for i, job := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// A panic here would bypass the worker's recovery (see Controller); the job is dropped instead.
+			defer func() {
+				if r := recover(); r != nil {
+					c.log.Error("process commit job panicked", "repo", job.Repo, "sha", job.SHA, "panic", r)
+					commits[i] = nil
+				}
+			}()
+			commits[i], anoms[i] = c.fetch(ctx, job)
+		}()
+	}
+	wg.Wait()
+
+	fetched := make([]*store.CommitRow, 0, len(commits))
+	fetchedAnoms := make([]*store.AnomalyRow, 0, len(commits))
+	for i, commit := range commits {
+		if commit != nil {
+			fetched = append(fetched, commit)
+			fetchedAnoms = append(fetchedAnoms, anoms[i])
+		}
+	}
+	n := c.save(ctx, fetched, fetchedAnoms)
+	c.log.Debug("commit stats batch saved", "jobs", len(batch), "fetched", len(fetched), "inserted", n)
+}
@@ -0,0 +1,115 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+func TestBatchConsumer_FlushesFullBatchInOneInsert(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+	ctx := context.Background()
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha1").Return(&github.CommitStats{SHA: "sha1", Additions: 5, Net: 5}, nil)
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha2").Return(nil, github.ErrNotFound)
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha3").Return(&github.CommitStats{SHA: "sha3", Deletions: 2, Net: -2}, nil)
+
+	var captured []*store.CommitStatsRow
+	mockStore.EXPECT().InsertCommits(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, commits []*store.CommitRow) ([]bool, error) {
+		for _, c := range commits {
+			captured = append(captured, c.Stats)
+		}
+		return []bool{true, false}, nil
+	}).Times(1)
+	mockStore.EXPECT().CanonicalizeCommits(gomock.Any(), []string{"sha3"}).Return(int64(1), nil)
+
+	jobs := make(chan CommitJob, 3)
+	cons := NewBatchConsumer(mockStore, mockFetcher, jobs, 3, time.Hour, ConsumerOptions{})
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha1"}
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha2"}
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha3"}
+	close(jobs)
+
+	cons.Run(ctx)
+
+	if len(captured) != 2 {
+		t.Fatalf("batch want 2 rows (404 skipped) got %d", len(captured))
+	}
+	if captured[0].Sha != "sha1" || captured[1].Sha != "sha3" || captured[1].Repo != "o/r" || captured[1].Net != -2 {
+		t.Errorf("batch rows want sha1, sha3 (o/r, net=-2) got %s, %s (%s, net=%d)", captured[0].Sha, captured[1].Sha, captured[1].Repo, captured[1].Net)
+	}
+}
+
+func TestBatchConsumer_FlushesPartialBatchAfterWait(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha1").Return(&github.CommitStats{SHA: "sha1"}, nil)
+	flushed := make(chan int, 1)
+	mockStore.EXPECT().InsertCommits(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, commits []*store.CommitRow) ([]bool, error) {
+		flushed <- len(commits)
+		return []bool{true}, nil
+	})
+
+	jobs := make(chan CommitJob, 1)
+	cons := NewBatchConsumer(mockStore, mockFetcher, jobs, 100, 50*time.Millisecond, ConsumerOptions{})
+	go cons.Run(ctx)
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha1"}
+
+	select {
+	case n := <-flushed:
+		if n != 1 {
+			t.Errorf("partial batch want 1 row got %d", n)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("partial batch was not flushed after wait")
+	}
+	cancel()
+}
+
+func TestBatchConsumer_FlushesPendingBatchOnCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha1").DoAndReturn(func(ctx context.Context, _, _, _ string) (*github.CommitStats, error) {
+		return &github.CommitStats{SHA: "sha1"}, ctx.Err()
+	})
+	var flushErr error
+	mockStore.EXPECT().InsertCommits(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, commits []*store.CommitRow) ([]bool, error) {
+		flushErr = ctx.Err()
+		return []bool{true}, flushErr
+	})
+
+	jobs := make(chan CommitJob)
+	cons := NewBatchConsumer(mockStore, mockFetcher, jobs, 100, time.Hour, ConsumerOptions{})
+	done := make(chan struct{})
+	go func() {
+		cons.Run(ctx)
+		close(done)
+	}()
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha1"} // unbuffered: the worker holds it in its batch
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker did not stop")
+	}
+	if flushErr != nil {
+		t.Errorf("pending batch flushed with a cancelled context: %v", flushErr)
+	}
+}
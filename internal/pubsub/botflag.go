@@ -0,0 +1,51 @@
+package pubsub
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/challenge-github-events/internal/store"
+)
+
+// BotFlagQueueSize is the number of logins waiting for Run before Enqueue drops them.
+const BotFlagQueueSize = 1000
+
+// BotFlagger flags the rows stored before burst rate gave a bot login away (see botclass.Classifier.OnFlag),
+// one login at a time in a single worker, off the producer's path.
+type BotFlagger struct {
+	store   store.Store
+	pending chan string
+	log     *slog.Logger
+}
+
+// NewBotFlagger returns a flagger marking rows through s.
+func NewBotFlagger(s store.Store) *BotFlagger {
+	return &BotFlagger{store: s, pending: make(chan string, BotFlagQueueSize), log: slog.Default()}
+}
+
+// Enqueue queues login for Run without blocking. The login is dropped with a warning when the queue is full;
+// rows stored after the flag are flagged on insert either way.
+func (f *BotFlagger) Enqueue(login string) {
+	select {
+	case f.pending <- login:
+	default:
+		f.log.Warn("bot flag queue full; stored rows not flagged", "login", login)
+	}
+}
+
+// Run flags the stored rows of queued logins until ctx is cancelled.
+func (f *BotFlagger) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case login := <-f.pending:
+			n, err := f.store.MarkBot(ctx, login)
+			if err != nil {
+				f.log.Warn("flag stored rows of bot", "login", login, "err", err)
+				continue
+			}
+			f.log.Info("login flagged as bot by burst rate", "login", login, "rows", n)
+		}
+	}
+}
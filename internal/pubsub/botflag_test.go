@@ -0,0 +1,62 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+func TestBotFlagger_EnqueueDoesNotBlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := NewBotFlagger(store.NewMockStore(ctrl))
+	// Nothing runs the queue: Enqueue must drop the overflow instead of blocking.
+	for i := 0; i < BotFlagQueueSize+10; i++ {
+		f.Enqueue("pusher")
+	}
+	if len(f.pending) != BotFlagQueueSize {
+		t.Errorf("want %d queued got %d", BotFlagQueueSize, len(f.pending))
+	}
+}
+
+func TestBotFlagger_RunFlagsQueuedLogins(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flagged := make(chan string, 2)
+	mark := func(_ context.Context, login string) (int64, error) {
+		flagged <- login
+		return 1, nil
+	}
+	gomock.InOrder(
+		mockStore.EXPECT().MarkBot(gomock.Any(), "first").DoAndReturn(func(ctx context.Context, login string) (int64, error) {
+			mark(ctx, login)
+			return 0, errors.New("db down")
+		}),
+		mockStore.EXPECT().MarkBot(gomock.Any(), "second").DoAndReturn(mark),
+	)
+
+	f := NewBotFlagger(mockStore)
+	f.Enqueue("first")
+	f.Enqueue("second")
+	go f.Run(ctx)
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-flagged:
+			if got != want {
+				t.Errorf("want %s flagged got %s", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s was not flagged", want)
+		}
+	}
+}
@@ -4,8 +4,15 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"math"
+	"time"
 
+	"github.com/challenge-github-events/internal/anomaly"
+	"github.com/challenge-github-events/internal/botclass"
 	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/identity"
+	"github.com/challenge-github-events/internal/language"
+	"github.com/challenge-github-events/internal/pathclass"
 	"github.com/challenge-github-events/internal/store"
 )
 
@@ -14,62 +21,311 @@ type CommitStatsFetcher interface {
 	GetCommitStats(ctx context.Context, owner, repo, ref string) (*github.CommitStats, error)
 }
 
-// Consumer processes commit jobs: fetch stats and persist. Depends only on Store interface.
-type Consumer struct {
+// ConsumerOptions configure how a Consumer or BatchConsumer maps commits to rows. The zero value disables them all.
+type ConsumerOptions struct {
+	// Paths selects the files excluded from adjusted line stats; nil excludes nothing.
+	Paths *pathclass.Classifier
+	// Mailmap overrides author and committer identities; nil overrides nothing.
+	Mailmap *identity.Mailmap
+	// Bots flags commits authored by bots; nil flags none.
+	Bots *botclass.Classifier
+	// Anomalies records outlier commits (capping them when Anomalies.Cap is set); nil records none.
+	Anomalies *anomaly.Detector
+}
+
+// commitPipeline fetches the commits of jobs and stores them, shared by Consumer and BatchConsumer.
+type commitPipeline struct {
 	store   store.Store
 	fetcher CommitStatsFetcher
-	jobs    <-chan CommitJob
+	opts    ConsumerOptions
 	log     *slog.Logger
 }
 
+// fetch fetches the stats of job and maps them to its rows and its anomalies row (nil unless an outlier).
+// Returns a nil commit when the stats could not be fetched.
+func (p *commitPipeline) fetch(ctx context.Context, job CommitJob) (*store.CommitRow, *store.AnomalyRow) {
+	stats, err := p.fetcher.GetCommitStats(ctx, job.Owner, job.Repo, job.SHA)
+	if err != nil {
+		if errors.Is(err, github.ErrNotFound) {
+			p.log.Debug("commit not found, skipping", "repo", job.Repo, "sha", job.SHA)
+			return nil, nil
+		}
+		p.log.Warn("get commit stats", "repo", job.Repo, "sha", job.SHA, "err", err)
+		return nil, nil
+	}
+	files := commitFileRows(stats, p.opts.Paths)
+	langs := commitLanguageRows(files)
+	row := commitStatsRow(job, stats, files, p.opts.Bots)
+	anom := checkAnomaly(row, langs, p.opts.Anomalies)
+	return &store.CommitRow{Stats: row, Files: files, Languages: langs, Identities: commitIdentityRows(stats, p.opts.Mailmap)}, anom
+}
+
+// save inserts commits with a single InsertCommits call and records the anomalies of the new ones (anoms[i]
+// is the anomalies row of commits[i]). Commits seen before are moved to their canonical repo. Returns the
+// number of commits inserted.
+func (p *commitPipeline) save(ctx context.Context, commits []*store.CommitRow, anoms []*store.AnomalyRow) int {
+	if len(commits) == 0 {
+		return 0
+	}
+	inserted, err := p.store.InsertCommits(ctx, commits)
+	if err != nil {
+		p.log.Warn("insert commits", "rows", len(commits), "err", err)
+		return 0
+	}
+	n := 0
+	var seen []string
+	for i, ok := range inserted {
+		row := commits[i].Stats
+		if !ok {
+			// Seen before, possibly in another repo (a fork or its upstream): keep it in its canonical repo.
+			seen = append(seen, row.Sha)
+			continue
+		}
+		n++
+		p.log.Debug("commit stats saved", "repo", row.Repo, "sha", row.Sha, "net", row.Net)
+		recordAnomaly(ctx, p.store, p.log, p.opts.Anomalies, row, anoms[i])
+	}
+	canonicalize(ctx, p.store, p.log, seen)
+	return n
+}
+
+// Consumer processes commit jobs: fetch stats and persist. Depends only on Store interface.
+type Consumer struct {
+	commitPipeline
+	jobs    <-chan CommitJob
+	latency ewma
+}
+
 // NewConsumer returns a consumer that reads jobs from the given channel.
-func NewConsumer(s store.Store, f CommitStatsFetcher, jobs <-chan CommitJob) *Consumer {
-	return &Consumer{store: s, fetcher: f, jobs: jobs, log: slog.Default()}
+func NewConsumer(s store.Store, f CommitStatsFetcher, jobs <-chan CommitJob, opts ConsumerOptions) *Consumer {
+	return &Consumer{commitPipeline: commitPipeline{store: s, fetcher: f, opts: opts, log: slog.Default()}, jobs: jobs}
 }
 
 // Run starts one worker. Call N times for N workers.
 func (c *Consumer) Run(ctx context.Context) {
+	c.RunUntil(ctx, nil)
+}
+
+// RunUntil runs one worker like Run until stop is closed; the job in progress is finished first.
+func (c *Consumer) RunUntil(ctx context.Context, stop <-chan struct{}) {
 	for {
 		select {
 		case <-ctx.Done():
 			c.log.Debug("consumer worker stopping")
 			return
+		case <-stop:
+			c.log.Debug("consumer worker stopped")
+			return
 		case job, ok := <-c.jobs:
 			if !ok {
 				c.log.Debug("consumer jobs channel closed")
 				return
 			}
+			start := time.Now()
 			c.process(ctx, job)
+			c.latency.observe(time.Since(start))
 		}
 	}
 }
 
+// JobLatency returns the moving average of the time its workers take to process a job.
+func (c *Consumer) JobLatency() time.Duration {
+	return c.latency.value()
+}
+
 func (c *Consumer) process(ctx context.Context, job CommitJob) {
-	stats, err := c.fetcher.GetCommitStats(ctx, job.Owner, job.Repo, job.SHA)
+	commit, anom := c.fetch(ctx, job)
+	if commit == nil {
+		return
+	}
+	c.save(ctx, []*store.CommitRow{commit}, []*store.AnomalyRow{anom})
+}
+
+// canonicalize attributes the given already stored commits to their canonical repo (see store.Store.CanonicalizeRepos).
+func canonicalize(ctx context.Context, s store.Store, log *slog.Logger, shas []string) {
+	if len(shas) == 0 {
+		return
+	}
+	n, err := s.CanonicalizeCommits(ctx, shas)
 	if err != nil {
-		if errors.Is(err, github.ErrNotFound) {
-			c.log.Debug("commit not found, skipping", "repo", job.Repo, "sha", job.SHA)
-			return
+		log.Warn("canonicalize commits", "commits", len(shas), "err", err)
+		return
+	}
+	if n > 0 {
+		log.Debug("commits moved to their canonical repo", "commits", n)
+	}
+}
+
+// checkAnomaly returns the anomalies row of a commit whose size is an outlier, or nil. When anoms.Cap is set,
+// it caps the lines of row and langs (the commit's language rows) counted by aggregates at the outlier limit.
+func checkAnomaly(row *store.CommitStatsRow, langs []*store.CommitLanguageRow, anoms *anomaly.Detector) *store.AnomalyRow {
+	f := anoms.Check(row.Repo, row.Additions+row.Deletions)
+	if f == nil {
+		return nil
+	}
+	capped := anoms.Cap && capLines(row, langs, f.Limit)
+	return &store.AnomalyRow{
+		Sha:         row.Sha,
+		Repo:        row.Repo,
+		Author:      row.Author,
+		CommittedAt: row.CommittedAt,
+		DetectedAt:  time.Now(),
+		Additions:   row.Additions,
+		Deletions:   row.Deletions,
+		Method:      f.Method,
+		Baseline:    f.Baseline,
+		Samples:     f.Samples,
+		Score:       f.Score,
+		Limit:       f.Limit,
+		Capped:      capped,
+	}
+}
+
+// capLines scales the lines of a commit counted by aggregates down so they sum to at most limit: its raw
+// lines into CappedAdditions and CappedDeletions (Additions and Deletions keep the commit's real size), its
+// adjusted lines and its language rows in place. Returns false when the commit was within limit already.
+func capLines(row *store.CommitStatsRow, langs []*store.CommitLanguageRow, limit int64) bool {
+	raw, adjusted := row.Additions+row.Deletions, row.AdjustedAdditions+row.AdjustedDeletions
+	if raw <= limit && adjusted <= limit {
+		return false
+	}
+	if raw > limit {
+		row.Capped = true
+		row.CappedAdditions = scaleLines(row.Additions, limit, raw)
+		row.CappedDeletions = limit - row.CappedAdditions
+		for _, l := range langs {
+			l.Additions = scaleLines(l.Additions, limit, raw)
+			l.Deletions = scaleLines(l.Deletions, limit, raw)
+		}
+	}
+	if adjusted > limit {
+		row.AdjustedAdditions = scaleLines(row.AdjustedAdditions, limit, adjusted)
+		row.AdjustedDeletions = limit - row.AdjustedAdditions
+		row.AdjustedNet = row.AdjustedAdditions - row.AdjustedDeletions
+		for _, l := range langs {
+			l.AdjustedAdditions = scaleLines(l.AdjustedAdditions, limit, adjusted)
+			l.AdjustedDeletions = scaleLines(l.AdjustedDeletions, limit, adjusted)
 		}
-		c.log.Warn("get commit stats", "repo", job.Repo, "sha", job.SHA, "err", err)
+	}
+	return true
+}
+
+// scaleLines returns n scaled by limit/total, rounded.
+func scaleLines(n, limit, total int64) int64 {
+	return int64(math.Round(float64(n) * float64(limit) / float64(total)))
+}
+
+// recordAnomaly stores the anomalies row of a newly inserted commit, or adds the commit to the baselines
+// when it is not an outlier, so outliers do not inflate them.
+func recordAnomaly(ctx context.Context, s store.Store, log *slog.Logger, anoms *anomaly.Detector, row *store.CommitStatsRow, anom *store.AnomalyRow) {
+	if anom == nil {
+		anoms.Observe(row.Repo, row.Additions+row.Deletions)
 		return
 	}
+	log.Info("outlier commit", "repo", row.Repo, "sha", row.Sha, "lines", row.Additions+row.Deletions,
+		"limit", anom.Limit, "baseline", anom.Baseline, "score", anom.Score)
+	if _, err := s.InsertAnomaly(ctx, anom); err != nil {
+		log.Warn("insert anomaly", "sha", row.Sha, "err", err)
+	}
+}
+
+// commitIdentityRows maps the author and committer of a commit to commit_identities rows, with their
+// canonical identity (mailmap overrides, then normalization) and merge keys.
+func commitIdentityRows(stats *github.CommitStats, mailmap *identity.Mailmap) []*store.CommitIdentityRow {
+	roles := []struct {
+		role string
+		id   github.CommitIdentity
+	}{
+		{store.RoleAuthor, stats.AuthorIdentity},
+		{store.RoleCommitter, stats.Committer},
+	}
+	rows := make([]*store.CommitIdentityRow, 0, len(roles))
+	for _, r := range roles {
+		canonical := mailmap.Canonical(identity.Identity{Name: r.id.Name, Email: r.id.Email, Login: r.id.Login})
+		keys := canonical.Keys()
+		if len(keys) == 0 {
+			continue
+		}
+		rows = append(rows, &store.CommitIdentityRow{
+			Sha:       stats.SHA,
+			Role:      r.role,
+			Name:      r.id.Name,
+			Email:     r.id.Email,
+			Login:     r.id.Login,
+			Canonical: store.AuthorRow{Name: canonical.Name, Email: canonical.Email, Login: canonical.Login},
+			Keys:      keys,
+		})
+	}
+	return rows
+}
+
+// commitStatsRow maps fetched commit stats for a job to its commit_stats row.
+// Adjusted lines subtract the lines of excluded files from the raw stats; bots classifies the author.
+func commitStatsRow(job CommitJob, stats *github.CommitStats, files []*store.CommitFileRow, bots *botclass.Classifier) *store.CommitStatsRow {
+	author := stats.AuthorIdentity
 	row := &store.CommitStatsRow{
-		Sha:         stats.SHA,
-		Repo:        job.Owner + "/" + job.Repo,
-		Author:      stats.Author,
-		CommittedAt: stats.CommittedAt,
-		Additions:   stats.Additions,
-		Deletions:   stats.Deletions,
-		Total:       stats.Total,
-		Net:         stats.Net,
-	}
-	inserted, err := c.store.InsertCommitStats(ctx, row)
-	if err != nil {
-		c.log.Warn("insert commit stats", "sha", job.SHA, "err", err)
-		return
+		Sha:               stats.SHA,
+		Repo:              job.Owner + "/" + job.Repo,
+		Author:            stats.Author,
+		CommittedAt:       stats.CommittedAt,
+		Additions:         stats.Additions,
+		Deletions:         stats.Deletions,
+		Total:             stats.Total,
+		Net:               stats.Net,
+		AdjustedAdditions: stats.Additions,
+		AdjustedDeletions: stats.Deletions,
+		ParentCount:       len(stats.Parents),
+		IsMerge:           stats.IsMerge(),
+		IsBot:             bots.Author(author.Name, author.Email, author.Login, author.Type),
 	}
-	if inserted {
-		c.log.Debug("commit stats saved", "repo", row.Repo, "sha", job.SHA, "net", row.Net)
+	for _, f := range files {
+		if f.Excluded {
+			row.AdjustedAdditions -= f.Additions
+			row.AdjustedDeletions -= f.Deletions
+		}
+	}
+	row.AdjustedNet = row.AdjustedAdditions - row.AdjustedDeletions
+	return row
+}
+
+// commitFileRows maps the per-file stats of a commit to its commit_files rows, flagging excluded paths.
+func commitFileRows(stats *github.CommitStats, paths *pathclass.Classifier) []*store.CommitFileRow {
+	rows := make([]*store.CommitFileRow, 0, len(stats.Files))
+	for _, f := range stats.Files {
+		rows = append(rows, &store.CommitFileRow{
+			Sha:              stats.SHA,
+			Filename:         f.Filename,
+			PreviousFilename: f.PreviousFilename,
+			Status:           f.Status,
+			Additions:        f.Additions,
+			Deletions:        f.Deletions,
+			Changes:          f.Changes,
+			Excluded:         paths.Excluded(f.Filename),
+		})
+	}
+	return rows
+}
+
+// commitLanguageRows sums file rows per commit and language. Excluded files only count towards raw lines.
+func commitLanguageRows(files []*store.CommitFileRow) []*store.CommitLanguageRow {
+	type key struct{ sha, lang string }
+	byKey := make(map[key]*store.CommitLanguageRow)
+	var rows []*store.CommitLanguageRow
+	for _, f := range files {
+		k := key{f.Sha, language.Detect(f.Filename)}
+		row, ok := byKey[k]
+		if !ok {
+			row = &store.CommitLanguageRow{Sha: k.sha, Language: k.lang}
+			byKey[k] = row
+			rows = append(rows, row)
+		}
+		row.Files++
+		row.Additions += f.Additions
+		row.Deletions += f.Deletions
+		if !f.Excluded {
+			row.AdjustedAdditions += f.Additions
+			row.AdjustedDeletions += f.Deletions
+		}
 	}
+	return rows
 }
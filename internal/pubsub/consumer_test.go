@@ -2,10 +2,16 @@ package pubsub
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/challenge-github-events/internal/anomaly"
+	"github.com/challenge-github-events/internal/botclass"
 	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/identity"
+	"github.com/challenge-github-events/internal/pathclass"
 	"github.com/challenge-github-events/internal/store"
 	"go.uber.org/mock/gomock"
 )
@@ -17,7 +23,6 @@ func TestConsumer_ProcessJob_InsertsStats(t *testing.T) {
 	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
 	ctx := context.Background()
 
-	var capturedRow *store.CommitStatsRow
 	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha1").Return(&github.CommitStats{
 		SHA:         "sha1",
 		Additions:   10,
@@ -26,26 +31,48 @@ func TestConsumer_ProcessJob_InsertsStats(t *testing.T) {
 		Net:         7,
 		Author:      "author",
 		CommittedAt: time.Now(),
+		Files:       []github.CommitFile{{Filename: "main.go", Status: "modified", Additions: 10, Deletions: 3, Changes: 13}},
 	}, nil)
-	mockStore.EXPECT().InsertCommitStats(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, row *store.CommitStatsRow) (bool, error) {
-		capturedRow = row
-		return true, nil
-	})
+	captured := captureCommit(mockStore, true)
 
 	jobs := make(chan CommitJob, 1)
-	cons := NewConsumer(mockStore, mockFetcher, jobs)
+	cons := NewConsumer(mockStore, mockFetcher, jobs, ConsumerOptions{})
 	jobs <- CommitJob{EventID: "e1", Owner: "o", Repo: "r", SHA: "sha1"}
 	close(jobs)
 
 	cons.Run(ctx)
 
+	capturedRow, capturedFiles := captured.Stats, captured.Files
 	if capturedRow == nil {
-		t.Fatal("InsertCommitStats was not called")
+		t.Fatal("InsertCommits was not called")
 	}
 	if capturedRow.Sha != "sha1" || capturedRow.Repo != "o/r" || capturedRow.Additions != 10 || capturedRow.Deletions != 3 || capturedRow.Net != 7 {
 		t.Errorf("inserted want sha=sha1 repo=o/r add=10 del=3 net=7 got sha=%s repo=%s add=%d del=%d net=%d",
 			capturedRow.Sha, capturedRow.Repo, capturedRow.Additions, capturedRow.Deletions, capturedRow.Net)
 	}
+	if len(capturedFiles) != 1 || capturedFiles[0].Sha != "sha1" || capturedFiles[0].Filename != "main.go" || capturedFiles[0].Additions != 10 {
+		t.Errorf("commit files want [sha1 main.go add=10] got %+v", capturedFiles)
+	}
+}
+
+func TestConsumer_ProcessJob_StoresNothingWhenInsertFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha1").Return(&github.CommitStats{
+		SHA:   "sha1",
+		Files: []github.CommitFile{{Filename: "main.go", Additions: 1}},
+	}, nil)
+	// The commit and its details are written together: no separate detail writes, and nothing more on error.
+	mockStore.EXPECT().InsertCommits(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection reset"))
+
+	jobs := make(chan CommitJob, 1)
+	cons := NewConsumer(mockStore, mockFetcher, jobs, ConsumerOptions{})
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha1"}
+	close(jobs)
+	cons.Run(context.Background())
 }
 
 func TestConsumer_ProcessJob_Skips404(t *testing.T) {
@@ -56,12 +83,244 @@ func TestConsumer_ProcessJob_Skips404(t *testing.T) {
 	ctx := context.Background()
 
 	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha").Return(nil, github.ErrNotFound)
-	// InsertCommitStats must not be called
+	// InsertCommits must not be called
 
 	jobs := make(chan CommitJob, 1)
-	cons := NewConsumer(mockStore, mockFetcher, jobs)
+	cons := NewConsumer(mockStore, mockFetcher, jobs, ConsumerOptions{})
 	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha"}
 	close(jobs)
 
 	cons.Run(ctx)
 }
+
+func TestConsumer_ProcessJob_CanonicalizesKnownCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "up", "lib", "sha1").Return(&github.CommitStats{SHA: "sha1", Additions: 1, Net: 1}, nil)
+	captureCommit(mockStore, false)
+	mockStore.EXPECT().CanonicalizeCommits(gomock.Any(), []string{"sha1"}).Return(int64(1), nil)
+
+	jobs := make(chan CommitJob, 1)
+	cons := NewConsumer(mockStore, mockFetcher, jobs, ConsumerOptions{})
+	jobs <- CommitJob{EventID: "e2", Owner: "up", Repo: "lib", SHA: "sha1"}
+	close(jobs)
+
+	cons.Run(context.Background())
+}
+
+func TestConsumer_ProcessJob_AdjustsExcludedFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+	ctx := context.Background()
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha1").Return(&github.CommitStats{
+		SHA:       "sha1",
+		Additions: 1010,
+		Deletions: 505,
+		Total:     1515,
+		Net:       505,
+		Files: []github.CommitFile{
+			{Filename: "main.go", Additions: 10, Deletions: 5},
+			{Filename: "package-lock.json", Additions: 1000, Deletions: 500},
+		},
+	}, nil)
+	captured := captureCommit(mockStore, true)
+
+	jobs := make(chan CommitJob, 1)
+	cons := NewConsumer(mockStore, mockFetcher, jobs, ConsumerOptions{Paths: pathclass.New(pathclass.DefaultRules)})
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha1"}
+	close(jobs)
+
+	cons.Run(ctx)
+
+	capturedRow, capturedFiles, capturedLangs := captured.Stats, captured.Files, captured.Languages
+	if capturedRow == nil {
+		t.Fatal("InsertCommits was not called")
+	}
+	if capturedRow.Net != 505 || capturedRow.AdjustedAdditions != 10 || capturedRow.AdjustedDeletions != 5 || capturedRow.AdjustedNet != 5 {
+		t.Errorf("want net=505 adjusted add=10 del=5 net=5 got net=%d adjusted add=%d del=%d net=%d",
+			capturedRow.Net, capturedRow.AdjustedAdditions, capturedRow.AdjustedDeletions, capturedRow.AdjustedNet)
+	}
+	if len(capturedFiles) != 2 || capturedFiles[0].Excluded || !capturedFiles[1].Excluded {
+		t.Errorf("want package-lock.json excluded only got %+v", capturedFiles)
+	}
+	if len(capturedLangs) != 2 {
+		t.Fatalf("languages want 2 (Go, JSON) got %d", len(capturedLangs))
+	}
+	if l := capturedLangs[1]; l.Language != "JSON" || l.Additions != 1000 || l.AdjustedAdditions != 0 {
+		t.Errorf("JSON want add=1000 adjusted add=0 got %s add=%d adjusted add=%d", l.Language, l.Additions, l.AdjustedAdditions)
+	}
+}
+
+func TestConsumer_ProcessJob_SavesIdentities(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+	ctx := context.Background()
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha1").Return(&github.CommitStats{
+		SHA:            "sha1",
+		Author:         "mona",
+		AuthorIdentity: github.CommitIdentity{Name: "mona", Email: "Mona@Laptop.example.com"},
+		Committer:      github.CommitIdentity{Name: "GitHub", Email: "noreply@github.com", Login: "web-flow"},
+	}, nil)
+	commit := captureCommit(mockStore, true)
+
+	mailmap, err := identity.ParseMailmap(strings.NewReader("Mona Lisa <mona@example.com> <mona@laptop.example.com>\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := make(chan CommitJob, 1)
+	cons := NewConsumer(mockStore, mockFetcher, jobs, ConsumerOptions{Mailmap: mailmap})
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha1"}
+	close(jobs)
+
+	cons.Run(ctx)
+
+	captured := commit.Identities
+	if len(captured) != 2 {
+		t.Fatalf("identities want author and committer got %d", len(captured))
+	}
+	author, committer := captured[0], captured[1]
+	if author.Role != store.RoleAuthor || author.Email != "Mona@Laptop.example.com" ||
+		author.Canonical != (store.AuthorRow{Name: "Mona Lisa", Email: "mona@example.com"}) ||
+		len(author.Keys) != 1 || author.Keys[0] != "email:mona@example.com" {
+		t.Errorf("author want mailmapped to Mona Lisa <mona@example.com> got %+v", author)
+	}
+	if committer.Role != store.RoleCommitter || len(committer.Keys) != 1 || committer.Keys[0] != "login:web-flow" {
+		t.Errorf("committer want keyed by login web-flow got %+v", committer)
+	}
+}
+
+func TestConsumer_ProcessJob_FlagsBotAuthors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "sha1").Return(&github.CommitStats{
+		SHA:            "sha1",
+		Author:         "some-app",
+		AuthorIdentity: github.CommitIdentity{Name: "some-app", Login: "some-app", Type: "Bot"},
+	}, nil)
+	commit := captureCommit(mockStore, true)
+
+	jobs := make(chan CommitJob, 1)
+	cons := NewConsumer(mockStore, mockFetcher, jobs, ConsumerOptions{Bots: botclass.New(nil, nil, 0, time.Minute)})
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "sha1"}
+	close(jobs)
+	cons.Run(context.Background())
+
+	if captured := commit.Stats; captured == nil || !captured.IsBot {
+		t.Errorf("commit by Bot account want is_bot got %+v", captured)
+	}
+}
+
+func TestConsumer_ProcessJob_RecordsAndCapsOutliers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+
+	anoms, err := anomaly.New(anomaly.MethodZScore, 4, 100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anoms.Cap = true
+	for i := 0; i < 40; i++ {
+		anoms.Observe("o/r", int64(10+i*5))
+	}
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "big").Return(&github.CommitStats{
+		SHA:       "big",
+		Additions: 2_000_000,
+		Total:     2_000_000,
+		Net:       2_000_000,
+		Files: []github.CommitFile{
+			{Filename: "gen.go", Additions: 1_500_000},
+			{Filename: "data.sql", Additions: 500_000},
+		},
+	}, nil)
+	commit := captureCommit(mockStore, true)
+	var anom *store.AnomalyRow
+	mockStore.EXPECT().InsertAnomaly(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, a *store.AnomalyRow) (bool, error) {
+		anom = a
+		return true, nil
+	})
+
+	jobs := make(chan CommitJob, 1)
+	cons := NewConsumer(mockStore, mockFetcher, jobs, ConsumerOptions{Anomalies: anoms})
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "big"}
+	close(jobs)
+	cons.Run(context.Background())
+
+	row, langs := commit.Stats, commit.Languages
+	if anom == nil || anom.Sha != "big" || anom.Additions != 2_000_000 || anom.Baseline != anomaly.BaselineRepo || !anom.Capped {
+		t.Fatalf("want capped anomaly of big against the repo baseline got %+v", anom)
+	}
+	if row.Net != 2_000_000 || row.AdjustedAdditions != anom.Limit || row.AdjustedNet != anom.Limit {
+		t.Errorf("want raw net 2000000 and adjusted lines capped at %d got net=%d adjusted add=%d net=%d",
+			anom.Limit, row.Net, row.AdjustedAdditions, row.AdjustedNet)
+	}
+	if !row.Capped || row.CappedAdditions != anom.Limit || row.CappedDeletions != 0 {
+		t.Errorf("want raw lines counted as %d capped additions got %+v", anom.Limit, row)
+	}
+	var langAdditions, langAdjusted int64
+	for _, l := range langs {
+		langAdditions += l.Additions
+		langAdjusted += l.AdjustedAdditions
+	}
+	if len(langs) != 2 || langAdjusted < anom.Limit-1 || langAdjusted > anom.Limit+1 || langAdditions < anom.Limit-1 || langAdditions > anom.Limit+1 {
+		t.Errorf("language additions want about %d got %d (adjusted %d) in %d languages", anom.Limit, langAdditions, langAdjusted, len(langs))
+	}
+}
+
+func TestConsumer_ProcessJob_FlagsOutlierWithoutCap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockFetcher := github.NewMockCommitStatsFetcher(ctrl)
+
+	anoms, err := anomaly.New(anomaly.MethodZScore, 4, 100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		anoms.Observe("o/r", int64(10+i*5))
+	}
+
+	mockFetcher.EXPECT().GetCommitStats(gomock.Any(), "o", "r", "big").Return(&github.CommitStats{SHA: "big", Additions: 2_000_000, Total: 2_000_000, Net: 2_000_000}, nil)
+	commit := captureCommit(mockStore, true)
+	var anom *store.AnomalyRow
+	mockStore.EXPECT().InsertAnomaly(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, a *store.AnomalyRow) (bool, error) {
+		anom = a
+		return true, nil
+	})
+
+	jobs := make(chan CommitJob, 1)
+	cons := NewConsumer(mockStore, mockFetcher, jobs, ConsumerOptions{Anomalies: anoms})
+	jobs <- CommitJob{Owner: "o", Repo: "r", SHA: "big"}
+	close(jobs)
+	cons.Run(context.Background())
+
+	if row := commit.Stats; anom == nil || anom.Capped || row.Capped || row.AdjustedAdditions != 2_000_000 {
+		t.Errorf("without ANOMALY_CAP want an uncapped anomaly and row got %+v and %+v", anom, row)
+	}
+}
+
+// captureCommit expects one InsertCommits call with a single commit, reporting it inserted or not, and
+// returns the commit once the call was made.
+func captureCommit(s *store.MockStore, inserted bool) *store.CommitRow {
+	c := new(store.CommitRow)
+	s.EXPECT().InsertCommits(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, commits []*store.CommitRow) ([]bool, error) {
+		*c = *commits[0]
+		return []bool{inserted}, nil
+	})
+	return c
+}
@@ -0,0 +1,275 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MaxWorkers is the largest consumer pool a Controller scales to.
+const MaxWorkers = 256
+
+// drainPoll is how often a drain checks whether the producer is idle and the jobs queue empty.
+const drainPoll = 100 * time.Millisecond
+
+// RestartDelay is how long a worker that panicked waits before it is restarted.
+const RestartDelay = time.Second
+
+var (
+	// ErrAutoscaleSuspended is returned by Autoscale after a manual Scale, until ResumeAutoscaling.
+	ErrAutoscaleSuspended = errors.New("autoscaling suspended by a manual scale")
+	// ErrPoolChanged is returned by Autoscale when the pool was resized, paused or drained since it was evaluated.
+	ErrPoolChanged = errors.New("worker pool changed since it was evaluated")
+)
+
+// Worker consumes commit jobs (Consumer or BatchConsumer).
+type Worker interface {
+	// RunUntil runs one worker until ctx is cancelled, the jobs channel is closed or stop is closed,
+	// finishing the jobs it has taken on stop.
+	RunUntil(ctx context.Context, stop <-chan struct{})
+}
+
+// ControllerStatus is a snapshot of the pipeline.
+type ControllerStatus struct {
+	Producer      string // ProducerRunning, ProducerPausing or ProducerPaused
+	Workers       int    // target size of the worker pool
+	Running       int    // workers still running, including those finishing their jobs after a scale down
+	QueueDepth    int
+	QueueCapacity int
+	QueuePending  int // skipped or spilled jobs waiting to be replayed
+	Draining      bool
+	Drained       bool  // drained and the workers stopped; Resume restarts them
+	Restarts      int64 // workers restarted after a panic since Start
+	// AutoscaleSuspended is set by a manual Scale and cleared by ResumeAutoscaling.
+	AutoscaleSuspended bool
+}
+
+// Controller runs the producer and a pool of consumer workers, and lets operators pause and resume
+// polling, resize the pool and drain the pipeline while the process keeps running.
+type Controller struct {
+	prod     *Producer
+	worker   Worker
+	queue    *Queue
+	log      *slog.Logger
+	running  atomic.Int64
+	restarts atomic.Int64
+	wg       sync.WaitGroup
+	// restartDelay is RestartDelay; tests shorten it.
+	restartDelay time.Duration
+
+	mu       sync.Mutex
+	ctx      context.Context
+	stopProd context.CancelFunc
+	prodDone chan struct{}   // closed once the producer and the queue's replay have stopped
+	stops    []chan struct{} // one per worker of the pool
+	draining bool
+	drained  bool
+	restore  int  // pool size before the drain
+	manual   bool // a manual Scale suspended autoscaling
+}
+
+// NewController returns a controller of prod and of workers reading from queue (the queue prod enqueues on).
+func NewController(prod *Producer, worker Worker, queue *Queue) *Controller {
+	return &Controller{prod: prod, worker: worker, queue: queue, restartDelay: RestartDelay, log: slog.Default()}
+}
+
+// Start runs the producer, the queue's replay and workers workers until Stop or until ctx is cancelled.
+func (c *Controller) Start(ctx context.Context, workers int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ctx = ctx
+	prodCtx, cancel := context.WithCancel(ctx)
+	c.stopProd = cancel
+	c.prodDone = make(chan struct{})
+	go func() {
+		defer close(c.prodDone)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.queue.Run(prodCtx)
+		}()
+		c.prod.Run(prodCtx)
+		wg.Wait()
+	}()
+	c.scale(min(max(workers, 0), MaxWorkers))
+}
+
+// Stop stops the producer, closes the jobs queue and waits for the workers to finish the queued jobs.
+func (c *Controller) Stop() {
+	c.mu.Lock()
+	c.stopProd()
+	c.draining = false
+	c.mu.Unlock()
+	<-c.prodDone
+	c.queue.Close()
+	c.wg.Wait()
+	c.log.Info("consumer workers stopped")
+}
+
+// Pause pauses polling; queued jobs are still consumed.
+func (c *Controller) Pause() {
+	c.prod.Pause()
+}
+
+// Resume resumes polling, cancelling a drain in progress or restarting the workers stopped by a drain.
+func (c *Controller) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.draining = false
+	if c.drained {
+		c.drained = false
+		c.scale(c.restore)
+	}
+	c.prod.Resume()
+}
+
+// Scale resizes the worker pool to n workers. Stopped workers finish their current jobs first. A manual
+// resize takes precedence over the autoscaler: Autoscale fails until ResumeAutoscaling.
+func (c *Controller) Scale(n int) error {
+	if n < 0 || n > MaxWorkers {
+		return fmt.Errorf("workers must be between 0 and %d", MaxWorkers)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drained = false
+	c.manual = true
+	c.scale(n)
+	return nil
+}
+
+// Autoscale resizes the worker pool from the from workers it was evaluated with to to workers. It fails
+// with ErrAutoscaleSuspended after a manual Scale, and with ErrPoolChanged when the pool no longer has from
+// workers, or polling was paused or a drain started since, so it never undoes an operator's action.
+func (c *Controller) Autoscale(from, to int) error {
+	if to < 0 || to > MaxWorkers {
+		return fmt.Errorf("workers must be between 0 and %d", MaxWorkers)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.manual {
+		return ErrAutoscaleSuspended
+	}
+	if len(c.stops) != from || c.draining || c.drained || c.prod.State() != ProducerRunning {
+		return ErrPoolChanged
+	}
+	c.scale(to)
+	return nil
+}
+
+// ResumeAutoscaling lets the autoscaler resize the pool again after a manual Scale.
+func (c *Controller) ResumeAutoscaling() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.manual = false
+}
+
+// scale starts or stops workers until the pool has n. A worker that panics is restarted after
+// RestartDelay; the job it was processing is lost. Requires c.mu.
+func (c *Controller) scale(n int) {
+	from := len(c.stops)
+	for len(c.stops) < n {
+		stop := make(chan struct{})
+		c.stops = append(c.stops, stop)
+		c.running.Add(1)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer c.running.Add(-1)
+			for c.runWorker(stop) {
+				c.restarts.Add(1)
+				select {
+				case <-c.ctx.Done():
+					return
+				case <-stop:
+					return
+				case <-time.After(c.restartDelay):
+				}
+			}
+		}()
+	}
+	for len(c.stops) > n {
+		close(c.stops[len(c.stops)-1])
+		c.stops = c.stops[:len(c.stops)-1]
+	}
+	if n != from {
+		c.log.Info("consumer workers scaled", "from", from, "to", n)
+	}
+}
+
+// runWorker runs one worker until it returns. Returns true when it panicked.
+func (c *Controller) runWorker(stop <-chan struct{}) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.log.Error("consumer worker panicked, restarting", "panic", r, "stack", string(debug.Stack()))
+			panicked = true
+		}
+	}()
+	c.worker.RunUntil(c.ctx, stop)
+	return false
+}
+
+// Drain pauses polling, waits for the producer to finish its current poll and for the workers to empty
+// the jobs queue, including skipped or spilled jobs, then stops the workers. It returns at once; Status
+// reports its progress.
+func (c *Controller) Drain() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.draining || c.drained {
+		return
+	}
+	c.draining = true
+	c.prod.Pause()
+	c.log.Info("draining")
+	go c.drain()
+}
+
+func (c *Controller) drain() {
+	ticker := time.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for {
+		c.mu.Lock()
+		if !c.draining {
+			c.mu.Unlock()
+			return
+		}
+		if c.prod.State() == ProducerPaused && c.queue.Len() == 0 && c.queue.Pending() == 0 {
+			c.restore = len(c.stops)
+			c.draining, c.drained = false, true
+			c.scale(0)
+			c.mu.Unlock()
+			c.log.Info("drained", "workers", c.restore)
+			return
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns the current state of the pipeline.
+func (c *Controller) Status() ControllerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	running := int(c.running.Load())
+	return ControllerStatus{
+		Producer:           c.prod.State(),
+		Workers:            len(c.stops),
+		Running:            running,
+		QueueDepth:         c.queue.Len(),
+		QueueCapacity:      c.queue.Cap(),
+		QueuePending:       c.queue.Pending(),
+		Draining:           c.draining || (c.drained && running > 0),
+		Drained:            c.drained && running == 0,
+		Restarts:           c.restarts.Load(),
+		AutoscaleSuspended: c.manual,
+	}
+}
@@ -0,0 +1,159 @@
+package pubsub
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+// slowWorker takes jobs from jobs and spends delay on each.
+type slowWorker struct {
+	jobs  <-chan CommitJob
+	delay time.Duration
+	done  atomic.Int64
+}
+
+func (w *slowWorker) RunUntil(ctx context.Context, stop <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case _, ok := <-w.jobs:
+			if !ok {
+				return
+			}
+			time.Sleep(w.delay)
+			w.done.Add(1)
+		}
+	}
+}
+
+// waitFor fails the test unless cond holds within 2s.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestController_PauseStopsPollingUntilResume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
+	var polls atomic.Int64
+	mockFetcher := github.NewMockEventsFetcher(ctrl)
+	mockFetcher.EXPECT().FetchEvents(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(context.Context, string, string) ([]github.Event, string, error) {
+		polls.Add(1)
+		return nil, "", nil
+	}).AnyTimes()
+
+	queue := testQueue(t, 1)
+	prod := NewProducer(mockStore, mockFetcher, queue, 5*time.Millisecond, nil)
+	c := NewController(prod, &slowWorker{jobs: queue.Jobs()}, queue)
+	c.Pause()
+	c.Start(context.Background(), 1)
+	defer c.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if n := polls.Load(); n != 0 || c.Status().Producer != ProducerPaused {
+		t.Fatalf("paused producer want no polls got %d (%s)", n, c.Status().Producer)
+	}
+	c.Resume()
+	waitFor(t, "polls after resume", func() bool { return polls.Load() >= 2 })
+	if st := c.Status().Producer; st != ProducerRunning {
+		t.Errorf("producer want running got %s", st)
+	}
+}
+
+func TestController_ScaleDrainAndResume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
+	queue := testQueue(t, 20)
+	for i := 0; i < 20; i++ {
+		queue.jobs <- CommitJob{SHA: "sha"}
+	}
+	prod := NewProducer(mockStore, github.NewMockEventsFetcher(ctrl), queue, time.Hour, nil)
+	prod.SetSources()
+	w := &slowWorker{jobs: queue.Jobs(), delay: 10 * time.Millisecond}
+	c := NewController(prod, w, queue)
+	c.Start(context.Background(), 1)
+	defer c.Stop()
+
+	if err := c.Scale(MaxWorkers + 1); err == nil {
+		t.Error("scale above MaxWorkers want error")
+	}
+	if err := c.Scale(4); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.Status(); st.Workers != 4 || st.QueueCapacity != 20 {
+		t.Errorf("want 4 workers and capacity 20 got %+v", st)
+	}
+
+	c.Drain()
+	if st := c.Status(); !st.Draining || st.Producer != ProducerPaused {
+		t.Errorf("want draining with the producer paused got %+v", st)
+	}
+	waitFor(t, "drain", func() bool { return c.Status().Drained })
+	if st := c.Status(); st.Workers != 0 || st.Running != 0 || st.QueueDepth != 0 || st.Draining || w.done.Load() != 20 {
+		t.Errorf("want every job done and no worker left got %+v and %d jobs done", st, w.done.Load())
+	}
+
+	c.Resume()
+	if st := c.Status(); st.Workers != 4 || st.Drained || st.Producer != ProducerRunning {
+		t.Errorf("resume want 4 workers back and the producer running got %+v", st)
+	}
+}
+
+// panickyWorker panics on its first job and then behaves like slowWorker.
+type panickyWorker struct {
+	slowWorker
+	panicked atomic.Bool
+}
+
+func (w *panickyWorker) RunUntil(ctx context.Context, stop <-chan struct{}) {
+	if !w.panicked.Swap(true) {
+		<-w.jobs
+		panic("boom")
+	}
+	w.slowWorker.RunUntil(ctx, stop)
+}
+
+func TestController_RestartsPanickingWorker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
+	queue := testQueue(t, 4)
+	prod := NewProducer(mockStore, github.NewMockEventsFetcher(ctrl), queue, time.Hour, nil)
+	prod.SetSources()
+	w := &panickyWorker{slowWorker: slowWorker{jobs: queue.Jobs()}}
+	c := NewController(prod, w, queue)
+	c.restartDelay = time.Millisecond
+	c.Start(context.Background(), 1)
+	defer c.Stop()
+
+	for i := 0; i < 3; i++ {
+		queue.jobs <- CommitJob{SHA: "sha"}
+	}
+	waitFor(t, "restarted worker", func() bool { return w.done.Load() == 2 })
+	if st := c.Status(); st.Restarts != 1 || st.Running != 1 {
+		t.Errorf("want one restart and the worker running got %+v", st)
+	}
+}
@@ -0,0 +1,139 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+)
+
+// CommitComparer compares two commits of a repo (e.g. github.Client).
+type CommitComparer interface {
+	CompareCommits(ctx context.Context, owner, repo, base, head string) (*github.Comparison, error)
+	CompareAllCommits(ctx context.Context, owner, repo, base, head string) (*github.Comparison, error)
+}
+
+// ForcePushQueueSize is the number of pushes waiting for a force-push check before Enqueue drops them.
+const ForcePushQueueSize = 1000
+
+// ForcePushDetector detects pushes that rewrote history and records them via the Store.
+// A push is forced when its payload sets forced or, when compare is enabled, when
+// comparing before...head reports "diverged" or "behind".
+type ForcePushDetector struct {
+	store       store.Store
+	comparer    CommitComparer
+	compare     bool
+	markOrphans bool
+	pending     chan forcePushCheck
+	log         *slog.Logger
+}
+
+// forcePushCheck is a push waiting for Run.
+type forcePushCheck struct {
+	eventID, owner, repo string
+	payload              *github.PushEventPayload
+}
+
+// NewForcePushDetector returns a detector. compare also detects unflagged force pushes with one compare
+// call per push; markOrphans flags the commits discarded by a force push as orphaned. Both need cmp.
+func NewForcePushDetector(s store.Store, cmp CommitComparer, compare, markOrphans bool) *ForcePushDetector {
+	return &ForcePushDetector{
+		store: s, comparer: cmp, compare: compare, markOrphans: markOrphans,
+		pending: make(chan forcePushCheck, ForcePushQueueSize),
+		log:     slog.Default(),
+	}
+}
+
+// Enqueue queues the push for Run without blocking, so compare calls never stall the producer.
+// The push is dropped with a warning when the queue is full.
+func (d *ForcePushDetector) Enqueue(eventID, owner, repo string, payload *github.PushEventPayload) {
+	select {
+	case d.pending <- forcePushCheck{eventID: eventID, owner: owner, repo: repo, payload: payload}:
+	default:
+		d.log.Warn("force push queue full; push not checked", "event_id", eventID, "repo", owner+"/"+repo)
+	}
+}
+
+// Run checks queued pushes until ctx is cancelled.
+func (d *ForcePushDetector) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-d.pending:
+			d.Check(ctx, c.eventID, c.owner, c.repo, c.payload)
+		}
+	}
+}
+
+// Check records the push as a force push when history was rewritten. Errors are logged, not returned,
+// so detection never blocks ingestion of the push itself.
+func (d *ForcePushDetector) Check(ctx context.Context, eventID, owner, repo string, payload *github.PushEventPayload) {
+	head := payload.Tip()
+	if payload.Before == "" || head == "" || payload.Before == github.ZeroSHA || head == github.ZeroSHA {
+		return // ref created or deleted
+	}
+	fp := &store.ForcePushRow{
+		EventID:    eventID,
+		Repo:       owner + "/" + repo,
+		Before:     payload.Before,
+		Head:       head,
+		DetectedAt: time.Now().UTC(),
+	}
+	switch {
+	case payload.Forced:
+		fp.DetectedVia = "flag"
+	case d.compare && d.comparer != nil:
+		cmp, err := d.comparer.CompareCommits(ctx, owner, repo, payload.Before, head)
+		if err != nil {
+			if !errors.Is(err, github.ErrNotFound) {
+				d.log.Warn("compare push", "event_id", eventID, "repo", fp.Repo, "err", err)
+			}
+			return
+		}
+		if cmp.Status != "diverged" && cmp.Status != "behind" {
+			return
+		}
+		fp.DetectedVia = "compare"
+		fp.Status = cmp.Status
+	default:
+		return
+	}
+
+	if d.markOrphans && d.comparer != nil {
+		fp.Orphaned = d.orphan(ctx, owner, repo, fp)
+	}
+	if _, err := d.store.InsertForcePush(ctx, fp); err != nil {
+		d.log.Warn("insert force push", "event_id", eventID, "err", err)
+		return
+	}
+	d.log.Info("force push detected", "event_id", eventID, "repo", fp.Repo, "via", fp.DetectedVia, "orphaned", fp.Orphaned)
+}
+
+// orphan marks the commits reachable from before but not from head (head...before) as orphaned.
+func (d *ForcePushDetector) orphan(ctx context.Context, owner, repo string, fp *store.ForcePushRow) int {
+	discarded, err := d.comparer.CompareAllCommits(ctx, owner, repo, fp.Head, fp.Before)
+	if err != nil {
+		if !errors.Is(err, github.ErrNotFound) {
+			d.log.Warn("list discarded commits", "event_id", fp.EventID, "repo", fp.Repo, "err", err)
+		}
+		return 0
+	}
+	if len(discarded.Commits) < discarded.TotalCommits {
+		d.log.Warn("discarded commits list cut off; the rest stay counted", "event_id", fp.EventID, "repo", fp.Repo,
+			"listed", len(discarded.Commits), "total", discarded.TotalCommits)
+	}
+	shas := make([]string, 0, len(discarded.Commits))
+	for _, c := range discarded.Commits {
+		shas = append(shas, c.SHA)
+	}
+	n, err := d.store.MarkCommitsOrphaned(ctx, shas)
+	if err != nil {
+		d.log.Warn("mark commits orphaned", "event_id", fp.EventID, "err", err)
+		return 0
+	}
+	return int(n)
+}
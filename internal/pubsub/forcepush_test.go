@@ -0,0 +1,124 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+func TestForcePushDetector_FlaggedPushMarksOrphans(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockCmp := github.NewMockCommitComparer(ctrl)
+	ctx := context.Background()
+
+	// head...before lists the commits only reachable from the old tip.
+	mockCmp.EXPECT().CompareAllCommits(gomock.Any(), "o", "r", "new", "old").Return(&github.Comparison{
+		Status:  "ahead",
+		Commits: []github.PushCommit{{SHA: "gone1"}, {SHA: "gone2"}},
+	}, nil)
+	mockStore.EXPECT().MarkCommitsOrphaned(gomock.Any(), []string{"gone1", "gone2"}).Return(int64(2), nil)
+	var captured *store.ForcePushRow
+	mockStore.EXPECT().InsertForcePush(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, fp *store.ForcePushRow) (bool, error) {
+		captured = fp
+		return true, nil
+	})
+
+	d := NewForcePushDetector(mockStore, mockCmp, false, true)
+	d.Check(ctx, "e1", "o", "r", &github.PushEventPayload{Before: "old", Head: "new", Forced: true})
+
+	if captured == nil {
+		t.Fatal("InsertForcePush was not called")
+	}
+	if captured.DetectedVia != "flag" || captured.Repo != "o/r" || captured.Orphaned != 2 {
+		t.Errorf("want via=flag repo=o/r orphaned=2 got via=%s repo=%s orphaned=%d", captured.DetectedVia, captured.Repo, captured.Orphaned)
+	}
+}
+
+func TestForcePushDetector_CompareDiverged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockCmp := github.NewMockCommitComparer(ctrl)
+	ctx := context.Background()
+
+	mockCmp.EXPECT().CompareCommits(gomock.Any(), "o", "r", "old", "new").Return(&github.Comparison{Status: "diverged"}, nil)
+	var captured *store.ForcePushRow
+	mockStore.EXPECT().InsertForcePush(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, fp *store.ForcePushRow) (bool, error) {
+		captured = fp
+		return true, nil
+	})
+
+	d := NewForcePushDetector(mockStore, mockCmp, true, false)
+	d.Check(ctx, "e1", "o", "r", &github.PushEventPayload{Before: "old", Head: "new"})
+
+	if captured == nil || captured.DetectedVia != "compare" || captured.Status != "diverged" {
+		t.Errorf("want force push via compare with status diverged got %+v", captured)
+	}
+}
+
+func TestForcePushDetector_FastForwardIsIgnored(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockCmp := github.NewMockCommitComparer(ctrl)
+	ctx := context.Background()
+
+	mockCmp.EXPECT().CompareCommits(gomock.Any(), "o", "r", "old", "new").Return(&github.Comparison{Status: "ahead"}, nil)
+	// InsertForcePush must not be called
+
+	d := NewForcePushDetector(mockStore, mockCmp, true, true)
+	d.Check(ctx, "e1", "o", "r", &github.PushEventPayload{Before: "old", Head: "new"})
+	// New branch: nothing to compare
+	d.Check(ctx, "e2", "o", "r", &github.PushEventPayload{Before: github.ZeroSHA, Head: "new", Forced: true})
+}
+
+func TestForcePushDetector_EnqueueDoesNotBlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockCmp := github.NewMockCommitComparer(ctrl)
+
+	d := NewForcePushDetector(mockStore, mockCmp, true, false)
+	// Nothing runs the queue: Enqueue must drop the overflow instead of blocking.
+	for i := 0; i < ForcePushQueueSize+10; i++ {
+		d.Enqueue("e", "o", "r", &github.PushEventPayload{Before: "old", Head: "new"})
+	}
+	if len(d.pending) != ForcePushQueueSize {
+		t.Errorf("want %d queued got %d", ForcePushQueueSize, len(d.pending))
+	}
+}
+
+func TestForcePushDetector_RunChecksQueuedPushes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockCmp := github.NewMockCommitComparer(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockCmp.EXPECT().CompareCommits(gomock.Any(), "o", "r", "old", "new").Return(&github.Comparison{Status: "diverged"}, nil)
+	inserted := make(chan *store.ForcePushRow, 1)
+	mockStore.EXPECT().InsertForcePush(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, fp *store.ForcePushRow) (bool, error) {
+		inserted <- fp
+		return true, nil
+	})
+
+	d := NewForcePushDetector(mockStore, mockCmp, true, false)
+	go d.Run(ctx)
+	d.Enqueue("e1", "o", "r", &github.PushEventPayload{Before: "old", Head: "new"})
+
+	select {
+	case fp := <-inserted:
+		if fp.EventID != "e1" || fp.DetectedVia != "compare" {
+			t.Errorf("want e1 via compare got %+v", fp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued push was not checked")
+	}
+}
@@ -2,131 +2,299 @@ package pubsub
 
 import (
 	"context"
-	"encoding/json"
 	"log/slog"
-	"strings"
+	"sync"
 	"time"
 
+	"github.com/challenge-github-events/internal/botclass"
 	"github.com/challenge-github-events/internal/github"
 	"github.com/challenge-github-events/internal/store"
 )
 
 // EventsFetcher fetches GitHub events (e.g. github.Client).
 type EventsFetcher interface {
-	FetchEvents(ctx context.Context, etag string) (events []github.Event, newEtag string, err error)
+	FetchEvents(ctx context.Context, path, etag string) (events []github.Event, newEtag string, err error)
 }
 
-// Producer polls GitHub events and enqueues commit jobs. Depends only on Store interface.
+// RateLimiter reports the remaining API budget (e.g. github.Client).
+type RateLimiter interface {
+	RateLimit() github.RateLimit
+}
+
+// RateLimitReserve is the number of API calls the producer leaves to consumer workers before pausing polls until reset.
+const RateLimitReserve = 100
+
+// Producer states reported by State.
+const (
+	ProducerRunning = "running"
+	ProducerPausing = "pausing" // paused, finishing its current poll
+	ProducerPaused  = "paused"
+)
+
+// Producer polls one or more event sources and dispatches events to the handler registered for their type.
+// PushEvents are handled by a PushHandler that enqueues commit jobs. Depends only on Store interface.
+//
+// Each source keeps its own ETag, cadence and cursor (newest event id seen). The most overdue source is
+// polled next; when the fetcher reports its rate limit, polls are spread so all sources share the
+// remaining budget evenly until reset. Source state is saved after each poll and restored by Run.
 type Producer struct {
-	store        store.Store
-	fetcher      EventsFetcher
-	jobs         chan<- CommitJob
-	pollInterval time.Duration
-	log          *slog.Logger
+	store    store.Store
+	fetcher  EventsFetcher
+	handlers *Registry
+	sources  []*sourceState
+	bots     *botclass.Classifier
+	log      *slog.Logger
+
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // closed by Resume
+	polling bool
+}
+
+// sourceState is the polling state of one source.
+type sourceState struct {
+	Source
+	etag   string
+	cursor string
+	next   time.Time
 }
 
-// NewProducer returns a producer that sends jobs to the given channel.
-// pollInterval is the delay between event fetches (e.g. from POLL_INTERVAL_SEC).
-func NewProducer(s store.Store, f EventsFetcher, jobs chan<- CommitJob, pollInterval time.Duration) *Producer {
-	return &Producer{store: s, fetcher: f, jobs: jobs, pollInterval: pollInterval, log: slog.Default()}
+// NewProducer returns a producer whose PushEvent handler enqueues jobs on the given queue.
+// It polls the global events stream every pollInterval (e.g. from POLL_INTERVAL_SEC) unless SetSources is called.
+// forcePushes is optional; when nil, force pushes are not detected.
+func NewProducer(s store.Store, f EventsFetcher, queue *Queue, pollInterval time.Duration, forcePushes *ForcePushDetector) *Producer {
+	handlers := NewRegistry()
+	handlers.Register(github.PushEventType, NewPushHandler(s, queue, forcePushes))
+	p := &Producer{store: s, fetcher: f, handlers: handlers, log: slog.Default()}
+	p.SetSources(GlobalSource(pollInterval))
+	return p
+}
+
+// Handlers returns the producer's event handler registry. Register handlers before calling Run.
+func (p *Producer) Handlers() *Registry {
+	return p.handlers
+}
+
+// SetSources replaces the polled sources. Call before Run.
+func (p *Producer) SetSources(sources ...Source) {
+	p.sources = make([]*sourceState, 0, len(sources))
+	for _, src := range sources {
+		p.sources = append(p.sources, &sourceState{Source: src})
+	}
+}
+
+// SetBots sets the classifier flagging events whose actor is a bot (github.Event.IsBot). Call before Run.
+func (p *Producer) SetBots(bots *botclass.Classifier) {
+	p.bots = bots
 }
 
 // Run polls until ctx is cancelled. Uses bounded channel for backpressure.
 func (p *Producer) Run(ctx context.Context) {
-	p.log.Info("producer running", "poll_interval", p.pollInterval)
-	var etag string
+	names := make([]string, 0, len(p.sources))
+	for _, src := range p.sources {
+		names = append(names, src.Name)
+	}
+	p.log.Info("producer running", "sources", names, "event_types", p.handlers.Types())
+	p.restore(ctx)
+	if len(p.sources) == 0 {
+		<-ctx.Done()
+		p.log.Info("producer stopping")
+		return
+	}
 	for {
+		src := p.nextSource()
 		select {
 		case <-ctx.Done():
 			p.log.Info("producer stopping")
 			return
-		default:
+		case <-time.After(time.Until(src.next)):
 		}
-		events, newEtag, err := p.fetcher.FetchEvents(ctx, etag)
-		if err != nil {
-			p.log.Warn("fetch events", "err", err)
-			continue
-		}
-		etag = newEtag
-		if len(events) > 0 {
-			p.log.Info("events fetched", "count", len(events), "etag", newEtag)
+		if !p.waitResumed(ctx) {
+			p.log.Info("producer stopping")
+			return
 		}
-		for _, e := range events {
-			if e.Type != "PushEvent" {
-				continue
-			}
-			inserted, err := p.store.InsertPushEvent(ctx, p.eventToRow(&e))
-			if err != nil {
-				p.log.Warn("insert push event", "id", e.ID, "err", err)
-				continue
-			}
-			if !inserted {
-				continue
-			}
-			payload := new(github.PushEventPayload)
-			if err := json.Unmarshal(e.RawPayload, payload); err != nil {
-				p.log.Warn("parse push payload", "id", e.ID, "err", err)
-				continue
-			}
-			owner, repo := splitRepo(e.Repo)
-			shas := make([]string, 0, len(payload.Commits)+1)
-			for _, c := range payload.Commits {
-				if c.SHA != "" {
-					shas = append(shas, c.SHA)
-				}
-			}
-			// Public /events API omits "commits"; use tip (head/after) so we still enqueue one job per push.
-			if len(shas) == 0 {
-				if tip := payload.Head; tip != "" {
-					shas = append(shas, tip)
-				} else if tip := payload.After; tip != "" {
-					shas = append(shas, tip)
-				}
-			}
-			p.log.Info("push event processed", "event_id", e.ID, "repo", owner+"/"+repo, "commits", len(shas))
-			for _, sha := range shas {
-				job := CommitJob{EventID: e.ID, Owner: owner, Repo: repo, SHA: sha}
-				select {
-				case p.jobs <- job:
-				case <-ctx.Done():
-					p.log.Info("producer stopping")
-					return
-				}
-			}
+		ok := p.poll(ctx, src)
+		p.mu.Lock()
+		p.polling = false
+		p.mu.Unlock()
+		if !ok {
+			p.log.Info("producer stopping")
+			return
 		}
+	}
+}
+
+// Pause stops polling after the current poll (if any) until Resume. Events are not lost: sources are
+// polled from their cursor on resume, as long as GitHub still lists them.
+func (p *Producer) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		p.paused = true
+		p.resumed = make(chan struct{})
+		p.log.Info("producer paused")
+	}
+}
+
+// Resume resumes polling after Pause.
+func (p *Producer) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused {
+		p.paused = false
+		close(p.resumed)
+		p.log.Info("producer resumed")
+	}
+}
+
+// State returns ProducerRunning, ProducerPausing or ProducerPaused.
+func (p *Producer) State() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case !p.paused:
+		return ProducerRunning
+	case p.polling:
+		return ProducerPausing
+	default:
+		return ProducerPaused
+	}
+}
+
+// waitResumed blocks while the producer is paused, then marks it polling. Returns false when ctx is cancelled.
+func (p *Producer) waitResumed(ctx context.Context) bool {
+	p.mu.Lock()
+	for p.paused {
+		resumed := p.resumed
+		p.mu.Unlock()
 		select {
 		case <-ctx.Done():
-			p.log.Info("producer stopping")
-			return
-		case <-time.After(p.pollInterval):
+			return false
+		case <-resumed:
 		}
+		p.mu.Lock()
 	}
+	p.polling = true
+	p.mu.Unlock()
+	return true
 }
 
-func (p *Producer) eventToRow(e *github.Event) *store.PushEventRow {
-	row := &store.PushEventRow{
-		ID:         e.ID,
-		Type:       e.Type,
-		CreatedAt:  e.CreatedAt,
-		Repo:       "",
-		RawPayload: e.RawPayload,
+// restore loads the saved ETag, cursor and last poll time of each source, so a restart
+// resumes with conditional requests and keeps each source's cadence.
+func (p *Producer) restore(ctx context.Context) {
+	states, err := p.store.PollerStates(ctx)
+	if err != nil {
+		p.log.Warn("load poller state", "err", err)
+		return
+	}
+	byName := make(map[string]*store.PollerStateRow, len(states))
+	for _, st := range states {
+		byName[st.Source] = st
 	}
-	if e.Repo != nil {
-		row.Repo = e.Repo.FullName
+	for _, src := range p.sources {
+		if st, ok := byName[src.Name]; ok {
+			src.etag = st.ETag
+			src.cursor = st.LastEventID
+			src.next = st.LastPollAt.Add(src.Interval)
+			p.log.Info("poller state restored", "source", src.Name, "etag", st.ETag, "last_event_id", st.LastEventID, "last_poll_at", st.LastPollAt)
+		}
 	}
-	if e.Actor != nil {
-		row.ActorLogin = e.Actor.Login
+}
+
+// nextSource returns the source due the earliest.
+func (p *Producer) nextSource() *sourceState {
+	next := p.sources[0]
+	for _, src := range p.sources[1:] {
+		if src.next.Before(next.next) {
+			next = src
+		}
 	}
-	return row
+	return next
 }
 
-func splitRepo(r *github.Repo) (owner, repo string) {
-	if r == nil {
-		return "", ""
+// poll fetches and dispatches one page of src, then schedules its next poll. Returns false when ctx is cancelled.
+func (p *Producer) poll(ctx context.Context, src *sourceState) bool {
+	events, newEtag, err := p.fetcher.FetchEvents(ctx, src.Path, src.etag)
+	polledAt := time.Now()
+	src.next = polledAt.Add(p.interval(src))
+	if err != nil {
+		p.log.Warn("fetch events", "source", src.Name, "err", err)
+		if ctx.Err() != nil {
+			return false
+		}
+		p.saveState(ctx, src, polledAt, "error: "+err.Error())
+		return true
+	}
+	src.etag = newEtag
+	status := "not_modified"
+	if len(events) > 0 {
+		status = "ok"
+		p.log.Info("events fetched", "source", src.Name, "count", len(events), "etag", newEtag)
 	}
-	parts := strings.SplitN(r.FullName, "/", 2)
-	if len(parts) == 2 {
-		return parts[0], parts[1]
+	cursor := src.cursor
+	for i := range events {
+		e := &events[i]
+		if src.cursor != "" && !newerEventID(e.ID, src.cursor) {
+			continue // already seen on a previous poll of this source
+		}
+		if newerEventID(e.ID, cursor) {
+			cursor = e.ID
+		}
+		e.Source = src.Name
+		if e.Actor != nil {
+			e.IsBot = p.bots.Event(e.Actor.Login, e.Actor.Type, e.CreatedAt)
+		}
+		if _, err := p.handlers.Dispatch(ctx, e); err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			p.log.Warn("handle event", "source", src.Name, "id", e.ID, "type", e.Type, "err", err)
+		}
+	}
+	src.cursor = cursor
+	p.saveState(ctx, src, polledAt, status)
+	return true
+}
+
+// saveState persists src's ETag and cursor after a poll; failures are logged and polling continues.
+func (p *Producer) saveState(ctx context.Context, src *sourceState, polledAt time.Time, status string) {
+	err := p.store.SavePollerState(ctx, &store.PollerStateRow{
+		Source:      src.Name,
+		ETag:        src.etag,
+		LastEventID: src.cursor,
+		LastPollAt:  polledAt,
+		LastStatus:  status,
+	})
+	if err != nil {
+		p.log.Warn("save poller state", "source", src.Name, "err", err)
+	}
+}
+
+// interval returns the delay before src's next poll: its own interval, stretched so that the
+// sources together use the remaining rate-limit budget (minus RateLimitReserve) evenly until reset.
+func (p *Producer) interval(src *sourceState) time.Duration {
+	rl, ok := p.fetcher.(RateLimiter)
+	if !ok {
+		return src.Interval
+	}
+	limit := rl.RateLimit()
+	untilReset := time.Until(limit.Reset)
+	if limit.Reset.IsZero() || untilReset <= 0 {
+		return src.Interval
+	}
+	budget := limit.Remaining - RateLimitReserve
+	if budget <= 0 {
+		p.log.Info("rate limit budget exhausted, pausing source until reset", "source", src.Name, "remaining", limit.Remaining, "reset", limit.Reset)
+		return max(src.Interval, untilReset)
+	}
+	fair := untilReset * time.Duration(len(p.sources)) / time.Duration(budget)
+	return max(src.Interval, fair)
+}
+
+// newerEventID reports whether event id a is newer than b. GitHub event ids are increasing decimal strings.
+func newerEventID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
 	}
-	return r.FullName, ""
+	return a > b
 }
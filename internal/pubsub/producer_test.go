@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/challenge-github-events/internal/botclass"
 	"github.com/challenge-github-events/internal/github"
 	"github.com/challenge-github-events/internal/store"
 	"go.uber.org/mock/gomock"
@@ -18,6 +19,7 @@ func TestProducer_EnqueuesJobsForInsertedEvent(t *testing.T) {
 	defer cancel()
 
 	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
 	payload := github.PushEventPayload{Commits: []github.PushCommit{{SHA: "sha1"}, {SHA: "sha2"}}}
 	payloadJSON, _ := json.Marshal(payload)
 	events := []github.Event{
@@ -31,19 +33,20 @@ func TestProducer_EnqueuesJobsForInsertedEvent(t *testing.T) {
 	}
 
 	mockFetcher := github.NewMockEventsFetcher(ctrl)
-	mockFetcher.EXPECT().FetchEvents(gomock.Any(), gomock.Any()).Return(events, "etag1", nil)
+	mockFetcher.EXPECT().FetchEvents(gomock.Any(), github.GlobalEventsPath, gomock.Any()).Return(events, "etag1", nil)
 	mockStore.EXPECT().InsertPushEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, event *store.PushEventRow) (bool, error) {
 		return event.ID == "e1", nil
 	}).Times(2)
+	mockStore.EXPECT().InsertCommitRepos(gomock.Any(), gomock.Any()).Return(nil)
 
-	jobs := make(chan CommitJob, 4)
-	prod := NewProducer(mockStore, mockFetcher, jobs, 10*time.Hour)
+	queue := testQueue(t, 4)
+	prod := NewProducer(mockStore, mockFetcher, queue, 10*time.Hour, nil)
 	go prod.Run(ctx)
 
 	var got []CommitJob
 	for i := 0; i < 2; i++ {
 		select {
-		case j := <-jobs:
+		case j := <-queue.Jobs():
 			got = append(got, j)
 		case <-time.After(2 * time.Second):
 			break
@@ -70,6 +73,7 @@ func TestProducer_EnqueuesTipCommitWhenCommitsEmpty(t *testing.T) {
 	defer cancel()
 
 	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
 	// Public /events API omits "commits" but includes "head".
 	payload := github.PushEventPayload{Head: "abc123tip"}
 	payloadJSON, _ := json.Marshal(payload)
@@ -78,16 +82,17 @@ func TestProducer_EnqueuesTipCommitWhenCommitsEmpty(t *testing.T) {
 	}
 
 	mockFetcher := github.NewMockEventsFetcher(ctrl)
-	mockFetcher.EXPECT().FetchEvents(gomock.Any(), gomock.Any()).Return(events, "", nil)
+	mockFetcher.EXPECT().FetchEvents(gomock.Any(), github.GlobalEventsPath, gomock.Any()).Return(events, "", nil)
 	mockStore.EXPECT().InsertPushEvent(gomock.Any(), gomock.Any()).Return(true, nil)
+	mockStore.EXPECT().InsertCommitRepos(gomock.Any(), gomock.Any()).Return(nil)
 
-	jobs := make(chan CommitJob, 2)
-	prod := NewProducer(mockStore, mockFetcher, jobs, 10*time.Hour)
+	queue := testQueue(t, 2)
+	prod := NewProducer(mockStore, mockFetcher, queue, 10*time.Hour, nil)
 	go prod.Run(ctx)
 
 	var got CommitJob
 	select {
-	case got = <-jobs:
+	case got = <-queue.Jobs():
 	case <-time.After(2 * time.Second):
 		t.Fatal("expected one job for tip commit")
 	}
@@ -105,6 +110,7 @@ func TestProducer_DoesNotEnqueueWhenInsertReturnsFalse(t *testing.T) {
 	defer cancel()
 
 	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
 	payload := github.PushEventPayload{Commits: []github.PushCommit{{SHA: "sha1"}}}
 	payloadJSON, _ := json.Marshal(payload)
 	events := []github.Event{
@@ -112,17 +118,211 @@ func TestProducer_DoesNotEnqueueWhenInsertReturnsFalse(t *testing.T) {
 	}
 
 	mockFetcher := github.NewMockEventsFetcher(ctrl)
-	mockFetcher.EXPECT().FetchEvents(gomock.Any(), gomock.Any()).Return(events, "", nil)
+	mockFetcher.EXPECT().FetchEvents(gomock.Any(), github.GlobalEventsPath, gomock.Any()).Return(events, "", nil)
 	mockStore.EXPECT().InsertPushEvent(gomock.Any(), gomock.Any()).Return(false, nil)
 
-	jobs := make(chan CommitJob, 1)
-	prod := NewProducer(mockStore, mockFetcher, jobs, 10*time.Hour)
+	queue := testQueue(t, 1)
+	prod := NewProducer(mockStore, mockFetcher, queue, 10*time.Hour, nil)
 	go prod.Run(ctx)
 
 	select {
-	case <-jobs:
+	case <-queue.Jobs():
 		t.Error("should not enqueue when InsertPushEvent returns false")
 	case <-time.After(500 * time.Millisecond):
 	}
 	cancel()
 }
+
+func TestProducer_RecordsRefAndLinksCommits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
+	payload := github.PushEventPayload{PushID: 99, Ref: "refs/heads/main", Size: 2, DistinctSize: 1, Commits: []github.PushCommit{{SHA: "sha1"}, {SHA: "sha2"}}}
+	payloadJSON, _ := json.Marshal(payload)
+	events := []github.Event{
+		{ID: "e1", Type: "PushEvent", Repo: &github.Repo{FullName: "o/r"}, RawPayload: payloadJSON},
+	}
+
+	mockFetcher := github.NewMockEventsFetcher(ctrl)
+	mockFetcher.EXPECT().FetchEvents(gomock.Any(), github.GlobalEventsPath, gomock.Any()).Return(events, "", nil)
+	var row *store.PushEventRow
+	mockStore.EXPECT().InsertPushEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, event *store.PushEventRow) (bool, error) {
+		row = event
+		return true, nil
+	})
+	var links []*store.CommitRepoRow
+	mockStore.EXPECT().InsertCommitRepos(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, rows []*store.CommitRepoRow) error {
+		links = rows
+		return nil
+	})
+	refsSaved := make(chan []*store.CommitRefRow, 1)
+	mockStore.EXPECT().InsertCommitRefs(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, refs []*store.CommitRefRow) error {
+		refsSaved <- refs
+		return nil
+	})
+
+	queue := testQueue(t, 2)
+	prod := NewProducer(mockStore, mockFetcher, queue, 10*time.Hour, nil)
+	go prod.Run(ctx)
+
+	var refs []*store.CommitRefRow
+	select {
+	case refs = <-refsSaved:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected commit refs to be saved")
+	}
+	cancel()
+
+	if row.Ref != "refs/heads/main" || row.RefType != "branch" || row.PushID != 99 || row.Size != 2 || row.DistinctSize != 1 {
+		t.Errorf("push row want ref=refs/heads/main type=branch push_id=99 size=2 distinct=1 got %+v", row)
+	}
+	if len(refs) != 2 || refs[0].Sha != "sha1" || refs[1].Ref != "refs/heads/main" || refs[1].Repo != "o/r" || refs[1].EventID != "e1" {
+		t.Errorf("commit refs want sha1, sha2 on o/r refs/heads/main got %+v", refs)
+	}
+	if len(links) != 2 || links[1].Sha != "sha2" || links[1].Repo != "o/r" {
+		t.Errorf("commit repos want sha1, sha2 in o/r got %+v", links)
+	}
+}
+
+func TestProducer_PollsEachSourceAndTagsEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
+	mockFetcher := github.NewMockEventsFetcher(ctrl)
+	mockFetcher.EXPECT().FetchEvents(gomock.Any(), "/orgs/golang/events", "").
+		Return([]github.Event{{ID: "11", Type: "WatchEvent", Repo: &github.Repo{FullName: "golang/go"}}}, "etag-org", nil)
+	mockFetcher.EXPECT().FetchEvents(gomock.Any(), "/repos/golang/go/events", "").
+		Return([]github.Event{{ID: "12", Type: "WatchEvent", Repo: &github.Repo{FullName: "golang/go"}}}, "etag-repo", nil)
+
+	var sources []string
+	got := make(chan struct{}, 2)
+	prod := NewProducer(mockStore, mockFetcher, testQueue(t, 1), 10*time.Hour, nil)
+	prod.Handlers().Register(github.WatchEventType, EventHandlerFunc(func(_ context.Context, e *github.Event) error {
+		sources = append(sources, e.Source)
+		got <- struct{}{}
+		return nil
+	}))
+	org, _ := ParseSource("org:golang", 10*time.Hour)
+	repo, _ := ParseSource("repo:golang/go", 10*time.Hour)
+	prod.SetSources(org, repo)
+	go prod.Run(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-got:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("want 2 events got %d", i)
+		}
+	}
+	cancel()
+	if sources[0] != "org:golang" || sources[1] != "repo:golang/go" {
+		t.Errorf("sources want [org:golang repo:golang/go] got %v", sources)
+	}
+}
+
+func TestProducer_SkipsEventsAtOrBeforeCursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockFetcher := github.NewMockEventsFetcher(ctrl)
+	gomock.InOrder(
+		mockFetcher.EXPECT().FetchEvents(gomock.Any(), github.GlobalEventsPath, "").
+			Return([]github.Event{{ID: "100", Type: "WatchEvent"}, {ID: "99", Type: "WatchEvent"}}, "e1", nil),
+		mockFetcher.EXPECT().FetchEvents(gomock.Any(), github.GlobalEventsPath, "e1").
+			Return([]github.Event{{ID: "101", Type: "WatchEvent"}, {ID: "100", Type: "WatchEvent"}}, "e2", nil),
+	)
+
+	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
+	var ids []string
+	prod := NewProducer(mockStore, mockFetcher, testQueue(t, 1), time.Hour, nil)
+	prod.Handlers().Register(github.WatchEventType, EventHandlerFunc(func(_ context.Context, e *github.Event) error {
+		ids = append(ids, e.ID)
+		return nil
+	}))
+	src := prod.sources[0]
+	prod.poll(context.Background(), src)
+	prod.poll(context.Background(), src)
+
+	if len(ids) != 3 || ids[2] != "101" {
+		t.Errorf("ids want [100 99 101] got %v", ids)
+	}
+	if src.cursor != "101" || src.etag != "e2" {
+		t.Errorf("cursor/etag want 101/e2 got %s/%s", src.cursor, src.etag)
+	}
+}
+
+func TestProducer_FlagsBotActors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockFetcher := github.NewMockEventsFetcher(ctrl)
+	mockFetcher.EXPECT().FetchEvents(gomock.Any(), github.GlobalEventsPath, "").Return([]github.Event{
+		{ID: "2", Type: "WatchEvent", Actor: &github.Actor{Login: "dependabot[bot]"}},
+		{ID: "1", Type: "WatchEvent", Actor: &github.Actor{Login: "mona", Type: "User"}},
+	}, "e1", nil)
+
+	mockStore := store.NewMockStore(ctrl)
+	allowPollerState(mockStore)
+	bots := map[string]bool{}
+	prod := NewProducer(mockStore, mockFetcher, testQueue(t, 1), time.Hour, nil)
+	prod.SetBots(botclass.New(botclass.DefaultRules, nil, 0, time.Minute))
+	prod.Handlers().Register(github.WatchEventType, EventHandlerFunc(func(_ context.Context, e *github.Event) error {
+		bots[e.Actor.Login] = e.IsBot
+		return nil
+	}))
+	prod.poll(context.Background(), prod.sources[0])
+
+	if !bots["dependabot[bot]"] || bots["mona"] {
+		t.Errorf("want dependabot[bot] flagged and mona not got %v", bots)
+	}
+}
+
+func TestProducer_RestoresAndSavesPollerState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lastPoll := time.Now().Add(-time.Hour)
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().PollerStates(gomock.Any()).Return([]*store.PollerStateRow{
+		{Source: "global", ETag: "saved-etag", LastEventID: "100", LastPollAt: lastPoll, LastStatus: "ok"},
+	}, nil)
+	mockFetcher := github.NewMockEventsFetcher(ctrl)
+	mockFetcher.EXPECT().FetchEvents(gomock.Any(), github.GlobalEventsPath, "saved-etag").Return(nil, "saved-etag", nil)
+	saved := make(chan *store.PollerStateRow, 1)
+	mockStore.EXPECT().SavePollerState(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, st *store.PollerStateRow) error {
+		saved <- st
+		return nil
+	})
+
+	prod := NewProducer(mockStore, mockFetcher, testQueue(t, 1), time.Minute, nil)
+	go prod.Run(ctx)
+
+	select {
+	case st := <-saved:
+		if st.Source != "global" || st.ETag != "saved-etag" || st.LastEventID != "100" || st.LastStatus != "not_modified" {
+			t.Errorf("saved state want global/saved-etag/100/not_modified got %+v", st)
+		}
+		if !st.LastPollAt.After(lastPoll) {
+			t.Errorf("LastPollAt want after %v got %v", lastPoll, st.LastPollAt)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("poller state not saved")
+	}
+}
+
+// allowPollerState lets the producer load an empty poller state and save any state.
+func allowPollerState(s *store.MockStore) {
+	s.EXPECT().PollerStates(gomock.Any()).Return(nil, nil).AnyTimes()
+	s.EXPECT().SavePollerState(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+}
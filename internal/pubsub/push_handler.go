@@ -0,0 +1,125 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+)
+
+// PushHandler stores PushEvents and enqueues one commit job per pushed commit.
+// What happens when the jobs queue is full depends on its backpressure strategy.
+type PushHandler struct {
+	store       store.Store
+	queue       *Queue
+	forcePushes *ForcePushDetector
+	log         *slog.Logger
+}
+
+// NewPushHandler returns a handler that enqueues jobs on the given queue.
+// forcePushes is optional; when nil, force pushes are not detected.
+func NewPushHandler(s store.Store, queue *Queue, forcePushes *ForcePushDetector) *PushHandler {
+	return &PushHandler{store: s, queue: queue, forcePushes: forcePushes, log: slog.Default()}
+}
+
+// HandleEvent stores e and, when it is new, enqueues its commits. Returns ctx.Err() when cancelled while enqueueing.
+func (h *PushHandler) HandleEvent(ctx context.Context, e *github.Event) error {
+	payload := new(github.PushEventPayload)
+	parseErr := json.Unmarshal(e.RawPayload, payload)
+	if parseErr != nil {
+		payload = nil
+	}
+	inserted, err := h.store.InsertPushEvent(ctx, pushEventRow(e, payload))
+	if err != nil {
+		h.log.Warn("insert push event", "id", e.ID, "err", err)
+		return nil
+	}
+	if !inserted {
+		return nil
+	}
+	if parseErr != nil {
+		h.log.Warn("parse push payload", "id", e.ID, "err", parseErr)
+		return nil
+	}
+	owner, repo := splitRepo(e.Repo)
+	if h.forcePushes != nil {
+		h.forcePushes.Enqueue(e.ID, owner, repo, payload)
+	}
+	shas := make([]string, 0, len(payload.Commits)+1)
+	for _, c := range payload.Commits {
+		if c.SHA != "" {
+			shas = append(shas, c.SHA)
+		}
+	}
+	// Public /events API omits "commits"; use tip (head/after) so we still enqueue one job per push.
+	if len(shas) == 0 {
+		if tip := payload.Tip(); tip != "" {
+			shas = append(shas, tip)
+		}
+	}
+	links := make([]*store.CommitRepoRow, 0, len(shas))
+	for _, sha := range shas {
+		links = append(links, &store.CommitRepoRow{Sha: sha, Repo: owner + "/" + repo, FirstSeenAt: e.CreatedAt})
+	}
+	if err := h.store.InsertCommitRepos(ctx, links); err != nil {
+		h.log.Warn("insert commit repos", "id", e.ID, "err", err)
+	}
+	if payload.Ref != "" {
+		refs := make([]*store.CommitRefRow, 0, len(shas))
+		for _, sha := range shas {
+			refs = append(refs, &store.CommitRefRow{Sha: sha, Repo: owner + "/" + repo, Ref: payload.Ref, EventID: e.ID})
+		}
+		if err := h.store.InsertCommitRefs(ctx, refs); err != nil {
+			h.log.Warn("insert commit refs", "id", e.ID, "err", err)
+		}
+	}
+	h.log.Info("push event processed", "event_id", e.ID, "repo", owner+"/"+repo, "ref", payload.Ref, "commits", len(shas))
+	for _, sha := range shas {
+		job := CommitJob{EventID: e.ID, Owner: owner, Repo: repo, SHA: sha}
+		if err := h.queue.Enqueue(ctx, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushEventRow maps an event to its gh_push_events row. payload is optional (nil when unparseable).
+func pushEventRow(e *github.Event, payload *github.PushEventPayload) *store.PushEventRow {
+	row := &store.PushEventRow{
+		ID:         e.ID,
+		Type:       e.Type,
+		CreatedAt:  e.CreatedAt,
+		Repo:       "",
+		RawPayload: e.RawPayload,
+		Source:     e.Source,
+		IsBot:      e.IsBot,
+	}
+	if payload != nil {
+		row.Ref = payload.Ref
+		row.RefType = payload.RefType()
+		row.PushID = payload.PushID
+		row.Size = payload.Size
+		row.DistinctSize = payload.DistinctSize
+	}
+	if e.Repo != nil {
+		row.Repo = e.Repo.FullName
+	}
+	if e.Actor != nil {
+		row.ActorLogin = e.Actor.Login
+	}
+	return row
+}
+
+func splitRepo(r *github.Repo) (owner, repo string) {
+	if r == nil {
+		return "", ""
+	}
+	parts := strings.SplitN(r.FullName, "/", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return r.FullName, ""
+}
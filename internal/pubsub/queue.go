@@ -0,0 +1,419 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+)
+
+// Backpressure strategies: what Queue.Enqueue does when the queue is full.
+const (
+	// BackpressureBlock waits for room, so polling pauses until consumers catch up.
+	BackpressureBlock = "block"
+	// BackpressureSkip records the job in memory (up to MaxSkipped jobs) and enqueues it again once there is room.
+	BackpressureSkip = "skip"
+	// BackpressureDropOldest discards the oldest queued job to make room.
+	BackpressureDropOldest = "drop-oldest"
+	// BackpressureSpill appends the job to the store's overflow (in batches of SpillBatchSize), replayed once there
+	// is room, even after a restart.
+	BackpressureSpill = "spill"
+)
+
+// Queue outcome counters (see Queue.Status).
+const (
+	QueueEnqueued = "enqueued" // jobs that went straight into the queue, possibly after blocking
+	QueueBlocked  = "blocked"  // enqueues that had to wait for room
+	QueueSkipped  = "skipped"  // jobs recorded in memory for later
+	QueueDropped  = "dropped"  // jobs lost: evicted by drop-oldest, or skipped beyond MaxSkipped
+	QueueSpilled  = "spilled"  // jobs appended to the store's overflow
+	QueueReplayed = "replayed" // skipped or spilled jobs moved into the queue
+)
+
+var queueOutcomes = []string{QueueEnqueued, QueueBlocked, QueueSkipped, QueueDropped, QueueSpilled, QueueReplayed}
+
+const (
+	// MaxSkipped is the number of skipped jobs kept in memory; further jobs are dropped while it is reached.
+	MaxSkipped = 100_000
+	// ReplayInterval is how often skipped or spilled jobs are moved back into the queue when it has room.
+	ReplayInterval = time.Second
+	// SpillBatchSize is the number of spilled jobs written to the store at once; fewer are written every
+	// ReplayInterval. Up to MaxSkipped jobs are kept in memory while writes fail.
+	SpillBatchSize = 100
+)
+
+// QueueStatus is a snapshot of a Queue.
+type QueueStatus struct {
+	Strategy string
+	Depth    int
+	Capacity int
+	// Pending is the number of skipped or spilled jobs waiting to be replayed.
+	Pending int
+	Counts  map[string]int64
+}
+
+// Queue is the bounded queue of commit jobs between the producer and the consumer workers. When it is full,
+// Enqueue blocks, skips, drops the oldest job or spills to the store depending on its strategy; Run replays
+// skipped and spilled jobs. Consumers read from Jobs.
+type Queue struct {
+	jobs           chan CommitJob
+	strategy       string
+	store          store.Store
+	replayInterval time.Duration
+	now            func() time.Time
+	log            *slog.Logger
+	counts         map[string]*atomic.Int64
+	maxSkipped     int
+
+	mu        sync.Mutex
+	skipped   []CommitJob
+	unspilled []*store.SpilledJobRow // spilled jobs not written to the store yet, oldest first
+	spilled   int                    // jobs in the store's overflow
+	replaying int                    // skipped jobs taken by replay and not in the queue yet
+
+	flushMu sync.Mutex // keeps writes of unspilled in order
+}
+
+// NewQueue returns a queue of size jobs with the given strategy. s is the overflow of BackpressureSpill
+// and may be nil for the other strategies. Jobs left in the overflow by a previous run are pending from the
+// start, so new jobs queue up behind them.
+func NewQueue(size int, strategy string, s store.Store) (*Queue, error) {
+	switch strategy {
+	case BackpressureBlock, BackpressureSkip, BackpressureDropOldest:
+	case BackpressureSpill:
+		if s == nil {
+			return nil, fmt.Errorf("backpressure %q needs a store", strategy)
+		}
+	default:
+		return nil, fmt.Errorf("unknown backpressure strategy %q", strategy)
+	}
+	counts := make(map[string]*atomic.Int64, len(queueOutcomes))
+	for _, o := range queueOutcomes {
+		counts[o] = new(atomic.Int64)
+	}
+	q := &Queue{
+		jobs:           make(chan CommitJob, size),
+		strategy:       strategy,
+		store:          s,
+		replayInterval: ReplayInterval,
+		now:            time.Now,
+		log:            slog.Default(),
+		counts:         counts,
+		maxSkipped:     MaxSkipped,
+	}
+	if strategy == BackpressureSpill {
+		n, err := s.SpilledJobsCount(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("count spilled jobs: %w", err)
+		}
+		if n > 0 {
+			q.log.Info("replaying spilled jobs", "jobs", n)
+		}
+		q.spilled = int(n)
+	}
+	return q, nil
+}
+
+// Jobs returns the channel consumers read jobs from. It is closed by Close.
+func (q *Queue) Jobs() <-chan CommitJob {
+	return q.jobs
+}
+
+// Len returns the number of jobs in the queue.
+func (q *Queue) Len() int {
+	return len(q.jobs)
+}
+
+// Cap returns the size of the queue.
+func (q *Queue) Cap() int {
+	return cap(q.jobs)
+}
+
+// Pending returns the number of skipped or spilled jobs waiting to be replayed.
+func (q *Queue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending()
+}
+
+// pending is Pending with q.mu held.
+func (q *Queue) pending() int {
+	return len(q.skipped) + len(q.unspilled) + q.spilled + q.replaying
+}
+
+// Enqueue adds job to the queue, applying the queue's strategy when it is full. With BackpressureSkip and
+// BackpressureSpill, job is also skipped or spilled while earlier jobs wait for replay, so jobs reach
+// consumers in the order they were enqueued. Returns ctx.Err() when cancelled while blocked.
+func (q *Queue) Enqueue(ctx context.Context, job CommitJob) error {
+	if q.tryEnqueue(job) {
+		q.counts[QueueEnqueued].Add(1)
+		return nil
+	}
+	switch q.strategy {
+	case BackpressureSkip:
+		q.skip(job)
+		return nil
+	case BackpressureDropOldest:
+		for {
+			select {
+			case old := <-q.jobs:
+				q.counts[QueueDropped].Add(1)
+				q.log.Warn("jobs queue full, dropping oldest job", "repo", old.Repo, "sha", old.SHA)
+			default:
+			}
+			select {
+			case q.jobs <- job:
+				q.counts[QueueEnqueued].Add(1)
+				return nil
+			default:
+			}
+		}
+	case BackpressureSpill:
+		if q.spill(ctx, job) {
+			return nil
+		}
+		return q.waitForBacklog(ctx, job)
+	}
+	q.counts[QueueBlocked].Add(1)
+	select {
+	case q.jobs <- job:
+		q.counts[QueueEnqueued].Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tryEnqueue adds job to the queue when it has room and, with BackpressureSkip and BackpressureSpill,
+// no job waits for replay.
+func (q *Queue) tryEnqueue(job CommitJob) bool {
+	if q.strategy == BackpressureSkip || q.strategy == BackpressureSpill {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.pending() > 0 {
+			return false
+		}
+	}
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// skip records job for a later replay, or drops it when MaxSkipped jobs are waiting already.
+func (q *Queue) skip(job CommitJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.skipped) >= q.maxSkipped {
+		q.counts[QueueDropped].Add(1)
+		q.log.Warn("too many skipped jobs, dropping job", "repo", job.Repo, "sha", job.SHA)
+		return
+	}
+	q.skipped = append(q.skipped, job)
+	q.counts[QueueSkipped].Add(1)
+}
+
+// spill buffers job for the store's overflow and writes the buffer once it holds SpillBatchSize jobs.
+// Returns false when maxSkipped jobs are buffered already because writes keep failing.
+func (q *Queue) spill(ctx context.Context, job CommitJob) bool {
+	row := &store.SpilledJobRow{EventID: job.EventID, Owner: job.Owner, Repo: job.Repo, Sha: job.SHA, SpilledAt: q.now()}
+	q.mu.Lock()
+	if len(q.unspilled) >= q.maxSkipped {
+		q.mu.Unlock()
+		return false
+	}
+	q.unspilled = append(q.unspilled, row)
+	full := len(q.unspilled) >= SpillBatchSize
+	q.mu.Unlock()
+	q.counts[QueueSpilled].Add(1)
+	if full {
+		q.flushSpilled(ctx)
+	}
+	return true
+}
+
+// flushSpilled writes the buffered spilled jobs to the store's overflow with one SpillJobs call. They stay
+// buffered, and pending, until written; after a failure the next flush writes them again.
+func (q *Queue) flushSpilled(ctx context.Context) {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+	q.mu.Lock()
+	rows := slices.Clone(q.unspilled)
+	q.mu.Unlock()
+	if len(rows) == 0 {
+		return
+	}
+	if err := q.store.SpillJobs(ctx, rows); err != nil {
+		q.log.Warn("spill jobs", "jobs", len(rows), "err", err)
+		return
+	}
+	q.mu.Lock()
+	q.unspilled = q.unspilled[len(rows):]
+	q.spilled += len(rows)
+	q.mu.Unlock()
+}
+
+// waitForBacklog retries job every replay interval until it can be spilled or, once the backlog has been
+// replayed, enqueued, so it never overtakes the jobs spilled before it. Returns ctx.Err() when cancelled.
+func (q *Queue) waitForBacklog(ctx context.Context, job CommitJob) error {
+	q.counts[QueueBlocked].Add(1)
+	q.log.Warn("too many jobs waiting to be spilled, waiting for the backlog", "sha", job.SHA)
+	ticker := time.NewTicker(q.replayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if q.tryEnqueue(job) {
+			q.counts[QueueEnqueued].Add(1)
+			return nil
+		}
+		if q.spill(ctx, job) {
+			return nil
+		}
+	}
+}
+
+// Run replays skipped and spilled jobs every ReplayInterval while the queue has room, until ctx is
+// cancelled. With BackpressureSpill, it also writes buffered spilled jobs, and replays those spilled before
+// a restart.
+func (q *Queue) Run(ctx context.Context) {
+	if q.strategy != BackpressureSkip && q.strategy != BackpressureSpill {
+		return
+	}
+	ticker := time.NewTicker(q.replayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.replay(ctx)
+		}
+	}
+}
+
+// replay moves as many skipped or spilled jobs into the queue as it has room for. They stay pending until
+// they are in the queue, so Enqueue does not overtake them. Spilled jobs are deleted from the store only once
+// in the queue (a crash in between replays them again), and those that do not fit stay where they are.
+func (q *Queue) replay(ctx context.Context) {
+	if q.strategy == BackpressureSpill {
+		q.flushSpilled(ctx)
+	}
+	room := cap(q.jobs) - len(q.jobs)
+	if room <= 0 {
+		return
+	}
+	n := 0
+	switch q.strategy {
+	case BackpressureSkip:
+		n = q.replaySkipped(room)
+	case BackpressureSpill:
+		n = q.replaySpilled(ctx, room)
+	}
+	if n > 0 {
+		q.log.Debug("jobs replayed", "jobs", n, "pending", q.Pending())
+	}
+}
+
+// replaySkipped moves up to room skipped jobs into the queue. Returns the number moved.
+func (q *Queue) replaySkipped(room int) int {
+	q.mu.Lock()
+	n := min(room, len(q.skipped))
+	jobs := slices.Clone(q.skipped[:n])
+	q.skipped = q.skipped[n:]
+	q.replaying = n
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.replaying = 0
+		q.mu.Unlock()
+	}()
+	for i, job := range jobs {
+		select {
+		case q.jobs <- job:
+			q.counts[QueueReplayed].Add(1)
+		default:
+			// Back to the front, ahead of the jobs skipped meanwhile.
+			q.mu.Lock()
+			q.skipped = append(jobs[i:], q.skipped...)
+			q.mu.Unlock()
+			return i
+		}
+	}
+	return len(jobs)
+}
+
+// replaySpilled moves up to room of the oldest spilled jobs into the queue and deletes them from the store.
+// Returns the number moved.
+func (q *Queue) replaySpilled(ctx context.Context, room int) int {
+	rows, err := q.store.SpilledJobs(ctx, room)
+	if err != nil {
+		q.log.Warn("read spilled jobs", "err", err)
+		return 0
+	}
+	ids := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		select {
+		case q.jobs <- CommitJob{EventID: r.EventID, Owner: r.Owner, Repo: r.Repo, SHA: r.Sha}:
+			q.counts[QueueReplayed].Add(1)
+			ids = append(ids, r.ID)
+			continue
+		default:
+		}
+		break
+	}
+	if err := q.store.DeleteSpilledJobs(ctx, ids); err != nil {
+		q.log.Warn("delete replayed jobs, they will be replayed again", "jobs", len(ids), "err", err)
+		return len(ids)
+	}
+	q.mu.Lock()
+	q.spilled = max(q.spilled-len(ids), 0)
+	q.mu.Unlock()
+	return len(ids)
+}
+
+// Close closes the jobs channel once nothing enqueues anymore (the producer and Run have stopped). Skipped
+// jobs not replayed yet are lost; spilled ones are written to the store (within ShutdownFlushTimeout) and
+// replayed by the next run.
+func (q *Queue) Close() {
+	if q.strategy == BackpressureSpill {
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownFlushTimeout)
+		q.flushSpilled(ctx)
+		cancel()
+	}
+	q.mu.Lock()
+	skipped, unspilled := len(q.skipped), len(q.unspilled)
+	q.mu.Unlock()
+	if skipped > 0 {
+		q.log.Warn("skipped jobs not replayed", "jobs", skipped)
+	}
+	if unspilled > 0 {
+		q.log.Warn("spilled jobs not written to the store", "jobs", unspilled)
+	}
+	close(q.jobs)
+}
+
+// Status returns the strategy, depth, pending jobs and outcome counters of the queue.
+func (q *Queue) Status() QueueStatus {
+	counts := make(map[string]int64, len(q.counts))
+	for o, n := range q.counts {
+		counts[o] = n.Load()
+	}
+	return QueueStatus{
+		Strategy: q.strategy,
+		Depth:    q.Len(),
+		Capacity: q.Cap(),
+		Pending:  q.Pending(),
+		Counts:   counts,
+	}
+}
@@ -0,0 +1,278 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+// testQueue returns a blocking queue of size jobs.
+func testQueue(t *testing.T, size int) *Queue {
+	t.Helper()
+	q, err := NewQueue(size, BackpressureBlock, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// slowConsumer takes jobs from q until it is closed, spending delay on each, and records them.
+type slowConsumer struct {
+	mu   sync.Mutex
+	got  []CommitJob
+	done chan struct{}
+}
+
+func consumeSlowly(q *Queue, delay time.Duration) *slowConsumer {
+	c := &slowConsumer{done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		for job := range q.Jobs() {
+			time.Sleep(delay)
+			c.mu.Lock()
+			c.got = append(c.got, job)
+			c.mu.Unlock()
+		}
+	}()
+	return c
+}
+
+func (c *slowConsumer) jobs() []CommitJob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]CommitJob(nil), c.got...)
+}
+
+// enqueueN enqueues jobs sha0..sha<n-1>.
+func enqueueN(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := q.Enqueue(context.Background(), CommitJob{Owner: "o", Repo: "r", SHA: fmt.Sprintf("sha%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func shas(jobs []CommitJob) []string {
+	out := make([]string, len(jobs))
+	for i, j := range jobs {
+		out[i] = j.SHA
+	}
+	return out
+}
+
+func TestNewQueue_RejectsUnknownStrategy(t *testing.T) {
+	if _, err := NewQueue(1, "lifo", nil); err == nil {
+		t.Error("unknown strategy want error")
+	}
+	if _, err := NewQueue(1, BackpressureSpill, nil); err == nil {
+		t.Error("spill without a store want error")
+	}
+}
+
+func TestQueue_BlockWaitsForSlowConsumer(t *testing.T) {
+	q := testQueue(t, 2)
+	c := consumeSlowly(q, 5*time.Millisecond)
+	enqueueN(t, q, 10)
+	q.Close()
+	<-c.done
+
+	if got := shas(c.jobs()); len(got) != 10 || got[0] != "sha0" || got[9] != "sha9" {
+		t.Errorf("want every job in order got %v", got)
+	}
+	st := q.Status()
+	if st.Counts[QueueEnqueued] != 10 || st.Counts[QueueBlocked] == 0 || st.Counts[QueueDropped] != 0 {
+		t.Errorf("unexpected counts %v", st.Counts)
+	}
+}
+
+func TestQueue_SkipRecordsAndReplaysWhenConsumerCatchesUp(t *testing.T) {
+	q, err := NewQueue(2, BackpressureSkip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.replayInterval = time.Millisecond
+	enqueueN(t, q, 10) // consumer stalled: returns at once
+	if st := q.Status(); st.Counts[QueueEnqueued] != 2 || st.Counts[QueueSkipped] != 8 || st.Pending != 8 || st.Counts[QueueBlocked] != 0 {
+		t.Fatalf("want 2 enqueued and 8 skipped got %+v", st)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+	c := consumeSlowly(q, 2*time.Millisecond)
+	waitFor(t, "replayed jobs", func() bool { return len(c.jobs()) == 10 })
+	if st := q.Status(); st.Counts[QueueReplayed] != 8 || st.Pending != 0 {
+		t.Errorf("want 8 replayed and none pending got %+v", st)
+	}
+}
+
+func TestQueue_ReplaysBacklogBeforeNewJobs(t *testing.T) {
+	for _, strategy := range []string{BackpressureSkip, BackpressureSpill} {
+		t.Run(strategy, func(t *testing.T) {
+			q, err := NewQueue(2, strategy, store.NewMemory())
+			if err != nil {
+				t.Fatal(err)
+			}
+			q.replayInterval = time.Millisecond
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go q.Run(ctx)
+			c := consumeSlowly(q, 3*time.Millisecond)
+
+			// The producer keeps enqueueing while the backlog is replayed, with room freed in between.
+			const n = 100
+			for i := 0; i < n; i++ {
+				if err := q.Enqueue(ctx, CommitJob{Owner: "o", Repo: "r", SHA: fmt.Sprintf("sha%d", i)}); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(500 * time.Microsecond)
+			}
+			waitFor(t, "every job", func() bool { return len(c.jobs()) == n })
+
+			for i, sha := range shas(c.jobs()) {
+				if want := fmt.Sprintf("sha%d", i); sha != want {
+					t.Fatalf("job %d want %s got %s: newer jobs overtook the backlog", i, want, sha)
+				}
+			}
+			if st := q.Status(); st.Counts[QueueReplayed] == 0 || st.Pending != 0 {
+				t.Errorf("want jobs replayed and none pending got %+v", st)
+			}
+		})
+	}
+}
+
+func TestQueue_DropOldestKeepsNewestJobs(t *testing.T) {
+	q, err := NewQueue(3, BackpressureDropOldest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueueN(t, q, 10)
+	q.Close()
+	var got []CommitJob
+	for job := range q.Jobs() {
+		got = append(got, job)
+	}
+
+	if s := shas(got); len(s) != 3 || s[0] != "sha7" || s[2] != "sha9" {
+		t.Errorf("want the 3 newest jobs got %v", s)
+	}
+	if st := q.Status(); st.Counts[QueueEnqueued] != 10 || st.Counts[QueueDropped] != 7 || st.Pending != 0 {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
+
+func TestQueue_SpillReplaysFromStoreAfterRestart(t *testing.T) {
+	st := store.NewMemory()
+	ctx := context.Background()
+	q, err := NewQueue(2, BackpressureSpill, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueueN(t, q, 10)
+	if s := q.Status(); s.Counts[QueueSpilled] != 8 || s.Pending != 8 {
+		t.Fatalf("want 8 spilled got %+v", s)
+	}
+	q.Close() // restart: the queued jobs are consumed, the spilled ones are written to the store
+	if n, _ := st.SpilledJobsCount(ctx); n != 8 {
+		t.Fatalf("want 8 jobs in the overflow got %d", n)
+	}
+
+	q, err = NewQueue(2, BackpressureSpill, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Before Run starts, a new job already queues up behind the overflow.
+	if err := q.Enqueue(ctx, CommitJob{Owner: "o", Repo: "r", SHA: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 0 || q.Pending() != 9 {
+		t.Fatalf("want the new job spilled behind 8 others got depth %d and %d pending", q.Len(), q.Pending())
+	}
+	q.replayInterval = time.Millisecond
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go q.Run(runCtx)
+	c := consumeSlowly(q, 2*time.Millisecond)
+	waitFor(t, "replayed jobs", func() bool { return len(c.jobs()) == 9 })
+
+	if got := shas(c.jobs()); got[0] != "sha2" || got[7] != "sha9" || got[8] != "new" {
+		t.Errorf("want spilled jobs replayed oldest first got %v", got)
+	}
+	if n, _ := st.SpilledJobsCount(ctx); n != 0 || q.Pending() != 0 || q.Status().Counts[QueueReplayed] != 9 {
+		t.Errorf("want the overflow emptied got %d left and %+v", n, q.Status())
+	}
+}
+
+func TestQueue_SpillWritesInBatches(t *testing.T) {
+	st := store.NewMemory()
+	ctx := context.Background()
+	q, err := NewQueue(2, BackpressureSpill, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueueN(t, q, 2+2*SpillBatchSize+50)
+	if n, _ := st.SpilledJobsCount(ctx); n != 2*SpillBatchSize {
+		t.Errorf("want %d jobs written in full batches got %d", 2*SpillBatchSize, n)
+	}
+	if p := q.Pending(); p != 2*SpillBatchSize+50 {
+		t.Errorf("want the unwritten jobs pending too got %d", p)
+	}
+	q.replay(ctx) // the queue is full: only writes the rest
+	if n, _ := st.SpilledJobsCount(ctx); n != 2*SpillBatchSize+50 {
+		t.Errorf("want every job written got %d", n)
+	}
+}
+
+func TestQueue_ReplayKeepsUndeliveredJobsInPlace(t *testing.T) {
+	st := store.NewMemory()
+	ctx := context.Background()
+	q, err := NewQueue(2, BackpressureSpill, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueueN(t, q, 7)
+	<-q.Jobs() // room for one replayed job
+	q.replay(ctx)
+
+	rows, err := st.SpilledJobs(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(rows); got != 4 || rows[0].Sha != "sha3" || rows[3].Sha != "sha6" {
+		t.Errorf("want sha3..sha6 left in the overflow in order got %d rows", got)
+	}
+	if q.Pending() != 4 || q.Status().Counts[QueueReplayed] != 1 {
+		t.Errorf("want 1 replayed and 4 pending got %+v", q.Status())
+	}
+}
+
+func TestQueue_SpillWaitsForBacklogWhenStoreFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().SpilledJobsCount(gomock.Any()).Return(int64(0), nil)
+	mockStore.EXPECT().SpillJobs(gomock.Any(), gomock.Any()).Return(errors.New("db down")).AnyTimes()
+	q, err := NewQueue(1, BackpressureSpill, mockStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.maxSkipped = 2
+	q.replayInterval = time.Millisecond
+	enqueueN(t, q, 3) // one queued, two buffered
+	<-q.Jobs()        // room, but the buffered jobs come first
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Enqueue(ctx, CommitJob{SHA: "sha3"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want blocked until the deadline got %v", err)
+	}
+	if st := q.Status(); st.Counts[QueueBlocked] != 1 || st.Counts[QueueSpilled] != 2 || st.Depth != 0 {
+		t.Errorf("want the job kept out of the queue got %+v", st)
+	}
+}
@@ -0,0 +1,90 @@
+package pubsub
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/challenge-github-events/internal/github"
+)
+
+// EventHandler ingests one event of the type it is registered for.
+// Returning ctx.Err() (or wrapping it) stops the producer.
+type EventHandler interface {
+	HandleEvent(ctx context.Context, e *github.Event) error
+}
+
+// EventHandlerFunc adapts a function to EventHandler.
+type EventHandlerFunc func(ctx context.Context, e *github.Event) error
+
+// HandleEvent calls f(ctx, e).
+func (f EventHandlerFunc) HandleEvent(ctx context.Context, e *github.Event) error {
+	return f(ctx, e)
+}
+
+// Registry maps GitHub event types to handlers and counts the events dispatched to each since startup.
+// Events of unregistered types are ignored.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]EventHandler
+	counts   map[string]*atomic.Int64
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]EventHandler), counts: make(map[string]*atomic.Int64)}
+}
+
+// Register sets the handler for eventType, replacing any previous one.
+func (r *Registry) Register(eventType string, h EventHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[eventType] = h
+	if _, ok := r.counts[eventType]; !ok {
+		r.counts[eventType] = new(atomic.Int64)
+	}
+}
+
+// Unregister removes the handler for eventType.
+func (r *Registry) Unregister(eventType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.handlers, eventType)
+}
+
+// Types returns the registered event types, sorted.
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Dispatch hands e to the handler registered for its type. Returns handled=false when none is registered.
+func (r *Registry) Dispatch(ctx context.Context, e *github.Event) (handled bool, err error) {
+	r.mu.RLock()
+	h, ok := r.handlers[e.Type]
+	n := r.counts[e.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	n.Add(1)
+	return true, h.HandleEvent(ctx, e)
+}
+
+// Counts returns the number of events dispatched per event type since startup.
+func (r *Registry) Counts() map[string]int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]int64, len(r.counts))
+	for t, n := range r.counts {
+		out[t] = n.Load()
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRegistry_DispatchesByTypeAndCounts(t *testing.T) {
+	ctx := context.Background()
+	var got []string
+	r := NewRegistry()
+	r.Register("A", EventHandlerFunc(func(_ context.Context, e *github.Event) error {
+		got = append(got, "A:"+e.ID)
+		return nil
+	}))
+
+	if handled, err := r.Dispatch(ctx, &github.Event{ID: "1", Type: "A"}); !handled || err != nil {
+		t.Errorf("type A want handled got handled=%v err=%v", handled, err)
+	}
+	if handled, _ := r.Dispatch(ctx, &github.Event{ID: "2", Type: "B"}); handled {
+		t.Error("unregistered type B want not handled")
+	}
+	r.Dispatch(ctx, &github.Event{ID: "3", Type: "A"})
+
+	if len(got) != 2 || got[1] != "A:3" {
+		t.Errorf("handled want [A:1 A:3] got %v", got)
+	}
+	if c := r.Counts(); c["A"] != 2 || c["B"] != 0 {
+		t.Errorf("counts want A=2 B=0 got %v", c)
+	}
+	if types := r.Types(); len(types) != 1 || types[0] != "A" {
+		t.Errorf("types want [A] got %v", types)
+	}
+}
+
+func TestActivityHandlers_PullRequestEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+
+	payload, _ := json.Marshal(github.PullRequestEventPayload{
+		Action:      "closed",
+		Number:      7,
+		PullRequest: github.PullRequest{Title: "Fix", State: "closed", Merged: true, Additions: 3, Deletions: 1},
+	})
+	var row *store.PullRequestEventRow
+	mockStore.EXPECT().InsertPullRequestEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, e *store.PullRequestEventRow) (bool, error) {
+		row = e
+		return true, nil
+	})
+
+	h := NewActivityHandlers(mockStore)[github.PullRequestEventType]
+	err := h.HandleEvent(context.Background(), &github.Event{
+		ID:         "e1",
+		Type:       github.PullRequestEventType,
+		Actor:      &github.Actor{Login: "octo"},
+		Repo:       &github.Repo{FullName: "o/r"},
+		RawPayload: payload,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.ID != "e1" || row.Repo != "o/r" || row.ActorLogin != "octo" || row.Number != 7 || !row.Merged || row.Additions != 3 {
+		t.Errorf("pull request row want e1 o/r octo #7 merged add=3 got %+v", row)
+	}
+}
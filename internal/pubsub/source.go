@@ -0,0 +1,60 @@
+package pubsub
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/challenge-github-events/internal/github"
+)
+
+// Source is one polled events stream with its own cadence.
+type Source struct {
+	// Name tags stored events, e.g. "global", "org:golang", "repo:golang/go", "user:octocat".
+	Name string
+	// Path is the events API path, e.g. "/orgs/golang/events".
+	Path string
+	// Interval is the minimum delay between two polls of this source.
+	Interval time.Duration
+}
+
+// GlobalSource returns the global /events source polled every interval.
+func GlobalSource(interval time.Duration) Source {
+	return Source{Name: "global", Path: github.GlobalEventsPath, Interval: interval}
+}
+
+// ParseSource parses a source spec: "global", "org:NAME", "repo:OWNER/NAME" or "user:NAME",
+// optionally followed by "@INTERVAL" (e.g. "org:golang@30s"). defaultInterval applies when no interval is given.
+func ParseSource(spec string, defaultInterval time.Duration) (Source, error) {
+	spec = strings.TrimSpace(spec)
+	interval := defaultInterval
+	if name, iv, ok := strings.Cut(spec, "@"); ok {
+		d, err := time.ParseDuration(iv)
+		if err != nil || d <= 0 {
+			return Source{}, fmt.Errorf("source %q: invalid interval %q", spec, iv)
+		}
+		spec, interval = name, d
+	}
+	if spec == "global" {
+		return GlobalSource(interval), nil
+	}
+	kind, target, ok := strings.Cut(spec, ":")
+	if !ok || target == "" {
+		return Source{}, fmt.Errorf("source %q: want global, org:NAME, repo:OWNER/NAME or user:NAME", spec)
+	}
+	src := Source{Name: kind + ":" + target, Interval: interval}
+	switch kind {
+	case "org":
+		src.Path = "/orgs/" + target + "/events"
+	case "repo":
+		if owner, repo, ok := strings.Cut(target, "/"); !ok || owner == "" || repo == "" {
+			return Source{}, fmt.Errorf("source %q: want repo:OWNER/NAME", spec)
+		}
+		src.Path = "/repos/" + target + "/events"
+	case "user":
+		src.Path = "/users/" + target + "/events/public"
+	default:
+		return Source{}, fmt.Errorf("source %q: unknown kind %q", spec, kind)
+	}
+	return src, nil
+}
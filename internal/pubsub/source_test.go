@@ -0,0 +1,35 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		spec     string
+		name     string
+		path     string
+		interval time.Duration
+	}{
+		{"global", "global", "/events", time.Minute},
+		{"org:golang", "org:golang", "/orgs/golang/events", time.Minute},
+		{"repo:golang/go@30s", "repo:golang/go", "/repos/golang/go/events", 30 * time.Second},
+		{" user:octocat@2m ", "user:octocat", "/users/octocat/events/public", 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		src, err := ParseSource(tt.spec, time.Minute)
+		if err != nil {
+			t.Errorf("ParseSource(%q): %v", tt.spec, err)
+			continue
+		}
+		if src.Name != tt.name || src.Path != tt.path || src.Interval != tt.interval {
+			t.Errorf("ParseSource(%q) want %s %s %s got %s %s %s", tt.spec, tt.name, tt.path, tt.interval, src.Name, src.Path, src.Interval)
+		}
+	}
+	for _, spec := range []string{"", "org:", "repo:golang", "team:x", "org:golang@soon"} {
+		if _, err := ParseSource(spec, time.Minute); err == nil {
+			t.Errorf("ParseSource(%q) want error", spec)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package repometa enriches the repos commits were seen in (commit_repos) with their GitHub metadata (language,
+// stars, fork and parent, default branch, archived flag, license), so stats can be filtered by it. Repos are
+// fetched lazily in small batches, missing ones first, and refreshed once their metadata is older than a TTL.
+// Enrichment only spends the API budget above RateLimitReserve, leaving the rest to the pollers and commit workers.
+package repometa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+)
+
+const (
+	// DefaultInterval is how often Run enriches a batch when no interval is given.
+	DefaultInterval = time.Minute
+	// DefaultTTL is how long metadata is used before it is refreshed when no TTL is given.
+	DefaultTTL = 24 * time.Hour
+	// BatchSize is the maximum number of repos fetched per run.
+	BatchSize = 50
+	// RateLimitReserve is the number of API calls enrichment leaves to the pollers and commit workers
+	// (more than pubsub.RateLimitReserve, so the producer pauses after enrichment does).
+	RateLimitReserve = 500
+)
+
+// Enricher fetches the metadata of stale repos and stores it. Depends only on the store interface and the fetcher.
+type Enricher struct {
+	store    store.Store
+	fetcher  github.RepositoryFetcher
+	ttl      time.Duration
+	interval time.Duration
+	now      func() time.Time
+	log      *slog.Logger
+}
+
+// NewEnricher returns an enricher refreshing metadata older than ttl (DefaultTTL when <= 0) every interval
+// (DefaultInterval when <= 0). When fetcher is a github.RateLimiter, runs stay within the budget above RateLimitReserve.
+func NewEnricher(s store.Store, fetcher github.RepositoryFetcher, ttl, interval time.Duration) *Enricher {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Enricher{
+		store:    s,
+		fetcher:  fetcher,
+		ttl:      ttl,
+		interval: interval,
+		now:      time.Now,
+		log:      slog.Default(),
+	}
+}
+
+// Run enriches a batch at start and then every interval until ctx is cancelled.
+func (e *Enricher) Run(ctx context.Context) {
+	e.log.Info("repo metadata enricher running", "ttl", e.ttl, "interval", e.interval)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		if err := e.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			e.log.Warn("repo metadata", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			e.log.Info("repo metadata enricher stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce fetches and stores the metadata of up to BatchSize stale repos, then moves the commits they share
+// with other repos to their canonical repo. Repos GitHub answers 404 for are stored as not found, so they are
+// retried only after the TTL. Stops early when the budget runs out or the
+// API is rate limited; other fetch errors skip the repo and are returned together.
+func (e *Enricher) RunOnce(ctx context.Context) error {
+	n := e.budget()
+	if n <= 0 {
+		e.log.Debug("repo metadata paused, rate limit budget reserved")
+		return nil
+	}
+	now := e.now()
+	repos, err := e.store.StaleRepositories(ctx, now.Add(-e.ttl), n)
+	if err != nil {
+		return fmt.Errorf("stale repositories: %w", err)
+	}
+	var errs []error
+	var enriched []string
+	for i, repo := range repos {
+		if e.budget() <= 0 {
+			e.log.Debug("repo metadata paused, rate limit budget reserved", "pending", len(repos)-i)
+			break
+		}
+		row, err := e.fetch(ctx, repo)
+		if errors.Is(err, github.ErrRateLimited) {
+			e.log.Info("repo metadata paused, rate limited", "pending", len(repos)-i)
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("fetch %s: %w", repo, err))
+			continue
+		}
+		row.FetchedAt = now
+		if err := e.store.SaveRepository(ctx, row); err != nil {
+			return fmt.Errorf("save %s: %w", repo, err)
+		}
+		enriched = append(enriched, repo)
+	}
+	if len(enriched) > 0 {
+		// Metadata may reveal that commits shared with another repo belong to an upstream.
+		moved, err := e.store.CanonicalizeRepos(ctx, enriched)
+		if err != nil {
+			return fmt.Errorf("canonicalize commits: %w", err)
+		}
+		e.log.Debug("repo metadata refreshed", "repos", len(enriched), "commits_moved", moved)
+	}
+	return errors.Join(errs...)
+}
+
+// fetch returns the metadata row of repo (owner/repo); repos GitHub does not know are returned as not found.
+func (e *Enricher) fetch(ctx context.Context, repo string) (*store.RepositoryRow, error) {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok {
+		return &store.RepositoryRow{Repo: repo}, nil
+	}
+	r, err := e.fetcher.GetRepository(ctx, owner, name)
+	if errors.Is(err, github.ErrNotFound) {
+		return &store.RepositoryRow{Repo: repo}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	row := &store.RepositoryRow{
+		Repo:          repo,
+		Found:         true,
+		Language:      r.Language,
+		Stars:         r.Stars,
+		Fork:          r.Fork,
+		DefaultBranch: r.DefaultBranch,
+		Archived:      r.Archived,
+	}
+	if r.Parent != nil {
+		row.Parent = r.Parent.FullName
+	}
+	if r.License != nil {
+		row.License = r.License.SPDXID
+	}
+	return row, nil
+}
+
+// budget returns the number of repos that may be fetched now: BatchSize, capped by the remaining API budget
+// above RateLimitReserve when the fetcher reports its rate limit.
+func (e *Enricher) budget() int {
+	rl, ok := e.fetcher.(github.RateLimiter)
+	if !ok {
+		return BatchSize
+	}
+	limit := rl.RateLimit()
+	if limit.Reset.IsZero() || !e.now().Before(limit.Reset) {
+		return BatchSize
+	}
+	return min(BatchSize, limit.Remaining-RateLimitReserve)
+}
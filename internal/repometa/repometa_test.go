@@ -0,0 +1,103 @@
+package repometa
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/github"
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// limitedFetcher is a RepositoryFetcher reporting a fixed rate limit.
+type limitedFetcher struct {
+	*github.MockRepositoryFetcher
+	limit github.RateLimit
+}
+
+func (f *limitedFetcher) RateLimit() github.RateLimit { return f.limit }
+
+func TestEnricher_RunOnce_SavesMetadataAndNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	fetcher := github.NewMockRepositoryFetcher(ctrl)
+	mockStore.EXPECT().StaleRepositories(gomock.Any(), now.Add(-DefaultTTL), BatchSize).Return([]string{"me/lib", "o/gone"}, nil)
+	fetcher.EXPECT().GetRepository(gomock.Any(), "me", "lib").Return(&github.Repository{
+		FullName: "me/lib", Language: "Go", Stars: 3, Fork: true, Parent: &github.Repo{FullName: "up/lib"},
+		DefaultBranch: "main", License: &github.License{SPDXID: "MIT"},
+	}, nil)
+	fetcher.EXPECT().GetRepository(gomock.Any(), "o", "gone").Return(nil, github.ErrNotFound)
+	mockStore.EXPECT().SaveRepository(gomock.Any(), &store.RepositoryRow{
+		Repo: "me/lib", Found: true, Language: "Go", Stars: 3, Fork: true, Parent: "up/lib", DefaultBranch: "main", License: "MIT", FetchedAt: now,
+	}).Return(nil)
+	mockStore.EXPECT().SaveRepository(gomock.Any(), &store.RepositoryRow{Repo: "o/gone", FetchedAt: now}).Return(nil)
+	mockStore.EXPECT().CanonicalizeRepos(gomock.Any(), []string{"me/lib", "o/gone"}).Return(int64(2), nil)
+
+	e := NewEnricher(mockStore, fetcher, 0, 0)
+	e.now = func() time.Time { return now }
+	if err := e.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnricher_RunOnce_SkipsFailedReposAndStopsWhenRateLimited(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	fetcher := github.NewMockRepositoryFetcher(ctrl)
+	mockStore.EXPECT().StaleRepositories(gomock.Any(), now.Add(-time.Hour), BatchSize).Return([]string{"o/flaky", "o/ok", "o/limited", "o/later"}, nil)
+	gomock.InOrder(
+		fetcher.EXPECT().GetRepository(gomock.Any(), "o", "flaky").Return(nil, errors.New("boom")),
+		fetcher.EXPECT().GetRepository(gomock.Any(), "o", "ok").Return(&github.Repository{FullName: "o/ok"}, nil),
+		fetcher.EXPECT().GetRepository(gomock.Any(), "o", "limited").Return(nil, github.ErrRateLimited),
+	)
+	mockStore.EXPECT().SaveRepository(gomock.Any(), gomock.Any()).Return(nil)
+	mockStore.EXPECT().CanonicalizeRepos(gomock.Any(), []string{"o/ok"}).Return(int64(0), nil)
+
+	e := NewEnricher(mockStore, fetcher, time.Hour, 0)
+	e.now = func() time.Time { return now }
+	if err := e.RunOnce(context.Background()); err == nil || !strings.Contains(err.Error(), "o/flaky") {
+		t.Fatalf("want o/flaky error got %v", err)
+	}
+}
+
+func TestEnricher_RunOnce_KeepsRateLimitReserve(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	fetcher := &limitedFetcher{MockRepositoryFetcher: github.NewMockRepositoryFetcher(ctrl)}
+	e := NewEnricher(mockStore, fetcher, 0, 0)
+	e.now = func() time.Time { return now }
+
+	// Two calls above the reserve: a batch of two.
+	fetcher.limit = github.RateLimit{Limit: 5000, Remaining: RateLimitReserve + 2, Reset: now.Add(time.Minute)}
+	mockStore.EXPECT().StaleRepositories(gomock.Any(), gomock.Any(), 2).Return([]string{"o/a"}, nil)
+	fetcher.EXPECT().GetRepository(gomock.Any(), "o", "a").Return(&github.Repository{FullName: "o/a"}, nil)
+	mockStore.EXPECT().SaveRepository(gomock.Any(), gomock.Any()).Return(nil)
+	mockStore.EXPECT().CanonicalizeRepos(gomock.Any(), []string{"o/a"}).Return(int64(0), nil)
+	if err := e.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// At the reserve: nothing is fetched until reset.
+	fetcher.limit.Remaining = RateLimitReserve
+	if err := e.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// After reset the reported budget is stale: a full batch.
+	fetcher.limit.Reset = now.Add(-time.Second)
+	mockStore.EXPECT().StaleRepositories(gomock.Any(), gomock.Any(), BatchSize).Return(nil, nil)
+	if err := e.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package retention maintains the monthly partitions of the event and commit tables and applies the
+// data retention policy: expiring old partitions (after rolling them up) and stripping old raw payloads.
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+)
+
+const (
+	// DefaultInterval is how often Run applies the policy.
+	DefaultInterval = time.Hour
+	// PartitionsAhead is the number of monthly partitions kept created ahead of the current month.
+	PartitionsAhead = 3
+)
+
+// Job applies the retention policy to a store.Retainer. Depends only on the store interfaces.
+type Job struct {
+	store      store.Retainer
+	maxAge     time.Duration
+	archive    bool
+	stripAfter time.Duration
+	interval   time.Duration
+	now        func() time.Time
+	log        *slog.Logger
+}
+
+// NewJob returns a job that keeps partitions created ahead and, when maxAge > 0, expires data older than maxAge
+// (detaching partitions instead of dropping them when archive is set). When stripAfter > 0, raw payloads of
+// events older than stripAfter are cleared.
+func NewJob(r store.Retainer, maxAge time.Duration, archive bool, stripAfter time.Duration) *Job {
+	return &Job{
+		store:      r,
+		maxAge:     maxAge,
+		archive:    archive,
+		stripAfter: stripAfter,
+		interval:   DefaultInterval,
+		now:        time.Now,
+		log:        slog.Default(),
+	}
+}
+
+// Run applies the policy at start and then every DefaultInterval until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	j.log.Info("retention job running", "max_age", j.maxAge, "archive", j.archive, "strip_payload_after", j.stripAfter)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		if err := j.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			j.log.Warn("retention", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			j.log.Info("retention job stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce creates upcoming partitions, expires old data and strips old payloads.
+func (j *Job) RunOnce(ctx context.Context) error {
+	now := j.now()
+	if err := j.store.EnsurePartitions(ctx, now, now.AddDate(0, PartitionsAhead, 0)); err != nil {
+		return err
+	}
+	if j.maxAge > 0 {
+		expired, err := j.store.ExpireBefore(ctx, now.Add(-j.maxAge), j.archive)
+		if err != nil {
+			return err
+		}
+		if len(expired) > 0 {
+			j.log.Info("partitions expired", "partitions", expired, "archived", j.archive)
+		}
+	}
+	if j.stripAfter > 0 {
+		n, err := j.store.StripRawPayloads(ctx, now.Add(-j.stripAfter))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			j.log.Info("raw payloads stripped", "events", n)
+		}
+	}
+	return nil
+}
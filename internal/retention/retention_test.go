@@ -0,0 +1,52 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+func TestJob_RunOnce_AppliesPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.Date(2025, 11, 15, 12, 0, 0, 0, time.UTC)
+
+	mockStore := store.NewMockRetainer(ctrl)
+	mockStore.EXPECT().EnsurePartitions(gomock.Any(), now, time.Date(2026, 2, 15, 12, 0, 0, 0, time.UTC)).Return(nil)
+	mockStore.EXPECT().ExpireBefore(gomock.Any(), now.Add(-90*24*time.Hour), true).Return([]string{"commit_stats_y2025m07"}, nil)
+	mockStore.EXPECT().StripRawPayloads(gomock.Any(), now.Add(-7*24*time.Hour)).Return(int64(12), nil)
+
+	job := NewJob(mockStore, 90*24*time.Hour, true, 7*24*time.Hour)
+	job.now = func() time.Time { return now }
+	if err := job.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJob_RunOnce_OnlyMaintainsPartitionsWhenDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockRetainer(ctrl)
+	mockStore.EXPECT().EnsurePartitions(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+	if err := NewJob(mockStore, 0, false, 0).RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJob_RunOnce_StopsOnPartitionError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockRetainer(ctrl)
+	mockStore.EXPECT().EnsurePartitions(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("boom"))
+
+	if err := NewJob(mockStore, time.Hour, false, time.Hour).RunOnce(context.Background()); err == nil {
+		t.Fatal("want error")
+	}
+}
@@ -2,29 +2,99 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/challenge-github-events/internal/export"
+	"github.com/challenge-github-events/internal/pubsub"
 	"github.com/challenge-github-events/internal/store"
 )
 
-// Server serves /health and /stats. Depends only on Store interface.
+// Server serves /health, /stats, /stats/languages, /stats/authors, /stats/events, /anomalies, /trending, /status/pollers, /commits/{sha}/files and /export,
+// the /admin endpoints once SetAdmin is called, /status/autoscaler once SetAutoscaler is called and /status/queue once SetQueue is called.
+// Depends only on Store, Admin, Autoscaler and Queue interfaces.
 type Server struct {
-	store store.Store
-	http  *http.Server
+	store      store.Store
+	defaults   store.StatsFilter
+	admin      Admin
+	adminToken string
+	autoscaler Autoscaler
+	queue      Queue
+	http       *http.Server
+}
+
+// Admin controls the ingestion pipeline (e.g. pubsub.Controller).
+type Admin interface {
+	Pause()
+	Resume()
+	Scale(n int) error
+	ResumeAutoscaling()
+	Drain()
+	Status() pubsub.ControllerStatus
+}
+
+// Autoscaler reports the scaling of the consumer worker pool (e.g. pubsub.Autoscaler).
+type Autoscaler interface {
+	Metrics() pubsub.AutoscalerMetrics
+}
+
+// Queue reports the jobs queue and its backpressure outcomes (e.g. pubsub.Queue).
+type Queue interface {
+	Status() pubsub.QueueStatus
 }
 
 // NewServer returns an HTTP server that uses the given Store.
-func NewServer(addr string, s store.Store) *Server {
+// defaults is the filter aggregate endpoints start from (e.g. ExcludeMerges from MERGE_POLICY).
+func NewServer(addr string, s store.Store, defaults store.StatsFilter) *Server {
 	mux := http.NewServeMux()
-	srv := &Server{store: s}
+	srv := &Server{store: s, defaults: defaults}
 	mux.HandleFunc("/health", srv.handleHealth)
 	mux.HandleFunc("/stats", srv.handleStats)
+	mux.HandleFunc("/stats/languages", srv.handleLanguageStats)
+	mux.HandleFunc("/stats/authors", srv.handleAuthorStats)
+	mux.HandleFunc("/stats/repos", srv.handleRepoStats)
+	mux.HandleFunc("/stats/events", srv.handleEventStats)
+	mux.HandleFunc("/anomalies", srv.handleAnomalies)
+	mux.HandleFunc("/trending", srv.handleTrending)
+	mux.HandleFunc("/status/pollers", srv.handlePollerStatus)
+	mux.HandleFunc("/status/autoscaler", srv.handleAutoscalerStatus)
+	mux.HandleFunc("/status/queue", srv.handleQueueStatus)
+	mux.HandleFunc("/commits/{sha}/files", srv.handleCommitFiles)
+	mux.HandleFunc("/export", srv.handleExport)
+	mux.HandleFunc("/admin/status", srv.adminOnly(http.MethodGet, srv.handleAdminStatus))
+	mux.HandleFunc("/admin/producer/pause", srv.adminOnly(http.MethodPost, srv.handleAdminPause))
+	mux.HandleFunc("/admin/producer/resume", srv.adminOnly(http.MethodPost, srv.handleAdminResume))
+	mux.HandleFunc("/admin/consumers/scale", srv.adminOnly(http.MethodPost, srv.handleAdminScale))
+	mux.HandleFunc("/admin/consumers/autoscale", srv.adminOnly(http.MethodPost, srv.handleAdminAutoscale))
+	mux.HandleFunc("/admin/drain", srv.adminOnly(http.MethodPost, srv.handleAdminDrain))
 	srv.http = &http.Server{Addr: addr, Handler: mux}
 	return srv
 }
 
+// SetAdmin enables the /admin endpoints, authenticated with the given bearer token. Without a call
+// (or with an empty token) they answer 404. Call before Start.
+func (s *Server) SetAdmin(admin Admin, token string) {
+	s.admin, s.adminToken = admin, token
+}
+
+// SetAutoscaler enables /status/autoscaler; without a call it answers 404. Call before Start.
+func (s *Server) SetAutoscaler(a Autoscaler) {
+	s.autoscaler = a
+}
+
+// SetQueue enables /status/queue; without a call it answers 404. Call before Start.
+func (s *Server) SetQueue(q Queue) {
+	s.queue = q
+}
+
 // Start starts the HTTP server (blocking).
 func (s *Server) Start() error {
 	return s.http.ListenAndServe()
@@ -60,13 +130,35 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	netLines, err := s.store.GlobalNetLines(r.Context())
+	filter, err := s.statsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current := filter
+	current.Since = time.Time{}
+	netLines, err := s.store.GlobalNetLines(r.Context(), current)
 	if err != nil {
 		slog.Error("stats: global net lines", "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	eventsCount, err := s.store.EventsSeenCount(r.Context())
+	resp := map[string]interface{}{
+		"global_net_lines_current": netLines,
+		"lines":                    linesMode(filter),
+		"bots":                     botsMode(filter),
+	}
+	if !filter.Since.IsZero() {
+		delta, err := s.store.GlobalNetLines(r.Context(), filter)
+		if err != nil {
+			slog.Error("stats: global net lines delta", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp["global_net_lines_delta_window"] = delta
+		resp["window"] = r.URL.Query().Get("window")
+	}
+	eventsCount, err := s.store.EventsSeenCount(r.Context(), store.EventFilter{ExcludeBots: filter.ExcludeBots})
 	if err != nil {
 		slog.Error("stats: events count", "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -75,8 +167,784 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	slog.Debug("stats served", "net_lines", netLines, "events_count", eventsCount)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	resp["events_seen_since_start"] = eventsCount
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// directoryStats is the line stats of all files of a commit under one directory.
+type directoryStats struct {
+	Directory string `json:"directory"`
+	Files     int    `json:"files"`
+	Additions int64  `json:"additions"`
+	Deletions int64  `json:"deletions"`
+	Net       int64  `json:"net"`
+}
+
+func (s *Server) handleCommitFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Debug("commit files method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sha := r.PathValue("sha")
+	files, err := s.store.CommitFiles(r.Context(), sha)
+	if err != nil {
+		slog.Error("commit files", "sha", sha, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(files) == 0 {
+		http.Error(w, "commit files not found", http.StatusNotFound)
+		return
+	}
+
+	out := make([]map[string]interface{}, 0, len(files))
+	byDir := make(map[string]*directoryStats)
+	for _, f := range files {
+		out = append(out, map[string]interface{}{
+			"filename":  f.Filename,
+			"status":    f.Status,
+			"additions": f.Additions,
+			"deletions": f.Deletions,
+			"changes":   f.Changes,
+			"net":       f.Additions - f.Deletions,
+			"excluded":  f.Excluded,
+		})
+		dir := path.Dir(f.Filename)
+		d, ok := byDir[dir]
+		if !ok {
+			d = &directoryStats{Directory: dir}
+			byDir[dir] = d
+		}
+		d.Files++
+		d.Additions += f.Additions
+		d.Deletions += f.Deletions
+		d.Net += f.Additions - f.Deletions
+	}
+	dirs := make([]*directoryStats, 0, len(byDir))
+	for _, d := range byDir {
+		dirs = append(dirs, d)
+	}
+	// Directories driving the most line growth first.
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].Net != dirs[j].Net {
+			return dirs[i].Net > dirs[j].Net
+		}
+		return dirs[i].Directory < dirs[j].Directory
+	})
+
+	slog.Debug("commit files served", "sha", sha, "files", len(files))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"global_net_lines_current": netLines,
-		"events_seen_since_start":  eventsCount,
+		"sha":         sha,
+		"files":       out,
+		"directories": dirs,
+	})
+}
+
+// statsFilter parses the aggregate query parameters shared by stats endpoints on top of the server defaults:
+// lines=raw|adjusted (default raw), window (e.g. 1h, 7d; default all time), merges=count|skip,
+// orphaned=include|exclude, bots=include|exclude and branch (a branch name, or "default" for each repo's default branch).
+func (s *Server) statsFilter(r *http.Request) (store.StatsFilter, error) {
+	f := s.defaults
+	q := r.URL.Query()
+	switch q.Get("lines") {
+	case "", "raw":
+	case "adjusted":
+		f.Adjusted = true
+	default:
+		return f, fmt.Errorf("invalid lines %q: want raw or adjusted", q.Get("lines"))
+	}
+	switch q.Get("merges") {
+	case "":
+	case "count":
+		f.ExcludeMerges = false
+	case "skip":
+		f.ExcludeMerges = true
+	default:
+		return f, fmt.Errorf("invalid merges %q: want count or skip", q.Get("merges"))
+	}
+	switch q.Get("orphaned") {
+	case "":
+	case "include":
+		f.ExcludeOrphaned = false
+	case "exclude":
+		f.ExcludeOrphaned = true
+	default:
+		return f, fmt.Errorf("invalid orphaned %q: want include or exclude", q.Get("orphaned"))
+	}
+	switch q.Get("bots") {
+	case "":
+	case "include":
+		f.ExcludeBots = false
+	case "exclude":
+		f.ExcludeBots = true
+	default:
+		return f, fmt.Errorf("invalid bots %q: want include or exclude", q.Get("bots"))
+	}
+	if v := q.Get("branch"); v != "" {
+		f.Branch = v
+	}
+	switch q.Get("forks") {
+	case "", "include":
+	case "exclude":
+		f.Forks = store.ForksExclude
+	case "only":
+		f.Forks = store.ForksOnly
+	default:
+		return f, fmt.Errorf("invalid forks %q: want include, exclude or only", q.Get("forks"))
+	}
+	if v := q.Get("repo_language"); v != "" {
+		f.RepoLanguage = v
+	}
+	if v := q.Get("min_stars"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("invalid min_stars %q", v)
+		}
+		f.MinStars = n
+	}
+	if v := q.Get("window"); v != "" {
+		d, err := parseWindow(v)
+		if err != nil {
+			return f, err
+		}
+		f.Since = time.Now().Add(-d)
+	}
+	return f, nil
+}
+
+// parseWindow parses a positive Go duration, also accepting whole days (e.g. "7d").
+func parseWindow(v string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", v)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return 0, fmt.Errorf("invalid window %q", v)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid window %q: must be positive", v)
+	}
+	return d, nil
+}
+
+func linesMode(f store.StatsFilter) string {
+	if f.Adjusted {
+		return "adjusted"
+	}
+	return "raw"
+}
+
+func botsMode(f store.StatsFilter) string {
+	if f.ExcludeBots {
+		return "exclude"
+	}
+	return "include"
+}
+
+func (s *Server) handleLanguageStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Debug("language stats method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := s.statsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	langs, err := s.store.LanguageStats(r.Context(), filter)
+	if err != nil {
+		slog.Error("language stats", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// net_share is relative to the sum of absolute nets, so it stays within [-1, 1] when nets cancel out.
+	var totalAdd, totalDel, totalAbsNet int64
+	for _, l := range langs {
+		totalAdd += l.Additions
+		totalDel += l.Deletions
+		totalAbsNet += max(l.Net, -l.Net)
+	}
+	out := make([]map[string]interface{}, 0, len(langs))
+	for _, l := range langs {
+		out = append(out, map[string]interface{}{
+			"language":  l.Language,
+			"commits":   l.Commits,
+			"additions": l.Additions,
+			"deletions": l.Deletions,
+			"net":       l.Net,
+			"share":     ratio(l.Additions+l.Deletions, totalAdd+totalDel),
+			"net_share": ratio(l.Net, totalAbsNet),
+		})
+	}
+	slog.Debug("language stats served", "languages", len(langs))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":    r.URL.Query().Get("window"),
+		"lines":     linesMode(filter),
+		"bots":      botsMode(filter),
+		"languages": out,
+		"totals": map[string]int64{
+			"additions": totalAdd,
+			"deletions": totalDel,
+			"net":       totalAdd - totalDel,
+		},
+	})
+}
+
+// Author stats limits (?limit=).
+const (
+	defaultAuthorLimit = 50
+	maxAuthorLimit     = 1000
+)
+
+func (s *Server) handleAuthorStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Debug("author stats method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := s.statsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultAuthorLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxAuthorLimit {
+			http.Error(w, fmt.Sprintf("invalid limit %q: want 1 to %d", v, maxAuthorLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	authors, err := s.store.AuthorStats(r.Context(), filter, limit)
+	if err != nil {
+		slog.Error("author stats", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(authors))
+	for _, a := range authors {
+		out = append(out, map[string]interface{}{
+			"author_id": a.AuthorID,
+			"name":      a.Name,
+			"email":     a.Email,
+			"login":     a.Login,
+			"commits":   a.Commits,
+			"additions": a.Additions,
+			"deletions": a.Deletions,
+			"net":       a.Net,
+		})
+	}
+	slog.Debug("author stats served", "authors", len(authors))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":  r.URL.Query().Get("window"),
+		"lines":   linesMode(filter),
+		"bots":    botsMode(filter),
+		"authors": out,
+	})
+}
+
+// ratio returns part/total, or 0 when total is 0.
+func ratio(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// Repo stats limits (?limit=).
+const (
+	defaultRepoLimit = 50
+	maxRepoLimit     = 1000
+)
+
+func (s *Server) handleRepoStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Debug("repo stats method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := s.statsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	shared := q.Get("shared")
+	switch shared {
+	case "":
+		shared = "canonical"
+	case "canonical", "every":
+	default:
+		http.Error(w, fmt.Sprintf("invalid shared %q: want canonical or every", shared), http.StatusBadRequest)
+		return
+	}
+	limit := defaultRepoLimit
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxRepoLimit {
+			http.Error(w, fmt.Sprintf("invalid limit %q: want 1 to %d", v, maxRepoLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	repos, err := s.store.RepoStats(r.Context(), filter, shared == "every", limit)
+	if err != nil {
+		slog.Error("repo stats", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(repos))
+	for _, rs := range repos {
+		out = append(out, map[string]interface{}{
+			"repo":           rs.Repo,
+			"commits":        rs.Commits,
+			"shared_commits": rs.Shared,
+			"additions":      rs.Additions,
+			"deletions":      rs.Deletions,
+			"net":            rs.Net,
+		})
+	}
+	slog.Debug("repo stats served", "repos", len(repos), "shared", shared)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"window": q.Get("window"),
+		"lines":  linesMode(filter),
+		"bots":   botsMode(filter),
+		"shared": shared,
+		"repos":  out,
+	})
+}
+
+func (s *Server) handleEventStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Debug("event stats method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := s.statsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	counts, err := s.store.EventCountsByType(r.Context(), store.EventFilter{ExcludeBots: filter.ExcludeBots})
+	if err != nil {
+		slog.Error("event stats", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	slog.Debug("event stats served", "total", total)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"events_by_type": counts,
+		"events_total":   total,
+		"bots":           botsMode(filter),
+	})
+}
+
+// Anomaly list limits (?limit=).
+const (
+	defaultAnomalyLimit = 100
+	maxAnomalyLimit     = 1000
+)
+
+// handleAnomalies lists outlier commits, latest first: window (e.g. 7d; default all time), repo and limit.
+func (s *Server) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Debug("anomalies method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter := store.AnomalyFilter{Repo: q.Get("repo"), Limit: defaultAnomalyLimit}
+	if v := q.Get("window"); v != "" {
+		d, err := parseWindow(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Since = time.Now().Add(-d)
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAnomalyLimit {
+			http.Error(w, fmt.Sprintf("invalid limit %q: want 1 to %d", v, maxAnomalyLimit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	anomalies, err := s.store.Anomalies(r.Context(), filter)
+	if err != nil {
+		slog.Error("anomalies", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(anomalies))
+	for _, a := range anomalies {
+		out = append(out, map[string]interface{}{
+			"sha":          a.Sha,
+			"repo":         a.Repo,
+			"author":       a.Author,
+			"committed_at": a.CommittedAt,
+			"detected_at":  a.DetectedAt,
+			"additions":    a.Additions,
+			"deletions":    a.Deletions,
+			"lines":        a.Additions + a.Deletions,
+			"method":       a.Method,
+			"baseline":     a.Baseline,
+			"samples":      a.Samples,
+			"score":        a.Score,
+			"limit":        a.Limit,
+			"capped":       a.Capped,
+		})
+	}
+	slog.Debug("anomalies served", "anomalies", len(anomalies))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":    q.Get("window"),
+		"anomalies": out,
+	})
+}
+
+const (
+	defaultTrendingWindow = "24h"
+	defaultTrendingLimit  = 20
+	maxTrendingLimit      = 100
+)
+
+// handleTrending serves the latest trending snapshot of a window (e.g. 1h, 7d; default 24h) computed by the
+// trending job, top limit repos first.
+func (s *Server) handleTrending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Debug("trending method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	window := q.Get("window")
+	if window == "" {
+		window = defaultTrendingWindow
+	}
+	d, err := parseWindow(window)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultTrendingLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTrendingLimit {
+			http.Error(w, fmt.Sprintf("invalid limit %q: want 1 to %d", v, maxTrendingLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	rows, err := s.store.Trending(r.Context(), d, limit)
+	if err != nil {
+		slog.Error("trending", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var computedAt *time.Time
+	repos := make([]map[string]interface{}, 0, len(rows))
+	for _, t := range rows {
+		computedAt = &t.ComputedAt
+		samples := make([]map[string]interface{}, 0, len(t.Samples))
+		for _, c := range t.Samples {
+			samples = append(samples, map[string]interface{}{
+				"sha":          c.Sha,
+				"author":       c.Author,
+				"committed_at": c.CommittedAt,
+				"additions":    c.Additions,
+				"deletions":    c.Deletions,
+			})
+		}
+		repos = append(repos, map[string]interface{}{
+			"rank":           t.Rank,
+			"repo":           t.Repo,
+			"score":          t.Score,
+			"velocity":       t.Velocity,
+			"pushes":         t.Pushes,
+			"commits":        t.Commits,
+			"sample_commits": samples,
+		})
+	}
+	slog.Debug("trending served", "window", window, "repos", len(rows))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":      window,
+		"computed_at": computedAt,
+		"repos":       repos,
+	})
+}
+
+// pollerStatus is one source in the /status/pollers response.
+type pollerStatus struct {
+	Source      string     `json:"source"`
+	ETag        string     `json:"etag,omitempty"`
+	LastEventID string     `json:"last_event_id,omitempty"`
+	LastPollAt  *time.Time `json:"last_poll_at,omitempty"`
+	LastStatus  string     `json:"last_status"`
+}
+
+func (s *Server) handlePollerStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Debug("poller status method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	states, err := s.store.PollerStates(r.Context())
+	if err != nil {
+		slog.Error("poller status", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pollers := make([]pollerStatus, 0, len(states))
+	for _, st := range states {
+		ps := pollerStatus{Source: st.Source, ETag: st.ETag, LastEventID: st.LastEventID, LastStatus: st.LastStatus}
+		if !st.LastPollAt.IsZero() {
+			lastPoll := st.LastPollAt
+			ps.LastPollAt = &lastPoll
+		}
+		pollers = append(pollers, ps)
+	}
+	slog.Debug("poller status served", "sources", len(pollers))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"pollers": pollers})
+}
+
+type scaleDecision struct {
+	At     time.Time `json:"at"`
+	From   int       `json:"from"`
+	To     int       `json:"to"`
+	Reason string    `json:"reason"`
+}
+
+// handleAutoscalerStatus reports the inputs of the last autoscaling evaluation and the recent decisions.
+func (s *Server) handleAutoscalerStatus(w http.ResponseWriter, r *http.Request) {
+	if s.autoscaler == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		slog.Debug("autoscaler status method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m := s.autoscaler.Metrics()
+	decisions := make([]scaleDecision, 0, len(m.Decisions))
+	for _, d := range m.Decisions {
+		decisions = append(decisions, scaleDecision{At: d.At, From: d.From, To: d.To, Reason: d.Reason})
+	}
+	var remaining *int
+	if m.RateRemaining >= 0 {
+		remaining = &m.RateRemaining
+	}
+	var evaluatedAt *time.Time
+	if !m.EvaluatedAt.IsZero() {
+		evaluatedAt = &m.EvaluatedAt
+	}
+	slog.Debug("autoscaler status served", "workers", m.Workers)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"min_workers":          m.Min,
+		"max_workers":          m.Max,
+		"workers":              m.Workers,
+		"queue_depth":          m.QueueDepth,
+		"queue_capacity":       m.QueueCapacity,
+		"job_latency_ms":       m.JobLatency.Milliseconds(),
+		"rate_limit_remaining": remaining,
+		"worker_restarts":      m.Restarts,
+		"suspended":            m.Suspended,
+		"scale_ups":            m.ScaleUps,
+		"scale_downs":          m.ScaleDowns,
+		"evaluated_at":         evaluatedAt,
+		"decisions":            decisions,
+	})
+}
+
+// handleQueueStatus reports the backpressure strategy, depth and outcome counters of the jobs queue.
+func (s *Server) handleQueueStatus(w http.ResponseWriter, r *http.Request) {
+	if s.queue == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		slog.Debug("queue status method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st := s.queue.Status()
+	slog.Debug("queue status served", "depth", st.Depth, "pending", st.Pending)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"strategy": st.Strategy,
+		"depth":    st.Depth,
+		"capacity": st.Capacity,
+		"pending":  st.Pending,
+		"counts":   st.Counts,
 	})
 }
+
+// handleExport streams rows as a file download: table=commits|push_events (default commits),
+// format=ndjson|csv|parquet (default ndjson), from and to (RFC 3339 or YYYY-MM-DD), repo and author.
+// Errors after the first byte can only be logged: the response is cut short.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		slog.Debug("export method not allowed", "method", r.Method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	table := q.Get("table")
+	if table == "" {
+		table = export.TableCommits
+	}
+	if err := export.CheckTable(table); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := export.ParseFormat(q.Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := export.ParseFilter(q.Get("from"), q.Get("to"), q.Get("repo"), q.Get("author"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, table, format))
+	n, err := export.Export(r.Context(), s.store, table, filter, format, w)
+	if err != nil {
+		slog.Error("export", "table", table, "format", format, "rows", n, "err", err)
+		return
+	}
+	slog.Debug("export served", "table", table, "format", format, "rows", n)
+}
+
+// adminOnly wraps an /admin handler: 404 unless SetAdmin was called with a token, 405 for other methods
+// than method and 401 without the bearer token.
+func (s *Server) adminOnly(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.admin == nil || s.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != method {
+			slog.Debug("admin method not allowed", "path", r.URL.Path, "method", r.Method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			slog.Warn("admin request unauthorized", "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+type adminStatus struct {
+	Producer       string `json:"producer"`
+	Workers        int    `json:"workers"`
+	RunningWorkers int    `json:"running_workers"`
+	QueueDepth     int    `json:"queue_depth"`
+	QueueCapacity  int    `json:"queue_capacity"`
+	QueuePending   int    `json:"queue_pending"`
+	Draining       bool   `json:"draining"`
+	Drained        bool   `json:"drained"`
+	Restarts       int64  `json:"worker_restarts"`
+	// AutoscaleSuspended is set after a manual scale until POST /admin/consumers/autoscale.
+	AutoscaleSuspended bool `json:"autoscale_suspended"`
+}
+
+// writeAdminStatus answers with the pipeline state after an admin action.
+func (s *Server) writeAdminStatus(w http.ResponseWriter, code int) {
+	st := s.admin.Status()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(adminStatus{
+		Producer:           st.Producer,
+		Workers:            st.Workers,
+		RunningWorkers:     st.Running,
+		QueueDepth:         st.QueueDepth,
+		QueueCapacity:      st.QueueCapacity,
+		QueuePending:       st.QueuePending,
+		Draining:           st.Draining,
+		Drained:            st.Drained,
+		Restarts:           st.Restarts,
+		AutoscaleSuspended: st.AutoscaleSuspended,
+	})
+}
+
+func (s *Server) handleAdminStatus(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("admin status served")
+	s.writeAdminStatus(w, http.StatusOK)
+}
+
+func (s *Server) handleAdminPause(w http.ResponseWriter, r *http.Request) {
+	s.admin.Pause()
+	slog.Info("admin: producer paused", "remote", r.RemoteAddr)
+	s.writeAdminStatus(w, http.StatusOK)
+}
+
+// handleAdminResume resumes polling, cancelling a drain or restarting the workers a drain stopped.
+func (s *Server) handleAdminResume(w http.ResponseWriter, r *http.Request) {
+	s.admin.Resume()
+	slog.Info("admin: producer resumed", "remote", r.RemoteAddr)
+	s.writeAdminStatus(w, http.StatusOK)
+}
+
+// handleAdminScale resizes the consumer worker pool to n workers and suspends autoscaling.
+func (s *Server) handleAdminScale(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil {
+		http.Error(w, "invalid n", http.StatusBadRequest)
+		return
+	}
+	if err := s.admin.Scale(n); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	slog.Info("admin: consumer workers scaled", "workers", n, "remote", r.RemoteAddr)
+	s.writeAdminStatus(w, http.StatusOK)
+}
+
+// handleAdminAutoscale lets the autoscaler resize the consumer worker pool again after a manual scale.
+func (s *Server) handleAdminAutoscale(w http.ResponseWriter, r *http.Request) {
+	s.admin.ResumeAutoscaling()
+	slog.Info("admin: autoscaling resumed", "remote", r.RemoteAddr)
+	s.writeAdminStatus(w, http.StatusOK)
+}
+
+// handleAdminDrain starts a drain and answers 202 at once; GET /admin/status reports drained when done.
+func (s *Server) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	s.admin.Drain()
+	slog.Info("admin: draining", "remote", r.RemoteAddr)
+	s.writeAdminStatus(w, http.StatusAccepted)
+}
@@ -1,11 +1,17 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/challenge-github-events/internal/pubsub"
 	"github.com/challenge-github-events/internal/store"
 	"go.uber.org/mock/gomock"
 )
@@ -16,7 +22,7 @@ func TestServer_Health(t *testing.T) {
 	mockStore := store.NewMockStore(ctrl)
 	mockStore.EXPECT().Ping(gomock.Any()).Return(nil)
 
-	srv := NewServer(":0", mockStore)
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
 
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	rec := httptest.NewRecorder()
@@ -38,10 +44,10 @@ func TestServer_Stats(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockStore := store.NewMockStore(ctrl)
-	mockStore.EXPECT().GlobalNetLines(gomock.Any()).Return(int64(42), nil)
-	mockStore.EXPECT().EventsSeenCount(gomock.Any()).Return(int64(10), nil)
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), store.StatsFilter{}).Return(int64(42), nil)
+	mockStore.EXPECT().EventsSeenCount(gomock.Any(), gomock.Any()).Return(int64(10), nil)
 
-	srv := NewServer(":0", mockStore)
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
 
 	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
 	rec := httptest.NewRecorder()
@@ -61,3 +67,711 @@ func TestServer_Stats(t *testing.T) {
 		t.Errorf("events_seen_since_start want 10 got %v", body["events_seen_since_start"])
 	}
 }
+
+func TestServer_Stats_Adjusted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), store.StatsFilter{Adjusted: true}).Return(int64(7), nil)
+	mockStore.EXPECT().EventsSeenCount(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	req := httptest.NewRequest(http.MethodGet, "/stats?lines=adjusted", nil)
+	rec := httptest.NewRecorder()
+	srv.handleStats(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := body["global_net_lines_current"].(float64); n != 7 {
+		t.Errorf("global_net_lines_current want 7 got %v", body["global_net_lines_current"])
+	}
+	if body["lines"] != "adjusted" {
+		t.Errorf("lines want adjusted got %v", body["lines"])
+	}
+}
+
+func TestServer_Stats_InvalidLines(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	srv := NewServer(":0", store.NewMockStore(ctrl), store.StatsFilter{})
+
+	req := httptest.NewRequest(http.MethodGet, "/stats?lines=bogus", nil)
+	rec := httptest.NewRecorder()
+	srv.handleStats(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status want 400 got %d", rec.Code)
+	}
+}
+
+func TestServer_CommitFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().CommitFiles(gomock.Any(), "abc").Return([]*store.CommitFileRow{
+		{Sha: "abc", Filename: "cmd/main.go", Status: "modified", Additions: 10, Deletions: 2, Changes: 12},
+		{Sha: "abc", Filename: "cmd/util.go", Status: "added", Additions: 5, Changes: 5},
+		{Sha: "abc", Filename: "README.md", Status: "modified", Additions: 1, Deletions: 4, Changes: 5},
+	}, nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	req := httptest.NewRequest(http.MethodGet, "/commits/abc/files", nil)
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Files       []map[string]interface{} `json:"files"`
+		Directories []directoryStats         `json:"directories"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Files) != 3 {
+		t.Errorf("files want 3 got %d", len(body.Files))
+	}
+	if len(body.Directories) != 2 || body.Directories[0].Directory != "cmd" || body.Directories[0].Net != 13 || body.Directories[0].Files != 2 {
+		t.Errorf("directories want cmd first with net=13 files=2 got %+v", body.Directories)
+	}
+}
+
+func TestServer_CommitFiles_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().CommitFiles(gomock.Any(), "missing").Return(nil, nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	req := httptest.NewRequest(http.MethodGet, "/commits/missing/files", nil)
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status want 404 got %d", rec.Code)
+	}
+}
+
+func TestServer_Stats_Window(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), store.StatsFilter{}).Return(int64(100), nil)
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, f store.StatsFilter) (int64, error) {
+		if since := time.Since(f.Since); since < 7*24*time.Hour || since > 7*24*time.Hour+time.Minute {
+			t.Errorf("since want ~7d ago got %s ago", since)
+		}
+		return 12, nil
+	})
+	mockStore.EXPECT().EventsSeenCount(gomock.Any(), gomock.Any()).Return(int64(3), nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	req := httptest.NewRequest(http.MethodGet, "/stats?window=7d", nil)
+	rec := httptest.NewRecorder()
+	srv.handleStats(rec, req)
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := body["global_net_lines_current"].(float64); n != 100 {
+		t.Errorf("global_net_lines_current want 100 got %v", body["global_net_lines_current"])
+	}
+	if n, _ := body["global_net_lines_delta_window"].(float64); n != 12 {
+		t.Errorf("global_net_lines_delta_window want 12 got %v", body["global_net_lines_delta_window"])
+	}
+}
+
+func TestServer_LanguageStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().LanguageStats(gomock.Any(), gomock.Any()).Return([]*store.LanguageStatsRow{
+		{Language: "Go", Commits: 2, Additions: 70, Deletions: 10, Net: 60},
+		{Language: "Markdown", Commits: 1, Additions: 0, Deletions: 20, Net: -20},
+	}, nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/languages?window=24h", nil)
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Languages []map[string]interface{} `json:"languages"`
+		Totals    map[string]int64         `json:"totals"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Totals["net"] != 40 || body.Totals["additions"] != 70 {
+		t.Errorf("totals want add=70 net=40 got %v", body.Totals)
+	}
+	// Nets of opposite sign: shares are of the 80 lines of absolute net, not of the total net of 40.
+	if len(body.Languages) != 2 || body.Languages[0]["share"] != 0.8 || body.Languages[0]["net_share"] != 0.75 ||
+		body.Languages[1]["net_share"] != -0.25 {
+		t.Errorf("want Go share=0.8 net_share=0.75 and Markdown net_share=-0.25 got %v", body.Languages)
+	}
+}
+
+func TestServer_LanguageStats_InvalidWindow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	srv := NewServer(":0", store.NewMockStore(ctrl), store.StatsFilter{})
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/languages?window=-1h", nil)
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status want 400 got %d", rec.Code)
+	}
+}
+
+func TestServer_AuthorStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().AuthorStats(gomock.Any(), store.StatsFilter{Adjusted: true}, 10).Return([]*store.AuthorStatsRow{
+		{AuthorID: 7, Name: "Mona", Login: "mona", Commits: 3, Additions: 20, Deletions: 5, Net: 15},
+	}, nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/authors?lines=adjusted&limit=10", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Authors []map[string]interface{} `json:"authors"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Authors) != 1 || body.Authors[0]["login"] != "mona" || body.Authors[0]["author_id"] != 7.0 || body.Authors[0]["net"] != 15.0 {
+		t.Errorf("authors want [mona id=7 net=15] got %v", body.Authors)
+	}
+
+	for _, limit := range []string{"0", "x", "1001"} {
+		rec := httptest.NewRecorder()
+		srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/authors?limit="+limit, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: status want 400 got %d", limit, rec.Code)
+		}
+	}
+}
+
+func TestServer_RepoStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().RepoStats(gomock.Any(), store.StatsFilter{}, false, defaultRepoLimit).Return([]*store.RepoStatsRow{
+		{Repo: "up/lib", Commits: 3, Shared: 1, Additions: 20, Deletions: 5, Net: 15},
+	}, nil)
+	mockStore.EXPECT().RepoStats(gomock.Any(), store.StatsFilter{Forks: store.ForksOnly}, true, 5).Return(nil, nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/repos", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Shared string                   `json:"shared"`
+		Repos  []map[string]interface{} `json:"repos"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Shared != "canonical" || len(body.Repos) != 1 || body.Repos[0]["repo"] != "up/lib" || body.Repos[0]["shared_commits"] != 1.0 || body.Repos[0]["net"] != 15.0 {
+		t.Errorf("want canonical [up/lib shared=1 net=15] got %s %v", body.Shared, body.Repos)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/repos?shared=every&forks=only&limit=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("shared=every: status want 200 got %d", rec.Code)
+	}
+	for _, q := range []string{"shared=twice", "limit=0", "limit=1001"} {
+		rec := httptest.NewRecorder()
+		srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/repos?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status want 400 got %d", q, rec.Code)
+		}
+	}
+}
+
+func TestServer_Stats_MergePolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	gomock.InOrder(
+		mockStore.EXPECT().GlobalNetLines(gomock.Any(), store.StatsFilter{ExcludeMerges: true}).Return(int64(5), nil),
+		mockStore.EXPECT().GlobalNetLines(gomock.Any(), store.StatsFilter{}).Return(int64(9), nil),
+	)
+	mockStore.EXPECT().EventsSeenCount(gomock.Any(), gomock.Any()).Return(int64(1), nil).Times(2)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{ExcludeMerges: true})
+
+	rec := httptest.NewRecorder()
+	srv.handleStats(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	srv.handleStats(rec, httptest.NewRequest(http.MethodGet, "/stats?merges=count", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+}
+
+func TestServer_Stats_Branch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), store.StatsFilter{Branch: store.BranchDefault}).Return(int64(4), nil)
+	mockStore.EXPECT().EventsSeenCount(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	rec := httptest.NewRecorder()
+	srv.handleStats(rec, httptest.NewRequest(http.MethodGet, "/stats?branch=default", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+}
+
+func TestServer_Stats_RepositoryMetadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), store.StatsFilter{Forks: store.ForksExclude, RepoLanguage: "Go", MinStars: 100}).Return(int64(4), nil)
+	mockStore.EXPECT().EventsSeenCount(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats?forks=exclude&repo_language=Go&min_stars=100", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	for _, q := range []string{"forks=some", "min_stars=-1", "min_stars=many"} {
+		rec = httptest.NewRecorder()
+		srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status want 400 got %d", q, rec.Code)
+		}
+	}
+}
+
+func TestServer_Stats_Bots(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().GlobalNetLines(gomock.Any(), store.StatsFilter{ExcludeBots: true}).Return(int64(4), nil)
+	mockStore.EXPECT().EventsSeenCount(gomock.Any(), store.EventFilter{ExcludeBots: true}).Return(int64(1), nil)
+	mockStore.EXPECT().EventCountsByType(gomock.Any(), store.EventFilter{}).Return(map[string]int64{"PushEvent": 2}, nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{ExcludeBots: true})
+
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Bots string `json:"bots"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Bots != "exclude" {
+		t.Errorf("bots want exclude got %q", body.Bots)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/events?bots=include", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("events status want 200 got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats?bots=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bots=maybe: status want 400 got %d", rec.Code)
+	}
+}
+
+func TestServer_EventStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().EventCountsByType(gomock.Any(), gomock.Any()).Return(map[string]int64{"PushEvent": 5, "WatchEvent": 2}, nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/events", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		ByType map[string]int64 `json:"events_by_type"`
+		Total  int64            `json:"events_total"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Total != 7 || body.ByType["WatchEvent"] != 2 {
+		t.Errorf("want total=7 WatchEvent=2 got %+v", body)
+	}
+}
+
+func TestServer_Anomalies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	committed := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockStore.EXPECT().Anomalies(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, f store.AnomalyFilter) ([]*store.AnomalyRow, error) {
+		if f.Repo != "o/r" || f.Limit != 5 || time.Since(f.Since) < 7*24*time.Hour-time.Minute {
+			t.Errorf("filter want repo o/r, limit 5, since 7d got %+v", f)
+		}
+		return []*store.AnomalyRow{{Sha: "big", Repo: "o/r", CommittedAt: committed, Additions: 2_000_000, Deletions: 10,
+			Method: "zscore", Baseline: "repo", Samples: 80, Score: 9.5, Limit: 4000, Capped: true}}, nil
+	})
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/anomalies?window=7d&repo=o/r&limit=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Window    string                   `json:"window"`
+		Anomalies []map[string]interface{} `json:"anomalies"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Window != "7d" || len(body.Anomalies) != 1 {
+		t.Fatalf("want window 7d and 1 anomaly got %+v", body)
+	}
+	a := body.Anomalies[0]
+	if a["sha"] != "big" || a["lines"] != 2000010.0 || a["limit"] != 4000.0 || a["capped"] != true || a["committed_at"] != "2025-03-01T12:00:00Z" {
+		t.Errorf("unexpected anomaly %v", a)
+	}
+
+	for _, q := range []string{"limit=0", "limit=1001", "window=soon"} {
+		rec := httptest.NewRecorder()
+		srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/anomalies?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status want 400 got %d", q, rec.Code)
+		}
+	}
+}
+
+func TestServer_Trending(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	computed := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockStore.EXPECT().Trending(gomock.Any(), 7*24*time.Hour, 5).Return([]*store.TrendingRow{
+		{Window: 7 * 24 * time.Hour, Repo: "o/r", Rank: 1, Score: 42.5, Velocity: 1.25, Pushes: 60, Commits: 150, ComputedAt: computed,
+			Samples: []store.TrendingSample{{Sha: "abc", Author: "dev", CommittedAt: computed.Add(-time.Hour), Additions: 10, Deletions: 2}}},
+	}, nil)
+	mockStore.EXPECT().Trending(gomock.Any(), 24*time.Hour, 20).Return(nil, nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/trending?window=7d&limit=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Window     string                   `json:"window"`
+		ComputedAt *time.Time               `json:"computed_at"`
+		Repos      []map[string]interface{} `json:"repos"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Window != "7d" || body.ComputedAt == nil || !body.ComputedAt.Equal(computed) || len(body.Repos) != 1 {
+		t.Fatalf("want window 7d computed at %v with 1 repo got %+v", computed, body)
+	}
+	r := body.Repos[0]
+	samples, _ := r["sample_commits"].([]interface{})
+	if r["repo"] != "o/r" || r["rank"] != 1.0 || r["score"] != 42.5 || r["velocity"] != 1.25 || r["commits"] != 150.0 || len(samples) != 1 {
+		t.Errorf("unexpected repo %v", r)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/trending", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"window":"24h"`) || !strings.Contains(rec.Body.String(), `"computed_at":null`) {
+		t.Errorf("default window without snapshot want 200 with 24h and no computed_at got %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, q := range []string{"limit=0", "limit=101", "window=soon"} {
+		rec := httptest.NewRecorder()
+		srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/trending?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status want 400 got %d", q, rec.Code)
+		}
+	}
+}
+
+func TestServer_PollerStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	lastPoll := time.Date(2025, 11, 3, 12, 0, 0, 0, time.UTC)
+	mockStore.EXPECT().PollerStates(gomock.Any()).Return([]*store.PollerStateRow{
+		{Source: "global", ETag: "abc", LastEventID: "42", LastPollAt: lastPoll, LastStatus: "ok"},
+		{Source: "org:golang", LastStatus: "error: rate limited"},
+	}, nil)
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/pollers", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Pollers []struct {
+			Source      string     `json:"source"`
+			ETag        string     `json:"etag"`
+			LastEventID string     `json:"last_event_id"`
+			LastPollAt  *time.Time `json:"last_poll_at"`
+			LastStatus  string     `json:"last_status"`
+		} `json:"pollers"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Pollers) != 2 {
+		t.Fatalf("want 2 pollers got %d", len(body.Pollers))
+	}
+	if p := body.Pollers[0]; p.ETag != "abc" || p.LastEventID != "42" || p.LastPollAt == nil || !p.LastPollAt.Equal(lastPoll) {
+		t.Errorf("pollers[0] want etag=abc last_event_id=42 last_poll_at=%v got %+v", lastPoll, p)
+	}
+	if p := body.Pollers[1]; p.LastPollAt != nil || p.LastStatus != "error: rate limited" {
+		t.Errorf("pollers[1] want no last_poll_at and error status got %+v", p)
+	}
+}
+
+// fakeAdmin records the admin actions it is asked for.
+type fakeAdmin struct {
+	actions []string
+	status  pubsub.ControllerStatus
+}
+
+func (a *fakeAdmin) Pause()  { a.actions = append(a.actions, "pause") }
+func (a *fakeAdmin) Resume() { a.actions = append(a.actions, "resume") }
+func (a *fakeAdmin) Drain()  { a.actions = append(a.actions, "drain") }
+func (a *fakeAdmin) ResumeAutoscaling() {
+	a.actions = append(a.actions, "autoscale")
+}
+func (a *fakeAdmin) Scale(n int) error {
+	if n < 0 {
+		return errors.New("workers must be between 0 and 256")
+	}
+	a.actions = append(a.actions, "scale "+strconv.Itoa(n))
+	return nil
+}
+func (a *fakeAdmin) Status() pubsub.ControllerStatus { return a.status }
+
+func TestServer_Admin(t *testing.T) {
+	admin := &fakeAdmin{status: pubsub.ControllerStatus{Producer: pubsub.ProducerPaused, Workers: 2, Running: 3, QueueDepth: 7, QueueCapacity: 100, Draining: true,
+		AutoscaleSuspended: true}}
+	srv := NewServer(":0", nil, store.StatsFilter{})
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.http.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/admin/status", "s3cret"); rec.Code != http.StatusNotFound {
+		t.Errorf("admin disabled want 404 got %d", rec.Code)
+	}
+	srv.SetAdmin(admin, "s3cret")
+	for _, tc := range []struct {
+		method, target, token string
+		code                  int
+	}{
+		{http.MethodGet, "/admin/status", "", http.StatusUnauthorized},
+		{http.MethodPost, "/admin/drain", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/drain", "s3cret", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/admin/consumers/scale?n=many", "s3cret", http.StatusBadRequest},
+		{http.MethodPost, "/admin/consumers/scale?n=-1", "s3cret", http.StatusBadRequest},
+		{http.MethodPost, "/admin/producer/pause", "s3cret", http.StatusOK},
+		{http.MethodPost, "/admin/consumers/scale?n=5", "s3cret", http.StatusOK},
+		{http.MethodGet, "/admin/consumers/autoscale", "s3cret", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/admin/consumers/autoscale", "s3cret", http.StatusOK},
+		{http.MethodPost, "/admin/drain", "s3cret", http.StatusAccepted},
+		{http.MethodPost, "/admin/producer/resume", "s3cret", http.StatusOK},
+	} {
+		if rec := do(tc.method, tc.target, tc.token); rec.Code != tc.code {
+			t.Errorf("%s %s want %d got %d", tc.method, tc.target, tc.code, rec.Code)
+		}
+	}
+	if got := strings.Join(admin.actions, ","); got != "pause,scale 5,autoscale,drain,resume" {
+		t.Errorf("unexpected admin actions %s", got)
+	}
+
+	rec := do(http.MethodGet, "/admin/status", "s3cret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["producer"] != "paused" || body["workers"] != 2.0 || body["running_workers"] != 3.0 || body["queue_depth"] != 7.0 ||
+		body["queue_capacity"] != 100.0 || body["draining"] != true || body["drained"] != false ||
+		body["autoscale_suspended"] != true {
+		t.Errorf("unexpected status %v", body)
+	}
+}
+
+type fakeAutoscaler pubsub.AutoscalerMetrics
+
+func (a fakeAutoscaler) Metrics() pubsub.AutoscalerMetrics { return pubsub.AutoscalerMetrics(a) }
+
+func TestServer_AutoscalerStatus(t *testing.T) {
+	srv := NewServer(":0", nil, store.StatsFilter{})
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/autoscaler", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("autoscaling disabled want 404 got %d", rec.Code)
+	}
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	srv.SetAutoscaler(fakeAutoscaler{Min: 1, Max: 8, Workers: 3, QueueDepth: 40, QueueCapacity: 100, JobLatency: 250 * time.Millisecond,
+		RateRemaining: -1, Restarts: 1, ScaleUps: 2, ScaleDowns: 1, EvaluatedAt: at,
+		Decisions: []pubsub.ScaleDecision{{At: at, From: 2, To: 3, Reason: "queue filling up"}}})
+	rec = httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/autoscaler", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Workers       int   `json:"workers"`
+		JobLatencyMs  int64 `json:"job_latency_ms"`
+		RateRemaining *int  `json:"rate_limit_remaining"`
+		Restarts      int64 `json:"worker_restarts"`
+		ScaleUps      int64 `json:"scale_ups"`
+		Decisions     []struct {
+			From   int    `json:"from"`
+			To     int    `json:"to"`
+			Reason string `json:"reason"`
+		} `json:"decisions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Workers != 3 || body.JobLatencyMs != 250 || body.RateRemaining != nil || body.Restarts != 1 || body.ScaleUps != 2 ||
+		len(body.Decisions) != 1 || body.Decisions[0].To != 3 || body.Decisions[0].Reason != "queue filling up" {
+		t.Errorf("unexpected autoscaler status %+v", body)
+	}
+}
+
+type fakeQueue pubsub.QueueStatus
+
+func (q fakeQueue) Status() pubsub.QueueStatus { return pubsub.QueueStatus(q) }
+
+func TestServer_QueueStatus(t *testing.T) {
+	srv := NewServer(":0", nil, store.StatsFilter{})
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/queue", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("no queue want 404 got %d", rec.Code)
+	}
+
+	srv.SetQueue(fakeQueue{Strategy: pubsub.BackpressureSpill, Depth: 10, Capacity: 10, Pending: 7,
+		Counts: map[string]int64{pubsub.QueueEnqueued: 25, pubsub.QueueSpilled: 9, pubsub.QueueReplayed: 2}})
+	rec = httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status/queue", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST want 405 got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/queue", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	var body struct {
+		Strategy string           `json:"strategy"`
+		Depth    int              `json:"depth"`
+		Pending  int              `json:"pending"`
+		Counts   map[string]int64 `json:"counts"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Strategy != "spill" || body.Depth != 10 || body.Pending != 7 || body.Counts["spilled"] != 9 || body.Counts["replayed"] != 2 {
+		t.Errorf("unexpected queue status %+v", body)
+	}
+}
+
+func TestServer_Export(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := store.NewMockStore(ctrl)
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	mockStore.EXPECT().ExportCommitStats(gomock.Any(), store.ExportFilter{From: from, Repo: "o/r"}, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ store.ExportFilter, fn func(*store.CommitStatsRow) error) error {
+			return fn(&store.CommitStatsRow{Sha: "abc", Repo: "o/r", CommittedAt: from, Additions: 3, Net: 3})
+		})
+
+	srv := NewServer(":0", mockStore, store.StatsFilter{})
+
+	rec := httptest.NewRecorder()
+	srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/export?format=csv&from=2025-03-01&repo=o/r", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want 200 got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Content-Type want text/csv got %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="commits.csv"` {
+		t.Errorf("Content-Disposition want commits.csv attachment got %q", cd)
+	}
+	want := "sha,repo,author,committed_at,additions,deletions,total,net,adjusted_additions,adjusted_deletions,adjusted_net,parent_count,is_merge,is_bot,orphaned,capped_additions,capped_deletions\n" +
+		"abc,o/r,,2025-03-01T00:00:00Z,3,0,0,3,0,0,0,0,false,false,false,,\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("body want\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestServer_Export_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	srv := NewServer(":0", store.NewMockStore(ctrl), store.StatsFilter{})
+	for _, query := range []string{"table=users", "format=xml", "from=yesterday", "from=2025-03-02&to=2025-03-01"} {
+		rec := httptest.NewRecorder()
+		srv.http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/export?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status want 400 got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,1014 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory implements Store in process memory, for demos and tests. Safe for concurrent use.
+// It honours the same idempotency rules as Postgres: rows are keyed like the tables' primary keys
+// and duplicate inserts report false. DefaultBranches are the branch names StatsFilter.Branch "default" falls back to.
+type Memory struct {
+	DefaultBranches []string
+
+	mu          sync.RWMutex
+	pushEvents  map[string]*PushEventRow
+	events      map[string]map[string]any // event type -> event id -> row
+	commits     map[string]*memoryCommit
+	files       map[string]map[string]*CommitFileRow
+	languages   map[string]map[string]*CommitLanguageRow
+	refs        map[string]map[CommitRefRow]bool // sha -> links (EventID cleared)
+	seenIn      map[string]map[string]time.Time  // sha -> repo -> first seen
+	forcePushes map[string]*ForcePushRow
+	orphans     map[string]bool // shas discarded by a force push
+	anomalies   map[string]*AnomalyRow
+	trending    map[time.Duration][]*TrendingRow
+	repos       map[string]*RepositoryRow
+	pollers     map[string]*PollerStateRow
+	overflow    []*SpilledJobRow // by id
+	overflowID  int64
+	authors     []*AuthorRow                     // by id - 1
+	aliases     map[string]int64                 // merge key -> author id
+	identities  map[[2]string]*CommitIdentityRow // (sha, role) -> identity
+}
+
+// memoryCommit is a commit_stats row with its orphaned flag.
+type memoryCommit struct {
+	CommitStatsRow
+	orphaned bool
+}
+
+// lines returns the additions and deletions of c counted by aggregates: adjusted lines when filter.Adjusted,
+// else raw lines, or the capped ones of a capped outlier.
+func (c *memoryCommit) lines(filter StatsFilter) (additions, deletions int64) {
+	switch {
+	case filter.Adjusted:
+		return c.AdjustedAdditions, c.AdjustedDeletions
+	case c.Capped:
+		return c.CappedAdditions, c.CappedDeletions
+	}
+	return c.Additions, c.Deletions
+}
+
+// NewMemory returns an empty in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{
+		DefaultBranches: []string{"main", "master"},
+		pushEvents:      make(map[string]*PushEventRow),
+		events:          make(map[string]map[string]any),
+		commits:         make(map[string]*memoryCommit),
+		files:           make(map[string]map[string]*CommitFileRow),
+		languages:       make(map[string]map[string]*CommitLanguageRow),
+		refs:            make(map[string]map[CommitRefRow]bool),
+		seenIn:          make(map[string]map[string]time.Time),
+		forcePushes:     make(map[string]*ForcePushRow),
+		orphans:         make(map[string]bool),
+		anomalies:       make(map[string]*AnomalyRow),
+		trending:        make(map[time.Duration][]*TrendingRow),
+		repos:           make(map[string]*RepositoryRow),
+		pollers:         make(map[string]*PollerStateRow),
+		aliases:         make(map[string]int64),
+		identities:      make(map[[2]string]*CommitIdentityRow),
+	}
+}
+
+// InsertPushEvent inserts a push event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (m *Memory) InsertPushEvent(_ context.Context, event *PushEventRow) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pushEvents[event.ID]; ok {
+		return false, nil
+	}
+	row := *event
+	m.pushEvents[event.ID] = &row
+	return true, nil
+}
+
+// InsertPullRequestEvent inserts a pull request event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (m *Memory) InsertPullRequestEvent(_ context.Context, e *PullRequestEventRow) (bool, error) {
+	row := *e
+	return m.insertEvent("PullRequestEvent", e.ID, &row), nil
+}
+
+// InsertCreateEvent inserts a create event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (m *Memory) InsertCreateEvent(_ context.Context, e *CreateEventRow) (bool, error) {
+	row := *e
+	return m.insertEvent("CreateEvent", e.ID, &row), nil
+}
+
+// InsertDeleteEvent inserts a delete event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (m *Memory) InsertDeleteEvent(_ context.Context, e *DeleteEventRow) (bool, error) {
+	row := *e
+	return m.insertEvent("DeleteEvent", e.ID, &row), nil
+}
+
+// InsertReleaseEvent inserts a release event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (m *Memory) InsertReleaseEvent(_ context.Context, e *ReleaseEventRow) (bool, error) {
+	row := *e
+	return m.insertEvent("ReleaseEvent", e.ID, &row), nil
+}
+
+// InsertWatchEvent inserts a watch event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (m *Memory) InsertWatchEvent(_ context.Context, e *WatchEventRow) (bool, error) {
+	row := *e
+	return m.insertEvent("WatchEvent", e.ID, &row), nil
+}
+
+func (m *Memory) insertEvent(typ, id string, row any) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byID := m.events[typ]
+	if byID == nil {
+		byID = make(map[string]any)
+		m.events[typ] = byID
+	}
+	if _, ok := byID[id]; ok {
+		return false
+	}
+	byID[id] = row
+	return true
+}
+
+// InsertCommitStats inserts commit stats. Returns (true, nil) if inserted, (false, nil) if duplicate sha.
+func (m *Memory) InsertCommitStats(_ context.Context, stats *CommitStatsRow) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.insertCommit(stats), nil
+}
+
+// InsertCommitStatsBatch inserts all rows under one lock.
+// inserted[i] is true when rows[i] was new; duplicate SHAs (stored or within the batch) report false.
+func (m *Memory) InsertCommitStatsBatch(_ context.Context, rows []*CommitStatsRow) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inserted := make([]bool, len(rows))
+	for i, r := range rows {
+		inserted[i] = m.insertCommit(r)
+	}
+	return inserted, nil
+}
+
+// InsertCommits inserts the stats rows and the details of the new commits under one lock.
+func (m *Memory) InsertCommits(_ context.Context, commits []*CommitRow) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inserted := make([]bool, len(commits))
+	for i, c := range commits {
+		if inserted[i] = m.insertCommit(c.Stats); inserted[i] {
+			m.insertFiles(c.Files)
+			m.insertLanguages(c.Languages)
+			m.saveIdentities(c.Identities)
+		}
+	}
+	return inserted, nil
+}
+
+// insertCommit stores stats unless its sha exists. Caller holds m.mu.
+func (m *Memory) insertCommit(stats *CommitStatsRow) bool {
+	if _, ok := m.commits[stats.Sha]; ok {
+		return false
+	}
+	m.commits[stats.Sha] = &memoryCommit{CommitStatsRow: *stats, orphaned: m.orphans[stats.Sha]}
+	return true
+}
+
+// InsertCommitFiles inserts per-file stats. Rows already present (same sha and filename) are skipped.
+func (m *Memory) InsertCommitFiles(_ context.Context, files []*CommitFileRow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.insertFiles(files)
+	return nil
+}
+
+// insertFiles stores files, skipping those present. Caller holds m.mu.
+func (m *Memory) insertFiles(files []*CommitFileRow) {
+	for _, f := range files {
+		bySha := m.files[f.Sha]
+		if bySha == nil {
+			bySha = make(map[string]*CommitFileRow)
+			m.files[f.Sha] = bySha
+		}
+		if _, ok := bySha[f.Filename]; !ok {
+			row := *f
+			bySha[f.Filename] = &row
+		}
+	}
+}
+
+// CommitFiles returns the per-file stats of a commit ordered by filename.
+func (m *Memory) CommitFiles(_ context.Context, sha string) ([]*CommitFileRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []*CommitFileRow
+	for _, f := range m.files[sha] {
+		row := *f
+		out = append(out, &row)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Filename < out[j].Filename })
+	return out, nil
+}
+
+// InsertCommitLanguages inserts per-language stats. Rows already present (same sha and language) are skipped.
+func (m *Memory) InsertCommitLanguages(_ context.Context, langs []*CommitLanguageRow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.insertLanguages(langs)
+	return nil
+}
+
+// insertLanguages stores langs, skipping those present. Caller holds m.mu.
+func (m *Memory) insertLanguages(langs []*CommitLanguageRow) {
+	for _, l := range langs {
+		bySha := m.languages[l.Sha]
+		if bySha == nil {
+			bySha = make(map[string]*CommitLanguageRow)
+			m.languages[l.Sha] = bySha
+		}
+		if _, ok := bySha[l.Language]; !ok {
+			row := *l
+			bySha[l.Language] = &row
+		}
+	}
+}
+
+// LanguageStats returns line stats per language for the commits selected by filter, ordered by net lines.
+func (m *Memory) LanguageStats(_ context.Context, filter StatsFilter) ([]*LanguageStatsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	byLang := make(map[string]*LanguageStatsRow)
+	for sha, langs := range m.languages {
+		c, ok := m.commits[sha]
+		if !ok || !m.matches(c, filter) {
+			continue
+		}
+		for _, l := range langs {
+			row := byLang[l.Language]
+			if row == nil {
+				row = &LanguageStatsRow{Language: l.Language}
+				byLang[l.Language] = row
+			}
+			row.Commits++
+			if filter.Adjusted {
+				row.Additions += l.AdjustedAdditions
+				row.Deletions += l.AdjustedDeletions
+			} else {
+				row.Additions += l.Additions
+				row.Deletions += l.Deletions
+			}
+		}
+	}
+	out := make([]*LanguageStatsRow, 0, len(byLang))
+	for _, row := range byLang {
+		row.Net = row.Additions - row.Deletions
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Net != out[j].Net {
+			return out[i].Net > out[j].Net
+		}
+		return out[i].Language < out[j].Language
+	})
+	return out, nil
+}
+
+// SaveCommitIdentities links each identity to a canonical author and stores it under one lock.
+func (m *Memory) SaveCommitIdentities(_ context.Context, rows []*CommitIdentityRow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saveIdentities(rows)
+	return nil
+}
+
+// saveIdentities is SaveCommitIdentities. Caller holds m.mu.
+func (m *Memory) saveIdentities(rows []*CommitIdentityRow) {
+	for _, r := range rows {
+		if len(r.Keys) == 0 {
+			continue
+		}
+		var known []int64
+		for _, key := range r.Keys {
+			if id, ok := m.aliases[key]; ok {
+				known = append(known, id)
+			}
+		}
+		var author *AuthorRow
+		if len(known) > 0 {
+			author = m.authors[known[0]-1]
+			m.mergeAuthors(author, otherAuthors(author.ID, known))
+		} else {
+			author = &AuthorRow{ID: int64(len(m.authors) + 1), Name: r.Canonical.Name}
+			m.authors = append(m.authors, author)
+		}
+		if author.Email == "" {
+			author.Email = r.Canonical.Email
+		}
+		if author.Login == "" {
+			author.Login = r.Canonical.Login
+		}
+		for _, key := range r.Keys {
+			if _, ok := m.aliases[key]; !ok {
+				m.aliases[key] = author.ID
+			}
+		}
+		r.AuthorID = author.ID
+		k := [2]string{r.Sha, r.Role}
+		if _, ok := m.identities[k]; !ok {
+			row := *r
+			row.Keys = slices.Clone(r.Keys)
+			m.identities[k] = &row
+		}
+	}
+}
+
+// mergeAuthors re-points the aliases and identities of the authors others to author, filling in its missing
+// email and login from them. Requires m.mu.
+func (m *Memory) mergeAuthors(author *AuthorRow, others []int64) {
+	for _, id := range others {
+		other := m.authors[id-1]
+		if author.Email == "" {
+			author.Email = other.Email
+		}
+		if author.Login == "" {
+			author.Login = other.Login
+		}
+		for key, a := range m.aliases {
+			if a == id {
+				m.aliases[key] = author.ID
+			}
+		}
+		for _, ident := range m.identities {
+			if ident.AuthorID == id {
+				ident.AuthorID = author.ID
+			}
+		}
+	}
+}
+
+// AuthorStats sums the commits matched by filter per canonical author.
+func (m *Memory) AuthorStats(_ context.Context, filter StatsFilter, limit int) ([]*AuthorStatsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	byAuthor := make(map[int64]*AuthorStatsRow)
+	for k, ident := range m.identities {
+		c, ok := m.commits[k[0]]
+		if k[1] != RoleAuthor || !ok || !m.matches(c, filter) {
+			continue
+		}
+		row := byAuthor[ident.AuthorID]
+		if row == nil {
+			a := m.authors[ident.AuthorID-1]
+			row = &AuthorStatsRow{AuthorID: a.ID, Name: a.Name, Email: a.Email, Login: a.Login}
+			byAuthor[a.ID] = row
+		}
+		row.Commits++
+		add, del := c.lines(filter)
+		row.Additions += add
+		row.Deletions += del
+	}
+	out := make([]*AuthorStatsRow, 0, len(byAuthor))
+	for _, row := range byAuthor {
+		row.Net = row.Additions - row.Deletions
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Net != out[j].Net {
+			return out[i].Net > out[j].Net
+		}
+		return out[i].AuthorID < out[j].AuthorID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// InsertCommitRefs links commits to the refs they were pushed to. Existing links are skipped.
+func (m *Memory) InsertCommitRefs(_ context.Context, refs []*CommitRefRow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range refs {
+		links := m.refs[r.Sha]
+		if links == nil {
+			links = make(map[CommitRefRow]bool)
+			m.refs[r.Sha] = links
+		}
+		links[CommitRefRow{Sha: r.Sha, Repo: r.Repo, Ref: r.Ref}] = true
+	}
+	return nil
+}
+
+// InsertCommitRepos records the repos commits were seen in. Existing links keep their first-seen time.
+func (m *Memory) InsertCommitRepos(_ context.Context, links []*CommitRepoRow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, l := range links {
+		repos := m.seenIn[l.Sha]
+		if repos == nil {
+			repos = make(map[string]time.Time)
+			m.seenIn[l.Sha] = repos
+		}
+		if _, ok := repos[l.Repo]; !ok {
+			repos[l.Repo] = l.FirstSeenAt
+		}
+	}
+	return nil
+}
+
+// CanonicalizeCommits attributes each of the given commits to its canonical repo.
+func (m *Memory) CanonicalizeCommits(_ context.Context, shas []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, sha := range shas {
+		if c, ok := m.commits[sha]; ok && m.canonicalize(c) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// CanonicalizeRepos attributes the commits seen in one of repos and in another repo to their canonical repo.
+func (m *Memory) CanonicalizeRepos(_ context.Context, repos []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for sha, seen := range m.seenIn {
+		c, ok := m.commits[sha]
+		if !ok || !slices.ContainsFunc(repos, func(r string) bool { _, ok := seen[r]; return ok }) {
+			continue
+		}
+		if m.canonicalize(c) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// canonicalize moves c to its canonical repo (see Store.CanonicalizeRepos) and reports whether it moved.
+// Caller holds m.mu for writing.
+func (m *Memory) canonicalize(c *memoryCommit) bool {
+	cur, ok := m.repos[c.Repo]
+	if !ok || cur.Found && !cur.Fork {
+		return false
+	}
+	best, bestFork, bestSeen := "", false, time.Time{}
+	for repo, seen := range m.seenIn[c.Sha] {
+		r, ok := m.repos[repo]
+		if repo == c.Repo || !ok || !r.Found || r.Fork && repo != cur.Parent {
+			continue
+		}
+		if best == "" || bestFork && !r.Fork ||
+			bestFork == r.Fork && (seen.Before(bestSeen) || seen.Equal(bestSeen) && repo < best) {
+			best, bestFork, bestSeen = repo, r.Fork, seen
+		}
+	}
+	if best == "" {
+		return false
+	}
+	c.Repo = best
+	return true
+}
+
+// RepoStats returns the line stats of the commits matched by filter per repo, by net lines descending.
+func (m *Memory) RepoStats(_ context.Context, filter StatsFilter, everyRepo bool, limit int) ([]*RepoStatsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	byRepo := make(map[string]*RepoStatsRow)
+	for _, c := range m.commits {
+		repos := []string{c.Repo}
+		shared := false
+		for repo := range m.seenIn[c.Sha] {
+			if repo != c.Repo {
+				shared = true
+				if everyRepo {
+					repos = append(repos, repo)
+				}
+			}
+		}
+		for _, repo := range repos {
+			in := *c
+			in.Repo = repo
+			if !m.matches(&in, filter) {
+				continue
+			}
+			row := byRepo[repo]
+			if row == nil {
+				row = &RepoStatsRow{Repo: repo}
+				byRepo[repo] = row
+			}
+			row.Commits++
+			if shared {
+				row.Shared++
+			}
+			add, del := c.lines(filter)
+			row.Additions += add
+			row.Deletions += del
+		}
+	}
+	out := make([]*RepoStatsRow, 0, len(byRepo))
+	for _, row := range byRepo {
+		row.Net = row.Additions - row.Deletions
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Net != out[j].Net {
+			return out[i].Net > out[j].Net
+		}
+		return out[i].Repo < out[j].Repo
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// InsertForcePush records a force push. Returns (true, nil) if inserted, (false, nil) if duplicate event id.
+func (m *Memory) InsertForcePush(_ context.Context, fp *ForcePushRow) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.forcePushes[fp.EventID]; ok {
+		return false, nil
+	}
+	row := *fp
+	m.forcePushes[fp.EventID] = &row
+	return true, nil
+}
+
+// InsertAnomaly records an outlier commit. Returns (true, nil) if inserted, (false, nil) if duplicate sha.
+func (m *Memory) InsertAnomaly(_ context.Context, a *AnomalyRow) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.anomalies[a.Sha]; ok {
+		return false, nil
+	}
+	row := *a
+	m.anomalies[a.Sha] = &row
+	return true, nil
+}
+
+// Anomalies returns the outlier commits matched by filter, most recently committed first.
+func (m *Memory) Anomalies(_ context.Context, filter AnomalyFilter) ([]*AnomalyRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []*AnomalyRow
+	for _, a := range m.anomalies {
+		if a.CommittedAt.Before(filter.Since) || (filter.Repo != "" && a.Repo != filter.Repo) {
+			continue
+		}
+		row := *a
+		out = append(out, &row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CommittedAt.Equal(out[j].CommittedAt) {
+			return out[i].CommittedAt.After(out[j].CommittedAt)
+		}
+		return out[i].Sha < out[j].Sha
+	})
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+	return out, nil
+}
+
+// RepoActivity returns the pushes and commits per repo and bucket since filter.Since.
+func (m *Memory) RepoActivity(_ context.Context, filter StatsFilter, bucket time.Duration) ([]*RepoActivityRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	type key struct {
+		repo   string
+		bucket time.Time
+	}
+	counts := make(map[key]*RepoActivityRow)
+	row := func(repo string, t time.Time) *RepoActivityRow {
+		k := key{repo, bucketStart(t, bucket)}
+		r, ok := counts[k]
+		if !ok {
+			r = &RepoActivityRow{Repo: k.repo, Bucket: k.bucket}
+			counts[k] = r
+		}
+		return r
+	}
+	for _, e := range m.pushEvents {
+		if e.CreatedAt.Before(filter.Since) || (filter.ExcludeBots && e.IsBot) || (filter.Repo != "" && e.Repo != filter.Repo) {
+			continue
+		}
+		row(e.Repo, e.CreatedAt).Pushes++
+	}
+	for _, c := range m.commits {
+		if m.matches(c, filter) {
+			row(c.Repo, c.CommittedAt).Commits++
+		}
+	}
+	out := make([]*RepoActivityRow, 0, len(counts))
+	for _, r := range counts {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Repo != out[j].Repo {
+			return out[i].Repo < out[j].Repo
+		}
+		return out[i].Bucket.Before(out[j].Bucket)
+	})
+	return out, nil
+}
+
+// bucketStart returns the start of the bucket of width bucket (whole seconds since the Unix epoch) containing t.
+func bucketStart(t time.Time, bucket time.Duration) time.Time {
+	width := max(int64(bucket/time.Second), 1)
+	return time.Unix(t.Unix()/width*width, 0).UTC()
+}
+
+// RecentCommits returns up to limit commits matched by filter, most recently committed first.
+func (m *Memory) RecentCommits(_ context.Context, filter StatsFilter, limit int) ([]*CommitStatsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []*CommitStatsRow
+	for _, c := range m.commits {
+		if m.matches(c, filter) {
+			row := c.CommitStatsRow
+			out = append(out, &row)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CommittedAt.Equal(out[j].CommittedAt) {
+			return out[i].CommittedAt.After(out[j].CommittedAt)
+		}
+		return out[i].Sha < out[j].Sha
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// SaveTrending replaces the trending snapshot of window with rows.
+func (m *Memory) SaveTrending(_ context.Context, window time.Duration, rows []*TrendingRow) error {
+	snapshot := make([]*TrendingRow, len(rows))
+	for i, r := range rows {
+		row := *r
+		row.Window = window
+		row.Samples = slices.Clone(r.Samples)
+		snapshot[i] = &row
+	}
+	sort.SliceStable(snapshot, func(i, j int) bool { return snapshot[i].Rank < snapshot[j].Rank })
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trending[window] = snapshot
+	return nil
+}
+
+// Trending returns up to limit rows of the trending snapshot of window by rank.
+func (m *Memory) Trending(_ context.Context, window time.Duration, limit int) ([]*TrendingRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snapshot := m.trending[window]
+	if limit > 0 && len(snapshot) > limit {
+		snapshot = snapshot[:limit]
+	}
+	out := make([]*TrendingRow, len(snapshot))
+	for i, r := range snapshot {
+		row := *r
+		row.Samples = slices.Clone(r.Samples)
+		out[i] = &row
+	}
+	return out, nil
+}
+
+// SaveRepository upserts the metadata of a repo.
+func (m *Memory) SaveRepository(_ context.Context, repo *RepositoryRow) error {
+	row := *repo
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.repos[row.Repo] = &row
+	return nil
+}
+
+// StaleRepositories returns up to limit repos commits were seen in whose metadata is missing or fetched before
+// fetchedBefore.
+func (m *Memory) StaleRepositories(_ context.Context, fetchedBefore time.Time, limit int) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[string]bool)
+	var out []string
+	for _, repos := range m.seenIn {
+		for repo := range repos {
+			if seen[repo] {
+				continue
+			}
+			seen[repo] = true
+			if r, ok := m.repos[repo]; !ok || r.FetchedAt.Before(fetchedBefore) {
+				out = append(out, repo)
+			}
+		}
+	}
+	fetchedAt := func(repo string) time.Time {
+		if r, ok := m.repos[repo]; ok {
+			return r.FetchedAt
+		}
+		return time.Time{}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := fetchedAt(out[i]), fetchedAt(out[j]); !a.Equal(b) {
+			return a.Before(b)
+		}
+		return out[i] < out[j]
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// MarkCommitsOrphaned flags the given commits as discarded by a force push and records them so those not
+// stored yet are flagged when inserted. Returns the number of stored rows newly marked.
+func (m *Memory) MarkCommitsOrphaned(_ context.Context, shas []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, sha := range shas {
+		m.orphans[sha] = true
+		if c, ok := m.commits[sha]; ok && !c.orphaned {
+			c.orphaned = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+// MarkBot flags the events and commits of login as bots. Returns the number of rows newly flagged.
+func (m *Memory) MarkBot(_ context.Context, login string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for k, id := range m.identities {
+		if c, ok := m.commits[k[0]]; ok && k[1] == RoleAuthor && !c.IsBot && strings.EqualFold(id.Login, login) {
+			c.IsBot = true
+			n++
+		}
+	}
+	for _, e := range m.pushEvents {
+		if !e.IsBot && strings.EqualFold(e.ActorLogin, login) {
+			e.IsBot = true
+			n++
+		}
+	}
+	for _, byID := range m.events {
+		for _, row := range byID {
+			if e := row.(interface{ base() *EventRow }).base(); !e.IsBot && strings.EqualFold(e.ActorLogin, login) {
+				e.IsBot = true
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// GlobalNetLines returns the sum of net (or adjusted net) lines of the commits selected by filter.
+func (m *Memory) GlobalNetLines(_ context.Context, filter StatsFilter) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var v int64
+	for _, c := range m.commits {
+		if !m.matches(c, filter) {
+			continue
+		}
+		add, del := c.lines(filter)
+		v += add - del
+	}
+	return v, nil
+}
+
+// matches reports whether c is selected by filter. Caller holds m.mu.
+func (m *Memory) matches(c *memoryCommit, filter StatsFilter) bool {
+	if !filter.Since.IsZero() && c.CommittedAt.Before(filter.Since) {
+		return false
+	}
+	if filter.ExcludeMerges && c.IsMerge {
+		return false
+	}
+	if filter.ExcludeOrphaned && c.orphaned {
+		return false
+	}
+	if filter.ExcludeBots && c.IsBot {
+		return false
+	}
+	if filter.Repo != "" && c.Repo != filter.Repo {
+		return false
+	}
+	if filter.repoMeta() {
+		r, ok := m.repos[c.Repo]
+		if !ok || !r.Found ||
+			filter.Forks == ForksOnly && !r.Fork || filter.Forks == ForksExclude && r.Fork ||
+			filter.RepoLanguage != "" && !strings.EqualFold(r.Language, filter.RepoLanguage) ||
+			r.Stars < filter.MinStars {
+			return false
+		}
+	}
+	if filter.Branch != "" {
+		refs := branchRefs(filter.Branch, m.DefaultBranches)
+		for link := range m.refs[c.Sha] {
+			if filter.Branch == BranchDefault {
+				if b := m.defaultBranch(link.Repo); b != "" {
+					if link.Ref == "refs/heads/"+b {
+						return true
+					}
+					continue
+				}
+			}
+			if slices.Contains(refs, link.Ref) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// defaultBranch returns the default branch of repo: its repositories row's, else the master_branch of its
+// latest CreateEvent, else "". Caller holds m.mu.
+func (m *Memory) defaultBranch(repo string) string {
+	if r := m.repos[repo]; r != nil && r.DefaultBranch != "" {
+		return r.DefaultBranch
+	}
+	var latest *CreateEventRow
+	for _, row := range m.events["CreateEvent"] {
+		e := row.(*CreateEventRow)
+		if e.Repo == repo && e.MasterBranch != "" && (latest == nil || e.CreatedAt.After(latest.CreatedAt)) {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	return latest.MasterBranch
+}
+
+// EventsSeenCount returns the number of stored push events matched by filter.
+func (m *Memory) EventsSeenCount(_ context.Context, filter EventFilter) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.countPushEvents(filter), nil
+}
+
+// countPushEvents counts the push events matched by filter. Caller holds m.mu.
+func (m *Memory) countPushEvents(filter EventFilter) int64 {
+	var n int64
+	for _, e := range m.pushEvents {
+		if !filter.ExcludeBots || !e.IsBot {
+			n++
+		}
+	}
+	return n
+}
+
+// EventCountsByType returns the number of stored events matched by filter of each supported event type.
+func (m *Memory) EventCountsByType(_ context.Context, filter EventFilter) (map[string]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := make(map[string]int64, len(eventTables))
+	for typ := range eventTables {
+		var n int64
+		for _, row := range m.events[typ] {
+			if !filter.ExcludeBots || !row.(interface{ base() *EventRow }).base().IsBot {
+				n++
+			}
+		}
+		counts[typ] = n
+	}
+	counts["PushEvent"] = m.countPushEvents(filter)
+	return counts, nil
+}
+
+// SavePollerState upserts the polling state of state.Source. An empty LastEventID keeps the stored one.
+func (m *Memory) SavePollerState(_ context.Context, state *PollerStateRow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	row := *state
+	if prev, ok := m.pollers[state.Source]; ok && row.LastEventID == "" {
+		row.LastEventID = prev.LastEventID
+	}
+	m.pollers[state.Source] = &row
+	return nil
+}
+
+// PollerStates returns the polling state of every source, ordered by source.
+func (m *Memory) PollerStates(_ context.Context) ([]*PollerStateRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*PollerStateRow, 0, len(m.pollers))
+	for _, st := range m.pollers {
+		row := *st
+		out = append(out, &row)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Source < out[j].Source })
+	return out, nil
+}
+
+// SpillJobs appends commit jobs to the overflow, assigning their ids.
+func (m *Memory) SpillJobs(_ context.Context, jobs []*SpilledJobRow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range jobs {
+		m.overflowID++
+		row := *j
+		row.ID = m.overflowID
+		m.overflow = append(m.overflow, &row)
+	}
+	return nil
+}
+
+// SpilledJobs returns up to limit jobs of the overflow, oldest first, leaving them in it.
+func (m *Memory) SpilledJobs(_ context.Context, limit int) ([]*SpilledJobRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := min(max(limit, 0), len(m.overflow))
+	out := make([]*SpilledJobRow, n)
+	for i, j := range m.overflow[:n] {
+		row := *j
+		out[i] = &row
+	}
+	return out, nil
+}
+
+// DeleteSpilledJobs removes the jobs with the given ids from the overflow.
+func (m *Memory) DeleteSpilledJobs(_ context.Context, ids []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overflow = slices.DeleteFunc(m.overflow, func(j *SpilledJobRow) bool { return slices.Contains(ids, j.ID) })
+	return nil
+}
+
+// SpilledJobsCount returns the number of jobs in the overflow.
+func (m *Memory) SpilledJobsCount(_ context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.overflow)), nil
+}
+
+// ExportCommitStats calls fn with a copy of each commit matched by filter, ordered by committed_at.
+func (m *Memory) ExportCommitStats(_ context.Context, filter ExportFilter, fn func(*CommitStatsRow) error) error {
+	m.mu.RLock()
+	var out []*CommitStatsRow
+	for _, c := range m.commits {
+		if filter.matches(c.CommittedAt, c.Repo, c.Author) {
+			row := c.CommitStatsRow
+			row.Orphaned = c.orphaned
+			out = append(out, &row)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CommittedAt.Equal(out[j].CommittedAt) {
+			return out[i].CommittedAt.Before(out[j].CommittedAt)
+		}
+		return out[i].Sha < out[j].Sha
+	})
+	for _, row := range out {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportPushEvents calls fn with a copy of each push event matched by filter, ordered by created_at.
+func (m *Memory) ExportPushEvents(_ context.Context, filter ExportFilter, fn func(*PushEventRow) error) error {
+	m.mu.RLock()
+	var out []*PushEventRow
+	for _, e := range m.pushEvents {
+		if filter.matches(e.CreatedAt, e.Repo, e.ActorLogin) {
+			row := *e
+			out = append(out, &row)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	for _, row := range out {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches reports whether a row with the given time, repo and author is selected by f.
+func (f ExportFilter) matches(at time.Time, repo, author string) bool {
+	return (f.From.IsZero() || !at.Before(f.From)) &&
+		(f.To.IsZero() || at.Before(f.To)) &&
+		(f.Repo == "" || repo == f.Repo) &&
+		(f.Author == "" || author == f.Author)
+}
+
+// Ping always succeeds.
+func (m *Memory) Ping(context.Context) error {
+	return nil
+}
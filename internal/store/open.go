@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Open returns the Store selected by the scheme of databaseURL and a func that releases it:
+//
+//	postgres://..., postgresql://...  Postgres
+//	sqlite:PATH, sqlite://PATH       SQLite database file at PATH (sqlite::memory: for a throwaway one)
+//	memory://                        Memory (lost on exit)
+//
+// defaultBranches are the branch names StatsFilter.Branch "default" selects; nil keeps main and master.
+func Open(ctx context.Context, databaseURL string, defaultBranches []string) (Store, func(), error) {
+	scheme, rest, _ := strings.Cut(databaseURL, ":")
+	switch scheme {
+	case "postgres", "postgresql":
+		pool, err := pgxpool.New(ctx, databaseURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		st := NewPostgres(pool)
+		if defaultBranches != nil {
+			st.DefaultBranches = defaultBranches
+		}
+		return st, pool.Close, nil
+	case "sqlite":
+		st, err := OpenSQLite(ctx, strings.TrimPrefix(rest, "//"))
+		if err != nil {
+			return nil, nil, err
+		}
+		if defaultBranches != nil {
+			st.DefaultBranches = defaultBranches
+		}
+		return st, func() { st.Close() }, nil
+	case "memory":
+		st := NewMemory()
+		if defaultBranches != nil {
+			st.DefaultBranches = defaultBranches
+		}
+		return st, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported DATABASE_URL scheme %q (want postgres, sqlite or memory)", scheme)
+	}
+}
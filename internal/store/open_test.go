@@ -0,0 +1,32 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/challenge-github-events/internal/store"
+)
+
+func TestOpen_SelectsBackendByScheme(t *testing.T) {
+	ctx := context.Background()
+	for url, want := range map[string]string{
+		"memory://":       "*store.Memory",
+		"sqlite::memory:": "*store.SQLite",
+	} {
+		st, closeStore, err := store.Open(ctx, url, []string{"trunk"})
+		if err != nil {
+			t.Fatalf("Open(%q): %v", url, err)
+		}
+		if got := fmt.Sprintf("%T", st); got != want {
+			t.Errorf("Open(%q) want %s got %s", url, want, got)
+		}
+		if err := st.Ping(ctx); err != nil {
+			t.Errorf("Open(%q) ping: %v", url, err)
+		}
+		closeStore()
+	}
+	if _, _, err := store.Open(ctx, "mysql://localhost/db", nil); err == nil {
+		t.Error("Open(mysql://) want error")
+	}
+}
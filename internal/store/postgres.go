@@ -2,27 +2,92 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Postgres implements Store using PostgreSQL. Only this package and main use *sql.DB / *pgxpool.Pool.
+// DefaultBranches are the branch names StatsFilter.Branch "default" falls back to.
 type Postgres struct {
-	pool *pgxpool.Pool
+	pool            *pgxpool.Pool
+	DefaultBranches []string
 }
 
 // NewPostgres returns a Store backed by the given pool. Caller must call Close when done.
 func NewPostgres(pool *pgxpool.Pool) *Postgres {
-	return &Postgres{pool: pool}
+	return &Postgres{pool: pool, DefaultBranches: []string{"main", "master"}}
 }
 
 // InsertPushEvent inserts a push event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
 func (p *Postgres) InsertPushEvent(ctx context.Context, event *PushEventRow) (bool, error) {
 	cmd, err := p.pool.Exec(ctx, `
-		INSERT INTO gh_push_events (id, type, created_at, actor_login, repo, raw_payload)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO gh_push_events (id, type, created_at, actor_login, repo, raw_payload,
+			ref, ref_type, push_id, size, distinct_size, source, is_bot)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, 0), $10, $11, NULLIF($12, ''), $13)
+		ON CONFLICT (id, created_at) DO NOTHING
+	`, event.ID, event.Type, event.CreatedAt, event.ActorLogin, event.Repo, event.RawPayload,
+		event.Ref, event.RefType, event.PushID, event.Size, event.DistinctSize, event.Source, event.IsBot)
+	if err != nil {
+		return false, err
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// InsertPullRequestEvent inserts a pull request event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (p *Postgres) InsertPullRequestEvent(ctx context.Context, e *PullRequestEventRow) (bool, error) {
+	return p.insertEvent(ctx, `
+		INSERT INTO gh_pull_request_events (id, created_at, actor_login, repo, raw_payload, source, is_bot,
+			action, number, title, state, merged, additions, deletions, changed_files)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (id) DO NOTHING
+	`, e.ID, e.CreatedAt, e.ActorLogin, e.Repo, e.RawPayload, e.Source, e.IsBot,
+		e.Action, e.Number, e.Title, e.State, e.Merged, e.Additions, e.Deletions, e.ChangedFiles)
+}
+
+// InsertCreateEvent inserts a create event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (p *Postgres) InsertCreateEvent(ctx context.Context, e *CreateEventRow) (bool, error) {
+	return p.insertEvent(ctx, `
+		INSERT INTO gh_create_events (id, created_at, actor_login, repo, raw_payload, source, is_bot, ref, ref_type, master_branch)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10)
 		ON CONFLICT (id) DO NOTHING
-	`, event.ID, event.Type, event.CreatedAt, event.ActorLogin, event.Repo, event.RawPayload)
+	`, e.ID, e.CreatedAt, e.ActorLogin, e.Repo, e.RawPayload, e.Source, e.IsBot, e.Ref, e.RefType, e.MasterBranch)
+}
+
+// InsertDeleteEvent inserts a delete event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (p *Postgres) InsertDeleteEvent(ctx context.Context, e *DeleteEventRow) (bool, error) {
+	return p.insertEvent(ctx, `
+		INSERT INTO gh_delete_events (id, created_at, actor_login, repo, raw_payload, source, is_bot, ref, ref_type)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9)
+		ON CONFLICT (id) DO NOTHING
+	`, e.ID, e.CreatedAt, e.ActorLogin, e.Repo, e.RawPayload, e.Source, e.IsBot, e.Ref, e.RefType)
+}
+
+// InsertReleaseEvent inserts a release event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (p *Postgres) InsertReleaseEvent(ctx context.Context, e *ReleaseEventRow) (bool, error) {
+	return p.insertEvent(ctx, `
+		INSERT INTO gh_release_events (id, created_at, actor_login, repo, raw_payload, source, is_bot, action, tag_name, name, draft, prerelease)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO NOTHING
+	`, e.ID, e.CreatedAt, e.ActorLogin, e.Repo, e.RawPayload, e.Source, e.IsBot, e.Action, e.TagName, e.Name, e.Draft, e.Prerelease)
+}
+
+// InsertWatchEvent inserts a watch event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (p *Postgres) InsertWatchEvent(ctx context.Context, e *WatchEventRow) (bool, error) {
+	return p.insertEvent(ctx, `
+		INSERT INTO gh_watch_events (id, created_at, actor_login, repo, raw_payload, source, is_bot, action)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)
+		ON CONFLICT (id) DO NOTHING
+	`, e.ID, e.CreatedAt, e.ActorLogin, e.Repo, e.RawPayload, e.Source, e.IsBot, e.Action)
+}
+
+func (p *Postgres) insertEvent(ctx context.Context, sql string, args ...any) (bool, error) {
+	cmd, err := p.pool.Exec(ctx, sql, args...)
 	if err != nil {
 		return false, err
 	}
@@ -31,32 +96,1232 @@ func (p *Postgres) InsertPushEvent(ctx context.Context, event *PushEventRow) (bo
 
 // InsertCommitStats inserts commit stats. Returns (true, nil) if inserted, (false, nil) if duplicate sha.
 func (p *Postgres) InsertCommitStats(ctx context.Context, stats *CommitStatsRow) (bool, error) {
+	inserted, err := p.InsertCommitStatsBatch(ctx, []*CommitStatsRow{stats})
+	if err != nil {
+		return false, err
+	}
+	return inserted[0], nil
+}
+
+// InsertCommitStatsBatch inserts all rows with one statement per few thousand rows: SHAs are first claimed in
+// commit_shas (ON CONFLICT DO NOTHING), then only the claimed rows are inserted into the partitioned commit_stats.
+// inserted[i] is true when rows[i] was new; duplicate SHAs (seen before or within the batch) report false.
+func (p *Postgres) InsertCommitStatsBatch(ctx context.Context, rows []*CommitStatsRow) ([]bool, error) {
+	return pgInsertCommitStats(ctx, p.pool, rows)
+}
+
+// pgQuerier is a pool or a transaction.
+type pgQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// pgMaxParams is the most bind parameters a statement may have in the PostgreSQL wire protocol.
+const pgMaxParams = 65535
+
+// commitStatsTypes are the column types of the batch in pgInsertCommitStatsChunk, one parameter each per row.
+var commitStatsTypes = []string{"text", "text", "text", "timestamptz", "bigint", "bigint", "bigint", "bigint",
+	"bigint", "bigint", "bigint", "int", "boolean", "boolean", "bigint", "bigint"}
+
+// pgInsertCommitStats is InsertCommitStatsBatch on q, with one statement per chunk of rows small enough
+// for pgMaxParams. A SHA claimed by an earlier chunk reports false in a later one.
+func pgInsertCommitStats(ctx context.Context, q pgQuerier, rows []*CommitStatsRow) ([]bool, error) {
+	inserted := make([]bool, 0, len(rows))
+	for chunk := range slices.Chunk(rows, pgMaxParams/len(commitStatsTypes)) {
+		ok, err := pgInsertCommitStatsChunk(ctx, q, chunk)
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, ok...)
+	}
+	return inserted, nil
+}
+
+// pgInsertCommitStatsChunk inserts rows with a single statement.
+func pgInsertCommitStatsChunk(ctx context.Context, q pgQuerier, rows []*CommitStatsRow) ([]bool, error) {
+	inserted := make([]bool, len(rows))
+	types := commitStatsTypes
+	var sb strings.Builder
+	sb.WriteString(`WITH batch (sha, repo, author, committed_at, additions, deletions, total, net,
+		adjusted_additions, adjusted_deletions, adjusted_net, parent_count, is_merge, is_bot,
+		capped_additions, capped_deletions) AS (VALUES `)
+	args := make([]any, 0, len(rows)*len(types))
+	for i, r := range rows {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(placeholders(i*len(types), types))
+		cappedAdd, cappedDel := r.cappedLines()
+		args = append(args, r.Sha, r.Repo, r.Author, r.CommittedAt, r.Additions, r.Deletions, r.Total, r.Net,
+			r.AdjustedAdditions, r.AdjustedDeletions, r.AdjustedNet, r.ParentCount, r.IsMerge, r.IsBot, cappedAdd, cappedDel)
+	}
+	sb.WriteString(`),
+	claimed AS (
+		INSERT INTO commit_shas (sha) SELECT DISTINCT sha FROM batch
+		ON CONFLICT (sha) DO NOTHING
+		RETURNING sha
+	)
+	INSERT INTO commit_stats (sha, repo, author, committed_at, additions, deletions, total, net,
+		adjusted_additions, adjusted_deletions, adjusted_net, parent_count, is_merge, is_bot,
+		capped_additions, capped_deletions, orphaned)
+	SELECT DISTINCT ON (b.sha) b.*, EXISTS (SELECT 1 FROM orphaned_commits o WHERE o.sha = b.sha)
+	FROM batch b JOIN claimed c ON c.sha = b.sha
+	RETURNING sha`)
+
+	dbRows, err := q.Query(ctx, sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer dbRows.Close()
+	newSHAs := make(map[string]bool, len(rows))
+	for dbRows.Next() {
+		var sha string
+		if err := dbRows.Scan(&sha); err != nil {
+			return nil, err
+		}
+		newSHAs[sha] = true
+	}
+	if err := dbRows.Err(); err != nil {
+		return nil, err
+	}
+	for i, r := range rows {
+		if newSHAs[r.Sha] {
+			inserted[i] = true
+			delete(newSHAs, r.Sha) // later duplicates within the batch are not new
+		}
+	}
+	return inserted, nil
+}
+
+// InsertCommits inserts the stats rows and the details of the new commits in one transaction. Identities are
+// saved as by SaveCommitIdentities, holding the locks of all their keys until the transaction ends.
+func (p *Postgres) InsertCommits(ctx context.Context, commits []*CommitRow) ([]bool, error) {
+	rows := make([]*CommitStatsRow, len(commits))
+	for i, c := range commits {
+		rows[i] = c.Stats
+	}
+	var inserted []bool
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		var err error
+		if inserted, err = pgInsertCommitStats(ctx, tx, rows); err != nil {
+			return err
+		}
+		batch := &pgx.Batch{}
+		var identities []*CommitIdentityRow
+		var keys []string
+		for i, c := range commits {
+			if !inserted[i] {
+				continue
+			}
+			queueCommitFiles(batch, c.Files)
+			queueCommitLanguages(batch, c.Languages)
+			for _, r := range c.Identities {
+				if len(r.Keys) > 0 {
+					identities = append(identities, r)
+					keys = append(keys, r.Keys...)
+				}
+			}
+		}
+		if batch.Len() > 0 {
+			if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+				return err
+			}
+		}
+		if err := pgLockKeys(ctx, tx, keys); err != nil {
+			return err
+		}
+		for _, r := range identities {
+			if err := pgSaveCommitIdentity(ctx, tx, r); err != nil {
+				return fmt.Errorf("save %s of %s: %w", r.Role, r.Sha, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// InsertCommitFiles inserts per-file stats in one round trip. Rows already present (same sha and filename) are skipped.
+func (p *Postgres) InsertCommitFiles(ctx context.Context, files []*CommitFileRow) error {
+	if len(files) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	queueCommitFiles(batch, files)
+	return p.pool.SendBatch(ctx, batch).Close()
+}
+
+// queueCommitFiles queues the inserts of files in batch.
+func queueCommitFiles(batch *pgx.Batch, files []*CommitFileRow) {
+	for _, f := range files {
+		batch.Queue(`
+			INSERT INTO commit_files (sha, filename, previous_filename, status, additions, deletions, changes, excluded)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8)
+			ON CONFLICT (sha, filename) DO NOTHING
+		`, f.Sha, f.Filename, f.PreviousFilename, f.Status, f.Additions, f.Deletions, f.Changes, f.Excluded)
+	}
+}
+
+// CommitFiles returns the per-file stats of a commit ordered by filename.
+func (p *Postgres) CommitFiles(ctx context.Context, sha string) ([]*CommitFileRow, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT sha, filename, COALESCE(previous_filename, ''), COALESCE(status, ''), additions, deletions, changes, excluded
+		FROM commit_files
+		WHERE sha = $1
+		ORDER BY filename
+	`, sha)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*CommitFileRow
+	for rows.Next() {
+		f := new(CommitFileRow)
+		if err := rows.Scan(&f.Sha, &f.Filename, &f.PreviousFilename, &f.Status, &f.Additions, &f.Deletions, &f.Changes, &f.Excluded); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// InsertCommitLanguages inserts per-language stats in one round trip. Rows already present (same sha and language) are skipped.
+func (p *Postgres) InsertCommitLanguages(ctx context.Context, langs []*CommitLanguageRow) error {
+	if len(langs) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	queueCommitLanguages(batch, langs)
+	return p.pool.SendBatch(ctx, batch).Close()
+}
+
+// queueCommitLanguages queues the inserts of langs in batch.
+func queueCommitLanguages(batch *pgx.Batch, langs []*CommitLanguageRow) {
+	for _, l := range langs {
+		batch.Queue(`
+			INSERT INTO commit_languages (sha, language, files, additions, deletions, adjusted_additions, adjusted_deletions)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (sha, language) DO NOTHING
+		`, l.Sha, l.Language, l.Files, l.Additions, l.Deletions, l.AdjustedAdditions, l.AdjustedDeletions)
+	}
+}
+
+// LanguageStats returns line stats per language for the commits selected by filter, ordered by net lines.
+// Rollups of expired partitions are included (see rollupWhere).
+func (p *Postgres) LanguageStats(ctx context.Context, filter StatsFilter) ([]*LanguageStatsRow, error) {
+	add, del := "additions", "deletions"
+	if filter.Adjusted {
+		add, del = "adjusted_additions", "adjusted_deletions"
+	}
+	where, args := p.statsWhere(filter, "cs")
+	rollups, args := rollupWhere(filter, args)
+	rows, err := p.pool.Query(ctx, `
+		SELECT language, SUM(commits), SUM(additions), SUM(deletions)
+		FROM (
+			SELECT l.language, COUNT(DISTINCT l.sha) AS commits, COALESCE(SUM(l.`+add+`), 0) AS additions, COALESCE(SUM(l.`+del+`), 0) AS deletions
+			FROM commit_languages l
+			JOIN commit_stats cs ON cs.sha = l.sha
+			`+where+`
+			GROUP BY l.language
+			UNION ALL
+			SELECT language, commits, `+add+`, `+del+`
+			FROM commit_language_rollups
+			`+rollups+`
+		) t
+		GROUP BY language
+		ORDER BY SUM(additions) - SUM(deletions) DESC, language
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*LanguageStatsRow
+	for rows.Next() {
+		l := new(LanguageStatsRow)
+		if err := rows.Scan(&l.Language, &l.Commits, &l.Additions, &l.Deletions); err != nil {
+			return nil, err
+		}
+		l.Net = l.Additions - l.Deletions
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// SaveCommitIdentities links each identity to a canonical author and stores it, one transaction per identity.
+// Advisory locks on the identity's keys (taken in sorted order) keep concurrent workers from creating
+// two authors for the same key. Keys already linked to several authors merge them into the author of the
+// strongest key.
+func (p *Postgres) SaveCommitIdentities(ctx context.Context, rows []*CommitIdentityRow) error {
+	for _, r := range rows {
+		if len(r.Keys) == 0 {
+			continue
+		}
+		err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+			if err := pgLockKeys(ctx, tx, r.Keys); err != nil {
+				return err
+			}
+			return pgSaveCommitIdentity(ctx, tx, r)
+		})
+		if err != nil {
+			return fmt.Errorf("save %s of %s: %w", r.Role, r.Sha, err)
+		}
+	}
+	return nil
+}
+
+// pgLockKeys takes the advisory locks of the author keys, in sorted order so concurrent transactions do not deadlock.
+func pgLockKeys(ctx context.Context, tx pgx.Tx, keys []string) error {
+	for _, key := range slices.Compact(slices.Sorted(slices.Values(keys))) {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pgSaveCommitIdentity links r to a canonical author and stores it. The caller holds the locks of r.Keys.
+func pgSaveCommitIdentity(ctx context.Context, tx pgx.Tx, r *CommitIdentityRow) error {
+	rows, err := tx.Query(ctx, `
+		SELECT author_id FROM author_aliases WHERE key = ANY($1)
+		ORDER BY array_position($1, key)
+	`, r.Keys)
+	if err != nil {
+		return err
+	}
+	known, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return err
+	}
+	var id int64
+	if len(known) == 0 {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO authors (name, email, login) VALUES ($1, NULLIF($2, ''), NULLIF($3, '')) RETURNING id
+		`, r.Canonical.Name, r.Canonical.Email, r.Canonical.Login).Scan(&id)
+	} else {
+		id = known[0]
+		err = pgMergeAuthors(ctx, tx, id, otherAuthors(id, known))
+		if err == nil {
+			_, err = tx.Exec(ctx, `
+				UPDATE authors SET email = COALESCE(email, NULLIF($2, '')), login = COALESCE(login, NULLIF($3, ''))
+				WHERE id = $1 AND (email IS NULL OR login IS NULL)
+			`, id, r.Canonical.Email, r.Canonical.Login)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO author_aliases (key, author_id) SELECT unnest($1::text[]), $2
+		ON CONFLICT (key) DO NOTHING
+	`, r.Keys, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO commit_identities (sha, role, name, email, login, author_id)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6)
+		ON CONFLICT (sha, role) DO NOTHING
+	`, r.Sha, r.Role, r.Name, r.Email, r.Login, id); err != nil {
+		return err
+	}
+	r.AuthorID = id
+	return nil
+}
+
+// pgMergeAuthors re-points the aliases and identities of the authors others to id, filling in its missing
+// email and login from them. The other authors are kept but no longer referenced.
+func pgMergeAuthors(ctx context.Context, tx pgx.Tx, id int64, others []int64) error {
+	if len(others) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `UPDATE author_aliases SET author_id = $1 WHERE author_id = ANY($2)`, id, others); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE commit_identities SET author_id = $1 WHERE author_id = ANY($2)`, id, others); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE authors SET
+			email = COALESCE(email, (SELECT email FROM authors WHERE id = ANY($2) AND email IS NOT NULL ORDER BY id LIMIT 1)),
+			login = COALESCE(login, (SELECT login FROM authors WHERE id = ANY($2) AND login IS NOT NULL ORDER BY id LIMIT 1))
+		WHERE id = $1
+	`, id, others)
+	return err
+}
+
+// AuthorStats sums the commits matched by filter per canonical author. Rolled-up commits are not
+// attributed to authors, so they are left out.
+func (p *Postgres) AuthorStats(ctx context.Context, filter StatsFilter, limit int) ([]*AuthorStatsRow, error) {
+	add, del := lineColumns(filter, "cs")
+	where, args := p.statsWhere(filter, "cs")
+	limitClause := ""
+	if limit > 0 {
+		args = append(args, limit)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(args))
+	}
+	rows, err := p.pool.Query(ctx, `
+		SELECT a.id, a.name, COALESCE(a.email, ''), COALESCE(a.login, ''), COUNT(*),
+			COALESCE(SUM(`+add+`), 0), COALESCE(SUM(`+del+`), 0)
+		FROM commit_stats cs
+		JOIN commit_identities ci ON ci.sha = cs.sha AND ci.role = 'author'
+		JOIN authors a ON a.id = ci.author_id
+		`+where+`
+		GROUP BY a.id
+		ORDER BY SUM(`+add+`) - SUM(`+del+`) DESC, a.id
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*AuthorStatsRow
+	for rows.Next() {
+		a := new(AuthorStatsRow)
+		if err := rows.Scan(&a.AuthorID, &a.Name, &a.Email, &a.Login, &a.Commits, &a.Additions, &a.Deletions); err != nil {
+			return nil, err
+		}
+		a.Net = a.Additions - a.Deletions
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// InsertCommitRefs links commits to the refs they were pushed to in one round trip. Existing links are skipped.
+func (p *Postgres) InsertCommitRefs(ctx context.Context, refs []*CommitRefRow) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, r := range refs {
+		batch.Queue(`
+			INSERT INTO commit_refs (sha, repo, ref, event_id)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (sha, repo, ref) DO NOTHING
+		`, r.Sha, r.Repo, r.Ref, r.EventID)
+	}
+	return p.pool.SendBatch(ctx, batch).Close()
+}
+
+// InsertCommitRepos records the repos commits were seen in in one round trip. Existing links keep their first-seen time.
+func (p *Postgres) InsertCommitRepos(ctx context.Context, links []*CommitRepoRow) error {
+	if len(links) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, l := range links {
+		batch.Queue(`
+			INSERT INTO commit_repos (sha, repo, first_seen_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (sha, repo) DO NOTHING
+		`, l.Sha, l.Repo, l.FirstSeenAt)
+	}
+	return p.pool.SendBatch(ctx, batch).Close()
+}
+
+// CanonicalizeCommits attributes each of the given commits to its canonical repo.
+func (p *Postgres) CanonicalizeCommits(ctx context.Context, shas []string) (int64, error) {
+	if len(shas) == 0 {
+		return 0, nil
+	}
+	cmd, err := p.pool.Exec(ctx, fmt.Sprintf(canonicalizeQuery, "cr.sha = ANY($1)"), shas)
+	if err != nil {
+		return 0, err
+	}
+	return cmd.RowsAffected(), nil
+}
+
+// CanonicalizeRepos attributes the commits seen in one of repos and in another repo to their canonical repo.
+func (p *Postgres) CanonicalizeRepos(ctx context.Context, repos []string) (int64, error) {
+	if len(repos) == 0 {
+		return 0, nil
+	}
+	cmd, err := p.pool.Exec(ctx, fmt.Sprintf(canonicalizeQuery, "cr.sha IN (SELECT sha FROM commit_repos WHERE repo = ANY($1))"), repos)
+	if err != nil {
+		return 0, err
+	}
+	return cmd.RowsAffected(), nil
+}
+
+// RepoStats returns the line stats of the commits matched by filter per repo, by net lines descending.
+// Commits rolled up by retention are not counted.
+func (p *Postgres) RepoStats(ctx context.Context, filter StatsFilter, everyRepo bool, limit int) ([]*RepoStatsRow, error) {
+	add, del := lineColumns(filter, "cs")
+	from := "commit_stats"
+	if everyRepo {
+		from = commitsInEveryRepo
+	}
+	where, args := p.statsWhere(filter, "cs")
+	limitClause := ""
+	if limit > 0 {
+		args = append(args, limit)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(args))
+	}
+	rows, err := p.pool.Query(ctx, `
+		SELECT cs.repo, COUNT(*),
+			COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM commit_repos o WHERE o.sha = cs.sha AND o.repo <> cs.repo)),
+			COALESCE(SUM(`+add+`), 0), COALESCE(SUM(`+del+`), 0)
+		FROM `+from+` cs
+		`+where+`
+		GROUP BY cs.repo
+		ORDER BY SUM(`+add+`) - SUM(`+del+`) DESC, cs.repo
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*RepoStatsRow
+	for rows.Next() {
+		r := new(RepoStatsRow)
+		if err := rows.Scan(&r.Repo, &r.Commits, &r.Shared, &r.Additions, &r.Deletions); err != nil {
+			return nil, err
+		}
+		r.Net = r.Additions - r.Deletions
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// InsertForcePush records a force push. Returns (true, nil) if inserted, (false, nil) if duplicate event id.
+func (p *Postgres) InsertForcePush(ctx context.Context, fp *ForcePushRow) (bool, error) {
+	cmd, err := p.pool.Exec(ctx, `
+		INSERT INTO force_pushes (event_id, repo, before_sha, head_sha, detected_via, status, orphaned, detected_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)
+		ON CONFLICT (event_id) DO NOTHING
+	`, fp.EventID, fp.Repo, fp.Before, fp.Head, fp.DetectedVia, fp.Status, fp.Orphaned, fp.DetectedAt)
+	if err != nil {
+		return false, err
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// InsertAnomaly records an outlier commit. Returns (true, nil) if inserted, (false, nil) if duplicate sha.
+func (p *Postgres) InsertAnomaly(ctx context.Context, a *AnomalyRow) (bool, error) {
 	cmd, err := p.pool.Exec(ctx, `
-		INSERT INTO commit_stats (sha, repo, author, committed_at, additions, deletions, total, net)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO anomalies (sha, repo, author, committed_at, detected_at, additions, deletions,
+			method, baseline, samples, score, limit_lines, capped)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		ON CONFLICT (sha) DO NOTHING
-	`, stats.Sha, stats.Repo, stats.Author, stats.CommittedAt, stats.Additions, stats.Deletions, stats.Total, stats.Net)
+	`, a.Sha, a.Repo, a.Author, a.CommittedAt, a.DetectedAt, a.Additions, a.Deletions,
+		a.Method, a.Baseline, a.Samples, a.Score, a.Limit, a.Capped)
 	if err != nil {
 		return false, err
 	}
 	return cmd.RowsAffected() > 0, nil
 }
 
-// GlobalNetLines returns the sum of net from commit_stats.
-func (p *Postgres) GlobalNetLines(ctx context.Context) (int64, error) {
+// Anomalies returns the outlier commits matched by filter, most recently committed first.
+func (p *Postgres) Anomalies(ctx context.Context, filter AnomalyFilter) ([]*AnomalyRow, error) {
+	var conds []string
+	var args []any
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		conds = append(conds, fmt.Sprintf("committed_at >= $%d", len(args)))
+	}
+	if filter.Repo != "" {
+		args = append(args, filter.Repo)
+		conds = append(conds, fmt.Sprintf("repo = $%d", len(args)))
+	}
+	where, limit := "", ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		limit = fmt.Sprintf("LIMIT $%d", len(args))
+	}
+	rows, err := p.pool.Query(ctx, `
+		SELECT sha, repo, COALESCE(author, ''), committed_at, detected_at, additions, deletions,
+			method, baseline, samples, score, limit_lines, capped
+		FROM anomalies `+where+`
+		ORDER BY committed_at DESC NULLS LAST, sha
+		`+limit, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*AnomalyRow
+	for rows.Next() {
+		a := new(AnomalyRow)
+		var committedAt *time.Time
+		if err := rows.Scan(&a.Sha, &a.Repo, &a.Author, &committedAt, &a.DetectedAt, &a.Additions, &a.Deletions,
+			&a.Method, &a.Baseline, &a.Samples, &a.Score, &a.Limit, &a.Capped); err != nil {
+			return nil, err
+		}
+		if committedAt != nil {
+			a.CommittedAt = *committedAt
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// RepoActivity returns the pushes and commits per repo and bucket since filter.Since. Rollups of expired
+// partitions are not counted.
+func (p *Postgres) RepoActivity(ctx context.Context, filter StatsFilter, bucket time.Duration) ([]*RepoActivityRow, error) {
+	where, args := p.statsWhere(filter, "cs")
+	if where == "" {
+		where = "WHERE cs.committed_at IS NOT NULL"
+	} else {
+		where += " AND cs.committed_at IS NOT NULL"
+	}
+	args = append(args, max(int64(bucket/time.Second), 1))
+	width := fmt.Sprintf("$%d::bigint", len(args))
+	pushConds := []string{"created_at IS NOT NULL"}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		pushConds = append(pushConds, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if filter.ExcludeBots {
+		pushConds = append(pushConds, "NOT is_bot")
+	}
+	if filter.Repo != "" {
+		args = append(args, filter.Repo)
+		pushConds = append(pushConds, fmt.Sprintf("repo = $%d", len(args)))
+	}
+	rows, err := p.pool.Query(ctx, `
+		SELECT repo, bucket, SUM(pushes)::bigint, SUM(commits)::bigint FROM (
+			SELECT repo, floor(extract(epoch FROM created_at) / `+width+`)::bigint * `+width+` AS bucket,
+				COUNT(*) AS pushes, 0 AS commits
+			FROM gh_push_events
+			WHERE `+strings.Join(pushConds, " AND ")+`
+			GROUP BY 1, 2
+			UNION ALL
+			SELECT cs.repo, floor(extract(epoch FROM cs.committed_at) / `+width+`)::bigint * `+width+`, 0, COUNT(*)
+			FROM commit_stats cs `+where+`
+			GROUP BY 1, 2
+		) a
+		GROUP BY repo, bucket
+		ORDER BY repo, bucket
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*RepoActivityRow
+	for rows.Next() {
+		r := new(RepoActivityRow)
+		var start int64
+		if err := rows.Scan(&r.Repo, &start, &r.Pushes, &r.Commits); err != nil {
+			return nil, err
+		}
+		r.Bucket = time.Unix(start, 0).UTC()
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// RecentCommits returns up to limit commits matched by filter, most recently committed first.
+func (p *Postgres) RecentCommits(ctx context.Context, filter StatsFilter, limit int) ([]*CommitStatsRow, error) {
+	where, args := p.statsWhere(filter, "cs")
+	limitClause := ""
+	if limit > 0 {
+		args = append(args, limit)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(args))
+	}
+	rows, err := p.pool.Query(ctx, `
+		SELECT cs.sha, cs.repo, COALESCE(cs.author, ''), cs.committed_at, cs.additions, cs.deletions, cs.total, cs.net,
+			cs.adjusted_additions, cs.adjusted_deletions, cs.adjusted_net, cs.parent_count, cs.is_merge, cs.is_bot
+		FROM commit_stats cs `+where+`
+		ORDER BY cs.committed_at DESC NULLS LAST, cs.sha
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*CommitStatsRow
+	for rows.Next() {
+		r := new(CommitStatsRow)
+		var committedAt *time.Time
+		if err := rows.Scan(&r.Sha, &r.Repo, &r.Author, &committedAt, &r.Additions, &r.Deletions, &r.Total, &r.Net,
+			&r.AdjustedAdditions, &r.AdjustedDeletions, &r.AdjustedNet, &r.ParentCount, &r.IsMerge, &r.IsBot); err != nil {
+			return nil, err
+		}
+		if committedAt != nil {
+			r.CommittedAt = *committedAt
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SaveTrending replaces the trending snapshot of window with rows in one transaction.
+func (p *Postgres) SaveTrending(ctx context.Context, window time.Duration, rows []*TrendingRow) error {
+	sec := int64(window / time.Second)
+	return pgx.BeginTxFunc(ctx, p.pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM trending_repos WHERE window_sec = $1`, sec); err != nil {
+			return err
+		}
+		batch := &pgx.Batch{}
+		for _, r := range rows {
+			samples, err := json.Marshal(r.Samples)
+			if err != nil {
+				return err
+			}
+			batch.Queue(`
+				INSERT INTO trending_repos (window_sec, repo, rank, score, velocity, pushes, commits, samples, computed_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			`, sec, r.Repo, r.Rank, r.Score, r.Velocity, r.Pushes, r.Commits, samples, r.ComputedAt)
+		}
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+// Trending returns up to limit rows of the trending snapshot of window by rank.
+func (p *Postgres) Trending(ctx context.Context, window time.Duration, limit int) ([]*TrendingRow, error) {
+	args := []any{int64(window / time.Second)}
+	limitClause := ""
+	if limit > 0 {
+		args = append(args, limit)
+		limitClause = "LIMIT $2"
+	}
+	rows, err := p.pool.Query(ctx, `
+		SELECT repo, rank, score, velocity, pushes, commits, samples, computed_at
+		FROM trending_repos
+		WHERE window_sec = $1
+		ORDER BY rank, repo
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*TrendingRow
+	for rows.Next() {
+		r := &TrendingRow{Window: window}
+		var samples []byte
+		if err := rows.Scan(&r.Repo, &r.Rank, &r.Score, &r.Velocity, &r.Pushes, &r.Commits, &samples, &r.ComputedAt); err != nil {
+			return nil, err
+		}
+		if len(samples) > 0 {
+			if err := json.Unmarshal(samples, &r.Samples); err != nil {
+				return nil, fmt.Errorf("trending samples of %s: %w", r.Repo, err)
+			}
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SaveRepository upserts the metadata of a repo.
+func (p *Postgres) SaveRepository(ctx context.Context, r *RepositoryRow) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO repositories (repo, found, language, stars, fork, parent, default_branch, archived, license, fetched_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, NULLIF($9, ''), $10)
+		ON CONFLICT (repo) DO UPDATE SET
+			found = EXCLUDED.found,
+			language = EXCLUDED.language,
+			stars = EXCLUDED.stars,
+			fork = EXCLUDED.fork,
+			parent = EXCLUDED.parent,
+			default_branch = EXCLUDED.default_branch,
+			archived = EXCLUDED.archived,
+			license = EXCLUDED.license,
+			fetched_at = EXCLUDED.fetched_at
+	`, r.Repo, r.Found, r.Language, r.Stars, r.Fork, r.Parent, r.DefaultBranch, r.Archived, r.License, r.FetchedAt)
+	return err
+}
+
+// StaleRepositories returns up to limit repos commits were seen in whose metadata is missing or fetched before
+// fetchedBefore. The repos of commit_repos are walked with one probe of its repo index each, rather than a scan
+// of every commit; stale metadata is found through the fetched_at index of repositories.
+func (p *Postgres) StaleRepositories(ctx context.Context, fetchedBefore time.Time, limit int) ([]string, error) {
+	args := []any{fetchedBefore}
+	limitClause := ""
+	if limit > 0 {
+		args = append(args, limit)
+		limitClause = "LIMIT $2"
+	}
+	rows, err := p.pool.Query(ctx, `
+		WITH RECURSIVE seen (repo) AS (
+			(SELECT repo FROM commit_repos ORDER BY repo LIMIT 1)
+			UNION ALL
+			SELECT (SELECT cr.repo FROM commit_repos cr WHERE cr.repo > s.repo ORDER BY cr.repo LIMIT 1)
+			FROM seen s WHERE s.repo IS NOT NULL
+		)
+		SELECT repo FROM (
+			SELECT s.repo, NULL::timestamptz AS fetched_at
+			FROM seen s
+			WHERE s.repo IS NOT NULL AND NOT EXISTS (SELECT 1 FROM repositories rm WHERE rm.repo = s.repo)
+			UNION ALL
+			SELECT rm.repo, rm.fetched_at
+			FROM repositories rm
+			WHERE rm.fetched_at < $1 AND EXISTS (SELECT 1 FROM commit_repos cr WHERE cr.repo = rm.repo)
+		) stale
+		ORDER BY fetched_at NULLS FIRST, repo
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var repo string
+		if err := rows.Scan(&repo); err != nil {
+			return nil, err
+		}
+		out = append(out, repo)
+	}
+	return out, rows.Err()
+}
+
+// MarkCommitsOrphaned flags the given commits as discarded by a force push and records them so those not
+// stored yet are flagged when inserted. Returns the number of stored rows newly marked.
+func (p *Postgres) MarkCommitsOrphaned(ctx context.Context, shas []string) (int64, error) {
+	if len(shas) == 0 {
+		return 0, nil
+	}
+	cmd, err := p.pool.Exec(ctx, `
+		WITH recorded AS (
+			INSERT INTO orphaned_commits (sha) SELECT DISTINCT unnest($1::text[])
+			ON CONFLICT (sha) DO NOTHING
+		)
+		UPDATE commit_stats SET orphaned = TRUE WHERE sha = ANY($1) AND NOT orphaned`, shas)
+	if err != nil {
+		return 0, err
+	}
+	return cmd.RowsAffected(), nil
+}
+
+// MarkBot flags the events and commits of login as bots. Returns the number of rows newly flagged.
+func (p *Postgres) MarkBot(ctx context.Context, login string) (int64, error) {
+	login = strings.ToLower(login)
+	stmts := []string{`
+		UPDATE commit_stats SET is_bot = TRUE
+		WHERE NOT is_bot AND sha IN (SELECT sha FROM commit_identities WHERE role = '` + RoleAuthor + `' AND lower(login) = $1)`}
+	for _, table := range eventTables {
+		stmts = append(stmts, `UPDATE `+table+` SET is_bot = TRUE WHERE NOT is_bot AND lower(actor_login) = $1`)
+	}
+	var n int64
+	for _, stmt := range stmts {
+		cmd, err := p.pool.Exec(ctx, stmt, login)
+		if err != nil {
+			return n, err
+		}
+		n += cmd.RowsAffected()
+	}
+	return n, nil
+}
+
+// GlobalNetLines returns the sum of net (or adjusted) lines from commit_stats for the commits selected by filter,
+// outliers capped (see lineColumns), plus the rollups of expired partitions (see rollupWhere).
+func (p *Postgres) GlobalNetLines(ctx context.Context, filter StatsFilter) (int64, error) {
 	var v int64
-	err := p.pool.QueryRow(ctx, `SELECT COALESCE(SUM(net), 0) FROM commit_stats`).Scan(&v)
+	add, del := lineColumns(filter, "cs")
+	where, args := p.statsWhere(filter, "cs")
+	rollups, args := rollupWhere(filter, args)
+	err := p.pool.QueryRow(ctx, `
+		SELECT (SELECT COALESCE(SUM(`+add+` - `+del+`), 0) FROM commit_stats cs `+where+`)
+			+ (SELECT COALESCE(SUM(`+netColumn(filter)+`), 0) FROM commit_stats_rollups `+rollups+`)
+	`, args...).Scan(&v)
 	return v, err
 }
 
-// EventsSeenCount returns the count of rows in gh_push_events.
-func (p *Postgres) EventsSeenCount(ctx context.Context) (int64, error) {
+// EventsSeenCount returns the count of rows in gh_push_events matched by filter plus the events of expired partitions.
+func (p *Postgres) EventsSeenCount(ctx context.Context, filter EventFilter) (int64, error) {
 	var n int64
-	err := p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM gh_push_events`).Scan(&n)
+	err := p.pool.QueryRow(ctx, `SELECT `+pushEventCount(filter)).Scan(&n)
 	return n, err
 }
 
+// pushEventCount counts the stored push events matched by filter, including the rollups of expired partitions.
+func pushEventCount(filter EventFilter) string {
+	where := eventWhere(filter)
+	return `(SELECT COUNT(*) FROM gh_push_events ` + where + `) + (SELECT COALESCE(SUM(events), 0) FROM push_event_rollups ` + where + `)`
+}
+
+// eventWhere returns the WHERE clause (empty when unfiltered) selecting the event or event rollup rows matched by filter.
+func eventWhere(filter EventFilter) string {
+	if filter.ExcludeBots {
+		return "WHERE NOT is_bot"
+	}
+	return ""
+}
+
+// eventTables maps each GitHub event type to the table storing it.
+var eventTables = map[string]string{
+	"PushEvent":        "gh_push_events",
+	"PullRequestEvent": "gh_pull_request_events",
+	"CreateEvent":      "gh_create_events",
+	"DeleteEvent":      "gh_delete_events",
+	"ReleaseEvent":     "gh_release_events",
+	"WatchEvent":       "gh_watch_events",
+}
+
+// EventCountsByType returns the count of rows matched by filter in each event table keyed by event type.
+func (p *Postgres) EventCountsByType(ctx context.Context, filter EventFilter) (map[string]int64, error) {
+	parts := make([]string, 0, len(eventTables))
+	for typ, table := range eventTables {
+		if table == "gh_push_events" {
+			parts = append(parts, fmt.Sprintf("SELECT '%s', %s", typ, pushEventCount(filter)))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("SELECT '%s', COUNT(*) FROM %s %s", typ, table, eventWhere(filter)))
+	}
+	rows, err := p.pool.Query(ctx, strings.Join(parts, " UNION ALL "))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int64, len(eventTables))
+	for rows.Next() {
+		var typ string
+		var n int64
+		if err := rows.Scan(&typ, &n); err != nil {
+			return nil, err
+		}
+		counts[typ] = n
+	}
+	return counts, rows.Err()
+}
+
+// SavePollerState upserts the polling state of state.Source.
+func (p *Postgres) SavePollerState(ctx context.Context, state *PollerStateRow) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO poller_state (source, etag, last_event_id, last_poll_at, last_status, updated_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, NOW())
+		ON CONFLICT (source) DO UPDATE SET
+			etag = EXCLUDED.etag,
+			last_event_id = COALESCE(EXCLUDED.last_event_id, poller_state.last_event_id),
+			last_poll_at = EXCLUDED.last_poll_at,
+			last_status = EXCLUDED.last_status,
+			updated_at = NOW()
+	`, state.Source, state.ETag, state.LastEventID, state.LastPollAt, state.LastStatus)
+	return err
+}
+
+// PollerStates returns the polling state of every source, ordered by source.
+func (p *Postgres) PollerStates(ctx context.Context) ([]*PollerStateRow, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT source, COALESCE(etag, ''), COALESCE(last_event_id, ''), last_poll_at, COALESCE(last_status, '')
+		FROM poller_state
+		ORDER BY source
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*PollerStateRow
+	for rows.Next() {
+		var st PollerStateRow
+		var lastPoll *time.Time
+		if err := rows.Scan(&st.Source, &st.ETag, &st.LastEventID, &lastPoll, &st.LastStatus); err != nil {
+			return nil, err
+		}
+		if lastPoll != nil {
+			st.LastPollAt = *lastPoll
+		}
+		out = append(out, &st)
+	}
+	return out, rows.Err()
+}
+
+// SpillJobs appends commit jobs to the overflow.
+func (p *Postgres) SpillJobs(ctx context.Context, jobs []*SpilledJobRow) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, j := range jobs {
+		batch.Queue(`
+			INSERT INTO job_overflow (event_id, owner, repo, sha, spilled_at)
+			VALUES (NULLIF($1, ''), $2, $3, $4, $5)
+		`, j.EventID, j.Owner, j.Repo, j.Sha, j.SpilledAt)
+	}
+	return p.pool.SendBatch(ctx, batch).Close()
+}
+
+// SpilledJobs returns up to limit jobs of the overflow, oldest first, leaving them in it.
+func (p *Postgres) SpilledJobs(ctx context.Context, limit int) ([]*SpilledJobRow, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, COALESCE(event_id, ''), owner, repo, sha, spilled_at
+		FROM job_overflow
+		ORDER BY id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*SpilledJobRow
+	for rows.Next() {
+		var j SpilledJobRow
+		if err := rows.Scan(&j.ID, &j.EventID, &j.Owner, &j.Repo, &j.Sha, &j.SpilledAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &j)
+	}
+	return out, rows.Err()
+}
+
+// DeleteSpilledJobs removes the jobs with the given ids from the overflow.
+func (p *Postgres) DeleteSpilledJobs(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := p.pool.Exec(ctx, `DELETE FROM job_overflow WHERE id = ANY($1)`, ids)
+	return err
+}
+
+// SpilledJobsCount returns the number of jobs in the overflow.
+func (p *Postgres) SpilledJobsCount(ctx context.Context) (int64, error) {
+	var n int64
+	err := p.pool.QueryRow(ctx, `SELECT COUNT(*) FROM job_overflow`).Scan(&n)
+	return n, err
+}
+
+// exportFetchSize is the number of rows fetched per round trip from an export cursor.
+const exportFetchSize = 1000
+
+// ExportCommitStats streams the commit_stats rows matched by filter to fn through a server-side cursor,
+// so memory stays constant however many rows match.
+func (p *Postgres) ExportCommitStats(ctx context.Context, filter ExportFilter, fn func(*CommitStatsRow) error) error {
+	where, args := exportWhere(filter, "committed_at", "author")
+	return p.exportRows(ctx, `
+		SELECT sha, repo, COALESCE(author, ''), committed_at, additions, deletions, total, net,
+			adjusted_additions, adjusted_deletions, adjusted_net, parent_count, is_merge, is_bot,
+			capped_additions, capped_deletions, orphaned
+		FROM commit_stats `+where+`
+		ORDER BY committed_at, sha
+	`, args, func(rows pgx.Rows) error {
+		r := new(CommitStatsRow)
+		var cappedAdd, cappedDel *int64
+		if err := rows.Scan(&r.Sha, &r.Repo, &r.Author, &r.CommittedAt, &r.Additions, &r.Deletions, &r.Total, &r.Net,
+			&r.AdjustedAdditions, &r.AdjustedDeletions, &r.AdjustedNet, &r.ParentCount, &r.IsMerge, &r.IsBot,
+			&cappedAdd, &cappedDel, &r.Orphaned); err != nil {
+			return err
+		}
+		if cappedAdd != nil && cappedDel != nil {
+			r.Capped, r.CappedAdditions, r.CappedDeletions = true, *cappedAdd, *cappedDel
+		}
+		return fn(r)
+	})
+}
+
+// ExportPushEvents streams the gh_push_events rows matched by filter to fn through a server-side cursor.
+func (p *Postgres) ExportPushEvents(ctx context.Context, filter ExportFilter, fn func(*PushEventRow) error) error {
+	where, args := exportWhere(filter, "created_at", "actor_login")
+	return p.exportRows(ctx, `
+		SELECT id, type, created_at, COALESCE(actor_login, ''), repo, raw_payload, COALESCE(ref, ''), COALESCE(ref_type, ''),
+			COALESCE(push_id, 0), COALESCE(size, 0), COALESCE(distinct_size, 0), COALESCE(source, ''), is_bot
+		FROM gh_push_events `+where+`
+		ORDER BY created_at, id
+	`, args, func(rows pgx.Rows) error {
+		r := new(PushEventRow)
+		if err := rows.Scan(&r.ID, &r.Type, &r.CreatedAt, &r.ActorLogin, &r.Repo, &r.RawPayload, &r.Ref, &r.RefType,
+			&r.PushID, &r.Size, &r.DistinctSize, &r.Source, &r.IsBot); err != nil {
+			return err
+		}
+		return fn(r)
+	})
+}
+
+// exportRows declares a cursor for query in a read-only transaction and fetches it exportFetchSize rows at a time,
+// calling scan for each row.
+func (p *Postgres) exportRows(ctx context.Context, query string, args []any, scan func(pgx.Rows) error) error {
+	return pgx.BeginTxFunc(ctx, p.pool, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DECLARE export_cursor NO SCROLL CURSOR FOR `+query, args...); err != nil {
+			return err
+		}
+		for {
+			rows, err := tx.Query(ctx, fmt.Sprintf(`FETCH FORWARD %d FROM export_cursor`, exportFetchSize))
+			if err != nil {
+				return err
+			}
+			n := 0
+			for rows.Next() {
+				n++
+				if err := scan(rows); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			if n < exportFetchSize {
+				return nil
+			}
+		}
+	})
+}
+
+// exportWhere returns the WHERE clause (empty when unfiltered) and its arguments for filter,
+// given the table's time and author columns.
+func exportWhere(filter ExportFilter, timeColumn, authorColumn string) (string, []any) {
+	var conds []string
+	var args []any
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conds = append(conds, fmt.Sprintf("%s >= $%d", timeColumn, len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conds = append(conds, fmt.Sprintf("%s < $%d", timeColumn, len(args)))
+	}
+	if filter.Repo != "" {
+		args = append(args, filter.Repo)
+		conds = append(conds, fmt.Sprintf("repo = $%d", len(args)))
+	}
+	if filter.Author != "" {
+		args = append(args, filter.Author)
+		conds = append(conds, fmt.Sprintf("%s = $%d", authorColumn, len(args)))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
 // Ping checks the database connection.
 func (p *Postgres) Ping(ctx context.Context) error {
 	return p.pool.Ping(ctx)
 }
+
+// placeholders returns "($n+1::type1, ..., $n+k::typek)" for one row of a multi-row VALUES list.
+func placeholders(n int, types []string) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for c, typ := range types {
+		if c > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "$%d::%s", n+c+1, typ)
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// commitsInEveryRepo is a commit_stats-shaped FROM source (used aliased as cs) with one row per repo a commit was
+// seen in: its canonical repo, and every other repo of commit_repos.
+const commitsInEveryRepo = `(
+	SELECT cr.repo, s.sha, s.committed_at, s.is_merge, s.orphaned, s.is_bot, s.additions, s.deletions,
+		s.adjusted_additions, s.adjusted_deletions, s.capped_additions, s.capped_deletions
+	FROM commit_stats s
+	JOIN commit_repos cr ON cr.sha = s.sha AND cr.repo <> s.repo
+	UNION ALL
+	SELECT s.repo, s.sha, s.committed_at, s.is_merge, s.orphaned, s.is_bot, s.additions, s.deletions,
+		s.adjusted_additions, s.adjusted_deletions, s.capped_additions, s.capped_deletions
+	FROM commit_stats s
+)`
+
+// canonicalizeQuery re-attributes commits of forks (or of repos not found) to their canonical repo (see
+// Store.CanonicalizeRepos): the first seen repo known not to be a fork, else the fork's parent. The %s verb is
+// the condition on cr.sha selecting the commits to consider.
+const canonicalizeQuery = `
+	UPDATE commit_stats SET repo = c.repo
+	FROM (
+		SELECT sha, repo FROM (
+			SELECT cr.sha, cr.repo,
+				ROW_NUMBER() OVER (PARTITION BY cr.sha ORDER BY rm.fork, cr.first_seen_at, cr.repo) AS n
+			FROM commit_repos cr
+			JOIN commit_stats s ON s.sha = cr.sha AND s.repo <> cr.repo
+			JOIN repositories cur ON cur.repo = s.repo AND NOT (cur.found AND NOT cur.fork)
+			JOIN repositories rm ON rm.repo = cr.repo AND rm.found AND (NOT rm.fork OR rm.repo = cur.parent)
+			WHERE %s
+		) ranked
+		WHERE n = 1
+	) c
+	WHERE commit_stats.sha = c.sha`
+
+// netColumn returns the commit_stats_rollups column holding the net lines selected by filter.
+func netColumn(filter StatsFilter) string {
+	if filter.Adjusted {
+		return "adjusted_net"
+	}
+	return "net"
+}
+
+// lineColumns returns the additions and deletions of the commit_stats rows aliased alias counted by
+// aggregates: adjusted lines when filter.Adjusted, else raw lines, or the capped ones of capped outliers.
+func lineColumns(filter StatsFilter, alias string) (add, del string) {
+	if filter.Adjusted {
+		return alias + ".adjusted_additions", alias + ".adjusted_deletions"
+	}
+	return "COALESCE(" + alias + ".capped_additions, " + alias + ".additions)",
+		"COALESCE(" + alias + ".capped_deletions, " + alias + ".deletions)"
+}
+
+// statsWhere returns the WHERE clause (empty when unfiltered) and its arguments selecting the
+// commit_stats rows (aliased as alias) matched by filter.
+func (p *Postgres) statsWhere(filter StatsFilter, alias string) (string, []any) {
+	var conds []string
+	var args []any
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		conds = append(conds, fmt.Sprintf("%s.committed_at >= $%d", alias, len(args)))
+	}
+	if filter.ExcludeMerges {
+		conds = append(conds, "NOT "+alias+".is_merge")
+	}
+	if filter.ExcludeOrphaned {
+		conds = append(conds, "NOT "+alias+".orphaned")
+	}
+	if filter.ExcludeBots {
+		conds = append(conds, "NOT "+alias+".is_bot")
+	}
+	if filter.Repo != "" {
+		args = append(args, filter.Repo)
+		conds = append(conds, fmt.Sprintf("%s.repo = $%d", alias, len(args)))
+	}
+	if filter.repoMeta() {
+		meta := []string{"rm.repo = " + alias + ".repo", "rm.found"}
+		switch filter.Forks {
+		case ForksOnly:
+			meta = append(meta, "rm.fork")
+		case ForksExclude:
+			meta = append(meta, "NOT rm.fork")
+		}
+		if filter.RepoLanguage != "" {
+			args = append(args, filter.RepoLanguage)
+			meta = append(meta, fmt.Sprintf("lower(rm.language) = lower($%d)", len(args)))
+		}
+		if filter.MinStars > 0 {
+			args = append(args, filter.MinStars)
+			meta = append(meta, fmt.Sprintf("rm.stars >= $%d", len(args)))
+		}
+		conds = append(conds, "EXISTS (SELECT 1 FROM repositories rm WHERE "+strings.Join(meta, " AND ")+")")
+	}
+	if filter.Branch == BranchDefault {
+		args = append(args, branchRefs(filter.Branch, p.DefaultBranches))
+		branch := defaultBranchSQL("r.repo")
+		conds = append(conds, fmt.Sprintf("EXISTS (SELECT 1 FROM commit_refs r WHERE r.sha = %s.sha AND "+
+			"(r.ref = 'refs/heads/' || %s OR %s IS NULL AND r.ref = ANY($%d)))", alias, branch, branch, len(args)))
+	} else if filter.Branch != "" {
+		args = append(args, branchRefs(filter.Branch, p.DefaultBranches))
+		conds = append(conds, fmt.Sprintf("EXISTS (SELECT 1 FROM commit_refs r WHERE r.sha = %s.sha AND r.ref = ANY($%d))", alias, len(args)))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// rollupWhere returns the WHERE clause selecting the rollup rows (commit_stats_rollups, commit_language_rollups)
+// matched by filter, appending its arguments to args. Rollups keep month, merge, orphaned and bot flags only:
+// a window counts the months starting at or after Since, and branch, repo and repository metadata filters
+// exclude rollups entirely.
+func rollupWhere(filter StatsFilter, args []any) (string, []any) {
+	if filter.Branch != "" || filter.Repo != "" || filter.repoMeta() {
+		return "WHERE FALSE", args
+	}
+	var conds []string
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		conds = append(conds, fmt.Sprintf("month >= $%d", len(args)))
+	}
+	if filter.ExcludeMerges {
+		conds = append(conds, "NOT is_merge")
+	}
+	if filter.ExcludeOrphaned {
+		conds = append(conds, "NOT orphaned")
+	}
+	if filter.ExcludeBots {
+		conds = append(conds, "NOT is_bot")
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// partitionedTable is a table range-partitioned by month on column (see config/sql/012_partition_by_month.sql).
+type partitionedTable struct {
+	name   string
+	column string
+}
+
+var partitionedTables = []partitionedTable{
+	{name: "gh_push_events", column: "created_at"},
+	{name: "commit_stats", column: "committed_at"},
+}
+
+// partitionName returns the name of t's partition for the month starting at month, e.g. commit_stats_y2025m11.
+func (t partitionedTable) partitionName(month time.Time) string {
+	return fmt.Sprintf("%s_y%04dm%02d", t.name, month.Year(), int(month.Month()))
+}
+
+// partitionMonth parses the month of a partition name created by partitionName.
+func (t partitionedTable) partitionMonth(name string) (time.Time, bool) {
+	var year, month int
+	suffix, ok := strings.CutPrefix(name, t.name+"_")
+	if !ok {
+		return time.Time{}, false
+	}
+	if _, err := fmt.Sscanf(suffix, "y%04dm%02d", &year, &month); err != nil || month < 1 || month > 12 {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), true
+}
+
+// monthStart returns the first instant (UTC) of t's month.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// EnsurePartitions creates the monthly partitions covering [from, to). Rows of a new partition's range
+// already in the default partition are moved into it in the same transaction.
+func (p *Postgres) EnsurePartitions(ctx context.Context, from, to time.Time) error {
+	for month := monthStart(from); month.Before(to); month = month.AddDate(0, 1, 0) {
+		for _, t := range partitionedTables {
+			if err := p.createPartition(ctx, t, month); err != nil {
+				return fmt.Errorf("create partition %s: %w", t.partitionName(month), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) createPartition(ctx context.Context, t partitionedTable, month time.Time) error {
+	name := t.partitionName(month)
+	var exists bool
+	if err := p.pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil || exists {
+		return err
+	}
+	lo, hi := month, month.AddDate(0, 1, 0)
+	part, parent := pgx.Identifier{name}.Sanitize(), pgx.Identifier{t.name}.Sanitize()
+	def, col := pgx.Identifier{t.name + "_default"}.Sanitize(), pgx.Identifier{t.column}.Sanitize()
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `CREATE TABLE `+part+` (LIKE `+parent+` INCLUDING DEFAULTS)`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			WITH moved AS (DELETE FROM `+def+` WHERE `+col+` >= $1 AND `+col+` < $2 RETURNING *)
+			INSERT INTO `+part+` SELECT * FROM moved
+		`, lo, hi); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`,
+			parent, part, lo.Format(time.RFC3339), hi.Format(time.RFC3339)))
+		return err
+	})
+}
+
+// ExpireBefore rolls up and removes data older than cutoff. Monthly partitions ending at or before cutoff are
+// dropped, or detached when archive is set; older rows in the default partitions are deleted, or moved to
+// <table>_archive. Per-file, per-language, ref and identity rows of dropped commits are deleted too (kept when archiving).
+func (p *Postgres) ExpireBefore(ctx context.Context, cutoff time.Time, archive bool) ([]string, error) {
+	var expired []string
+	for _, t := range partitionedTables {
+		names, err := p.partitions(ctx, t)
+		if err != nil {
+			return expired, err
+		}
+		for _, name := range names {
+			month, ok := t.partitionMonth(name)
+			if !ok || month.AddDate(0, 1, 0).After(cutoff) {
+				continue
+			}
+			if err := p.expirePartition(ctx, t, name, archive); err != nil {
+				return expired, fmt.Errorf("expire partition %s: %w", name, err)
+			}
+			expired = append(expired, name)
+		}
+		if err := p.expireDefaultRows(ctx, t, cutoff, archive); err != nil {
+			return expired, fmt.Errorf("expire %s_default rows: %w", t.name, err)
+		}
+	}
+	return expired, nil
+}
+
+// partitions returns the names of the partitions attached to t.
+func (p *Postgres) partitions(ctx context.Context, t partitionedTable) ([]string, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = $1::regclass
+		ORDER BY c.relname
+	`, t.name)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (p *Postgres) expirePartition(ctx context.Context, t partitionedTable, name string, archive bool) error {
+	part := pgx.Identifier{name}.Sanitize()
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		if err := rollUp(ctx, tx, t, part, "", nil, !archive); err != nil {
+			return err
+		}
+		if archive {
+			_, err := tx.Exec(ctx, `ALTER TABLE `+pgx.Identifier{t.name}.Sanitize()+` DETACH PARTITION `+part)
+			return err
+		}
+		_, err := tx.Exec(ctx, `DROP TABLE `+part)
+		return err
+	})
+}
+
+func (p *Postgres) expireDefaultRows(ctx context.Context, t partitionedTable, cutoff time.Time, archive bool) error {
+	def := pgx.Identifier{t.name + "_default"}.Sanitize()
+	where := `WHERE ` + pgx.Identifier{t.column}.Sanitize() + ` < $1`
+	args := []any{cutoff}
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		if err := rollUp(ctx, tx, t, def, where, args, !archive); err != nil {
+			return err
+		}
+		if !archive {
+			_, err := tx.Exec(ctx, `DELETE FROM `+def+` `+where, args...)
+			return err
+		}
+		dest := pgx.Identifier{t.name + "_archive"}.Sanitize()
+		if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+dest+` (LIKE `+pgx.Identifier{t.name}.Sanitize()+` INCLUDING DEFAULTS)`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `WITH moved AS (DELETE FROM `+def+` `+where+` RETURNING *) INSERT INTO `+dest+` SELECT * FROM moved`, args...)
+		return err
+	})
+}
+
+// rollUp adds the rows of source (a partition of t, filtered by where) to t's rollup tables.
+// Commit rollups count the capped lines of capped outliers, as aggregates do (see lineColumns).
+// When deleteDetails is set, the commit_files, commit_languages, commit_refs, commit_repos and commit_identities rows of the commits are deleted.
+func rollUp(ctx context.Context, tx pgx.Tx, t partitionedTable, source, where string, args []any, deleteDetails bool) error {
+	var stmts []string
+	switch t.name {
+	case "gh_push_events":
+		stmts = append(stmts, `
+			INSERT INTO push_event_rollups (month, is_bot, events)
+			SELECT date_trunc('month', created_at AT TIME ZONE 'UTC')::date, is_bot, COUNT(*)
+			FROM `+source+` `+where+`
+			GROUP BY 1, 2
+			ON CONFLICT (month, is_bot) DO UPDATE SET events = push_event_rollups.events + EXCLUDED.events`)
+	case "commit_stats":
+		stmts = append(stmts, `
+			INSERT INTO commit_stats_rollups (month, is_merge, orphaned, is_bot, commits, additions, deletions, net,
+				adjusted_additions, adjusted_deletions, adjusted_net)
+			SELECT date_trunc('month', committed_at AT TIME ZONE 'UTC')::date, is_merge, orphaned, is_bot, COUNT(*),
+				SUM(COALESCE(capped_additions, additions)), SUM(COALESCE(capped_deletions, deletions)),
+				SUM(COALESCE(capped_additions - capped_deletions, net)),
+				SUM(adjusted_additions), SUM(adjusted_deletions), SUM(adjusted_net)
+			FROM `+source+` `+where+`
+			GROUP BY 1, 2, 3, 4
+			ON CONFLICT (month, is_merge, orphaned, is_bot) DO UPDATE SET
+				commits = commit_stats_rollups.commits + EXCLUDED.commits,
+				additions = commit_stats_rollups.additions + EXCLUDED.additions,
+				deletions = commit_stats_rollups.deletions + EXCLUDED.deletions,
+				net = commit_stats_rollups.net + EXCLUDED.net,
+				adjusted_additions = commit_stats_rollups.adjusted_additions + EXCLUDED.adjusted_additions,
+				adjusted_deletions = commit_stats_rollups.adjusted_deletions + EXCLUDED.adjusted_deletions,
+				adjusted_net = commit_stats_rollups.adjusted_net + EXCLUDED.adjusted_net`,
+			`
+			INSERT INTO commit_language_rollups (month, language, is_merge, orphaned, is_bot, commits, additions, deletions,
+				adjusted_additions, adjusted_deletions)
+			SELECT date_trunc('month', cs.committed_at AT TIME ZONE 'UTC')::date, l.language, cs.is_merge, cs.orphaned, cs.is_bot,
+				COUNT(DISTINCT l.sha), SUM(l.additions), SUM(l.deletions), SUM(l.adjusted_additions), SUM(l.adjusted_deletions)
+			FROM commit_languages l
+			JOIN (SELECT * FROM `+source+` `+where+`) cs ON cs.sha = l.sha
+			GROUP BY 1, 2, 3, 4, 5
+			ON CONFLICT (month, language, is_merge, orphaned, is_bot) DO UPDATE SET
+				commits = commit_language_rollups.commits + EXCLUDED.commits,
+				additions = commit_language_rollups.additions + EXCLUDED.additions,
+				deletions = commit_language_rollups.deletions + EXCLUDED.deletions,
+				adjusted_additions = commit_language_rollups.adjusted_additions + EXCLUDED.adjusted_additions,
+				adjusted_deletions = commit_language_rollups.adjusted_deletions + EXCLUDED.adjusted_deletions`)
+		if deleteDetails {
+			for _, details := range []string{"commit_files", "commit_languages", "commit_refs", "commit_repos", "commit_identities"} {
+				stmts = append(stmts, `DELETE FROM `+details+` WHERE sha IN (SELECT sha FROM `+source+` `+where+`)`)
+			}
+		}
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(ctx, stmt, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StripRawPayloads clears raw_payload of events (all event tables) created before cutoff.
+func (p *Postgres) StripRawPayloads(ctx context.Context, cutoff time.Time) (int64, error) {
+	var n int64
+	for _, table := range eventTables {
+		cmd, err := p.pool.Exec(ctx, `UPDATE `+table+` SET raw_payload = NULL WHERE created_at < $1 AND raw_payload IS NOT NULL`, cutoff)
+		if err != nil {
+			return n, err
+		}
+		n += cmd.RowsAffected()
+	}
+	return n, nil
+}
@@ -0,0 +1,1318 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the pure-Go "sqlite" driver
+)
+
+//go:embed sqlite_schema.sql
+var sqliteSchema string
+
+// sqliteTimeFormat is how timestamps are stored: UTC and fixed width, so TEXT comparison orders them.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+
+// SQLite implements Store using SQLite (pure Go, no cgo), with the same idempotency semantics as Postgres.
+// DefaultBranches are the branch names StatsFilter.Branch "default" falls back to. ExportPageSize is the number
+// of rows exports read per query (DefaultExportPageSize when <= 0).
+type SQLite struct {
+	db              *sql.DB
+	DefaultBranches []string
+	ExportPageSize  int
+}
+
+// DefaultExportPageSize is the number of rows SQLite exports read per query. Between pages the connection
+// is released, so a slow download does not hold up ingestion and queries.
+const DefaultExportPageSize = 1000
+
+// OpenSQLite opens the SQLite database at dsn (a file path or ":memory:") and creates the schema.
+// Caller must call Close when done.
+func OpenSQLite(ctx context.Context, dsn string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// One connection serializes writers (avoiding SQLITE_BUSY) and keeps ":memory:" a single database.
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create sqlite schema: %w", err)
+	}
+	if err := sqliteAddColumns(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("upgrade sqlite schema: %w", err)
+	}
+	return &SQLite{db: db, DefaultBranches: []string{"main", "master"}}, nil
+}
+
+// sqliteAddedColumns are the columns added to tables after their first release. CREATE TABLE IF NOT EXISTS
+// leaves tables of older databases as they are, so OpenSQLite adds the missing ones.
+var sqliteAddedColumns = []struct{ table, column, definition string }{
+	{"gh_push_events", "is_bot", "INTEGER NOT NULL DEFAULT 0"},
+	{"gh_pull_request_events", "is_bot", "INTEGER NOT NULL DEFAULT 0"},
+	{"gh_create_events", "is_bot", "INTEGER NOT NULL DEFAULT 0"},
+	{"gh_delete_events", "is_bot", "INTEGER NOT NULL DEFAULT 0"},
+	{"gh_release_events", "is_bot", "INTEGER NOT NULL DEFAULT 0"},
+	{"gh_watch_events", "is_bot", "INTEGER NOT NULL DEFAULT 0"},
+	{"commit_stats", "is_bot", "INTEGER NOT NULL DEFAULT 0"},
+	{"commit_stats", "capped_additions", "INTEGER"},
+	{"commit_stats", "capped_deletions", "INTEGER"},
+}
+
+// sqliteAddColumns adds the sqliteAddedColumns missing from db.
+func sqliteAddColumns(ctx context.Context, db *sql.DB) error {
+	for _, c := range sqliteAddedColumns {
+		var n int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, `ALTER TABLE `+c.table+` ADD COLUMN `+c.column+` `+c.definition); err != nil {
+			return fmt.Errorf("add %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// InsertPushEvent inserts a push event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (s *SQLite) InsertPushEvent(ctx context.Context, event *PushEventRow) (bool, error) {
+	return s.insert(ctx, `
+		INSERT INTO gh_push_events (id, type, created_at, actor_login, repo, raw_payload,
+			ref, ref_type, push_id, size, distinct_size, source, is_bot)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, 0), ?, ?, NULLIF(?, ''), ?)
+		ON CONFLICT (id) DO NOTHING
+	`, event.ID, event.Type, sqliteTime(event.CreatedAt), event.ActorLogin, event.Repo, string(event.RawPayload),
+		event.Ref, event.RefType, event.PushID, event.Size, event.DistinctSize, event.Source, event.IsBot)
+}
+
+// InsertPullRequestEvent inserts a pull request event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (s *SQLite) InsertPullRequestEvent(ctx context.Context, e *PullRequestEventRow) (bool, error) {
+	return s.insert(ctx, `
+		INSERT INTO gh_pull_request_events (id, created_at, actor_login, repo, raw_payload, source, is_bot,
+			action, number, title, state, merged, additions, deletions, changed_files)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`, e.ID, sqliteTime(e.CreatedAt), e.ActorLogin, e.Repo, string(e.RawPayload), e.Source, e.IsBot,
+		e.Action, e.Number, e.Title, e.State, e.Merged, e.Additions, e.Deletions, e.ChangedFiles)
+}
+
+// InsertCreateEvent inserts a create event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (s *SQLite) InsertCreateEvent(ctx context.Context, e *CreateEventRow) (bool, error) {
+	return s.insert(ctx, `
+		INSERT INTO gh_create_events (id, created_at, actor_login, repo, raw_payload, source, is_bot, ref, ref_type, master_branch)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`, e.ID, sqliteTime(e.CreatedAt), e.ActorLogin, e.Repo, string(e.RawPayload), e.Source, e.IsBot, e.Ref, e.RefType, e.MasterBranch)
+}
+
+// InsertDeleteEvent inserts a delete event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (s *SQLite) InsertDeleteEvent(ctx context.Context, e *DeleteEventRow) (bool, error) {
+	return s.insert(ctx, `
+		INSERT INTO gh_delete_events (id, created_at, actor_login, repo, raw_payload, source, is_bot, ref, ref_type)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`, e.ID, sqliteTime(e.CreatedAt), e.ActorLogin, e.Repo, string(e.RawPayload), e.Source, e.IsBot, e.Ref, e.RefType)
+}
+
+// InsertReleaseEvent inserts a release event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (s *SQLite) InsertReleaseEvent(ctx context.Context, e *ReleaseEventRow) (bool, error) {
+	return s.insert(ctx, `
+		INSERT INTO gh_release_events (id, created_at, actor_login, repo, raw_payload, source, is_bot, action, tag_name, name, draft, prerelease)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`, e.ID, sqliteTime(e.CreatedAt), e.ActorLogin, e.Repo, string(e.RawPayload), e.Source, e.IsBot, e.Action, e.TagName, e.Name, e.Draft, e.Prerelease)
+}
+
+// InsertWatchEvent inserts a watch event. Returns (true, nil) if inserted, (false, nil) if duplicate id.
+func (s *SQLite) InsertWatchEvent(ctx context.Context, e *WatchEventRow) (bool, error) {
+	return s.insert(ctx, `
+		INSERT INTO gh_watch_events (id, created_at, actor_login, repo, raw_payload, source, is_bot, action)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`, e.ID, sqliteTime(e.CreatedAt), e.ActorLogin, e.Repo, string(e.RawPayload), e.Source, e.IsBot, e.Action)
+}
+
+// insert runs an INSERT ... ON CONFLICT DO NOTHING and reports whether a row was inserted.
+func (s *SQLite) insert(ctx context.Context, query string, args ...any) (bool, error) {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// InsertCommitStats inserts commit stats. Returns (true, nil) if inserted, (false, nil) if duplicate sha.
+func (s *SQLite) InsertCommitStats(ctx context.Context, stats *CommitStatsRow) (bool, error) {
+	inserted, err := s.InsertCommitStatsBatch(ctx, []*CommitStatsRow{stats})
+	if err != nil {
+		return false, err
+	}
+	return inserted[0], nil
+}
+
+// InsertCommitStatsBatch inserts all rows with one multi-row INSERT ... ON CONFLICT per few thousand rows.
+// inserted[i] is true when rows[i] was new; duplicate SHAs (in the table or within the batch) report false.
+func (s *SQLite) InsertCommitStatsBatch(ctx context.Context, rows []*CommitStatsRow) ([]bool, error) {
+	return sqliteInsertCommitStats(ctx, s.db, rows)
+}
+
+// sqliteQuerier is a database or a transaction.
+type sqliteQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// sqliteMaxParams is the most bind parameters a statement may have (SQLITE_MAX_VARIABLE_NUMBER).
+const sqliteMaxParams = 32766
+
+// sqliteInsertCommitStats is InsertCommitStatsBatch on q, with one statement per chunk of rows small enough
+// for sqliteMaxParams (17 per row).
+func sqliteInsertCommitStats(ctx context.Context, q sqliteQuerier, rows []*CommitStatsRow) ([]bool, error) {
+	inserted := make([]bool, 0, len(rows))
+	for chunk := range slices.Chunk(rows, sqliteMaxParams/17) {
+		ok, err := sqliteInsertCommitStatsChunk(ctx, q, chunk)
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, ok...)
+	}
+	return inserted, nil
+}
+
+// sqliteInsertCommitStatsChunk inserts rows with a single statement.
+func sqliteInsertCommitStatsChunk(ctx context.Context, q sqliteQuerier, rows []*CommitStatsRow) ([]bool, error) {
+	inserted := make([]bool, len(rows))
+	const row = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, EXISTS (SELECT 1 FROM orphaned_commits WHERE sha = ?))"
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO commit_stats (sha, repo, author, committed_at, additions, deletions, total, net,
+		adjusted_additions, adjusted_deletions, adjusted_net, parent_count, is_merge, is_bot,
+		capped_additions, capped_deletions, orphaned) VALUES `)
+	args := make([]any, 0, len(rows)*17)
+	for i, r := range rows {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(row)
+		cappedAdd, cappedDel := r.cappedLines()
+		args = append(args, r.Sha, r.Repo, r.Author, sqliteTime(r.CommittedAt), r.Additions, r.Deletions, r.Total, r.Net,
+			r.AdjustedAdditions, r.AdjustedDeletions, r.AdjustedNet, r.ParentCount, r.IsMerge, r.IsBot, cappedAdd, cappedDel, r.Sha)
+	}
+	sb.WriteString(` ON CONFLICT (sha) DO NOTHING RETURNING sha`)
+
+	dbRows, err := q.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer dbRows.Close()
+	newSHAs := make(map[string]bool, len(rows))
+	for dbRows.Next() {
+		var sha string
+		if err := dbRows.Scan(&sha); err != nil {
+			return nil, err
+		}
+		newSHAs[sha] = true
+	}
+	if err := dbRows.Err(); err != nil {
+		return nil, err
+	}
+	for i, r := range rows {
+		if newSHAs[r.Sha] {
+			inserted[i] = true
+			delete(newSHAs, r.Sha) // later duplicates within the batch are not new
+		}
+	}
+	return inserted, nil
+}
+
+// InsertCommits inserts the stats rows and the details of the new commits in one transaction.
+func (s *SQLite) InsertCommits(ctx context.Context, commits []*CommitRow) ([]bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows := make([]*CommitStatsRow, len(commits))
+	for i, c := range commits {
+		rows[i] = c.Stats
+	}
+	inserted, err := sqliteInsertCommitStats(ctx, tx, rows)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range commits {
+		if !inserted[i] {
+			continue
+		}
+		if err := sqliteExecEach(ctx, tx, sqliteInsertCommitFile, len(c.Files), commitFileArgs(c.Files)); err != nil {
+			return nil, err
+		}
+		if err := sqliteExecEach(ctx, tx, sqliteInsertCommitLanguage, len(c.Languages), commitLanguageArgs(c.Languages)); err != nil {
+			return nil, err
+		}
+		if err := sqliteSaveCommitIdentities(ctx, tx, c.Identities); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// InsertCommitFiles inserts per-file stats in one transaction. Rows already present (same sha and filename) are skipped.
+func (s *SQLite) InsertCommitFiles(ctx context.Context, files []*CommitFileRow) error {
+	return s.execEach(ctx, sqliteInsertCommitFile, len(files), commitFileArgs(files))
+}
+
+const sqliteInsertCommitFile = `
+	INSERT INTO commit_files (sha, filename, previous_filename, status, additions, deletions, changes, excluded)
+	VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?)
+	ON CONFLICT (sha, filename) DO NOTHING`
+
+// commitFileArgs returns the sqliteInsertCommitFile arguments of files[i].
+func commitFileArgs(files []*CommitFileRow) func(i int) []any {
+	return func(i int) []any {
+		f := files[i]
+		return []any{f.Sha, f.Filename, f.PreviousFilename, f.Status, f.Additions, f.Deletions, f.Changes, f.Excluded}
+	}
+}
+
+// CommitFiles returns the per-file stats of a commit ordered by filename.
+func (s *SQLite) CommitFiles(ctx context.Context, sha string) ([]*CommitFileRow, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT sha, filename, COALESCE(previous_filename, ''), COALESCE(status, ''), additions, deletions, changes, excluded
+		FROM commit_files
+		WHERE sha = ?
+		ORDER BY filename
+	`, sha)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*CommitFileRow
+	for rows.Next() {
+		f := new(CommitFileRow)
+		if err := rows.Scan(&f.Sha, &f.Filename, &f.PreviousFilename, &f.Status, &f.Additions, &f.Deletions, &f.Changes, &f.Excluded); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// InsertCommitLanguages inserts per-language stats in one transaction. Rows already present (same sha and language) are skipped.
+func (s *SQLite) InsertCommitLanguages(ctx context.Context, langs []*CommitLanguageRow) error {
+	return s.execEach(ctx, sqliteInsertCommitLanguage, len(langs), commitLanguageArgs(langs))
+}
+
+const sqliteInsertCommitLanguage = `
+	INSERT INTO commit_languages (sha, language, files, additions, deletions, adjusted_additions, adjusted_deletions)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (sha, language) DO NOTHING`
+
+// commitLanguageArgs returns the sqliteInsertCommitLanguage arguments of langs[i].
+func commitLanguageArgs(langs []*CommitLanguageRow) func(i int) []any {
+	return func(i int) []any {
+		l := langs[i]
+		return []any{l.Sha, l.Language, l.Files, l.Additions, l.Deletions, l.AdjustedAdditions, l.AdjustedDeletions}
+	}
+}
+
+// LanguageStats returns line stats per language for the commits selected by filter, ordered by net lines.
+func (s *SQLite) LanguageStats(ctx context.Context, filter StatsFilter) ([]*LanguageStatsRow, error) {
+	add, del := "l.additions", "l.deletions"
+	if filter.Adjusted {
+		add, del = "l.adjusted_additions", "l.adjusted_deletions"
+	}
+	where, args := s.statsWhere(filter, "cs")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT l.language, COUNT(DISTINCT l.sha), COALESCE(SUM(`+add+`), 0), COALESCE(SUM(`+del+`), 0)
+		FROM commit_languages l
+		JOIN commit_stats cs ON cs.sha = l.sha
+		`+where+`
+		GROUP BY l.language
+		ORDER BY SUM(`+add+`) - SUM(`+del+`) DESC, l.language
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*LanguageStatsRow
+	for rows.Next() {
+		l := new(LanguageStatsRow)
+		if err := rows.Scan(&l.Language, &l.Commits, &l.Additions, &l.Deletions); err != nil {
+			return nil, err
+		}
+		l.Net = l.Additions - l.Deletions
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// SaveCommitIdentities links each identity to a canonical author and stores it, all in one transaction.
+// The single connection serializes concurrent callers.
+func (s *SQLite) SaveCommitIdentities(ctx context.Context, rows []*CommitIdentityRow) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := sqliteSaveCommitIdentities(ctx, tx, rows); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteSaveCommitIdentities is SaveCommitIdentities in tx.
+func sqliteSaveCommitIdentities(ctx context.Context, tx *sql.Tx, rows []*CommitIdentityRow) error {
+	for _, r := range rows {
+		if len(r.Keys) == 0 {
+			continue
+		}
+		id, err := sqliteResolveAuthor(ctx, tx, r)
+		if err != nil {
+			return fmt.Errorf("save %s of %s: %w", r.Role, r.Sha, err)
+		}
+		for _, key := range r.Keys {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO author_aliases (key, author_id) VALUES (?, ?) ON CONFLICT (key) DO NOTHING`, key, id); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO commit_identities (sha, role, name, email, login, author_id)
+			VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?)
+			ON CONFLICT (sha, role) DO NOTHING
+		`, r.Sha, r.Role, r.Name, r.Email, r.Login, id); err != nil {
+			return err
+		}
+		r.AuthorID = id
+	}
+	return nil
+}
+
+// sqliteResolveAuthor returns the author linked to the first known key of r, filling in its missing email
+// and login and merging into it the other authors linked to r's keys, or creates one from r.Canonical.
+func sqliteResolveAuthor(ctx context.Context, tx *sql.Tx, r *CommitIdentityRow) (int64, error) {
+	var known []int64
+	for _, key := range r.Keys {
+		var id int64
+		err := tx.QueryRowContext(ctx, `SELECT author_id FROM author_aliases WHERE key = ?`, key).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		known = append(known, id)
+	}
+	if len(known) == 0 {
+		res, err := tx.ExecContext(ctx, `INSERT INTO authors (name, email, login, created_at) VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?)`,
+			r.Canonical.Name, r.Canonical.Email, r.Canonical.Login, sqliteTime(time.Now()))
+		if err != nil {
+			return 0, err
+		}
+		return res.LastInsertId()
+	}
+	id := known[0]
+	for _, other := range otherAuthors(id, known) {
+		for _, q := range []string{
+			`UPDATE author_aliases SET author_id = ?1 WHERE author_id = ?2`,
+			`UPDATE commit_identities SET author_id = ?1 WHERE author_id = ?2`,
+			`UPDATE authors SET email = COALESCE(email, (SELECT email FROM authors WHERE id = ?2)),
+				login = COALESCE(login, (SELECT login FROM authors WHERE id = ?2)) WHERE id = ?1`,
+		} {
+			if _, err := tx.ExecContext(ctx, q, id, other); err != nil {
+				return 0, err
+			}
+		}
+	}
+	_, err := tx.ExecContext(ctx, `
+		UPDATE authors SET email = COALESCE(email, NULLIF(?, '')), login = COALESCE(login, NULLIF(?, ''))
+		WHERE id = ?
+	`, r.Canonical.Email, r.Canonical.Login, id)
+	return id, err
+}
+
+// AuthorStats sums the commits matched by filter per canonical author.
+func (s *SQLite) AuthorStats(ctx context.Context, filter StatsFilter, limit int) ([]*AuthorStatsRow, error) {
+	add, del := lineColumns(filter, "cs")
+	where, args := s.statsWhere(filter, "cs")
+	limitClause := ""
+	if limit > 0 {
+		args = append(args, limit)
+		limitClause = "LIMIT ?"
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id, a.name, COALESCE(a.email, ''), COALESCE(a.login, ''), COUNT(*),
+			COALESCE(SUM(`+add+`), 0), COALESCE(SUM(`+del+`), 0)
+		FROM commit_stats cs
+		JOIN commit_identities ci ON ci.sha = cs.sha AND ci.role = 'author'
+		JOIN authors a ON a.id = ci.author_id
+		`+where+`
+		GROUP BY a.id
+		ORDER BY SUM(`+add+`) - SUM(`+del+`) DESC, a.id
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*AuthorStatsRow
+	for rows.Next() {
+		a := new(AuthorStatsRow)
+		if err := rows.Scan(&a.AuthorID, &a.Name, &a.Email, &a.Login, &a.Commits, &a.Additions, &a.Deletions); err != nil {
+			return nil, err
+		}
+		a.Net = a.Additions - a.Deletions
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// InsertCommitRefs links commits to the refs they were pushed to in one transaction. Existing links are skipped.
+func (s *SQLite) InsertCommitRefs(ctx context.Context, refs []*CommitRefRow) error {
+	return s.execEach(ctx, `
+		INSERT INTO commit_refs (sha, repo, ref, event_id)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (sha, repo, ref) DO NOTHING
+	`, len(refs), func(i int) []any {
+		r := refs[i]
+		return []any{r.Sha, r.Repo, r.Ref, r.EventID}
+	})
+}
+
+// InsertCommitRepos records the repos commits were seen in in one transaction. Existing links keep their first-seen time.
+func (s *SQLite) InsertCommitRepos(ctx context.Context, links []*CommitRepoRow) error {
+	return s.execEach(ctx, `
+		INSERT INTO commit_repos (sha, repo, first_seen_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (sha, repo) DO NOTHING
+	`, len(links), func(i int) []any {
+		l := links[i]
+		return []any{l.Sha, l.Repo, sqliteTime(l.FirstSeenAt)}
+	})
+}
+
+// CanonicalizeCommits attributes each of the given commits to its canonical repo.
+func (s *SQLite) CanonicalizeCommits(ctx context.Context, shas []string) (int64, error) {
+	if len(shas) == 0 {
+		return 0, nil
+	}
+	args := make([]any, len(shas))
+	for i, sha := range shas {
+		args[i] = sha
+	}
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(canonicalizeQuery, "cr.sha IN ("+sqliteParams(len(shas))+")"), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CanonicalizeRepos attributes the commits seen in one of repos and in another repo to their canonical repo.
+func (s *SQLite) CanonicalizeRepos(ctx context.Context, repos []string) (int64, error) {
+	if len(repos) == 0 {
+		return 0, nil
+	}
+	args := make([]any, len(repos))
+	for i, repo := range repos {
+		args[i] = repo
+	}
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(canonicalizeQuery,
+		"cr.sha IN (SELECT sha FROM commit_repos WHERE repo IN ("+sqliteParams(len(repos))+"))"), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RepoStats returns the line stats of the commits matched by filter per repo, by net lines descending.
+func (s *SQLite) RepoStats(ctx context.Context, filter StatsFilter, everyRepo bool, limit int) ([]*RepoStatsRow, error) {
+	add, del := lineColumns(filter, "cs")
+	from := "commit_stats"
+	if everyRepo {
+		from = commitsInEveryRepo
+	}
+	where, args := s.statsWhere(filter, "cs")
+	limitClause := ""
+	if limit > 0 {
+		args = append(args, limit)
+		limitClause = "LIMIT ?"
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT cs.repo, COUNT(*),
+			SUM(EXISTS (SELECT 1 FROM commit_repos o WHERE o.sha = cs.sha AND o.repo <> cs.repo)),
+			COALESCE(SUM(`+add+`), 0), COALESCE(SUM(`+del+`), 0)
+		FROM `+from+` cs
+		`+where+`
+		GROUP BY cs.repo
+		ORDER BY SUM(`+add+`) - SUM(`+del+`) DESC, cs.repo
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*RepoStatsRow
+	for rows.Next() {
+		r := new(RepoStatsRow)
+		if err := rows.Scan(&r.Repo, &r.Commits, &r.Shared, &r.Additions, &r.Deletions); err != nil {
+			return nil, err
+		}
+		r.Net = r.Additions - r.Deletions
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// execEach runs query once per row (args(i) for i in [0, n)) in one transaction.
+func (s *SQLite) execEach(ctx context.Context, query string, n int, args func(i int) []any) error {
+	if n == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := sqliteExecEach(ctx, tx, query, n, args); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteExecEach is execEach in tx.
+func sqliteExecEach(ctx context.Context, tx *sql.Tx, query string, n int, args func(i int) []any) error {
+	if n == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := 0; i < n; i++ {
+		if _, err := stmt.ExecContext(ctx, args(i)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertForcePush records a force push. Returns (true, nil) if inserted, (false, nil) if duplicate event id.
+func (s *SQLite) InsertForcePush(ctx context.Context, fp *ForcePushRow) (bool, error) {
+	detectedAt := fp.DetectedAt
+	if detectedAt.IsZero() {
+		detectedAt = time.Now()
+	}
+	return s.insert(ctx, `
+		INSERT INTO force_pushes (event_id, repo, before_sha, head_sha, detected_via, status, orphaned, detected_at)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+		ON CONFLICT (event_id) DO NOTHING
+	`, fp.EventID, fp.Repo, fp.Before, fp.Head, fp.DetectedVia, fp.Status, fp.Orphaned, sqliteTime(detectedAt))
+}
+
+// InsertAnomaly records an outlier commit. Returns (true, nil) if inserted, (false, nil) if duplicate sha.
+func (s *SQLite) InsertAnomaly(ctx context.Context, a *AnomalyRow) (bool, error) {
+	detectedAt := a.DetectedAt
+	if detectedAt.IsZero() {
+		detectedAt = time.Now()
+	}
+	return s.insert(ctx, `
+		INSERT INTO anomalies (sha, repo, author, committed_at, detected_at, additions, deletions,
+			method, baseline, samples, score, limit_lines, capped)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (sha) DO NOTHING
+	`, a.Sha, a.Repo, a.Author, sqliteTime(a.CommittedAt), sqliteTime(detectedAt), a.Additions, a.Deletions,
+		a.Method, a.Baseline, a.Samples, a.Score, a.Limit, a.Capped)
+}
+
+// Anomalies returns the outlier commits matched by filter, most recently committed first.
+func (s *SQLite) Anomalies(ctx context.Context, filter AnomalyFilter) ([]*AnomalyRow, error) {
+	var conds []string
+	var args []any
+	if !filter.Since.IsZero() {
+		conds, args = append(conds, "committed_at >= ?"), append(args, sqliteTime(filter.Since))
+	}
+	if filter.Repo != "" {
+		conds, args = append(conds, "repo = ?"), append(args, filter.Repo)
+	}
+	where, limit := "", ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	if filter.Limit > 0 {
+		limit, args = "LIMIT ?", append(args, filter.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT sha, repo, COALESCE(author, ''), COALESCE(committed_at, ''), detected_at, additions, deletions,
+			method, baseline, samples, score, limit_lines, capped
+		FROM anomalies `+where+`
+		ORDER BY committed_at IS NULL, committed_at DESC, sha
+		`+limit, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*AnomalyRow
+	for rows.Next() {
+		a := new(AnomalyRow)
+		var committedAt, detectedAt string
+		if err := rows.Scan(&a.Sha, &a.Repo, &a.Author, &committedAt, &detectedAt, &a.Additions, &a.Deletions,
+			&a.Method, &a.Baseline, &a.Samples, &a.Score, &a.Limit, &a.Capped); err != nil {
+			return nil, err
+		}
+		if a.CommittedAt, err = parseSQLiteTime(committedAt); err != nil {
+			return nil, err
+		}
+		if a.DetectedAt, err = parseSQLiteTime(detectedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// RepoActivity returns the pushes and commits per repo and bucket since filter.Since.
+func (s *SQLite) RepoActivity(ctx context.Context, filter StatsFilter, bucket time.Duration) ([]*RepoActivityRow, error) {
+	width := max(int64(bucket/time.Second), 1)
+	pushConds := []string{"created_at IS NOT NULL"}
+	args := []any{width, width}
+	if !filter.Since.IsZero() {
+		pushConds, args = append(pushConds, "created_at >= ?"), append(args, sqliteTime(filter.Since))
+	}
+	if filter.ExcludeBots {
+		pushConds = append(pushConds, "NOT is_bot")
+	}
+	if filter.Repo != "" {
+		pushConds, args = append(pushConds, "repo = ?"), append(args, filter.Repo)
+	}
+	where, statsArgs := s.statsWhere(filter, "cs")
+	if where == "" {
+		where = "WHERE cs.committed_at IS NOT NULL"
+	} else {
+		where += " AND cs.committed_at IS NOT NULL"
+	}
+	args = append(append(args, width, width), statsArgs...)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT repo, bucket, SUM(pushes), SUM(commits) FROM (
+			SELECT repo, CAST(strftime('%s', created_at) AS INTEGER) / ? * ? AS bucket, COUNT(*) AS pushes, 0 AS commits
+			FROM gh_push_events
+			WHERE `+strings.Join(pushConds, " AND ")+`
+			GROUP BY 1, 2
+			UNION ALL
+			SELECT cs.repo, CAST(strftime('%s', cs.committed_at) AS INTEGER) / ? * ?, 0, COUNT(*)
+			FROM commit_stats cs `+where+`
+			GROUP BY 1, 2
+		)
+		GROUP BY repo, bucket
+		ORDER BY repo, bucket
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*RepoActivityRow
+	for rows.Next() {
+		r := new(RepoActivityRow)
+		var start int64
+		if err := rows.Scan(&r.Repo, &start, &r.Pushes, &r.Commits); err != nil {
+			return nil, err
+		}
+		r.Bucket = time.Unix(start, 0).UTC()
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// RecentCommits returns up to limit commits matched by filter, most recently committed first.
+func (s *SQLite) RecentCommits(ctx context.Context, filter StatsFilter, limit int) ([]*CommitStatsRow, error) {
+	where, args := s.statsWhere(filter, "cs")
+	limitClause := ""
+	if limit > 0 {
+		limitClause, args = "LIMIT ?", append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT cs.sha, cs.repo, COALESCE(cs.author, ''), COALESCE(cs.committed_at, ''), cs.additions, cs.deletions, cs.total, cs.net,
+			cs.adjusted_additions, cs.adjusted_deletions, cs.adjusted_net, cs.parent_count, cs.is_merge, cs.is_bot
+		FROM commit_stats cs `+where+`
+		ORDER BY cs.committed_at IS NULL, cs.committed_at DESC, cs.sha
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*CommitStatsRow
+	for rows.Next() {
+		r := new(CommitStatsRow)
+		var committedAt string
+		if err := rows.Scan(&r.Sha, &r.Repo, &r.Author, &committedAt, &r.Additions, &r.Deletions, &r.Total, &r.Net,
+			&r.AdjustedAdditions, &r.AdjustedDeletions, &r.AdjustedNet, &r.ParentCount, &r.IsMerge, &r.IsBot); err != nil {
+			return nil, err
+		}
+		if r.CommittedAt, err = parseSQLiteTime(committedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SaveTrending replaces the trending snapshot of window with rows in one transaction.
+func (s *SQLite) SaveTrending(ctx context.Context, window time.Duration, rows []*TrendingRow) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	sec := int64(window / time.Second)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM trending_repos WHERE window_sec = ?`, sec); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		samples, err := json.Marshal(r.Samples)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO trending_repos (window_sec, repo, rank, score, velocity, pushes, commits, samples, computed_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, sec, r.Repo, r.Rank, r.Score, r.Velocity, r.Pushes, r.Commits, string(samples), sqliteTime(r.ComputedAt)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Trending returns up to limit rows of the trending snapshot of window by rank.
+func (s *SQLite) Trending(ctx context.Context, window time.Duration, limit int) ([]*TrendingRow, error) {
+	args := []any{int64(window / time.Second)}
+	limitClause := ""
+	if limit > 0 {
+		limitClause, args = "LIMIT ?", append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT repo, rank, score, velocity, pushes, commits, COALESCE(samples, ''), computed_at
+		FROM trending_repos
+		WHERE window_sec = ?
+		ORDER BY rank, repo
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*TrendingRow
+	for rows.Next() {
+		r := &TrendingRow{Window: window}
+		var samples, computedAt string
+		if err := rows.Scan(&r.Repo, &r.Rank, &r.Score, &r.Velocity, &r.Pushes, &r.Commits, &samples, &computedAt); err != nil {
+			return nil, err
+		}
+		if samples != "" {
+			if err := json.Unmarshal([]byte(samples), &r.Samples); err != nil {
+				return nil, fmt.Errorf("trending samples of %s: %w", r.Repo, err)
+			}
+		}
+		if r.ComputedAt, err = parseSQLiteTime(computedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SaveRepository upserts the metadata of a repo.
+func (s *SQLite) SaveRepository(ctx context.Context, r *RepositoryRow) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO repositories (repo, found, language, stars, fork, parent, default_branch, archived, license, fetched_at)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), ?)
+		ON CONFLICT (repo) DO UPDATE SET
+			found = excluded.found,
+			language = excluded.language,
+			stars = excluded.stars,
+			fork = excluded.fork,
+			parent = excluded.parent,
+			default_branch = excluded.default_branch,
+			archived = excluded.archived,
+			license = excluded.license,
+			fetched_at = excluded.fetched_at
+	`, r.Repo, r.Found, r.Language, r.Stars, r.Fork, r.Parent, r.DefaultBranch, r.Archived, r.License, sqliteTime(r.FetchedAt))
+	return err
+}
+
+// StaleRepositories returns up to limit repos commits were seen in whose metadata is missing or fetched before
+// fetchedBefore, walking the repo index of commit_repos rather than every commit (see Postgres.StaleRepositories).
+func (s *SQLite) StaleRepositories(ctx context.Context, fetchedBefore time.Time, limit int) ([]string, error) {
+	args := []any{sqliteTime(fetchedBefore)}
+	limitClause := ""
+	if limit > 0 {
+		limitClause, args = "LIMIT ?", append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE seen (repo) AS (
+			SELECT (SELECT repo FROM commit_repos ORDER BY repo LIMIT 1)
+			UNION ALL
+			SELECT (SELECT cr.repo FROM commit_repos cr WHERE cr.repo > s.repo ORDER BY cr.repo LIMIT 1)
+			FROM seen s WHERE s.repo IS NOT NULL
+		)
+		SELECT repo FROM (
+			SELECT s.repo, NULL AS fetched_at
+			FROM seen s
+			WHERE s.repo IS NOT NULL AND NOT EXISTS (SELECT 1 FROM repositories rm WHERE rm.repo = s.repo)
+			UNION ALL
+			SELECT rm.repo, rm.fetched_at
+			FROM repositories rm
+			WHERE rm.fetched_at < ? AND EXISTS (SELECT 1 FROM commit_repos cr WHERE cr.repo = rm.repo)
+		)
+		ORDER BY fetched_at IS NOT NULL, fetched_at, repo
+		`+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var repo string
+		if err := rows.Scan(&repo); err != nil {
+			return nil, err
+		}
+		out = append(out, repo)
+	}
+	return out, rows.Err()
+}
+
+// MarkCommitsOrphaned flags the given commits as discarded by a force push and records them so those not
+// stored yet are flagged when inserted. Returns the number of stored rows newly marked.
+func (s *SQLite) MarkCommitsOrphaned(ctx context.Context, shas []string) (int64, error) {
+	if len(shas) == 0 {
+		return 0, nil
+	}
+	args := make([]any, len(shas))
+	for i, sha := range shas {
+		args[i] = sha
+	}
+	values := strings.TrimSuffix(strings.Repeat("(?), ", len(shas)), ", ")
+	if _, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO orphaned_commits (sha) VALUES `+values, args...); err != nil {
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE commit_stats SET orphaned = 1 WHERE sha IN (`+sqliteParams(len(shas))+`) AND NOT orphaned`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// MarkBot flags the events and commits of login as bots. Returns the number of rows newly flagged.
+func (s *SQLite) MarkBot(ctx context.Context, login string) (int64, error) {
+	login = strings.ToLower(login)
+	stmts := []string{`
+		UPDATE commit_stats SET is_bot = 1
+		WHERE NOT is_bot AND sha IN (SELECT sha FROM commit_identities WHERE role = '` + RoleAuthor + `' AND lower(login) = ?)`}
+	for _, table := range eventTables {
+		stmts = append(stmts, `UPDATE `+table+` SET is_bot = 1 WHERE NOT is_bot AND lower(actor_login) = ?`)
+	}
+	var n int64
+	for _, stmt := range stmts {
+		res, err := s.db.ExecContext(ctx, stmt, login)
+		if err != nil {
+			return n, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return n, err
+		}
+		n += affected
+	}
+	return n, nil
+}
+
+// GlobalNetLines returns the sum of net (or adjusted) lines from commit_stats for the commits selected by filter,
+// outliers capped (see lineColumns).
+func (s *SQLite) GlobalNetLines(ctx context.Context, filter StatsFilter) (int64, error) {
+	var v int64
+	add, del := lineColumns(filter, "cs")
+	where, args := s.statsWhere(filter, "cs")
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(`+add+` - `+del+`), 0) FROM commit_stats cs `+where, args...).Scan(&v)
+	return v, err
+}
+
+// EventsSeenCount returns the count of rows in gh_push_events matched by filter.
+func (s *SQLite) EventsSeenCount(ctx context.Context, filter EventFilter) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM gh_push_events `+eventWhere(filter)).Scan(&n)
+	return n, err
+}
+
+// EventCountsByType returns the count of rows matched by filter in each event table keyed by event type.
+func (s *SQLite) EventCountsByType(ctx context.Context, filter EventFilter) (map[string]int64, error) {
+	parts := make([]string, 0, len(eventTables))
+	for typ, table := range eventTables {
+		parts = append(parts, fmt.Sprintf("SELECT '%s', COUNT(*) FROM %s %s", typ, table, eventWhere(filter)))
+	}
+	rows, err := s.db.QueryContext(ctx, strings.Join(parts, " UNION ALL "))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int64, len(eventTables))
+	for rows.Next() {
+		var typ string
+		var n int64
+		if err := rows.Scan(&typ, &n); err != nil {
+			return nil, err
+		}
+		counts[typ] = n
+	}
+	return counts, rows.Err()
+}
+
+// SavePollerState upserts the polling state of state.Source.
+func (s *SQLite) SavePollerState(ctx context.Context, state *PollerStateRow) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO poller_state (source, etag, last_event_id, last_poll_at, last_status, updated_at)
+		VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?)
+		ON CONFLICT (source) DO UPDATE SET
+			etag = excluded.etag,
+			last_event_id = COALESCE(excluded.last_event_id, poller_state.last_event_id),
+			last_poll_at = excluded.last_poll_at,
+			last_status = excluded.last_status,
+			updated_at = excluded.updated_at
+	`, state.Source, state.ETag, state.LastEventID, sqliteTime(state.LastPollAt), state.LastStatus, sqliteTime(time.Now()))
+	return err
+}
+
+// PollerStates returns the polling state of every source, ordered by source.
+func (s *SQLite) PollerStates(ctx context.Context) ([]*PollerStateRow, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT source, COALESCE(etag, ''), COALESCE(last_event_id, ''), COALESCE(last_poll_at, ''), COALESCE(last_status, '')
+		FROM poller_state
+		ORDER BY source
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*PollerStateRow
+	for rows.Next() {
+		var st PollerStateRow
+		var lastPoll string
+		if err := rows.Scan(&st.Source, &st.ETag, &st.LastEventID, &lastPoll, &st.LastStatus); err != nil {
+			return nil, err
+		}
+		if st.LastPollAt, err = parseSQLiteTime(lastPoll); err != nil {
+			return nil, err
+		}
+		out = append(out, &st)
+	}
+	return out, rows.Err()
+}
+
+// SpillJobs appends commit jobs to the overflow.
+func (s *SQLite) SpillJobs(ctx context.Context, jobs []*SpilledJobRow) error {
+	return s.execEach(ctx, `
+		INSERT INTO job_overflow (event_id, owner, repo, sha, spilled_at)
+		VALUES (NULLIF(?, ''), ?, ?, ?, ?)
+	`, len(jobs), func(i int) []any {
+		j := jobs[i]
+		return []any{j.EventID, j.Owner, j.Repo, j.Sha, sqliteTime(j.SpilledAt)}
+	})
+}
+
+// SpilledJobs returns up to limit jobs of the overflow, oldest first, leaving them in it.
+func (s *SQLite) SpilledJobs(ctx context.Context, limit int) ([]*SpilledJobRow, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, COALESCE(event_id, ''), owner, repo, sha, spilled_at
+		FROM job_overflow
+		ORDER BY id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*SpilledJobRow
+	for rows.Next() {
+		var j SpilledJobRow
+		var spilledAt string
+		if err := rows.Scan(&j.ID, &j.EventID, &j.Owner, &j.Repo, &j.Sha, &spilledAt); err != nil {
+			return nil, err
+		}
+		if j.SpilledAt, err = parseSQLiteTime(spilledAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &j)
+	}
+	return out, rows.Err()
+}
+
+// DeleteSpilledJobs removes the jobs with the given ids from the overflow.
+func (s *SQLite) DeleteSpilledJobs(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM job_overflow WHERE id IN (`+sqliteParams(len(ids))+`)`, args...)
+	return err
+}
+
+// SpilledJobsCount returns the number of jobs in the overflow.
+func (s *SQLite) SpilledJobsCount(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM job_overflow`).Scan(&n)
+	return n, err
+}
+
+// ExportCommitStats streams the commit_stats rows matched by filter to fn, ordered by committed_at.
+// Rows are read a page at a time (keyset on committed_at and sha), releasing the connection between pages.
+func (s *SQLite) ExportCommitStats(ctx context.Context, filter ExportFilter, fn func(*CommitStatsRow) error) error {
+	where, args := sqliteExportWhere(filter, "committed_at", "author")
+	query := `
+		SELECT sha, repo, COALESCE(author, ''), COALESCE(committed_at, ''), additions, deletions, total, net,
+			adjusted_additions, adjusted_deletions, adjusted_net, parent_count, is_merge, is_bot,
+			capped_additions, capped_deletions, orphaned
+		FROM commit_stats ` + sqliteKeysetWhere(where, "committed_at", "sha") + `
+		ORDER BY COALESCE(committed_at, ''), sha
+		LIMIT ?`
+	var lastTime, lastSha string
+	for {
+		var page []*CommitStatsRow
+		err := s.queryPage(ctx, query, args, lastTime, lastSha, func(rows *sql.Rows) error {
+			r := new(CommitStatsRow)
+			var committedAt string
+			var cappedAdd, cappedDel sql.NullInt64
+			if err := rows.Scan(&r.Sha, &r.Repo, &r.Author, &committedAt, &r.Additions, &r.Deletions, &r.Total, &r.Net,
+				&r.AdjustedAdditions, &r.AdjustedDeletions, &r.AdjustedNet, &r.ParentCount, &r.IsMerge, &r.IsBot,
+				&cappedAdd, &cappedDel, &r.Orphaned); err != nil {
+				return err
+			}
+			if cappedAdd.Valid && cappedDel.Valid {
+				r.Capped, r.CappedAdditions, r.CappedDeletions = true, cappedAdd.Int64, cappedDel.Int64
+			}
+			var err error
+			if r.CommittedAt, err = parseSQLiteTime(committedAt); err != nil {
+				return err
+			}
+			lastTime, lastSha = committedAt, r.Sha
+			page = append(page, r)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, r := range page {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		if len(page) < s.exportPageSize() {
+			return nil
+		}
+	}
+}
+
+// ExportPushEvents streams the gh_push_events rows matched by filter to fn, ordered by created_at.
+// Rows are read a page at a time (keyset on created_at and id), releasing the connection between pages.
+func (s *SQLite) ExportPushEvents(ctx context.Context, filter ExportFilter, fn func(*PushEventRow) error) error {
+	where, args := sqliteExportWhere(filter, "created_at", "actor_login")
+	query := `
+		SELECT id, type, COALESCE(created_at, ''), COALESCE(actor_login, ''), repo, COALESCE(raw_payload, ''),
+			COALESCE(ref, ''), COALESCE(ref_type, ''), COALESCE(push_id, 0), COALESCE(size, 0),
+			COALESCE(distinct_size, 0), COALESCE(source, ''), is_bot
+		FROM gh_push_events ` + sqliteKeysetWhere(where, "created_at", "id") + `
+		ORDER BY COALESCE(created_at, ''), id
+		LIMIT ?`
+	var lastTime, lastID string
+	for {
+		var page []*PushEventRow
+		err := s.queryPage(ctx, query, args, lastTime, lastID, func(rows *sql.Rows) error {
+			r := new(PushEventRow)
+			var createdAt, payload string
+			if err := rows.Scan(&r.ID, &r.Type, &createdAt, &r.ActorLogin, &r.Repo, &payload,
+				&r.Ref, &r.RefType, &r.PushID, &r.Size, &r.DistinctSize, &r.Source, &r.IsBot); err != nil {
+				return err
+			}
+			var err error
+			if r.CreatedAt, err = parseSQLiteTime(createdAt); err != nil {
+				return err
+			}
+			if payload != "" {
+				r.RawPayload = json.RawMessage(payload)
+			}
+			lastTime, lastID = createdAt, r.ID
+			page = append(page, r)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, r := range page {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		if len(page) < s.exportPageSize() {
+			return nil
+		}
+	}
+}
+
+// queryPage runs an export page query with args, then the keyset (lastTime, lastKey) and the page size,
+// calling scan for each row. The rows are closed before it returns.
+func (s *SQLite) queryPage(ctx context.Context, query string, args []any, lastTime, lastKey string, scan func(*sql.Rows) error) error {
+	rows, err := s.db.QueryContext(ctx, query, append(args[:len(args):len(args)], lastTime, lastKey, s.exportPageSize())...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLite) exportPageSize() int {
+	if s.ExportPageSize <= 0 {
+		return DefaultExportPageSize
+	}
+	return s.ExportPageSize
+}
+
+// sqliteKeysetWhere adds to where (empty or a WHERE clause) the condition selecting the rows after the
+// keyset (timeColumn, keyColumn) given by the next two placeholders. A NULL timeColumn sorts first.
+func sqliteKeysetWhere(where, timeColumn, keyColumn string) string {
+	cond := "(COALESCE(" + timeColumn + ", ''), " + keyColumn + ") > (?, ?)"
+	if where == "" {
+		return "WHERE " + cond
+	}
+	return where + " AND " + cond
+}
+
+// sqliteExportWhere is exportWhere with ? placeholders.
+func sqliteExportWhere(filter ExportFilter, timeColumn, authorColumn string) (string, []any) {
+	var conds []string
+	var args []any
+	if !filter.From.IsZero() {
+		conds, args = append(conds, timeColumn+" >= ?"), append(args, sqliteTime(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conds, args = append(conds, timeColumn+" < ?"), append(args, sqliteTime(filter.To))
+	}
+	if filter.Repo != "" {
+		conds, args = append(conds, "repo = ?"), append(args, filter.Repo)
+	}
+	if filter.Author != "" {
+		conds, args = append(conds, authorColumn+" = ?"), append(args, filter.Author)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Ping checks the database connection.
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// statsWhere returns the WHERE clause (empty when unfiltered) and its arguments selecting the
+// commit_stats rows (aliased as alias) matched by filter.
+func (s *SQLite) statsWhere(filter StatsFilter, alias string) (string, []any) {
+	var conds []string
+	var args []any
+	if !filter.Since.IsZero() {
+		args = append(args, sqliteTime(filter.Since))
+		conds = append(conds, alias+".committed_at >= ?")
+	}
+	if filter.ExcludeMerges {
+		conds = append(conds, "NOT "+alias+".is_merge")
+	}
+	if filter.ExcludeOrphaned {
+		conds = append(conds, "NOT "+alias+".orphaned")
+	}
+	if filter.ExcludeBots {
+		conds = append(conds, "NOT "+alias+".is_bot")
+	}
+	if filter.Repo != "" {
+		args = append(args, filter.Repo)
+		conds = append(conds, alias+".repo = ?")
+	}
+	if filter.repoMeta() {
+		meta := []string{"rm.repo = " + alias + ".repo", "rm.found"}
+		switch filter.Forks {
+		case ForksOnly:
+			meta = append(meta, "rm.fork")
+		case ForksExclude:
+			meta = append(meta, "NOT rm.fork")
+		}
+		if filter.RepoLanguage != "" {
+			args = append(args, filter.RepoLanguage)
+			meta = append(meta, "lower(rm.language) = lower(?)")
+		}
+		if filter.MinStars > 0 {
+			args = append(args, filter.MinStars)
+			meta = append(meta, "rm.stars >= ?")
+		}
+		conds = append(conds, "EXISTS (SELECT 1 FROM repositories rm WHERE "+strings.Join(meta, " AND ")+")")
+	}
+	if filter.Branch != "" {
+		refs := branchRefs(filter.Branch, s.DefaultBranches)
+		in := "FALSE"
+		if len(refs) > 0 {
+			for _, ref := range refs {
+				args = append(args, ref)
+			}
+			in = "r.ref IN (" + sqliteParams(len(refs)) + ")"
+		}
+		if filter.Branch == BranchDefault {
+			branch := defaultBranchSQL("r.repo")
+			in = "(r.ref = 'refs/heads/' || " + branch + " OR " + branch + " IS NULL AND " + in + ")"
+		}
+		conds = append(conds, "EXISTS (SELECT 1 FROM commit_refs r WHERE r.sha = "+alias+".sha AND "+in+")")
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// sqliteParams returns n comma-separated "?" placeholders.
+func sqliteParams(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// sqliteTime returns t as stored in SQLite, or nil for the zero time.
+func sqliteTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// parseSQLiteTime parses a stored timestamp; empty means the zero time.
+func parseSQLiteTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(sqliteTimeFormat, v, time.UTC)
+}
@@ -0,0 +1,255 @@
+-- SQLite schema for store.SQLite, equivalent to the PostgreSQL migrations in config/sql.
+-- Timestamps are TEXT in sqliteTimeFormat (UTC, fixed width) so they compare lexically; booleans are 0/1.
+CREATE TABLE IF NOT EXISTS gh_push_events (
+    id            TEXT PRIMARY KEY,
+    type          TEXT NOT NULL,
+    created_at    TEXT,
+    actor_login   TEXT,
+    repo          TEXT NOT NULL,
+    raw_payload   TEXT,
+    ref           TEXT,
+    ref_type      TEXT,
+    push_id       INTEGER,
+    size          INTEGER,
+    distinct_size INTEGER,
+    source        TEXT,
+    is_bot        INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS commit_stats (
+    sha                TEXT PRIMARY KEY,
+    repo               TEXT NOT NULL,
+    author             TEXT,
+    committed_at       TEXT,
+    additions          INTEGER NOT NULL DEFAULT 0,
+    deletions          INTEGER NOT NULL DEFAULT 0,
+    total              INTEGER NOT NULL DEFAULT 0,
+    net                INTEGER NOT NULL DEFAULT 0,
+    adjusted_additions INTEGER NOT NULL DEFAULT 0,
+    adjusted_deletions INTEGER NOT NULL DEFAULT 0,
+    adjusted_net       INTEGER NOT NULL DEFAULT 0,
+    parent_count       INTEGER NOT NULL DEFAULT 0,
+    is_merge           INTEGER NOT NULL DEFAULT 0,
+    orphaned           INTEGER NOT NULL DEFAULT 0,
+    is_bot             INTEGER NOT NULL DEFAULT 0,
+    capped_additions   INTEGER,
+    capped_deletions   INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_commit_stats_committed_at ON commit_stats (committed_at);
+
+CREATE TABLE IF NOT EXISTS commit_files (
+    sha               TEXT NOT NULL,
+    filename          TEXT NOT NULL,
+    previous_filename TEXT,
+    status            TEXT,
+    additions         INTEGER NOT NULL DEFAULT 0,
+    deletions         INTEGER NOT NULL DEFAULT 0,
+    changes           INTEGER NOT NULL DEFAULT 0,
+    excluded          INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (sha, filename)
+);
+
+CREATE TABLE IF NOT EXISTS commit_languages (
+    sha                TEXT NOT NULL,
+    language           TEXT NOT NULL,
+    files              INTEGER NOT NULL DEFAULT 0,
+    additions          INTEGER NOT NULL DEFAULT 0,
+    deletions          INTEGER NOT NULL DEFAULT 0,
+    adjusted_additions INTEGER NOT NULL DEFAULT 0,
+    adjusted_deletions INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (sha, language)
+);
+
+CREATE TABLE IF NOT EXISTS force_pushes (
+    event_id     TEXT PRIMARY KEY,
+    repo         TEXT NOT NULL,
+    before_sha   TEXT NOT NULL,
+    head_sha     TEXT NOT NULL,
+    detected_via TEXT NOT NULL,
+    status       TEXT,
+    orphaned     INTEGER NOT NULL DEFAULT 0,
+    detected_at  TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS orphaned_commits (
+    sha       TEXT PRIMARY KEY,
+    marked_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS anomalies (
+    sha          TEXT PRIMARY KEY,
+    repo         TEXT NOT NULL,
+    author       TEXT,
+    committed_at TEXT,
+    detected_at  TEXT NOT NULL,
+    additions    INTEGER NOT NULL DEFAULT 0,
+    deletions    INTEGER NOT NULL DEFAULT 0,
+    method       TEXT NOT NULL,
+    baseline     TEXT NOT NULL,
+    samples      INTEGER NOT NULL DEFAULT 0,
+    score        REAL NOT NULL,
+    limit_lines  INTEGER NOT NULL,
+    capped       INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_anomalies_committed_at ON anomalies (committed_at);
+
+CREATE TABLE IF NOT EXISTS trending_repos (
+    window_sec  INTEGER NOT NULL,
+    repo        TEXT NOT NULL,
+    rank        INTEGER NOT NULL,
+    score       REAL NOT NULL,
+    velocity    REAL NOT NULL,
+    pushes      INTEGER NOT NULL DEFAULT 0,
+    commits     INTEGER NOT NULL DEFAULT 0,
+    samples     TEXT,
+    computed_at TEXT NOT NULL,
+    PRIMARY KEY (window_sec, repo)
+);
+
+CREATE TABLE IF NOT EXISTS commit_repos (
+    sha           TEXT NOT NULL,
+    repo          TEXT NOT NULL,
+    first_seen_at TEXT NOT NULL,
+    PRIMARY KEY (sha, repo)
+);
+CREATE INDEX IF NOT EXISTS idx_commit_repos_repo ON commit_repos (repo);
+
+CREATE TABLE IF NOT EXISTS repositories (
+    repo           TEXT PRIMARY KEY,
+    found          BOOLEAN NOT NULL DEFAULT 1,
+    language       TEXT,
+    stars          INTEGER NOT NULL DEFAULT 0,
+    fork           BOOLEAN NOT NULL DEFAULT 0,
+    parent         TEXT,
+    default_branch TEXT,
+    archived       BOOLEAN NOT NULL DEFAULT 0,
+    license        TEXT,
+    fetched_at     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_repositories_fetched_at ON repositories (fetched_at);
+
+CREATE TABLE IF NOT EXISTS commit_refs (
+    sha      TEXT NOT NULL,
+    repo     TEXT NOT NULL,
+    ref      TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    PRIMARY KEY (sha, repo, ref)
+);
+
+CREATE INDEX IF NOT EXISTS idx_commit_refs_ref ON commit_refs (ref);
+
+CREATE TABLE IF NOT EXISTS gh_pull_request_events (
+    id            TEXT PRIMARY KEY,
+    created_at    TEXT,
+    actor_login   TEXT,
+    repo          TEXT NOT NULL,
+    raw_payload   TEXT,
+    source        TEXT,
+    is_bot        INTEGER NOT NULL DEFAULT 0,
+    action        TEXT,
+    number        INTEGER,
+    title         TEXT,
+    state         TEXT,
+    merged        INTEGER NOT NULL DEFAULT 0,
+    additions     INTEGER NOT NULL DEFAULT 0,
+    deletions     INTEGER NOT NULL DEFAULT 0,
+    changed_files INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS gh_create_events (
+    id            TEXT PRIMARY KEY,
+    created_at    TEXT,
+    actor_login   TEXT,
+    repo          TEXT NOT NULL,
+    raw_payload   TEXT,
+    source        TEXT,
+    is_bot        INTEGER NOT NULL DEFAULT 0,
+    ref           TEXT,
+    ref_type      TEXT,
+    master_branch TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_gh_create_events_repo ON gh_create_events (repo, created_at);
+
+CREATE TABLE IF NOT EXISTS gh_delete_events (
+    id          TEXT PRIMARY KEY,
+    created_at  TEXT,
+    actor_login TEXT,
+    repo        TEXT NOT NULL,
+    raw_payload TEXT,
+    source      TEXT,
+    is_bot      INTEGER NOT NULL DEFAULT 0,
+    ref         TEXT,
+    ref_type    TEXT
+);
+
+CREATE TABLE IF NOT EXISTS gh_release_events (
+    id          TEXT PRIMARY KEY,
+    created_at  TEXT,
+    actor_login TEXT,
+    repo        TEXT NOT NULL,
+    raw_payload TEXT,
+    source      TEXT,
+    is_bot      INTEGER NOT NULL DEFAULT 0,
+    action      TEXT,
+    tag_name    TEXT,
+    name        TEXT,
+    draft       INTEGER NOT NULL DEFAULT 0,
+    prerelease  INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS gh_watch_events (
+    id          TEXT PRIMARY KEY,
+    created_at  TEXT,
+    actor_login TEXT,
+    repo        TEXT NOT NULL,
+    raw_payload TEXT,
+    source      TEXT,
+    is_bot      INTEGER NOT NULL DEFAULT 0,
+    action      TEXT
+);
+
+CREATE TABLE IF NOT EXISTS poller_state (
+    source        TEXT PRIMARY KEY,
+    etag          TEXT,
+    last_event_id TEXT,
+    last_poll_at  TEXT,
+    last_status   TEXT,
+    updated_at    TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS authors (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT NOT NULL,
+    email      TEXT,
+    login      TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS author_aliases (
+    key       TEXT PRIMARY KEY,
+    author_id INTEGER NOT NULL REFERENCES authors (id)
+);
+
+CREATE TABLE IF NOT EXISTS commit_identities (
+    sha       TEXT NOT NULL,
+    role      TEXT NOT NULL,
+    name      TEXT,
+    email     TEXT,
+    login     TEXT,
+    author_id INTEGER NOT NULL REFERENCES authors (id),
+    PRIMARY KEY (sha, role)
+);
+
+CREATE INDEX IF NOT EXISTS idx_commit_identities_author_id ON commit_identities (author_id);
+
+CREATE TABLE IF NOT EXISTS job_overflow (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id   TEXT,
+    owner      TEXT NOT NULL,
+    repo       TEXT NOT NULL,
+    sha        TEXT NOT NULL,
+    spilled_at TEXT NOT NULL
+);
@@ -0,0 +1,112 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+	"github.com/challenge-github-events/internal/store/storetest"
+)
+
+func TestSQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		st, err := store.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "events.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { st.Close() })
+		return st
+	})
+}
+
+func TestSQLite_UpgradesOldSchema(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.db")
+	// commit_stats as created before the is_bot column, with a row in it.
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE commit_stats (
+			sha TEXT PRIMARY KEY, repo TEXT NOT NULL, author TEXT, committed_at TEXT,
+			additions INTEGER NOT NULL DEFAULT 0, deletions INTEGER NOT NULL DEFAULT 0,
+			total INTEGER NOT NULL DEFAULT 0, net INTEGER NOT NULL DEFAULT 0,
+			adjusted_additions INTEGER NOT NULL DEFAULT 0, adjusted_deletions INTEGER NOT NULL DEFAULT 0,
+			adjusted_net INTEGER NOT NULL DEFAULT 0, parent_count INTEGER NOT NULL DEFAULT 0,
+			is_merge INTEGER NOT NULL DEFAULT 0, orphaned INTEGER NOT NULL DEFAULT 0
+		);
+		INSERT INTO commit_stats (sha, repo, committed_at, additions, net) VALUES ('old', 'o/r', '2025-03-01T12:00:00Z', 7, 7);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := store.OpenSQLite(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	bot := &store.CommitStatsRow{Sha: "bot", Repo: "o/r", CommittedAt: time.Now(), Additions: 5, Net: 5, IsBot: true}
+	if _, err := st.InsertCommitStats(ctx, bot); err != nil {
+		t.Fatal(err)
+	}
+	if net, err := st.GlobalNetLines(ctx, store.StatsFilter{ExcludeBots: true}); err != nil || net != 7 {
+		t.Errorf("GlobalNetLines without bots want 7 got %d (%v)", net, err)
+	}
+}
+
+func TestSQLite_ExportReleasesConnectionBetweenPages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	st, err := store.OpenSQLite(ctx, filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	st.ExportPageSize = 2
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		// Two commits share a timestamp so a page boundary falls between them.
+		row := &store.CommitStatsRow{Sha: fmt.Sprintf("c%d", i), Repo: "o/r", CommittedAt: base.Add(time.Duration(i/2) * time.Minute)}
+		if _, err := st.InsertCommitStats(ctx, row); err != nil {
+			t.Fatal(err)
+		}
+		event := &store.PushEventRow{ID: fmt.Sprintf("e%d", i), Type: "PushEvent", CreatedAt: row.CommittedAt, Repo: "o/r"}
+		if _, err := st.InsertPushEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Writing from the callback needs the only connection, which a cursor held across pages would block.
+	var shas []string
+	err = st.ExportCommitStats(ctx, store.ExportFilter{}, func(r *store.CommitStatsRow) error {
+		shas = append(shas, r.Sha)
+		_, err := st.InsertCommitStats(ctx, &store.CommitStatsRow{Sha: "late-" + r.Sha, Repo: "o/r", CommittedAt: base.Add(-time.Hour)})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(shas) != "[c0 c1 c2 c3 c4]" {
+		t.Errorf("commit export want [c0 c1 c2 c3 c4] got %v", shas)
+	}
+
+	var ids []string
+	err = st.ExportPushEvents(ctx, store.ExportFilter{}, func(r *store.PushEventRow) error {
+		ids = append(ids, r.ID)
+		_, err := st.InsertPushEvent(ctx, &store.PushEventRow{ID: "late-" + r.ID, Type: "PushEvent", CreatedAt: base.Add(-time.Hour), Repo: "o/r"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[e0 e1 e2 e3 e4]" {
+		t.Errorf("push export want [e0 e1 e2 e3 e4] got %v", ids)
+	}
+}
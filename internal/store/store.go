@@ -1,10 +1,11 @@
 package store
 
-//go:generate go run go.uber.org/mock/mockgen -destination store_mock.gen.go -package store . Store
+//go:generate go run go.uber.org/mock/mockgen -destination store_mock.gen.go -package store . Store,Retainer
 
 import (
 	"context"
 	"encoding/json"
+	"slices"
 	"time"
 )
 
@@ -12,12 +13,107 @@ import (
 // Only main and this package use *sql.DB.
 type Store interface {
 	InsertPushEvent(ctx context.Context, event *PushEventRow) (inserted bool, err error)
+	InsertPullRequestEvent(ctx context.Context, event *PullRequestEventRow) (inserted bool, err error)
+	InsertCreateEvent(ctx context.Context, event *CreateEventRow) (inserted bool, err error)
+	InsertDeleteEvent(ctx context.Context, event *DeleteEventRow) (inserted bool, err error)
+	InsertReleaseEvent(ctx context.Context, event *ReleaseEventRow) (inserted bool, err error)
+	InsertWatchEvent(ctx context.Context, event *WatchEventRow) (inserted bool, err error)
 	InsertCommitStats(ctx context.Context, stats *CommitStatsRow) (inserted bool, err error)
-	GlobalNetLines(ctx context.Context) (int64, error)
-	EventsSeenCount(ctx context.Context) (int64, error)
+	// InsertCommitStatsBatch inserts rows in one statement; inserted[i] reports whether rows[i] was new.
+	InsertCommitStatsBatch(ctx context.Context, rows []*CommitStatsRow) (inserted []bool, err error)
+	// InsertCommits inserts the stats rows of commits like InsertCommitStatsBatch and, in the same transaction,
+	// the files, languages and identities (see SaveCommitIdentities) of the new ones: on error nothing is stored.
+	InsertCommits(ctx context.Context, commits []*CommitRow) (inserted []bool, err error)
+	InsertCommitFiles(ctx context.Context, files []*CommitFileRow) error
+	CommitFiles(ctx context.Context, sha string) ([]*CommitFileRow, error)
+	InsertCommitLanguages(ctx context.Context, langs []*CommitLanguageRow) error
+	LanguageStats(ctx context.Context, filter StatsFilter) ([]*LanguageStatsRow, error)
+	// SaveCommitIdentities links each identity to a canonical author and stores it; identities without Keys
+	// are skipped. The author is the one linked to the first of Keys already known, or a new author from
+	// Canonical; the other keys are linked to it too, so identities sharing any key merge. Other authors
+	// linked to any of Keys are merged into it: their aliases and identities move to it. Sets AuthorID.
+	SaveCommitIdentities(ctx context.Context, rows []*CommitIdentityRow) error
+	// AuthorStats returns the line stats of the commits matched by filter per canonical author
+	// (commit authors, not committers), by net lines descending. limit <= 0 returns all authors.
+	AuthorStats(ctx context.Context, filter StatsFilter, limit int) ([]*AuthorStatsRow, error)
+	InsertCommitRefs(ctx context.Context, refs []*CommitRefRow) error
+	// InsertCommitRepos records the repos commits were seen in. Existing links keep their first-seen time.
+	InsertCommitRepos(ctx context.Context, links []*CommitRepoRow) error
+	// CanonicalizeCommits attributes each of the given commits seen in several repos to its canonical repo
+	// (see CanonicalizeRepos). Returns the number of commits re-attributed.
+	CanonicalizeCommits(ctx context.Context, shas []string) (int64, error)
+	// CanonicalizeRepos attributes the commits seen both in one of repos and in another repo to their canonical
+	// repo, preferring upstreams: a commit of a fork (or of a repo GitHub did not find) moves to the first seen
+	// repo known not to be a fork, or else to the fork's parent when seen there. Commits of repos without
+	// metadata stay where they are. Returns the number of commits re-attributed.
+	CanonicalizeRepos(ctx context.Context, repos []string) (int64, error)
+	// RepoStats returns the line stats of the commits matched by filter per repo, by net lines descending.
+	// A commit seen in several repos counts in its canonical repo only, or in each of them with everyRepo.
+	// limit <= 0 returns all repos.
+	RepoStats(ctx context.Context, filter StatsFilter, everyRepo bool, limit int) ([]*RepoStatsRow, error)
+	InsertForcePush(ctx context.Context, fp *ForcePushRow) (inserted bool, err error)
+	// InsertAnomaly records an outlier commit. Returns (false, nil) if the commit is already recorded.
+	InsertAnomaly(ctx context.Context, a *AnomalyRow) (inserted bool, err error)
+	// Anomalies returns the outlier commits matched by filter, most recently committed first.
+	Anomalies(ctx context.Context, filter AnomalyFilter) ([]*AnomalyRow, error)
+	// RepoActivity returns the pushes and commits per repo and time bucket of width bucket (buckets start at
+	// multiples of bucket since the Unix epoch). Commits are those matched by filter; pushes are the events
+	// created at or after filter.Since, of filter.Repo when set, leaving out bots with filter.ExcludeBots.
+	RepoActivity(ctx context.Context, filter StatsFilter, bucket time.Duration) ([]*RepoActivityRow, error)
+	// RecentCommits returns up to limit commits matched by filter, most recently committed first.
+	RecentCommits(ctx context.Context, filter StatsFilter, limit int) ([]*CommitStatsRow, error)
+	// SaveTrending replaces the trending snapshot of window with rows.
+	SaveTrending(ctx context.Context, window time.Duration, rows []*TrendingRow) error
+	// Trending returns up to limit rows of the trending snapshot of window by rank (all when limit <= 0).
+	Trending(ctx context.Context, window time.Duration, limit int) ([]*TrendingRow, error)
+	// SaveRepository upserts the metadata of a repo.
+	SaveRepository(ctx context.Context, repo *RepositoryRow) error
+	// StaleRepositories returns up to limit repos commits were seen in (see InsertCommitRepos) whose metadata is
+	// missing or was fetched before fetchedBefore: missing ones first, then the least recently fetched.
+	StaleRepositories(ctx context.Context, fetchedBefore time.Time, limit int) ([]string, error)
+	// MarkCommitsOrphaned flags the given commits as discarded by a force push. Commits not stored yet are
+	// flagged when inserted. Returns the number of stored rows newly marked.
+	MarkCommitsOrphaned(ctx context.Context, shas []string) (int64, error)
+	// MarkBot flags as bots the stored events whose actor is login and the commits whose author's GitHub login
+	// is login (case-insensitive), e.g. once its burst rate gave it away. Rolled-up rows keep their flag.
+	// Returns the number of rows newly flagged.
+	MarkBot(ctx context.Context, login string) (int64, error)
+	GlobalNetLines(ctx context.Context, filter StatsFilter) (int64, error)
+	EventsSeenCount(ctx context.Context, filter EventFilter) (int64, error)
+	// EventCountsByType returns the number of stored events matched by filter per GitHub event type.
+	EventCountsByType(ctx context.Context, filter EventFilter) (map[string]int64, error)
+	// SavePollerState upserts the polling state of one event source.
+	SavePollerState(ctx context.Context, state *PollerStateRow) error
+	PollerStates(ctx context.Context) ([]*PollerStateRow, error)
+	// SpillJobs appends commit jobs that did not fit in the jobs queue to the overflow.
+	SpillJobs(ctx context.Context, jobs []*SpilledJobRow) error
+	// SpilledJobs returns up to limit jobs of the overflow, oldest first, leaving them in it.
+	SpilledJobs(ctx context.Context, limit int) ([]*SpilledJobRow, error)
+	// DeleteSpilledJobs removes the jobs with the given ids from the overflow, e.g. once they were replayed.
+	DeleteSpilledJobs(ctx context.Context, ids []int64) error
+	// SpilledJobsCount returns the number of jobs in the overflow.
+	SpilledJobsCount(ctx context.Context) (int64, error)
+	// ExportCommitStats streams the commit_stats rows matched by filter to fn, ordered by committed_at.
+	ExportCommitStats(ctx context.Context, filter ExportFilter, fn func(*CommitStatsRow) error) error
+	// ExportPushEvents streams the gh_push_events rows matched by filter to fn, ordered by created_at.
+	ExportPushEvents(ctx context.Context, filter ExportFilter, fn func(*PushEventRow) error) error
 	Ping(ctx context.Context) error
 }
 
+// Retainer is implemented by stores with time-partitioned tables (Postgres): gh_push_events and
+// commit_stats are partitioned by month, and expired partitions are rolled up before they are removed
+// so counters and aggregates do not change.
+type Retainer interface {
+	// EnsurePartitions creates the monthly partitions covering [from, to), moving matching rows out of the default partitions.
+	EnsurePartitions(ctx context.Context, from, to time.Time) error
+	// ExpireBefore rolls up and removes data older than cutoff: whole partitions ending at or before cutoff are
+	// dropped (or detached when archive is set, leaving them as standalone tables) and older rows in the default
+	// partitions are deleted (or moved to <table>_archive). Returns the names of the removed partitions.
+	ExpireBefore(ctx context.Context, cutoff time.Time, archive bool) ([]string, error)
+	// StripRawPayloads clears raw_payload of events created before cutoff. Returns the number of events stripped.
+	StripRawPayloads(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
 // PushEventRow is the row shape for gh_push_events.
 type PushEventRow struct {
 	ID         string
@@ -26,6 +122,16 @@ type PushEventRow struct {
 	ActorLogin string
 	Repo       string
 	RawPayload json.RawMessage
+	// Push details; Ref is e.g. refs/heads/main and RefType is branch, tag or empty.
+	Ref          string
+	RefType      string
+	PushID       int64
+	Size         int
+	DistinctSize int
+	// Source is the events stream the event was polled from (e.g. global, org:golang).
+	Source string
+	// IsBot flags events whose actor is a bot or automation account (see internal/botclass).
+	IsBot bool
 }
 
 // CommitStatsRow is the row shape for commit_stats.
@@ -38,4 +144,399 @@ type CommitStatsRow struct {
 	Deletions   int64
 	Total       int64
 	Net         int64
+	// Adjusted* exclude lines of generated, vendored and lockfiles.
+	AdjustedAdditions int64
+	AdjustedDeletions int64
+	AdjustedNet       int64
+	ParentCount       int
+	IsMerge           bool
+	// IsBot flags commits authored by a bot or automation account.
+	IsBot bool
+	// Capped flags outliers capped by ANOMALY_CAP: aggregates of raw lines count CappedAdditions and
+	// CappedDeletions instead of Additions and Deletions (adjusted lines are capped in place).
+	Capped          bool
+	CappedAdditions int64
+	CappedDeletions int64
+	// Orphaned flags commits discarded by a force push. Only ExportCommitStats reads it: inserts take it from
+	// the commits recorded by MarkCommitsOrphaned.
+	Orphaned bool
+}
+
+// cappedLines returns the capped_additions and capped_deletions values of r: NULL unless r is capped.
+func (r *CommitStatsRow) cappedLines() (additions, deletions any) {
+	if !r.Capped {
+		return nil, nil
+	}
+	return r.CappedAdditions, r.CappedDeletions
+}
+
+// CommitRow is a commit_stats row with the commit_files, commit_languages and commit_identities rows of the
+// commit, inserted together by InsertCommits.
+type CommitRow struct {
+	Stats      *CommitStatsRow
+	Files      []*CommitFileRow
+	Languages  []*CommitLanguageRow
+	Identities []*CommitIdentityRow
+}
+
+// StatsFilter selects which commits and line counts aggregate queries use.
+// The zero value counts raw lines of every commit.
+type StatsFilter struct {
+	// Adjusted counts adjusted lines (excluding generated, vendored and lockfiles) instead of raw lines.
+	Adjusted bool
+	// Since keeps only commits committed at or after this time; zero means all time.
+	Since time.Time
+	// ExcludeMerges leaves out merge commits (MERGE_POLICY=skip).
+	ExcludeMerges bool
+	// ExcludeOrphaned leaves out commits discarded by a force push.
+	ExcludeOrphaned bool
+	// Branch keeps only commits pushed to this branch. "default" means the default branch of the repo each
+	// ref was pushed to: repositories.default_branch, else the master_branch of its latest CreateEvent, else
+	// (when neither is known) any of the store's DefaultBranches.
+	Branch string
+	// ExcludeBots leaves out commits authored by bots.
+	ExcludeBots bool
+	// Repo keeps only commits of this owner/repo.
+	Repo string
+	// Forks keeps only commits of forks (ForksOnly) or of repos that are not forks (ForksExclude); empty keeps both.
+	// Like RepoLanguage and MinStars it uses the repositories table, so when any of them is set commits of repos
+	// without metadata (not enriched yet, or not found on GitHub) are left out.
+	Forks string
+	// RepoLanguage keeps only commits of repos whose primary language is this (case-insensitive).
+	RepoLanguage string
+	// MinStars keeps only commits of repos with at least this many stars.
+	MinStars int
+}
+
+// StatsFilter.Forks values.
+const (
+	ForksExclude = "exclude"
+	ForksOnly    = "only"
+)
+
+// repoMeta reports whether f filters commits by repository metadata.
+func (f StatsFilter) repoMeta() bool {
+	return f.Forks != "" || f.RepoLanguage != "" || f.MinStars > 0
+}
+
+// EventFilter selects which events the event counters count. The zero value counts every event.
+type EventFilter struct {
+	// ExcludeBots leaves out events whose actor is a bot.
+	ExcludeBots bool
+}
+
+// ExportFilter selects the rows streamed by the Export* methods. Zero fields match every row.
+type ExportFilter struct {
+	// From and To bound committed_at (commits) or created_at (events): From inclusive, To exclusive.
+	From time.Time
+	To   time.Time
+	// Repo is an owner/repo name.
+	Repo string
+	// Author is the commit author, or the actor login of push events.
+	Author string
+}
+
+// BranchDefault is the StatsFilter.Branch value selecting default-branch commits.
+const BranchDefault = "default"
+
+// branchRefs returns the refs selected by StatsFilter.Branch; BranchDefault expands to defaults, the
+// fallback for repos whose default branch is unknown.
+func branchRefs(branch string, defaults []string) []string {
+	if branch != BranchDefault {
+		return []string{"refs/heads/" + branch}
+	}
+	refs := make([]string, 0, len(defaults))
+	for _, b := range defaults {
+		refs = append(refs, "refs/heads/"+b)
+	}
+	return refs
+}
+
+// defaultBranchSQL returns the SQL expression for the default branch of the repo in column repo: its
+// repositories.default_branch, else the master_branch of its latest CreateEvent, else NULL.
+func defaultBranchSQL(repo string) string {
+	return `COALESCE(
+		(SELECT NULLIF(rm.default_branch, '') FROM repositories rm WHERE rm.repo = ` + repo + `),
+		(SELECT ce.master_branch FROM gh_create_events ce WHERE ce.repo = ` + repo + ` AND ce.master_branch <> ''
+			ORDER BY ce.created_at DESC LIMIT 1))`
+}
+
+// otherAuthors returns the distinct ids of known other than id, in order.
+func otherAuthors(id int64, known []int64) []int64 {
+	var others []int64
+	for _, k := range known {
+		if k != id && !slices.Contains(others, k) {
+			others = append(others, k)
+		}
+	}
+	return others
+}
+
+// CommitFileRow is the row shape for commit_files.
+type CommitFileRow struct {
+	Sha              string
+	Filename         string
+	PreviousFilename string
+	Status           string
+	Additions        int64
+	Deletions        int64
+	Changes          int64
+	Excluded         bool
+}
+
+// CommitLanguageRow is the row shape for commit_languages.
+type CommitLanguageRow struct {
+	Sha               string
+	Language          string
+	Files             int
+	Additions         int64
+	Deletions         int64
+	AdjustedAdditions int64
+	AdjustedDeletions int64
+}
+
+// LanguageStatsRow is the aggregated line stats of one language.
+type LanguageStatsRow struct {
+	Language  string
+	Commits   int64
+	Additions int64
+	Deletions int64
+	Net       int64
+}
+
+// Commit identity roles (commit_identities.role).
+const (
+	RoleAuthor    = "author"
+	RoleCommitter = "committer"
+)
+
+// AuthorRow is a canonical author (authors).
+type AuthorRow struct {
+	ID    int64
+	Name  string
+	Email string
+	Login string
+}
+
+// CommitIdentityRow is the author or committer of a commit as recorded by git and GitHub (commit_identities).
+type CommitIdentityRow struct {
+	Sha   string
+	Role  string
+	Name  string
+	Email string
+	Login string
+	// Canonical is the identity after normalization and mailmap overrides, used for new authors.
+	// Keys are its merge keys, strongest first (see identity.Identity.Keys).
+	Canonical AuthorRow
+	Keys      []string
+	AuthorID  int64
+}
+
+// AuthorStatsRow is the aggregated line stats of one canonical author.
+type AuthorStatsRow struct {
+	AuthorID  int64
+	Name      string
+	Email     string
+	Login     string
+	Commits   int64
+	Additions int64
+	Deletions int64
+	Net       int64
+}
+
+// RepoStatsRow is the line stats of the commits of one repo. Shared counts those also seen in another repo.
+type RepoStatsRow struct {
+	Repo      string
+	Commits   int64
+	Shared    int64
+	Additions int64
+	Deletions int64
+	Net       int64
+}
+
+// ForcePushRow is the row shape for force_pushes.
+// DetectedVia is "flag" (payload forced flag) or "compare" (compare status diverged/behind).
+type ForcePushRow struct {
+	EventID     string
+	Repo        string
+	Before      string
+	Head        string
+	DetectedVia string
+	Status      string
+	Orphaned    int
+	DetectedAt  time.Time
+}
+
+// AnomalyRow is the row shape for anomalies: a commit whose size (additions + deletions) is an outlier
+// against a rolling baseline of recent commits (see internal/anomaly).
+type AnomalyRow struct {
+	Sha         string
+	Repo        string
+	Author      string
+	CommittedAt time.Time
+	DetectedAt  time.Time
+	Additions   int64
+	Deletions   int64
+	// Method is zscore or percentile; Baseline is repo or global, with Samples commits.
+	Method   string
+	Baseline string
+	Samples  int
+	// Score is the z-score of the commit size against the baseline (log scale).
+	Score float64
+	// Limit is the size above which commits are outliers. Capped commits count at most Limit adjusted lines.
+	Limit  int64
+	Capped bool
+}
+
+// AnomalyFilter selects the rows returned by Anomalies. Zero fields match every row.
+type AnomalyFilter struct {
+	// Since keeps only commits committed at or after this time.
+	Since time.Time
+	// Repo is an owner/repo name.
+	Repo string
+	// Limit is the maximum number of rows returned; <= 0 returns all.
+	Limit int
+}
+
+// RepoActivityRow counts the pushes and commits of a repo within one time bucket.
+type RepoActivityRow struct {
+	Repo    string
+	Bucket  time.Time // bucket start
+	Pushes  int64
+	Commits int64
+}
+
+// TrendingRow is the row shape for trending_repos: one repo of the trending snapshot of a window.
+type TrendingRow struct {
+	Window     time.Duration
+	Repo       string
+	Rank       int     // 1 is the top trending repo
+	Score      float64 // decayed activity of the window minus that of the window before (see internal/trending)
+	Velocity   float64 // pushes and commits per hour over the window
+	Pushes     int64
+	Commits    int64
+	Samples    []TrendingSample
+	ComputedAt time.Time
+}
+
+// TrendingSample is a recent commit of a trending repo, stored as JSON with its TrendingRow.
+type TrendingSample struct {
+	Sha         string    `json:"sha"`
+	Author      string    `json:"author,omitempty"`
+	CommittedAt time.Time `json:"committed_at"`
+	Additions   int64     `json:"additions"`
+	Deletions   int64     `json:"deletions"`
+}
+
+// RepositoryRow is the row shape for repositories: the GitHub metadata of a repo, refreshed after a TTL
+// (see internal/repometa). Found is false when GitHub answered 404 (deleted, private or renamed repo);
+// the other fields are then empty. Parent is the owner/repo a fork was forked from.
+type RepositoryRow struct {
+	Repo          string
+	Found         bool
+	Language      string
+	Stars         int
+	Fork          bool
+	Parent        string
+	DefaultBranch string
+	Archived      bool
+	License       string // SPDX id
+	FetchedAt     time.Time
+}
+
+// PollerStateRow is the row shape for poller_state: the last poll of one event source.
+// LastStatus is "ok", "not_modified" or "error: <message>".
+type PollerStateRow struct {
+	Source      string
+	ETag        string
+	LastEventID string
+	LastPollAt  time.Time
+	LastStatus  string
+}
+
+// SpilledJobRow is the row shape for job_overflow: a commit job that did not fit in the jobs queue
+// (BACKPRESSURE=spill), replayed once there is room again. ID is assigned by SpillJobs.
+type SpilledJobRow struct {
+	ID        int64
+	EventID   string
+	Owner     string
+	Repo      string
+	Sha       string
+	SpilledAt time.Time
+}
+
+// CommitRefRow is the row shape for commit_refs: a commit pushed to a ref by a push event.
+type CommitRefRow struct {
+	Sha     string
+	Repo    string
+	Ref     string
+	EventID string
+}
+
+// CommitRepoRow is the row shape for commit_repos: a repo a commit was seen in (e.g. a fork and its upstream).
+// commit_stats.repo is the canonical one of them.
+type CommitRepoRow struct {
+	Sha         string
+	Repo        string
+	FirstSeenAt time.Time
+}
+
+// EventRow holds the columns shared by the non-push event tables.
+type EventRow struct {
+	ID         string
+	CreatedAt  time.Time
+	ActorLogin string
+	Repo       string
+	RawPayload json.RawMessage
+	Source     string // events stream the event was polled from
+	IsBot      bool   // actor is a bot or automation account
+}
+
+// base returns the shared columns of an event row; the event row types embed EventRow.
+func (e *EventRow) base() *EventRow {
+	return e
+}
+
+// PullRequestEventRow is the row shape for gh_pull_request_events.
+type PullRequestEventRow struct {
+	EventRow
+	Action       string
+	Number       int
+	Title        string
+	State        string
+	Merged       bool
+	Additions    int64
+	Deletions    int64
+	ChangedFiles int
+}
+
+// CreateEventRow is the row shape for gh_create_events.
+type CreateEventRow struct {
+	EventRow
+	Ref          string
+	RefType      string
+	MasterBranch string
+}
+
+// DeleteEventRow is the row shape for gh_delete_events.
+type DeleteEventRow struct {
+	EventRow
+	Ref     string
+	RefType string
+}
+
+// ReleaseEventRow is the row shape for gh_release_events.
+type ReleaseEventRow struct {
+	EventRow
+	Action     string
+	TagName    string
+	Name       string
+	Draft      bool
+	Prerelease bool
+}
+
+// WatchEventRow is the row shape for gh_watch_events.
+type WatchEventRow struct {
+	EventRow
+	Action string
 }
@@ -1,9 +1,9 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/challenge-github-events/internal/store (interfaces: Store)
+// Source: github.com/challenge-github-events/internal/store (interfaces: Store,Retainer)
 //
 // Generated by this command:
 //
-//	mockgen -destination store_mock.gen.go -package store . Store
+//	mockgen -destination store_mock.gen.go -package store . Store,Retainer
 //
 
 // Package store is a generated GoMock package.
@@ -12,6 +12,7 @@ package store
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -40,34 +41,237 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// Anomalies mocks base method.
+func (m *MockStore) Anomalies(ctx context.Context, filter AnomalyFilter) ([]*AnomalyRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Anomalies", ctx, filter)
+	ret0, _ := ret[0].([]*AnomalyRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Anomalies indicates an expected call of Anomalies.
+func (mr *MockStoreMockRecorder) Anomalies(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Anomalies", reflect.TypeOf((*MockStore)(nil).Anomalies), ctx, filter)
+}
+
+// AuthorStats mocks base method.
+func (m *MockStore) AuthorStats(ctx context.Context, filter StatsFilter, limit int) ([]*AuthorStatsRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuthorStats", ctx, filter, limit)
+	ret0, _ := ret[0].([]*AuthorStatsRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AuthorStats indicates an expected call of AuthorStats.
+func (mr *MockStoreMockRecorder) AuthorStats(ctx, filter, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthorStats", reflect.TypeOf((*MockStore)(nil).AuthorStats), ctx, filter, limit)
+}
+
+// CanonicalizeCommits mocks base method.
+func (m *MockStore) CanonicalizeCommits(ctx context.Context, shas []string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CanonicalizeCommits", ctx, shas)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CanonicalizeCommits indicates an expected call of CanonicalizeCommits.
+func (mr *MockStoreMockRecorder) CanonicalizeCommits(ctx, shas any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CanonicalizeCommits", reflect.TypeOf((*MockStore)(nil).CanonicalizeCommits), ctx, shas)
+}
+
+// CanonicalizeRepos mocks base method.
+func (m *MockStore) CanonicalizeRepos(ctx context.Context, repos []string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CanonicalizeRepos", ctx, repos)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CanonicalizeRepos indicates an expected call of CanonicalizeRepos.
+func (mr *MockStoreMockRecorder) CanonicalizeRepos(ctx, repos any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CanonicalizeRepos", reflect.TypeOf((*MockStore)(nil).CanonicalizeRepos), ctx, repos)
+}
+
+// CommitFiles mocks base method.
+func (m *MockStore) CommitFiles(ctx context.Context, sha string) ([]*CommitFileRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CommitFiles", ctx, sha)
+	ret0, _ := ret[0].([]*CommitFileRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CommitFiles indicates an expected call of CommitFiles.
+func (mr *MockStoreMockRecorder) CommitFiles(ctx, sha any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitFiles", reflect.TypeOf((*MockStore)(nil).CommitFiles), ctx, sha)
+}
+
+// DeleteSpilledJobs mocks base method.
+func (m *MockStore) DeleteSpilledJobs(ctx context.Context, ids []int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSpilledJobs", ctx, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSpilledJobs indicates an expected call of DeleteSpilledJobs.
+func (mr *MockStoreMockRecorder) DeleteSpilledJobs(ctx, ids any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSpilledJobs", reflect.TypeOf((*MockStore)(nil).DeleteSpilledJobs), ctx, ids)
+}
+
+// EventCountsByType mocks base method.
+func (m *MockStore) EventCountsByType(ctx context.Context, filter EventFilter) (map[string]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EventCountsByType", ctx, filter)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EventCountsByType indicates an expected call of EventCountsByType.
+func (mr *MockStoreMockRecorder) EventCountsByType(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EventCountsByType", reflect.TypeOf((*MockStore)(nil).EventCountsByType), ctx, filter)
+}
+
 // EventsSeenCount mocks base method.
-func (m *MockStore) EventsSeenCount(ctx context.Context) (int64, error) {
+func (m *MockStore) EventsSeenCount(ctx context.Context, filter EventFilter) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "EventsSeenCount", ctx)
+	ret := m.ctrl.Call(m, "EventsSeenCount", ctx, filter)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // EventsSeenCount indicates an expected call of EventsSeenCount.
-func (mr *MockStoreMockRecorder) EventsSeenCount(ctx any) *gomock.Call {
+func (mr *MockStoreMockRecorder) EventsSeenCount(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EventsSeenCount", reflect.TypeOf((*MockStore)(nil).EventsSeenCount), ctx, filter)
+}
+
+// ExportCommitStats mocks base method.
+func (m *MockStore) ExportCommitStats(ctx context.Context, filter ExportFilter, fn func(*CommitStatsRow) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportCommitStats", ctx, filter, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportCommitStats indicates an expected call of ExportCommitStats.
+func (mr *MockStoreMockRecorder) ExportCommitStats(ctx, filter, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportCommitStats", reflect.TypeOf((*MockStore)(nil).ExportCommitStats), ctx, filter, fn)
+}
+
+// ExportPushEvents mocks base method.
+func (m *MockStore) ExportPushEvents(ctx context.Context, filter ExportFilter, fn func(*PushEventRow) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportPushEvents", ctx, filter, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportPushEvents indicates an expected call of ExportPushEvents.
+func (mr *MockStoreMockRecorder) ExportPushEvents(ctx, filter, fn any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EventsSeenCount", reflect.TypeOf((*MockStore)(nil).EventsSeenCount), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportPushEvents", reflect.TypeOf((*MockStore)(nil).ExportPushEvents), ctx, filter, fn)
 }
 
 // GlobalNetLines mocks base method.
-func (m *MockStore) GlobalNetLines(ctx context.Context) (int64, error) {
+func (m *MockStore) GlobalNetLines(ctx context.Context, filter StatsFilter) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GlobalNetLines", ctx)
+	ret := m.ctrl.Call(m, "GlobalNetLines", ctx, filter)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GlobalNetLines indicates an expected call of GlobalNetLines.
-func (mr *MockStoreMockRecorder) GlobalNetLines(ctx any) *gomock.Call {
+func (mr *MockStoreMockRecorder) GlobalNetLines(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GlobalNetLines", reflect.TypeOf((*MockStore)(nil).GlobalNetLines), ctx, filter)
+}
+
+// InsertAnomaly mocks base method.
+func (m *MockStore) InsertAnomaly(ctx context.Context, a *AnomalyRow) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertAnomaly", ctx, a)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertAnomaly indicates an expected call of InsertAnomaly.
+func (mr *MockStoreMockRecorder) InsertAnomaly(ctx, a any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GlobalNetLines", reflect.TypeOf((*MockStore)(nil).GlobalNetLines), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertAnomaly", reflect.TypeOf((*MockStore)(nil).InsertAnomaly), ctx, a)
+}
+
+// InsertCommitFiles mocks base method.
+func (m *MockStore) InsertCommitFiles(ctx context.Context, files []*CommitFileRow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertCommitFiles", ctx, files)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertCommitFiles indicates an expected call of InsertCommitFiles.
+func (mr *MockStoreMockRecorder) InsertCommitFiles(ctx, files any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCommitFiles", reflect.TypeOf((*MockStore)(nil).InsertCommitFiles), ctx, files)
+}
+
+// InsertCommitLanguages mocks base method.
+func (m *MockStore) InsertCommitLanguages(ctx context.Context, langs []*CommitLanguageRow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertCommitLanguages", ctx, langs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertCommitLanguages indicates an expected call of InsertCommitLanguages.
+func (mr *MockStoreMockRecorder) InsertCommitLanguages(ctx, langs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCommitLanguages", reflect.TypeOf((*MockStore)(nil).InsertCommitLanguages), ctx, langs)
+}
+
+// InsertCommitRefs mocks base method.
+func (m *MockStore) InsertCommitRefs(ctx context.Context, refs []*CommitRefRow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertCommitRefs", ctx, refs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertCommitRefs indicates an expected call of InsertCommitRefs.
+func (mr *MockStoreMockRecorder) InsertCommitRefs(ctx, refs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCommitRefs", reflect.TypeOf((*MockStore)(nil).InsertCommitRefs), ctx, refs)
+}
+
+// InsertCommitRepos mocks base method.
+func (m *MockStore) InsertCommitRepos(ctx context.Context, links []*CommitRepoRow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertCommitRepos", ctx, links)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertCommitRepos indicates an expected call of InsertCommitRepos.
+func (mr *MockStoreMockRecorder) InsertCommitRepos(ctx, links any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCommitRepos", reflect.TypeOf((*MockStore)(nil).InsertCommitRepos), ctx, links)
 }
 
 // InsertCommitStats mocks base method.
@@ -85,6 +289,96 @@ func (mr *MockStoreMockRecorder) InsertCommitStats(ctx, stats any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCommitStats", reflect.TypeOf((*MockStore)(nil).InsertCommitStats), ctx, stats)
 }
 
+// InsertCommitStatsBatch mocks base method.
+func (m *MockStore) InsertCommitStatsBatch(ctx context.Context, rows []*CommitStatsRow) ([]bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertCommitStatsBatch", ctx, rows)
+	ret0, _ := ret[0].([]bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertCommitStatsBatch indicates an expected call of InsertCommitStatsBatch.
+func (mr *MockStoreMockRecorder) InsertCommitStatsBatch(ctx, rows any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCommitStatsBatch", reflect.TypeOf((*MockStore)(nil).InsertCommitStatsBatch), ctx, rows)
+}
+
+// InsertCommits mocks base method.
+func (m *MockStore) InsertCommits(ctx context.Context, commits []*CommitRow) ([]bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertCommits", ctx, commits)
+	ret0, _ := ret[0].([]bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertCommits indicates an expected call of InsertCommits.
+func (mr *MockStoreMockRecorder) InsertCommits(ctx, commits any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCommits", reflect.TypeOf((*MockStore)(nil).InsertCommits), ctx, commits)
+}
+
+// InsertCreateEvent mocks base method.
+func (m *MockStore) InsertCreateEvent(ctx context.Context, event *CreateEventRow) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertCreateEvent", ctx, event)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertCreateEvent indicates an expected call of InsertCreateEvent.
+func (mr *MockStoreMockRecorder) InsertCreateEvent(ctx, event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCreateEvent", reflect.TypeOf((*MockStore)(nil).InsertCreateEvent), ctx, event)
+}
+
+// InsertDeleteEvent mocks base method.
+func (m *MockStore) InsertDeleteEvent(ctx context.Context, event *DeleteEventRow) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertDeleteEvent", ctx, event)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertDeleteEvent indicates an expected call of InsertDeleteEvent.
+func (mr *MockStoreMockRecorder) InsertDeleteEvent(ctx, event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertDeleteEvent", reflect.TypeOf((*MockStore)(nil).InsertDeleteEvent), ctx, event)
+}
+
+// InsertForcePush mocks base method.
+func (m *MockStore) InsertForcePush(ctx context.Context, fp *ForcePushRow) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertForcePush", ctx, fp)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertForcePush indicates an expected call of InsertForcePush.
+func (mr *MockStoreMockRecorder) InsertForcePush(ctx, fp any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertForcePush", reflect.TypeOf((*MockStore)(nil).InsertForcePush), ctx, fp)
+}
+
+// InsertPullRequestEvent mocks base method.
+func (m *MockStore) InsertPullRequestEvent(ctx context.Context, event *PullRequestEventRow) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertPullRequestEvent", ctx, event)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertPullRequestEvent indicates an expected call of InsertPullRequestEvent.
+func (mr *MockStoreMockRecorder) InsertPullRequestEvent(ctx, event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertPullRequestEvent", reflect.TypeOf((*MockStore)(nil).InsertPullRequestEvent), ctx, event)
+}
+
 // InsertPushEvent mocks base method.
 func (m *MockStore) InsertPushEvent(ctx context.Context, event *PushEventRow) (bool, error) {
 	m.ctrl.T.Helper()
@@ -100,6 +394,81 @@ func (mr *MockStoreMockRecorder) InsertPushEvent(ctx, event any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertPushEvent", reflect.TypeOf((*MockStore)(nil).InsertPushEvent), ctx, event)
 }
 
+// InsertReleaseEvent mocks base method.
+func (m *MockStore) InsertReleaseEvent(ctx context.Context, event *ReleaseEventRow) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertReleaseEvent", ctx, event)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertReleaseEvent indicates an expected call of InsertReleaseEvent.
+func (mr *MockStoreMockRecorder) InsertReleaseEvent(ctx, event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertReleaseEvent", reflect.TypeOf((*MockStore)(nil).InsertReleaseEvent), ctx, event)
+}
+
+// InsertWatchEvent mocks base method.
+func (m *MockStore) InsertWatchEvent(ctx context.Context, event *WatchEventRow) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWatchEvent", ctx, event)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertWatchEvent indicates an expected call of InsertWatchEvent.
+func (mr *MockStoreMockRecorder) InsertWatchEvent(ctx, event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWatchEvent", reflect.TypeOf((*MockStore)(nil).InsertWatchEvent), ctx, event)
+}
+
+// LanguageStats mocks base method.
+func (m *MockStore) LanguageStats(ctx context.Context, filter StatsFilter) ([]*LanguageStatsRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LanguageStats", ctx, filter)
+	ret0, _ := ret[0].([]*LanguageStatsRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LanguageStats indicates an expected call of LanguageStats.
+func (mr *MockStoreMockRecorder) LanguageStats(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LanguageStats", reflect.TypeOf((*MockStore)(nil).LanguageStats), ctx, filter)
+}
+
+// MarkBot mocks base method.
+func (m *MockStore) MarkBot(ctx context.Context, login string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkBot", ctx, login)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkBot indicates an expected call of MarkBot.
+func (mr *MockStoreMockRecorder) MarkBot(ctx, login any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkBot", reflect.TypeOf((*MockStore)(nil).MarkBot), ctx, login)
+}
+
+// MarkCommitsOrphaned mocks base method.
+func (m *MockStore) MarkCommitsOrphaned(ctx context.Context, shas []string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkCommitsOrphaned", ctx, shas)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkCommitsOrphaned indicates an expected call of MarkCommitsOrphaned.
+func (mr *MockStoreMockRecorder) MarkCommitsOrphaned(ctx, shas any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkCommitsOrphaned", reflect.TypeOf((*MockStore)(nil).MarkCommitsOrphaned), ctx, shas)
+}
+
 // Ping mocks base method.
 func (m *MockStore) Ping(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -113,3 +482,261 @@ func (mr *MockStoreMockRecorder) Ping(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStore)(nil).Ping), ctx)
 }
+
+// PollerStates mocks base method.
+func (m *MockStore) PollerStates(ctx context.Context) ([]*PollerStateRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PollerStates", ctx)
+	ret0, _ := ret[0].([]*PollerStateRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PollerStates indicates an expected call of PollerStates.
+func (mr *MockStoreMockRecorder) PollerStates(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PollerStates", reflect.TypeOf((*MockStore)(nil).PollerStates), ctx)
+}
+
+// RecentCommits mocks base method.
+func (m *MockStore) RecentCommits(ctx context.Context, filter StatsFilter, limit int) ([]*CommitStatsRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecentCommits", ctx, filter, limit)
+	ret0, _ := ret[0].([]*CommitStatsRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecentCommits indicates an expected call of RecentCommits.
+func (mr *MockStoreMockRecorder) RecentCommits(ctx, filter, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecentCommits", reflect.TypeOf((*MockStore)(nil).RecentCommits), ctx, filter, limit)
+}
+
+// RepoActivity mocks base method.
+func (m *MockStore) RepoActivity(ctx context.Context, filter StatsFilter, bucket time.Duration) ([]*RepoActivityRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RepoActivity", ctx, filter, bucket)
+	ret0, _ := ret[0].([]*RepoActivityRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RepoActivity indicates an expected call of RepoActivity.
+func (mr *MockStoreMockRecorder) RepoActivity(ctx, filter, bucket any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RepoActivity", reflect.TypeOf((*MockStore)(nil).RepoActivity), ctx, filter, bucket)
+}
+
+// RepoStats mocks base method.
+func (m *MockStore) RepoStats(ctx context.Context, filter StatsFilter, everyRepo bool, limit int) ([]*RepoStatsRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RepoStats", ctx, filter, everyRepo, limit)
+	ret0, _ := ret[0].([]*RepoStatsRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RepoStats indicates an expected call of RepoStats.
+func (mr *MockStoreMockRecorder) RepoStats(ctx, filter, everyRepo, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RepoStats", reflect.TypeOf((*MockStore)(nil).RepoStats), ctx, filter, everyRepo, limit)
+}
+
+// SaveCommitIdentities mocks base method.
+func (m *MockStore) SaveCommitIdentities(ctx context.Context, rows []*CommitIdentityRow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCommitIdentities", ctx, rows)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCommitIdentities indicates an expected call of SaveCommitIdentities.
+func (mr *MockStoreMockRecorder) SaveCommitIdentities(ctx, rows any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCommitIdentities", reflect.TypeOf((*MockStore)(nil).SaveCommitIdentities), ctx, rows)
+}
+
+// SavePollerState mocks base method.
+func (m *MockStore) SavePollerState(ctx context.Context, state *PollerStateRow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePollerState", ctx, state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePollerState indicates an expected call of SavePollerState.
+func (mr *MockStoreMockRecorder) SavePollerState(ctx, state any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePollerState", reflect.TypeOf((*MockStore)(nil).SavePollerState), ctx, state)
+}
+
+// SaveRepository mocks base method.
+func (m *MockStore) SaveRepository(ctx context.Context, repo *RepositoryRow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveRepository", ctx, repo)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveRepository indicates an expected call of SaveRepository.
+func (mr *MockStoreMockRecorder) SaveRepository(ctx, repo any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRepository", reflect.TypeOf((*MockStore)(nil).SaveRepository), ctx, repo)
+}
+
+// SaveTrending mocks base method.
+func (m *MockStore) SaveTrending(ctx context.Context, window time.Duration, rows []*TrendingRow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTrending", ctx, window, rows)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTrending indicates an expected call of SaveTrending.
+func (mr *MockStoreMockRecorder) SaveTrending(ctx, window, rows any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTrending", reflect.TypeOf((*MockStore)(nil).SaveTrending), ctx, window, rows)
+}
+
+// SpillJobs mocks base method.
+func (m *MockStore) SpillJobs(ctx context.Context, jobs []*SpilledJobRow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SpillJobs", ctx, jobs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SpillJobs indicates an expected call of SpillJobs.
+func (mr *MockStoreMockRecorder) SpillJobs(ctx, jobs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpillJobs", reflect.TypeOf((*MockStore)(nil).SpillJobs), ctx, jobs)
+}
+
+// SpilledJobs mocks base method.
+func (m *MockStore) SpilledJobs(ctx context.Context, limit int) ([]*SpilledJobRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SpilledJobs", ctx, limit)
+	ret0, _ := ret[0].([]*SpilledJobRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SpilledJobs indicates an expected call of SpilledJobs.
+func (mr *MockStoreMockRecorder) SpilledJobs(ctx, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpilledJobs", reflect.TypeOf((*MockStore)(nil).SpilledJobs), ctx, limit)
+}
+
+// SpilledJobsCount mocks base method.
+func (m *MockStore) SpilledJobsCount(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SpilledJobsCount", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SpilledJobsCount indicates an expected call of SpilledJobsCount.
+func (mr *MockStoreMockRecorder) SpilledJobsCount(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpilledJobsCount", reflect.TypeOf((*MockStore)(nil).SpilledJobsCount), ctx)
+}
+
+// StaleRepositories mocks base method.
+func (m *MockStore) StaleRepositories(ctx context.Context, fetchedBefore time.Time, limit int) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StaleRepositories", ctx, fetchedBefore, limit)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StaleRepositories indicates an expected call of StaleRepositories.
+func (mr *MockStoreMockRecorder) StaleRepositories(ctx, fetchedBefore, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StaleRepositories", reflect.TypeOf((*MockStore)(nil).StaleRepositories), ctx, fetchedBefore, limit)
+}
+
+// Trending mocks base method.
+func (m *MockStore) Trending(ctx context.Context, window time.Duration, limit int) ([]*TrendingRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Trending", ctx, window, limit)
+	ret0, _ := ret[0].([]*TrendingRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Trending indicates an expected call of Trending.
+func (mr *MockStoreMockRecorder) Trending(ctx, window, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Trending", reflect.TypeOf((*MockStore)(nil).Trending), ctx, window, limit)
+}
+
+// MockRetainer is a mock of Retainer interface.
+type MockRetainer struct {
+	ctrl     *gomock.Controller
+	recorder *MockRetainerMockRecorder
+	isgomock struct{}
+}
+
+// MockRetainerMockRecorder is the mock recorder for MockRetainer.
+type MockRetainerMockRecorder struct {
+	mock *MockRetainer
+}
+
+// NewMockRetainer creates a new mock instance.
+func NewMockRetainer(ctrl *gomock.Controller) *MockRetainer {
+	mock := &MockRetainer{ctrl: ctrl}
+	mock.recorder = &MockRetainerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRetainer) EXPECT() *MockRetainerMockRecorder {
+	return m.recorder
+}
+
+// EnsurePartitions mocks base method.
+func (m *MockRetainer) EnsurePartitions(ctx context.Context, from, to time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnsurePartitions", ctx, from, to)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnsurePartitions indicates an expected call of EnsurePartitions.
+func (mr *MockRetainerMockRecorder) EnsurePartitions(ctx, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsurePartitions", reflect.TypeOf((*MockRetainer)(nil).EnsurePartitions), ctx, from, to)
+}
+
+// ExpireBefore mocks base method.
+func (m *MockRetainer) ExpireBefore(ctx context.Context, cutoff time.Time, archive bool) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireBefore", ctx, cutoff, archive)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpireBefore indicates an expected call of ExpireBefore.
+func (mr *MockRetainerMockRecorder) ExpireBefore(ctx, cutoff, archive any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireBefore", reflect.TypeOf((*MockRetainer)(nil).ExpireBefore), ctx, cutoff, archive)
+}
+
+// StripRawPayloads mocks base method.
+func (m *MockRetainer) StripRawPayloads(ctx context.Context, cutoff time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StripRawPayloads", ctx, cutoff)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StripRawPayloads indicates an expected call of StripRawPayloads.
+func (mr *MockRetainerMockRecorder) StripRawPayloads(ctx, cutoff any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StripRawPayloads", reflect.TypeOf((*MockRetainer)(nil).StripRawPayloads), ctx, cutoff)
+}
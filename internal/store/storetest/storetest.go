@@ -0,0 +1,1345 @@
+// Package storetest is a backend-agnostic conformance suite for store.Store implementations.
+// Each backend runs it from its own test (see memory_test.go, sqlite_test.go, postgres_test.go in package store).
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/identity"
+	"github.com/challenge-github-events/internal/store"
+)
+
+// Run runs the suite. newStore must return an empty store for each subtest.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"PushEventIdempotent", testPushEventIdempotent},
+		{"ActivityEventsCountedByType", testActivityEventsCountedByType},
+		{"CommitStatsIdempotent", testCommitStatsIdempotent},
+		{"CommitStatsBatch", testCommitStatsBatch},
+		{"LargeCommitStatsBatch", testLargeCommitStatsBatch},
+		{"CommitFiles", testCommitFiles},
+		{"CommitsWithDetails", testCommitsWithDetails},
+		{"PollerState", testPollerState},
+		{"JobOverflow", testJobOverflow},
+		{"ConcurrentInsertsOfSameSHA", testConcurrentInsertsOfSameSHA},
+		{"ConcurrentBatchesOfSameSHAs", testConcurrentBatchesOfSameSHAs},
+		{"AdjustedLines", testAdjustedLines},
+		{"TimeWindow", testTimeWindow},
+		{"ExcludeMerges", testExcludeMerges},
+		{"ExcludeBots", testExcludeBots},
+		{"MarkBot", testMarkBot},
+		{"ForcePushAndOrphans", testForcePushAndOrphans},
+		{"BranchFilter", testBranchFilter},
+		{"DefaultBranchPerRepo", testDefaultBranchPerRepo},
+		{"RepoFilter", testRepoFilter},
+		{"RepositoryMetadataFilters", testRepositoryMetadataFilters},
+		{"StaleRepositories", testStaleRepositories},
+		{"CanonicalRepoOfSharedCommits", testCanonicalRepoOfSharedCommits},
+		{"RepoStatsOfSharedCommits", testRepoStatsOfSharedCommits},
+		{"LanguageStats", testLanguageStats},
+		{"Anomalies", testAnomalies},
+		{"CappedOutliers", testCappedOutliers},
+		{"RepoActivity", testRepoActivity},
+		{"RecentCommits", testRecentCommits},
+		{"TrendingSnapshot", testTrendingSnapshot},
+		{"ExportCommitStats", testExportCommitStats},
+		{"ExportPushEvents", testExportPushEvents},
+		{"AuthorsMergeByKey", testAuthorsMergeByKey},
+		{"AuthorsMergedByLinkingCommit", testAuthorsMergedByLinkingCommit},
+		{"ConcurrentIdentitiesOfSameAuthor", testConcurrentIdentitiesOfSameAuthor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func testPushEventIdempotent(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	row := &store.PushEventRow{ID: "e1", Type: "PushEvent", CreatedAt: time.Now(), Repo: "o/r", RawPayload: []byte(`{}`)}
+	if ok, err := s.InsertPushEvent(ctx, row); err != nil || !ok {
+		t.Fatalf("first insert want (true, nil) got (%v, %v)", ok, err)
+	}
+	if ok, err := s.InsertPushEvent(ctx, row); err != nil || ok {
+		t.Fatalf("duplicate insert want (false, nil) got (%v, %v)", ok, err)
+	}
+	if n, err := s.EventsSeenCount(ctx, store.EventFilter{}); err != nil || n != 1 {
+		t.Errorf("EventsSeenCount want 1 got %d (%v)", n, err)
+	}
+}
+
+func testActivityEventsCountedByType(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	base := store.EventRow{ID: "w1", CreatedAt: time.Now(), Repo: "o/r", Source: "global"}
+	for i := 0; i < 2; i++ {
+		if _, err := s.InsertWatchEvent(ctx, &store.WatchEventRow{EventRow: base, Action: "started"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base.ID = "pr1"
+	if _, err := s.InsertPullRequestEvent(ctx, &store.PullRequestEventRow{EventRow: base, Action: "opened", Number: 1}); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := s.EventCountsByType(ctx, store.EventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["WatchEvent"] != 1 || counts["PullRequestEvent"] != 1 || counts["PushEvent"] != 0 {
+		t.Errorf("counts want WatchEvent=1 PullRequestEvent=1 PushEvent=0 got %v", counts)
+	}
+}
+
+func testCommitStatsIdempotent(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	row := commit("sha1", 10, 4)
+	if ok, err := s.InsertCommitStats(ctx, row); err != nil || !ok {
+		t.Fatalf("first insert want (true, nil) got (%v, %v)", ok, err)
+	}
+	again := commit("sha1", 100, 0)
+	if ok, err := s.InsertCommitStats(ctx, again); err != nil || ok {
+		t.Fatalf("duplicate insert want (false, nil) got (%v, %v)", ok, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != 6 {
+		t.Errorf("GlobalNetLines want 6 (first row kept) got %d (%v)", net, err)
+	}
+}
+
+func testCommitStatsBatch(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	if _, err := s.InsertCommitStats(ctx, commit("old", 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	inserted, err := s.InsertCommitStatsBatch(ctx, []*store.CommitStatsRow{
+		commit("a", 5, 0), commit("old", 5, 0), commit("b", 5, 0), commit("a", 5, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bool{true, false, true, false}
+	for i := range want {
+		if inserted[i] != want[i] {
+			t.Fatalf("inserted want %v got %v", want, inserted)
+		}
+	}
+	if inserted, err := s.InsertCommitStatsBatch(ctx, nil); err != nil || len(inserted) != 0 {
+		t.Errorf("empty batch want ([], nil) got (%v, %v)", inserted, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != 11 {
+		t.Errorf("GlobalNetLines want 11 got %d (%v)", net, err)
+	}
+}
+
+// testLargeCommitStatsBatch inserts more rows than fit the bind parameters of one statement.
+func testLargeCommitStatsBatch(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	const n = 5000
+	rows := make([]*store.CommitStatsRow, 0, n+1)
+	for i := range n {
+		rows = append(rows, commit(fmt.Sprintf("sha%d", i), 1, 0))
+	}
+	rows = append(rows, commit("sha0", 1, 0)) // claimed by the first statement
+	inserted, err := s.InsertCommitStatsBatch(ctx, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inserted) != n+1 {
+		t.Fatalf("want %d results got %d", n+1, len(inserted))
+	}
+	if !inserted[0] || !inserted[n-1] || inserted[n] {
+		t.Errorf("want first and last rows inserted and the duplicate not got %v, %v, %v", inserted[0], inserted[n-1], inserted[n])
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != n {
+		t.Errorf("GlobalNetLines want %d got %d (%v)", n, net, err)
+	}
+}
+
+func testCommitFiles(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	files := []*store.CommitFileRow{
+		{Sha: "sha1", Filename: "z.go", Status: "modified", Additions: 3, Deletions: 1, Changes: 4},
+		{Sha: "sha1", Filename: "a/b.lock", Status: "added", Additions: 100, Changes: 100, Excluded: true},
+		{Sha: "sha2", Filename: "other.go", Status: "added", Additions: 1, Changes: 1},
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.InsertCommitFiles(ctx, files); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := s.CommitFiles(ctx, "sha1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Filename != "a/b.lock" || got[1].Filename != "z.go" {
+		t.Fatalf("CommitFiles want [a/b.lock z.go] got %v", got)
+	}
+	if !got[0].Excluded || got[1].Additions != 3 || got[1].Status != "modified" {
+		t.Errorf("CommitFiles rows not round-tripped: %+v %+v", got[0], got[1])
+	}
+	if got, err := s.CommitFiles(ctx, "missing"); err != nil || len(got) != 0 {
+		t.Errorf("CommitFiles(missing) want none got %v (%v)", got, err)
+	}
+}
+
+func testCommitsWithDetails(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	withDetails := func(sha, filename string) *store.CommitRow {
+		return &store.CommitRow{
+			Stats:      commit(sha, 3, 1),
+			Files:      []*store.CommitFileRow{{Sha: sha, Filename: filename, Additions: 3, Deletions: 1, Changes: 4}},
+			Languages:  []*store.CommitLanguageRow{{Sha: sha, Language: "Go", Files: 1, Additions: 3, Deletions: 1, AdjustedAdditions: 3, AdjustedDeletions: 1}},
+			Identities: []*store.CommitIdentityRow{identityRow(sha, store.RoleAuthor, identity.Identity{Name: "Dev", Email: "dev@example.com"})},
+		}
+	}
+	inserted, err := s.InsertCommits(ctx, []*store.CommitRow{withDetails("sha1", "a.go"), withDetails("sha2", "b.go")})
+	if err != nil || len(inserted) != 2 || !inserted[0] || !inserted[1] {
+		t.Fatalf("InsertCommits want [true true] got %v (%v)", inserted, err)
+	}
+	// A known commit is not inserted again, and neither are its details.
+	inserted, err = s.InsertCommits(ctx, []*store.CommitRow{withDetails("sha1", "other.go"), withDetails("sha3", "c.go")})
+	if err != nil || len(inserted) != 2 || inserted[0] || !inserted[1] {
+		t.Fatalf("InsertCommits with a known commit want [false true] got %v (%v)", inserted, err)
+	}
+	if files, err := s.CommitFiles(ctx, "sha1"); err != nil || len(files) != 1 || files[0].Filename != "a.go" {
+		t.Errorf("CommitFiles(sha1) want [a.go] got %v (%v)", files, err)
+	}
+	if langs, err := s.LanguageStats(ctx, store.StatsFilter{}); err != nil || languages(langs) != "Go:3:9-3=6" {
+		t.Errorf("LanguageStats want Go:3:9-3=6 got %s (%v)", languages(langs), err)
+	}
+	if authors, err := s.AuthorStats(ctx, store.StatsFilter{}, 0); err != nil || authorStats(authors) != "Dev:3:6" {
+		t.Errorf("AuthorStats want Dev:3:6 got %s (%v)", authorStats(authors), err)
+	}
+}
+
+func testPollerState(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	polled := time.Date(2025, 11, 3, 12, 0, 0, 0, time.UTC)
+	if err := s.SavePollerState(ctx, &store.PollerStateRow{Source: "global", ETag: "a", LastEventID: "10", LastPollAt: polled, LastStatus: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+	// An error poll has no new cursor; the stored one is kept.
+	if err := s.SavePollerState(ctx, &store.PollerStateRow{Source: "global", ETag: "a", LastPollAt: polled.Add(time.Minute), LastStatus: "error: boom"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SavePollerState(ctx, &store.PollerStateRow{Source: "org:golang", LastStatus: "not_modified"}); err != nil {
+		t.Fatal(err)
+	}
+	states, err := s.PollerStates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[0].Source != "global" || states[1].Source != "org:golang" {
+		t.Fatalf("PollerStates want [global org:golang] got %v", states)
+	}
+	st := states[0]
+	if st.ETag != "a" || st.LastEventID != "10" || st.LastStatus != "error: boom" || !st.LastPollAt.Equal(polled.Add(time.Minute)) {
+		t.Errorf("global state want etag=a last_event_id=10 status=error: boom last_poll_at=%v got %+v", polled.Add(time.Minute), st)
+	}
+}
+
+func testConcurrentInsertsOfSameSHA(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	const workers = 16
+	var wg sync.WaitGroup
+	results := make(chan bool, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := s.InsertCommitStats(ctx, commit("same", 7, 2))
+			if err != nil {
+				t.Error(err)
+			}
+			results <- ok
+		}()
+	}
+	wg.Wait()
+	close(results)
+	inserted := 0
+	for ok := range results {
+		if ok {
+			inserted++
+		}
+	}
+	if inserted != 1 {
+		t.Errorf("want exactly 1 insert reported new got %d", inserted)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != 5 {
+		t.Errorf("GlobalNetLines want 5 got %d (%v)", net, err)
+	}
+}
+
+func testConcurrentBatchesOfSameSHAs(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	const workers = 8
+	var wg sync.WaitGroup
+	newPerSHA := make([]int, 3)
+	var mu sync.Mutex
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			inserted, err := s.InsertCommitStatsBatch(ctx, []*store.CommitStatsRow{commit("s0", 1, 0), commit("s1", 1, 0), commit("s2", 1, 0)})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for j, ok := range inserted {
+				if ok {
+					newPerSHA[j]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for j, n := range newPerSHA {
+		if n != 1 {
+			t.Errorf("s%d reported new %d times, want 1", j, n)
+		}
+	}
+}
+
+func testAdjustedLines(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	row := commit("sha1", 1000, 10)
+	row.AdjustedAdditions, row.AdjustedDeletions, row.AdjustedNet = 50, 10, 40
+	mustInsert(t, s, row)
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != 990 {
+		t.Errorf("raw GlobalNetLines want 990 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Adjusted: true}); err != nil || net != 40 {
+		t.Errorf("adjusted GlobalNetLines want 40 got %d (%v)", net, err)
+	}
+}
+
+func testTimeWindow(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now()
+	old := commit("old", 100, 0)
+	old.CommittedAt = now.Add(-48 * time.Hour)
+	recent := commit("recent", 10, 0)
+	recent.CommittedAt = now.Add(-time.Hour)
+	edge := commit("edge", 1, 0)
+	edge.CommittedAt = now.Add(-24 * time.Hour)
+	mustInsert(t, s, old, recent, edge)
+
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Since: edge.CommittedAt}); err != nil || net != 11 {
+		t.Errorf("GlobalNetLines since 24h (inclusive) want 11 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Since: now.Add(-2 * time.Hour).In(time.FixedZone("UTC+5", 5*3600))}); err != nil || net != 10 {
+		t.Errorf("GlobalNetLines since 2h (other zone) want 10 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Since: now.Add(time.Hour)}); err != nil || net != 0 {
+		t.Errorf("GlobalNetLines since future want 0 got %d (%v)", net, err)
+	}
+}
+
+func testExcludeMerges(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	merge := commit("merge", 500, 0)
+	merge.ParentCount, merge.IsMerge = 2, true
+	mustInsert(t, s, commit("plain", 5, 0), merge)
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != 505 {
+		t.Errorf("GlobalNetLines want 505 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{ExcludeMerges: true}); err != nil || net != 5 {
+		t.Errorf("GlobalNetLines without merges want 5 got %d (%v)", net, err)
+	}
+}
+
+func testExcludeBots(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	bot := commit("bot", 40, 0)
+	bot.IsBot = true
+	mustInsert(t, s, commit("human", 3, 1), bot)
+	if err := s.InsertCommitLanguages(ctx, []*store.CommitLanguageRow{
+		{Sha: "human", Language: "Go", Files: 1, Additions: 3, Deletions: 1, AdjustedAdditions: 3, AdjustedDeletions: 1},
+		{Sha: "bot", Language: "JSON", Files: 1, Additions: 40, AdjustedAdditions: 40},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveCommitIdentities(ctx, []*store.CommitIdentityRow{
+		identityRow("human", store.RoleAuthor, identity.Identity{Name: "Mona", Email: "mona@example.com", Login: "mona"}),
+		identityRow("bot", store.RoleAuthor, identity.Identity{Name: "dependabot[bot]", Email: "1+dependabot[bot]@users.noreply.github.com", Login: "dependabot[bot]"}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	events := []*store.PushEventRow{
+		{ID: "p1", Type: "PushEvent", CreatedAt: now, ActorLogin: "mona", Repo: "o/r"},
+		{ID: "p2", Type: "PushEvent", CreatedAt: now, ActorLogin: "dependabot[bot]", Repo: "o/r", IsBot: true},
+	}
+	for _, e := range events {
+		if _, err := s.InsertPushEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	watch := store.EventRow{ID: "w1", CreatedAt: now, ActorLogin: "stars-bot", Repo: "o/r", IsBot: true}
+	if _, err := s.InsertWatchEvent(ctx, &store.WatchEventRow{EventRow: watch, Action: "started"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != 42 {
+		t.Errorf("GlobalNetLines want 42 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{ExcludeBots: true}); err != nil || net != 2 {
+		t.Errorf("GlobalNetLines without bots want 2 got %d (%v)", net, err)
+	}
+	langs, err := s.LanguageStats(ctx, store.StatsFilter{ExcludeBots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Go:1:3-1=2"; languages(langs) != want {
+		t.Errorf("LanguageStats without bots want %s got %s", want, languages(langs))
+	}
+	authors, err := s.AuthorStats(ctx, store.StatsFilter{ExcludeBots: true}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Mona/mona:1:2"; authorStats(authors) != want {
+		t.Errorf("AuthorStats without bots want %s got %s", want, authorStats(authors))
+	}
+	if n, err := s.EventsSeenCount(ctx, store.EventFilter{}); err != nil || n != 2 {
+		t.Errorf("EventsSeenCount want 2 got %d (%v)", n, err)
+	}
+	if n, err := s.EventsSeenCount(ctx, store.EventFilter{ExcludeBots: true}); err != nil || n != 1 {
+		t.Errorf("EventsSeenCount without bots want 1 got %d (%v)", n, err)
+	}
+	counts, err := s.EventCountsByType(ctx, store.EventFilter{ExcludeBots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["PushEvent"] != 1 || counts["WatchEvent"] != 0 {
+		t.Errorf("counts without bots want PushEvent=1 WatchEvent=0 got %v", counts)
+	}
+
+	var exported []string
+	if err := s.ExportCommitStats(ctx, store.ExportFilter{}, func(r *store.CommitStatsRow) error {
+		exported = append(exported, fmt.Sprintf("%s:%v", r.Sha, r.IsBot))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(exported)
+	if got := fmt.Sprint(exported); got != "[bot:true human:false]" {
+		t.Errorf("exported is_bot want [bot:true human:false] got %s", got)
+	}
+	if err := s.ExportPushEvents(ctx, store.ExportFilter{Author: "dependabot[bot]"}, func(r *store.PushEventRow) error {
+		if !r.IsBot {
+			t.Errorf("exported push event %s want is_bot", r.ID)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testMarkBot(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustInsert(t, s, commit("busy-1", 10, 0), commit("busy-2", 20, 0), commit("human", 3, 1))
+	if err := s.SaveCommitIdentities(ctx, []*store.CommitIdentityRow{
+		identityRow("busy-1", store.RoleAuthor, identity.Identity{Name: "Busy", Email: "busy@example.com", Login: "Busy"}),
+		identityRow("busy-2", store.RoleAuthor, identity.Identity{Name: "Busy", Email: "busy@example.com", Login: "Busy"}),
+		identityRow("human", store.RoleAuthor, identity.Identity{Name: "Mona", Email: "mona@example.com", Login: "mona"}),
+		identityRow("human", store.RoleCommitter, identity.Identity{Name: "Busy", Email: "busy@example.com", Login: "Busy"}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, e := range []*store.PushEventRow{
+		{ID: "p1", Type: "PushEvent", CreatedAt: now, ActorLogin: "Busy", Repo: "o/r"},
+		{ID: "p2", Type: "PushEvent", CreatedAt: now, ActorLogin: "mona", Repo: "o/r"},
+	} {
+		if _, err := s.InsertPushEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	watch := store.EventRow{ID: "w1", CreatedAt: now, ActorLogin: "Busy", Repo: "o/r"}
+	if _, err := s.InsertWatchEvent(ctx, &store.WatchEventRow{EventRow: watch, Action: "started"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two commits authored by busy and two of its events; a commit it only committed stays human.
+	if n, err := s.MarkBot(ctx, "busy"); err != nil || n != 4 {
+		t.Errorf("MarkBot want 4 rows flagged got %d (%v)", n, err)
+	}
+	if n, err := s.MarkBot(ctx, "busy"); err != nil || n != 0 {
+		t.Errorf("MarkBot again want 0 rows flagged got %d (%v)", n, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{ExcludeBots: true}); err != nil || net != 2 {
+		t.Errorf("GlobalNetLines without bots want 2 got %d (%v)", net, err)
+	}
+	if n, err := s.EventsSeenCount(ctx, store.EventFilter{ExcludeBots: true}); err != nil || n != 1 {
+		t.Errorf("EventsSeenCount without bots want 1 got %d (%v)", n, err)
+	}
+	if counts, err := s.EventCountsByType(ctx, store.EventFilter{ExcludeBots: true}); err != nil || counts["WatchEvent"] != 0 {
+		t.Errorf("WatchEvent count without bots want 0 got %d (%v)", counts["WatchEvent"], err)
+	}
+}
+
+func testForcePushAndOrphans(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	fp := &store.ForcePushRow{EventID: "e1", Repo: "o/r", Before: "b", Head: "h", DetectedVia: "flag", Orphaned: 1, DetectedAt: time.Now()}
+	if ok, err := s.InsertForcePush(ctx, fp); err != nil || !ok {
+		t.Fatalf("InsertForcePush want (true, nil) got (%v, %v)", ok, err)
+	}
+	if ok, err := s.InsertForcePush(ctx, fp); err != nil || ok {
+		t.Fatalf("duplicate InsertForcePush want (false, nil) got (%v, %v)", ok, err)
+	}
+	mustInsert(t, s, commit("kept", 3, 0), commit("gone", 30, 0))
+	if n, err := s.MarkCommitsOrphaned(ctx, []string{"gone", "unknown"}); err != nil || n != 1 {
+		t.Errorf("MarkCommitsOrphaned want 1 got %d (%v)", n, err)
+	}
+	if n, err := s.MarkCommitsOrphaned(ctx, []string{"gone"}); err != nil || n != 0 {
+		t.Errorf("MarkCommitsOrphaned again want 0 got %d (%v)", n, err)
+	}
+	if n, err := s.MarkCommitsOrphaned(ctx, nil); err != nil || n != 0 {
+		t.Errorf("MarkCommitsOrphaned(nil) want 0 got %d (%v)", n, err)
+	}
+	// "unknown" was discarded before it was fetched: it is flagged when inserted.
+	mustInsert(t, s, commit("unknown", 300, 0))
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != 333 {
+		t.Errorf("GlobalNetLines want 333 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{ExcludeOrphaned: true}); err != nil || net != 3 {
+		t.Errorf("GlobalNetLines without orphans want 3 got %d (%v)", net, err)
+	}
+}
+
+func testBranchFilter(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustInsert(t, s, commit("on-main", 1, 0), commit("on-feature", 10, 0), commit("on-both", 100, 0), commit("unlinked", 1000, 0))
+	refs := []*store.CommitRefRow{
+		{Sha: "on-main", Repo: "o/r", Ref: "refs/heads/main", EventID: "e1"},
+		{Sha: "on-feature", Repo: "o/r", Ref: "refs/heads/feature", EventID: "e2"},
+		{Sha: "on-both", Repo: "o/r", Ref: "refs/heads/feature", EventID: "e2"},
+		{Sha: "on-both", Repo: "o/r", Ref: "refs/heads/master", EventID: "e3"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.InsertCommitRefs(ctx, refs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Branch: store.BranchDefault}); err != nil || net != 101 {
+		t.Errorf("GlobalNetLines on default branches (main, master) want 101 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Branch: "feature"}); err != nil || net != 110 {
+		t.Errorf("GlobalNetLines on feature want 110 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Branch: "missing"}); err != nil || net != 0 {
+		t.Errorf("GlobalNetLines on missing branch want 0 got %d (%v)", net, err)
+	}
+}
+
+func testDefaultBranchPerRepo(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	mustInsert(t, s, commit("meta-trunk", 1, 0), commit("meta-main", 10, 0),
+		commit("create-develop", 100, 0), commit("create-master", 1000, 0),
+		commit("unknown-main", 10000, 0), commit("unknown-feature", 100000, 0))
+	refs := []*store.CommitRefRow{
+		{Sha: "meta-trunk", Repo: "o/meta", Ref: "refs/heads/trunk", EventID: "e1"},
+		{Sha: "meta-main", Repo: "o/meta", Ref: "refs/heads/main", EventID: "e2"},
+		{Sha: "create-develop", Repo: "o/create", Ref: "refs/heads/develop", EventID: "e3"},
+		{Sha: "create-master", Repo: "o/create", Ref: "refs/heads/master", EventID: "e4"},
+		{Sha: "unknown-main", Repo: "o/unknown", Ref: "refs/heads/main", EventID: "e5"},
+		{Sha: "unknown-feature", Repo: "o/unknown", Ref: "refs/heads/feature", EventID: "e6"},
+	}
+	if err := s.InsertCommitRefs(ctx, refs); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveRepository(ctx, &store.RepositoryRow{Repo: "o/meta", Found: true, DefaultBranch: "trunk", FetchedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	// The latest CreateEvent naming a master branch wins.
+	for i, branch := range []string{"master", "develop"} {
+		e := &store.CreateEventRow{EventRow: store.EventRow{ID: fmt.Sprintf("c%d", i), CreatedAt: now.Add(time.Duration(i) * time.Minute), Repo: "o/create"},
+			Ref: "feature", RefType: "branch", MasterBranch: branch}
+		if _, err := s.InsertCreateEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Branch: store.BranchDefault}); err != nil || net != 10101 {
+		t.Errorf("GlobalNetLines on each repo's default branch want 10101 got %d (%v)", net, err)
+	}
+}
+
+func testRepoFilter(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	other := commit("other", 50, 0)
+	other.Repo = "o/other"
+	old := commit("old", 7, 0)
+	old.CommittedAt = time.Now().Add(-48 * time.Hour)
+	mustInsert(t, s, commit("a", 10, 2), old, other)
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Repo: "o/r"}); err != nil || net != 15 {
+		t.Errorf("GlobalNetLines of o/r want 15 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Repo: "o/r", Since: time.Now().Add(-time.Hour)}); err != nil || net != 8 {
+		t.Errorf("GlobalNetLines of o/r in the last hour want 8 got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Repo: "o/none"}); err != nil || net != 0 {
+		t.Errorf("GlobalNetLines of unknown repo want 0 got %d (%v)", net, err)
+	}
+}
+
+func testRepositoryMetadataFilters(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	rows := []*store.CommitStatsRow{commit("upstream", 10, 0), commit("fork", 20, 0), commit("gone", 40, 0), commit("new", 80, 0)}
+	for i, repo := range []string{"up/lib", "me/lib", "o/gone", "o/new"} {
+		rows[i].Repo = repo
+	}
+	mustInsert(t, s, rows...)
+	now := time.Now().Truncate(time.Second)
+	for _, r := range []*store.RepositoryRow{
+		{Repo: "up/lib", Found: true, Language: "Go", Stars: 500, DefaultBranch: "main", License: "MIT", FetchedAt: now},
+		{Repo: "me/lib", Found: true, Language: "Go", Stars: 2, Fork: true, Parent: "up/lib", DefaultBranch: "main", FetchedAt: now},
+		{Repo: "o/gone", FetchedAt: now},
+	} {
+		if err := s.SaveRepository(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		filter store.StatsFilter
+		want   int64
+	}{
+		{store.StatsFilter{}, 150},
+		{store.StatsFilter{Forks: store.ForksExclude}, 10},
+		{store.StatsFilter{Forks: store.ForksOnly}, 20},
+		{store.StatsFilter{RepoLanguage: "go"}, 30},
+		{store.StatsFilter{RepoLanguage: "Rust"}, 0},
+		{store.StatsFilter{MinStars: 100}, 10},
+		{store.StatsFilter{Forks: store.ForksOnly, MinStars: 100}, 0},
+		{store.StatsFilter{Forks: store.ForksExclude, Repo: "up/lib", RepoLanguage: "Go"}, 10},
+	} {
+		if net, err := s.GlobalNetLines(ctx, tt.filter); err != nil || net != tt.want {
+			t.Errorf("GlobalNetLines(%+v) want %d got %d (%v)", tt.filter, tt.want, net, err)
+		}
+	}
+
+	// Metadata is replaced on refresh.
+	if err := s.SaveRepository(ctx, &store.RepositoryRow{Repo: "me/lib", Found: true, Language: "Go", Stars: 300, FetchedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{MinStars: 100}); err != nil || net != 30 {
+		t.Errorf("GlobalNetLines after refresh want 30 got %d (%v)", net, err)
+	}
+}
+
+func testStaleRepositories(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	var links []*store.CommitRepoRow
+	for i, repo := range []string{"o/fresh", "o/stale", "o/older", "o/new", "o/new"} {
+		links = append(links, &store.CommitRepoRow{Sha: fmt.Sprintf("sha%d", i), Repo: repo, FirstSeenAt: now})
+	}
+	if err := s.InsertCommitRepos(ctx, links); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*store.RepositoryRow{
+		{Repo: "o/fresh", Found: true, FetchedAt: now},
+		{Repo: "o/stale", Found: true, FetchedAt: now.Add(-25 * time.Hour)},
+		{Repo: "o/older", FetchedAt: now.Add(-48 * time.Hour)},
+		{Repo: "o/unused", Found: true, FetchedAt: now.Add(-72 * time.Hour)},
+	} {
+		if err := s.SaveRepository(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := s.StaleRepositories(ctx, now.Add(-24*time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, " ") != "o/new o/older o/stale" {
+		t.Errorf("want missing then least recently fetched [o/new o/older o/stale] got %v", got)
+	}
+	if got, err := s.StaleRepositories(ctx, now.Add(-24*time.Hour), 2); err != nil || len(got) != 2 || got[1] != "o/older" {
+		t.Errorf("limit 2 want [o/new o/older] got %v (%v)", got, err)
+	}
+}
+
+func testJobOverflow(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	var jobs []*store.SpilledJobRow
+	for _, sha := range []string{"a", "b", "c"} {
+		jobs = append(jobs, &store.SpilledJobRow{EventID: "e1", Owner: "o", Repo: "r", Sha: sha, SpilledAt: now})
+	}
+	jobs[2].EventID = ""
+	if err := s.SpillJobs(ctx, jobs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SpillJobs(ctx, jobs[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.SpilledJobsCount(ctx); err != nil || n != 3 {
+		t.Fatalf("count want 3 got %d (%v)", n, err)
+	}
+
+	got, err := s.SpilledJobs(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Sha != "a" || got[1].Sha != "b" || got[0].ID >= got[1].ID ||
+		got[0].EventID != "e1" || got[0].Owner != "o" || got[0].Repo != "r" || !got[0].SpilledAt.Equal(now) {
+		t.Fatalf("want the 2 oldest jobs [a b] got %+v", got)
+	}
+	if again, err := s.SpilledJobs(ctx, 2); err != nil || len(again) != 2 || again[0].ID != got[0].ID {
+		t.Fatalf("jobs not deleted want to stay in the overflow got %+v (%v)", again, err)
+	}
+	if err := s.DeleteSpilledJobs(ctx, []int64{got[0].ID, got[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = s.SpilledJobs(ctx, 10); err != nil || len(got) != 1 || got[0].Sha != "c" || got[0].EventID != "" {
+		t.Fatalf("want the remaining job c got %+v (%v)", got, err)
+	}
+	if err := s.DeleteSpilledJobs(ctx, []int64{got[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteSpilledJobs(ctx, nil); err != nil {
+		t.Errorf("DeleteSpilledJobs(nil) want nil got %v", err)
+	}
+	if got, err = s.SpilledJobs(ctx, 10); err != nil || len(got) != 0 {
+		t.Errorf("empty overflow want no job got %+v (%v)", got, err)
+	}
+	if n, err := s.SpilledJobsCount(ctx); err != nil || n != 0 {
+		t.Errorf("count want 0 got %d (%v)", n, err)
+	}
+}
+
+// forkAndUpstream stores commits seen in the fork me/lib first and then in its upstream up/lib: "shared" and
+// "later" are attributed to the fork, "upstream" to up/lib and "own" is only in the fork.
+func forkAndUpstream(t *testing.T, s store.Store) {
+	t.Helper()
+	ctx := context.Background()
+	shared, later, upstream, own := commit("shared", 10, 0), commit("later", 20, 0), commit("upstream", 40, 0), commit("own", 80, 0)
+	shared.Repo, later.Repo, upstream.Repo, own.Repo = "me/lib", "me/lib", "up/lib", "me/lib"
+	mustInsert(t, s, shared, later, upstream, own)
+	seen := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err := s.InsertCommitRepos(ctx, []*store.CommitRepoRow{
+		{Sha: "shared", Repo: "me/lib", FirstSeenAt: seen},
+		{Sha: "shared", Repo: "up/lib", FirstSeenAt: seen.Add(time.Minute)},
+		{Sha: "later", Repo: "me/lib", FirstSeenAt: seen},
+		{Sha: "later", Repo: "up/lib", FirstSeenAt: seen.Add(time.Minute)},
+		{Sha: "upstream", Repo: "up/lib", FirstSeenAt: seen},
+		{Sha: "upstream", Repo: "me/lib", FirstSeenAt: seen.Add(time.Minute)},
+		{Sha: "own", Repo: "me/lib", FirstSeenAt: seen},
+		{Sha: "own", Repo: "me/lib", FirstSeenAt: seen.Add(time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCanonicalRepoOfSharedCommits(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	forkAndUpstream(t, s)
+	repoNet := func(repo string) int64 {
+		t.Helper()
+		net, err := s.GlobalNetLines(ctx, store.StatsFilter{Repo: repo})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return net
+	}
+
+	// Without metadata commits stay where they arrived first.
+	if n, err := s.CanonicalizeRepos(ctx, []string{"me/lib", "up/lib"}); err != nil || n != 0 {
+		t.Fatalf("CanonicalizeRepos without metadata want 0 got %d (%v)", n, err)
+	}
+	now := time.Now().Truncate(time.Second)
+	for _, r := range []*store.RepositoryRow{
+		{Repo: "up/lib", Found: true, FetchedAt: now},
+		{Repo: "me/lib", Found: true, Fork: true, Parent: "up/lib", FetchedAt: now},
+	} {
+		if err := s.SaveRepository(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := s.CanonicalizeCommits(ctx, []string{"shared", "upstream", "own", "unknown"}); err != nil || n != 1 {
+		t.Fatalf("CanonicalizeCommits want 1 (shared) got %d (%v)", n, err)
+	}
+	if net := repoNet("me/lib"); net != 100 {
+		t.Errorf("fork net after moving shared want 100 got %d", net)
+	}
+	if n, err := s.CanonicalizeRepos(ctx, []string{"up/lib"}); err != nil || n != 1 {
+		t.Fatalf("CanonicalizeRepos want 1 (later) got %d (%v)", n, err)
+	}
+	if n, err := s.CanonicalizeRepos(ctx, []string{"up/lib", "me/lib"}); err != nil || n != 0 {
+		t.Errorf("CanonicalizeRepos again want 0 got %d (%v)", n, err)
+	}
+	if up, fork := repoNet("up/lib"), repoNet("me/lib"); up != 70 || fork != 80 {
+		t.Errorf("net want up/lib 70 and me/lib 80 got %d and %d", up, fork)
+	}
+}
+
+func testRepoStatsOfSharedCommits(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	forkAndUpstream(t, s)
+	format := func(rows []*store.RepoStatsRow) string {
+		var out []string
+		for _, r := range rows {
+			out = append(out, fmt.Sprintf("%s:%d/%d:%d", r.Repo, r.Commits, r.Shared, r.Net))
+		}
+		return strings.Join(out, " ")
+	}
+
+	rows, err := s.RepoStats(ctx, store.StatsFilter{}, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := format(rows); got != "me/lib:3/2:110 up/lib:1/1:40" {
+		t.Errorf("canonical want [me/lib:3/2:110 up/lib:1/1:40] got [%s]", got)
+	}
+	rows, err = s.RepoStats(ctx, store.StatsFilter{}, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := format(rows); got != "me/lib:4/3:150 up/lib:3/3:70" {
+		t.Errorf("every repo want [me/lib:4/3:150 up/lib:3/3:70] got [%s]", got)
+	}
+	rows, err = s.RepoStats(ctx, store.StatsFilter{Repo: "up/lib"}, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := format(rows); got != "up/lib:3/3:70" {
+		t.Errorf("every repo of up/lib want [up/lib:3/3:70] got [%s]", got)
+	}
+}
+
+func testLanguageStats(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	old := commit("old", 0, 0)
+	old.CommittedAt = time.Now().Add(-48 * time.Hour)
+	merge := commit("merge", 0, 0)
+	merge.ParentCount, merge.IsMerge = 2, true
+	mustInsert(t, s, commit("c1", 0, 0), commit("c2", 0, 0), old, merge)
+	err := s.InsertCommitLanguages(ctx, []*store.CommitLanguageRow{
+		{Sha: "c1", Language: "Go", Files: 2, Additions: 30, Deletions: 10, AdjustedAdditions: 20, AdjustedDeletions: 10},
+		{Sha: "c1", Language: "YAML", Files: 1, Additions: 5, AdjustedAdditions: 5},
+		{Sha: "c2", Language: "Go", Files: 1, Additions: 5, Deletions: 5, AdjustedAdditions: 5, AdjustedDeletions: 5},
+		{Sha: "old", Language: "Python", Files: 1, Additions: 99, AdjustedAdditions: 99},
+		{Sha: "merge", Language: "Go", Files: 1, Additions: 1000, AdjustedAdditions: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Duplicates (same sha and language) are ignored.
+	if err := s.InsertCommitLanguages(ctx, []*store.CommitLanguageRow{{Sha: "c1", Language: "Go", Additions: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.LanguageStats(ctx, store.StatsFilter{Since: time.Now().Add(-24 * time.Hour), ExcludeMerges: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Go:2:35-15=20 YAML:1:5-0=5"; languages(got) != want {
+		t.Errorf("LanguageStats want %s got %s", want, languages(got))
+	}
+	got, err = s.LanguageStats(ctx, store.StatsFilter{Adjusted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Go:3:1025-15=1010 Python:1:99-0=99 YAML:1:5-0=5"; languages(got) != want {
+		t.Errorf("adjusted LanguageStats want %s got %s", want, languages(got))
+	}
+}
+
+func testCappedOutliers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	big := commit("big", 2_000_000, 10)
+	big.Capped, big.CappedAdditions, big.CappedDeletions = true, 900, 100
+	big.AdjustedAdditions, big.AdjustedDeletions, big.AdjustedNet = 990, 10, 980
+	mustInsert(t, s, commit("small", 50, 20), big)
+	if err := s.SaveCommitIdentities(ctx, []*store.CommitIdentityRow{
+		identityRow("small", store.RoleAuthor, identity.Identity{Name: "Mona", Login: "mona"}),
+		identityRow("big", store.RoleAuthor, identity.Identity{Name: "Mona", Login: "mona"}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{}); err != nil || net != 830 {
+		t.Errorf("raw GlobalNetLines want 830 (30 + capped 800) got %d (%v)", net, err)
+	}
+	if net, err := s.GlobalNetLines(ctx, store.StatsFilter{Adjusted: true}); err != nil || net != 1010 {
+		t.Errorf("adjusted GlobalNetLines want 1010 got %d (%v)", net, err)
+	}
+	repos, err := s.RepoStats(ctx, store.StatsFilter{}, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].Additions != 950 || repos[0].Deletions != 120 {
+		t.Errorf("RepoStats want 950 additions and 120 deletions got %+v", repos)
+	}
+	authors, err := s.AuthorStats(ctx, store.StatsFilter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := authorStats(authors); got != "Mona/mona:2:830" {
+		t.Errorf("AuthorStats want Mona/mona:2:830 got %s", got)
+	}
+}
+
+// mustInsert inserts commit_stats rows, failing the test on error.
+func testAnomalies(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := []*store.AnomalyRow{
+		{Sha: "a", Repo: "o/r", Author: "dev", CommittedAt: base, DetectedAt: base.Add(time.Minute), Additions: 2_000_000, Deletions: 5,
+			Method: "zscore", Baseline: "repo", Samples: 120, Score: 7.25, Limit: 40_000, Capped: true},
+		{Sha: "b", Repo: "o/other", CommittedAt: base.Add(time.Hour), DetectedAt: base.Add(time.Hour), Additions: 90_000,
+			Method: "percentile", Baseline: "global", Samples: 1000, Score: 4.5, Limit: 20_000},
+		{Sha: "c", Repo: "o/r", CommittedAt: base.Add(2 * time.Hour), DetectedAt: base.Add(2 * time.Hour), Deletions: 300_000,
+			Method: "zscore", Baseline: "global", Samples: 30, Score: 5, Limit: 10_000},
+	}
+	for _, r := range rows {
+		if ok, err := s.InsertAnomaly(ctx, r); err != nil || !ok {
+			t.Fatalf("insert %s want (true, nil) got (%v, %v)", r.Sha, ok, err)
+		}
+	}
+	if ok, err := s.InsertAnomaly(ctx, rows[0]); err != nil || ok {
+		t.Fatalf("duplicate insert want (false, nil) got (%v, %v)", ok, err)
+	}
+
+	shas := func(filter store.AnomalyFilter) string {
+		t.Helper()
+		got, err := s.Anomalies(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]string, 0, len(got))
+		for _, a := range got {
+			out = append(out, a.Sha)
+		}
+		return fmt.Sprint(out)
+	}
+	if got := shas(store.AnomalyFilter{}); got != "[c b a]" {
+		t.Errorf("unfiltered want [c b a] (latest commit first) got %s", got)
+	}
+	if got := shas(store.AnomalyFilter{Since: base.Add(time.Hour)}); got != "[c b]" {
+		t.Errorf("since 1h want [c b] got %s", got)
+	}
+	if got := shas(store.AnomalyFilter{Repo: "o/r", Limit: 1}); got != "[c]" {
+		t.Errorf("repo o/r, limit 1 want [c] got %s", got)
+	}
+
+	got, err := s.Anomalies(ctx, store.AnomalyFilter{Repo: "o/r", Since: base, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("want 2 rows got %d", len(got))
+	}
+	a, want := got[1], rows[0]
+	if a.Sha != want.Sha || a.Author != "dev" || !a.CommittedAt.Equal(want.CommittedAt) || !a.DetectedAt.Equal(want.DetectedAt) ||
+		a.Additions != want.Additions || a.Deletions != want.Deletions || a.Method != want.Method || a.Baseline != want.Baseline ||
+		a.Samples != want.Samples || a.Score != want.Score || a.Limit != want.Limit || !a.Capped {
+		t.Errorf("row a want %+v got %+v", want, a)
+	}
+}
+
+func testRepoActivity(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(sha, repo string, offset time.Duration) *store.CommitStatsRow {
+		c := commit(sha, 1, 0)
+		c.Repo, c.CommittedAt = repo, base.Add(offset)
+		return c
+	}
+	bot := at("bot", "o/r", 10*time.Minute)
+	bot.IsBot = true
+	mustInsert(t, s, at("a", "o/r", 5*time.Minute), at("b", "o/r", 70*time.Minute), at("c", "o/other", 0), at("old", "o/r", -2*time.Hour), bot)
+	for _, e := range []*store.PushEventRow{
+		{ID: "p1", Type: "PushEvent", CreatedAt: base.Add(time.Minute), Repo: "o/r"},
+		{ID: "p2", Type: "PushEvent", CreatedAt: base.Add(59 * time.Minute), Repo: "o/r"},
+		{ID: "p3", Type: "PushEvent", CreatedAt: base.Add(3 * time.Minute), Repo: "o/r", IsBot: true},
+		{ID: "p4", Type: "PushEvent", CreatedAt: base.Add(-3 * time.Hour), Repo: "o/r"},
+	} {
+		if _, err := s.InsertPushEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	activity := func(filter store.StatsFilter) string {
+		t.Helper()
+		rows, err := s.RepoActivity(ctx, filter, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]string, 0, len(rows))
+		for _, r := range rows {
+			out = append(out, fmt.Sprintf("%s@%s:%d/%d", r.Repo, r.Bucket.UTC().Format("15:04"), r.Pushes, r.Commits))
+		}
+		return fmt.Sprint(out)
+	}
+	if got := activity(store.StatsFilter{Since: base, ExcludeBots: true}); got != "[o/other@12:00:0/1 o/r@12:00:2/1 o/r@13:00:0/1]" {
+		t.Errorf("activity without bots want [o/other@12:00:0/1 o/r@12:00:2/1 o/r@13:00:0/1] got %s", got)
+	}
+	if got := activity(store.StatsFilter{Since: base, Repo: "o/r"}); got != "[o/r@12:00:3/2 o/r@13:00:0/1]" {
+		t.Errorf("activity of o/r with bots want [o/r@12:00:3/2 o/r@13:00:0/1] got %s", got)
+	}
+}
+
+func testRecentCommits(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var rows []*store.CommitStatsRow
+	for i, sha := range []string{"a", "b", "c"} {
+		c := commit(sha, int64(i+1), 0)
+		c.CommittedAt = base.Add(time.Duration(i) * time.Minute)
+		rows = append(rows, c)
+	}
+	merge := commit("merge", 1, 0)
+	merge.ParentCount, merge.IsMerge = 2, true
+	other := commit("other", 1, 0)
+	other.Repo = "o/other"
+	mustInsert(t, s, append(rows, merge, other)...)
+
+	got, err := s.RecentCommits(ctx, store.StatsFilter{Repo: "o/r", ExcludeMerges: true}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Sha != "c" || got[1].Sha != "b" {
+		t.Fatalf("want [c b] got %d rows", len(got))
+	}
+	if got[0].Author != "dev" || got[0].Additions != 3 || !got[0].CommittedAt.Equal(rows[2].CommittedAt) {
+		t.Errorf("unexpected row %+v", got[0])
+	}
+	if all, err := s.RecentCommits(ctx, store.StatsFilter{}, 0); err != nil || len(all) != 5 {
+		t.Errorf("unlimited want 5 commits got %d (%v)", len(all), err)
+	}
+}
+
+func testTrendingSnapshot(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	sample := store.TrendingSample{Sha: "abc", Author: "dev", CommittedAt: at.Add(-time.Minute), Additions: 10, Deletions: 2}
+	day := []*store.TrendingRow{
+		{Repo: "o/b", Rank: 2, Score: 4.5, Velocity: 0.5, Pushes: 6, Commits: 6, ComputedAt: at},
+		{Repo: "o/a", Rank: 1, Score: 12.25, Velocity: 1.5, Pushes: 12, Commits: 24, Samples: []store.TrendingSample{sample}, ComputedAt: at},
+	}
+	if err := s.SaveTrending(ctx, 24*time.Hour, day); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveTrending(ctx, time.Hour, []*store.TrendingRow{{Repo: "o/c", Rank: 1, Score: 1, ComputedAt: at}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Trending(ctx, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Repo != "o/a" || got[1].Repo != "o/b" {
+		t.Fatalf("want [o/a o/b] by rank got %d rows", len(got))
+	}
+	a := got[0]
+	if a.Window != 24*time.Hour || a.Score != 12.25 || a.Velocity != 1.5 || a.Pushes != 12 || a.Commits != 24 || !a.ComputedAt.Equal(at) ||
+		len(a.Samples) != 1 || a.Samples[0].Sha != "abc" || !a.Samples[0].CommittedAt.Equal(sample.CommittedAt) || a.Samples[0].Deletions != 2 {
+		t.Errorf("unexpected row %+v", a)
+	}
+	if got[1].Samples != nil && len(got[1].Samples) != 0 {
+		t.Errorf("row without samples want none got %+v", got[1].Samples)
+	}
+
+	// Saving replaces the snapshot of the window only.
+	if err := s.SaveTrending(ctx, 24*time.Hour, []*store.TrendingRow{{Repo: "o/d", Rank: 1, Score: 3, ComputedAt: at.Add(time.Hour)}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Trending(ctx, 24*time.Hour, 1); err != nil || len(got) != 1 || got[0].Repo != "o/d" {
+		t.Errorf("replaced snapshot want [o/d] got %d rows (%v)", len(got), err)
+	}
+	if got, err := s.Trending(ctx, time.Hour, 10); err != nil || len(got) != 1 || got[0].Repo != "o/c" {
+		t.Errorf("1h snapshot want [o/c] got %d rows (%v)", len(got), err)
+	}
+	if got, err := s.Trending(ctx, 7*24*time.Hour, 10); err != nil || len(got) != 0 {
+		t.Errorf("unknown window want no rows got %d (%v)", len(got), err)
+	}
+}
+
+func testExportCommitStats(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	a, b, c := commit("a", 1, 0), commit("b", 2, 0), commit("c", 3, 0)
+	a.CommittedAt, b.CommittedAt, c.CommittedAt = base.Add(2*time.Hour), base, base.Add(time.Hour)
+	c.Repo, c.Author = "o/other", "someone"
+	c.Capped, c.CappedAdditions = true, 2
+	mustInsert(t, s, a, b, c)
+	if _, err := s.MarkCommitsOrphaned(ctx, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	export := func(filter store.ExportFilter) string {
+		t.Helper()
+		var out []string
+		err := s.ExportCommitStats(ctx, filter, func(r *store.CommitStatsRow) error {
+			if r.Sha == "a" && (!r.CommittedAt.Equal(a.CommittedAt) || r.Additions != 1 || r.Author != "dev" || r.Capped || r.Orphaned) {
+				t.Errorf("row a want %+v got %+v", a, r)
+			}
+			if r.Sha == "b" && !r.Orphaned {
+				t.Errorf("row b want orphaned got %+v", r)
+			}
+			if r.Sha == "c" && (!r.Capped || r.CappedAdditions != 2 || r.CappedDeletions != 0 || r.Orphaned) {
+				t.Errorf("row c want capped to 2 additions got %+v", r)
+			}
+			out = append(out, r.Sha)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(out)
+	}
+	if got := export(store.ExportFilter{}); got != "[b c a]" {
+		t.Errorf("unfiltered want [b c a] (by committed_at) got %s", got)
+	}
+	if got := export(store.ExportFilter{From: base.Add(time.Hour), To: base.Add(2 * time.Hour)}); got != "[c]" {
+		t.Errorf("[1h, 2h) want [c] got %s", got)
+	}
+	if got := export(store.ExportFilter{Repo: "o/r"}); got != "[b a]" {
+		t.Errorf("repo o/r want [b a] got %s", got)
+	}
+	if got := export(store.ExportFilter{Author: "someone"}); got != "[c]" {
+		t.Errorf("author someone want [c] got %s", got)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err := s.ExportCommitStats(ctx, store.ExportFilter{}, func(*store.CommitStatsRow) error { n++; return stop })
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("callback error want stop after 1 row got %v after %d", err, n)
+	}
+}
+
+func testExportPushEvents(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := []*store.PushEventRow{
+		{ID: "e2", Type: "PushEvent", CreatedAt: base.Add(time.Minute), ActorLogin: "dev", Repo: "o/r",
+			RawPayload: []byte(`{"size":1}`), Ref: "refs/heads/main", RefType: "branch", PushID: 7, Size: 1, DistinctSize: 1, Source: "global"},
+		{ID: "e1", Type: "PushEvent", CreatedAt: base, ActorLogin: "other", Repo: "o/r"},
+	}
+	for _, r := range rows {
+		if _, err := s.InsertPushEvent(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []*store.PushEventRow
+	if err := s.ExportPushEvents(ctx, store.ExportFilter{}, func(r *store.PushEventRow) error {
+		got = append(got, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != "e1" || got[1].ID != "e2" {
+		t.Fatalf("want [e1 e2] got %d rows", len(got))
+	}
+	e2 := got[1]
+	var payload struct{ Size int }
+	if err := json.Unmarshal(e2.RawPayload, &payload); err != nil || payload.Size != 1 {
+		t.Errorf("e2 raw payload want {\"size\":1} got %s (%v)", e2.RawPayload, err)
+	}
+	if !e2.CreatedAt.Equal(rows[0].CreatedAt) || e2.ActorLogin != "dev" ||
+		e2.Ref != "refs/heads/main" || e2.PushID != 7 || e2.Size != 1 || e2.Source != "global" {
+		t.Errorf("e2 want %+v got %+v", rows[0], e2)
+	}
+
+	n := 0
+	if err := s.ExportPushEvents(ctx, store.ExportFilter{Author: "dev", From: base.Add(time.Second)}, func(*store.PushEventRow) error {
+		n++
+		return nil
+	}); err != nil || n != 1 {
+		t.Errorf("filtered export want 1 row got %d (%v)", n, err)
+	}
+}
+
+func testAuthorsMergeByKey(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	merge := commit("merge", 100, 0)
+	merge.ParentCount, merge.IsMerge = 2, true
+	mustInsert(t, s, commit("a", 10, 0), commit("b", 5, 1), commit("c", 1, 0), commit("d", 3, 0), merge)
+
+	rows := []*store.CommitIdentityRow{
+		// Linked to login mona by GitHub, then seen with the same email unlinked, then with a noreply email.
+		identityRow("a", store.RoleAuthor, identity.Identity{Name: "Mona", Email: "mona@example.com", Login: "mona"}),
+		identityRow("b", store.RoleAuthor, identity.Identity{Name: "mona lisa", Email: "Mona@Example.com"}),
+		identityRow("c", store.RoleAuthor, identity.Identity{Name: "M", Email: "1+mona@users.noreply.github.com"}),
+		identityRow("d", store.RoleAuthor, identity.Identity{Name: "Hubot", Email: "hubot@example.com"}),
+		identityRow("merge", store.RoleAuthor, identity.Identity{Name: "Hubot", Email: "hubot@example.com"}),
+		identityRow("a", store.RoleCommitter, identity.Identity{Name: "GitHub", Email: "noreply@github.com", Login: "web-flow"}),
+		identityRow("e", store.RoleAuthor, identity.Identity{}),
+	}
+	if err := s.SaveCommitIdentities(ctx, rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].AuthorID == 0 || rows[1].AuthorID != rows[0].AuthorID || rows[2].AuthorID != rows[0].AuthorID {
+		t.Errorf("mona identities want one author got ids %d %d %d", rows[0].AuthorID, rows[1].AuthorID, rows[2].AuthorID)
+	}
+	if rows[3].AuthorID == rows[0].AuthorID || rows[4].AuthorID != rows[3].AuthorID || rows[5].AuthorID == rows[0].AuthorID {
+		t.Errorf("hubot and web-flow want their own authors got ids %d %d %d", rows[3].AuthorID, rows[4].AuthorID, rows[5].AuthorID)
+	}
+	// Saving again is idempotent.
+	if err := s.SaveCommitIdentities(ctx, rows[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.AuthorStats(ctx, store.StatsFilter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := authorStats(stats); got != "Hubot:2:103 Mona/mona:3:15" {
+		t.Errorf("AuthorStats want Hubot:2:103 Mona/mona:3:15 got %s", got)
+	}
+	stats, err = s.AuthorStats(ctx, store.StatsFilter{ExcludeMerges: true}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := authorStats(stats); got != "Mona/mona:3:15" {
+		t.Errorf("AuthorStats without merges, limit 1 want Mona/mona:3:15 got %s", got)
+	}
+}
+
+func testAuthorsMergedByLinkingCommit(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustInsert(t, s, commit("x", 10, 0), commit("y", 5, 0), commit("z", 1, 0), commit("w", 2, 0))
+
+	// The same person seen first by email only, then by login only: two authors.
+	byEmail := identityRow("x", store.RoleAuthor, identity.Identity{Name: "Mona", Email: "mona@work.example"})
+	byLogin := identityRow("y", store.RoleAuthor, identity.Identity{Name: "Mona Lisa", Login: "monalisa"})
+	if err := s.SaveCommitIdentities(ctx, []*store.CommitIdentityRow{byEmail, byLogin}); err != nil {
+		t.Fatal(err)
+	}
+	if byEmail.AuthorID == byLogin.AuthorID {
+		t.Fatalf("unlinked identities want two authors got %d", byEmail.AuthorID)
+	}
+
+	// A commit with both the login and the email links them: the login's author absorbs the other.
+	linking := identityRow("z", store.RoleAuthor, identity.Identity{Name: "Mona", Email: "mona@work.example", Login: "monalisa"})
+	if err := s.SaveCommitIdentities(ctx, []*store.CommitIdentityRow{linking}); err != nil {
+		t.Fatal(err)
+	}
+	if linking.AuthorID != byLogin.AuthorID {
+		t.Errorf("linking identity want author %d got %d", byLogin.AuthorID, linking.AuthorID)
+	}
+	later := identityRow("w", store.RoleAuthor, identity.Identity{Name: "M", Email: "mona@work.example"})
+	if err := s.SaveCommitIdentities(ctx, []*store.CommitIdentityRow{later}); err != nil {
+		t.Fatal(err)
+	}
+	if later.AuthorID != byLogin.AuthorID {
+		t.Errorf("email of the merged author want author %d got %d", byLogin.AuthorID, later.AuthorID)
+	}
+
+	stats, err := s.AuthorStats(ctx, store.StatsFilter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := authorStats(stats); got != "Mona Lisa/monalisa:4:18" {
+		t.Errorf("AuthorStats want Mona Lisa/monalisa:4:18 got %s", got)
+	}
+	if len(stats) == 1 && stats[0].Email != "mona@work.example" {
+		t.Errorf("merged author want the email of the other got %q", stats[0].Email)
+	}
+}
+
+func testConcurrentIdentitiesOfSameAuthor(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	const workers = 8
+	rows := make([]*store.CommitIdentityRow, workers)
+	var wg sync.WaitGroup
+	for i := range rows {
+		sha := fmt.Sprintf("sha%d", i)
+		mustInsert(t, s, commit(sha, 1, 0))
+		rows[i] = identityRow(sha, store.RoleAuthor, identity.Identity{Name: "Mona", Email: "mona@example.com"})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.SaveCommitIdentities(ctx, rows[i:i+1]); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	stats, err := s.AuthorStats(ctx, store.StatsFilter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Commits != workers {
+		t.Errorf("want one author with %d commits got %s", workers, authorStats(stats))
+	}
+}
+
+// identityRow returns the commit_identities row of id for sha, with its canonical form and keys.
+func identityRow(sha, role string, id identity.Identity) *store.CommitIdentityRow {
+	c := id.Normalize()
+	return &store.CommitIdentityRow{
+		Sha: sha, Role: role, Name: id.Name, Email: id.Email, Login: id.Login,
+		Canonical: store.AuthorRow{Name: c.Name, Email: c.Email, Login: c.Login},
+		Keys:      c.Keys(),
+	}
+}
+
+// authorStats formats AuthorStats rows as "Name[/login]:commits:net" in order.
+func authorStats(rows []*store.AuthorStatsRow) string {
+	out := ""
+	for i, r := range rows {
+		if i > 0 {
+			out += " "
+		}
+		out += r.Name
+		if r.Login != "" {
+			out += "/" + r.Login
+		}
+		out += fmt.Sprintf(":%d:%d", r.Commits, r.Net)
+	}
+	return out
+}
+
+func mustInsert(t *testing.T, s store.Store, rows ...*store.CommitStatsRow) {
+	t.Helper()
+	if _, err := s.InsertCommitStatsBatch(context.Background(), rows); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// languages formats LanguageStats rows as "Lang:commits:additions-deletions=net" in order.
+func languages(rows []*store.LanguageStatsRow) string {
+	out := ""
+	for i, r := range rows {
+		if i > 0 {
+			out += " "
+		}
+		out += fmt.Sprintf("%s:%d:%d-%d=%d", r.Language, r.Commits, r.Additions, r.Deletions, r.Net)
+	}
+	return out
+}
+
+// commit returns a non-merge commit_stats row with the given line counts, committed now.
+func commit(sha string, additions, deletions int64) *store.CommitStatsRow {
+	return &store.CommitStatsRow{
+		Sha:               sha,
+		Repo:              "o/r",
+		Author:            "dev",
+		CommittedAt:       time.Now(),
+		Additions:         additions,
+		Deletions:         deletions,
+		Total:             additions + deletions,
+		Net:               additions - deletions,
+		AdjustedAdditions: additions,
+		AdjustedDeletions: deletions,
+		AdjustedNet:       additions - deletions,
+		ParentCount:       1,
+	}
+}
@@ -0,0 +1,203 @@
+// Package trending spots repositories whose activity suddenly spikes. Pushes and commits are weighted with
+// exponential decay over a sliding window and compared with the same decay over the window before it, so
+// repos rank by how much their recent activity exceeds their previous level. Snapshots are persisted
+// periodically per window.
+package trending
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+)
+
+const (
+	// DefaultInterval is how often Run recomputes the snapshots when no interval is given.
+	DefaultInterval = 5 * time.Minute
+	// Limit is the number of repos kept in the snapshot of each window.
+	Limit = 100
+	// Samples is the number of recent commits stored with each trending repo.
+	Samples = 3
+	// MinEvents is the number of pushes and commits a repo needs within a window to trend.
+	MinEvents = 3
+	// bucketsPerWindow is the resolution activity is aggregated at.
+	bucketsPerWindow = 24
+	// halfLivesPerWindow is how many times the weight of activity halves across a window.
+	halfLivesPerWindow = 4
+)
+
+// DefaultWindows are the windows scored when none are configured.
+var DefaultWindows = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+// ParseWindows parses window lengths given as Go durations or whole days (e.g. "1h", "7d").
+func ParseWindows(specs []string) ([]time.Duration, error) {
+	out := make([]time.Duration, 0, len(specs))
+	for _, v := range specs {
+		var d time.Duration
+		if days, ok := strings.CutSuffix(v, "d"); ok {
+			n, err := strconv.Atoi(days)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trending window %q", v)
+			}
+			d = time.Duration(n) * 24 * time.Hour
+		} else {
+			var err error
+			if d, err = time.ParseDuration(v); err != nil {
+				return nil, fmt.Errorf("invalid trending window %q", v)
+			}
+		}
+		if d < time.Minute {
+			return nil, fmt.Errorf("invalid trending window %q: must be at least 1m", v)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// Score ranks repos by the activity of buckets of [now-2*window, now): the decayed activity of the last window
+// minus that of the window before, where an event's weight halves every window/4 of age within its window.
+// Velocity is the pushes and commits per hour over the last window. Returns the top limit repos (all when
+// limit <= 0) with a positive score and at least MinEvents events in the last window.
+func Score(activity []*store.RepoActivityRow, now time.Time, window time.Duration, limit int) []*store.TrendingRow {
+	type repoScore struct {
+		recent, previous float64
+		pushes, commits  int64
+	}
+	halfLife := float64(window / halfLivesPerWindow)
+	width := window / bucketsPerWindow
+	scores := make(map[string]*repoScore)
+	for _, a := range activity {
+		age := max(now.Sub(a.Bucket.Add(width/2)), 0)
+		if age >= 2*window {
+			continue
+		}
+		rs, ok := scores[a.Repo]
+		if !ok {
+			rs = &repoScore{}
+			scores[a.Repo] = rs
+		}
+		events := float64(a.Pushes + a.Commits)
+		if age < window {
+			rs.recent += events * math.Exp2(-float64(age)/halfLife)
+			rs.pushes += a.Pushes
+			rs.commits += a.Commits
+		} else {
+			rs.previous += events * math.Exp2(-float64(age-window)/halfLife)
+		}
+	}
+	var out []*store.TrendingRow
+	for repo, rs := range scores {
+		score := rs.recent - rs.previous
+		if rs.pushes+rs.commits < MinEvents || score <= 0 {
+			continue
+		}
+		out = append(out, &store.TrendingRow{
+			Window:     window,
+			Repo:       repo,
+			Score:      score,
+			Velocity:   float64(rs.pushes+rs.commits) / window.Hours(),
+			Pushes:     rs.pushes,
+			Commits:    rs.commits,
+			ComputedAt: now,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Repo < out[j].Repo
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	for i, r := range out {
+		r.Rank = i + 1
+	}
+	return out
+}
+
+// Job recomputes and persists the trending snapshots. Depends only on the store interface.
+type Job struct {
+	store    store.Store
+	defaults store.StatsFilter
+	windows  []time.Duration
+	interval time.Duration
+	now      func() time.Time
+	log      *slog.Logger
+}
+
+// NewJob returns a job scoring each window every interval (DefaultInterval when <= 0). Commits are those
+// matched by defaults (e.g. merge, orphan and bot exclusion); bots' pushes are left out with ExcludeBots.
+func NewJob(s store.Store, defaults store.StatsFilter, windows []time.Duration, interval time.Duration) *Job {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Job{
+		store:    s,
+		defaults: defaults,
+		windows:  windows,
+		interval: interval,
+		now:      time.Now,
+		log:      slog.Default(),
+	}
+}
+
+// Run recomputes the snapshots at start and then every interval until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	j.log.Info("trending job running", "windows", j.windows, "interval", j.interval)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		if err := j.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			j.log.Warn("trending", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			j.log.Info("trending job stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce scores every window and replaces its snapshot, with sample commits of each trending repo.
+func (j *Job) RunOnce(ctx context.Context) error {
+	now := j.now()
+	for _, window := range j.windows {
+		filter := j.defaults
+		filter.Since = now.Add(-2 * window)
+		activity, err := j.store.RepoActivity(ctx, filter, window/bucketsPerWindow)
+		if err != nil {
+			return fmt.Errorf("activity of the last %s: %w", window, err)
+		}
+		rows := Score(activity, now, window, Limit)
+		for _, r := range rows {
+			filter := j.defaults
+			filter.Since, filter.Repo = now.Add(-window), r.Repo
+			commits, err := j.store.RecentCommits(ctx, filter, Samples)
+			if err != nil {
+				return fmt.Errorf("sample commits of %s: %w", r.Repo, err)
+			}
+			for _, c := range commits {
+				r.Samples = append(r.Samples, store.TrendingSample{
+					Sha:         c.Sha,
+					Author:      c.Author,
+					CommittedAt: c.CommittedAt,
+					Additions:   c.Additions,
+					Deletions:   c.Deletions,
+				})
+			}
+		}
+		if err := j.store.SaveTrending(ctx, window, rows); err != nil {
+			return fmt.Errorf("save trending of the last %s: %w", window, err)
+		}
+		j.log.Debug("trending computed", "window", window, "repos", len(rows))
+	}
+	return nil
+}
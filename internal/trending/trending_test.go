@@ -0,0 +1,112 @@
+package trending
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/challenge-github-events/internal/store"
+	"go.uber.org/mock/gomock"
+)
+
+var now = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// hourly returns a row of repo activity in the bucket starting hoursAgo hours before now.
+func hourly(repo string, hoursAgo int, pushes, commits int64) *store.RepoActivityRow {
+	return &store.RepoActivityRow{Repo: repo, Bucket: now.Add(-time.Duration(hoursAgo) * time.Hour), Pushes: pushes, Commits: commits}
+}
+
+func TestScore_SpikeOutranksSteadyActivity(t *testing.T) {
+	var activity []*store.RepoActivityRow
+	for h := 1; h <= 48; h++ {
+		activity = append(activity, hourly("o/steady", h, 5, 10))
+	}
+	activity = append(activity,
+		hourly("o/spike", 30, 1, 0),
+		hourly("o/spike", 2, 10, 40),
+		hourly("o/spike", 1, 10, 30),
+		hourly("o/fading", 30, 20, 40),
+		hourly("o/fading", 20, 1, 1),
+	)
+
+	rows := Score(activity, now, 24*time.Hour, 0)
+	if len(rows) != 1 || rows[0].Repo != "o/spike" {
+		t.Fatalf("want only o/spike trending got %+v", rows)
+	}
+	r := rows[0]
+	if r.Rank != 1 || r.Score <= 0 || r.Pushes != 20 || r.Commits != 70 || r.Velocity != 90.0/24 || r.Window != 24*time.Hour || !r.ComputedAt.Equal(now) {
+		t.Errorf("unexpected row %+v", r)
+	}
+}
+
+func TestScore_RecentActivityWeighsMore(t *testing.T) {
+	rows := Score([]*store.RepoActivityRow{
+		hourly("o/old", 20, 10, 10),
+		hourly("o/new", 1, 10, 10),
+		hourly("o/few", 1, 1, 1),
+	}, now, 24*time.Hour, 0)
+	if len(rows) != 2 || rows[0].Repo != "o/new" || rows[1].Repo != "o/old" || rows[1].Rank != 2 {
+		t.Fatalf("want [o/new o/old] (o/few under MinEvents) got %+v", rows)
+	}
+	// 20 events each, 19.5h and 0.5h old on average, with a half-life of 6h.
+	if rows[1].Score < 2 || rows[1].Score > 2.2 || rows[0].Score < 18.8 || rows[0].Score > 19 {
+		t.Errorf("decay want old ~2.1 and new ~18.9 got %v and %v", rows[1].Score, rows[0].Score)
+	}
+	if got := Score([]*store.RepoActivityRow{hourly("o/a", 1, 5, 0), hourly("o/b", 1, 9, 0)}, now, 24*time.Hour, 1); len(got) != 1 || got[0].Repo != "o/b" {
+		t.Errorf("limit 1 want [o/b] got %+v", got)
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	got, err := ParseWindows([]string{"1h", "24h", "7d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != time.Hour || got[2] != 7*24*time.Hour {
+		t.Errorf("want [1h 24h 168h] got %v", got)
+	}
+	for _, bad := range []string{"", "7x", "d", "30s", "-1h"} {
+		if _, err := ParseWindows([]string{bad}); err == nil {
+			t.Errorf("ParseWindows(%q) want error", bad)
+		}
+	}
+}
+
+func TestJob_RunOnce_SavesSnapshotsWithSamples(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	defaults := store.StatsFilter{ExcludeOrphaned: true, ExcludeBots: true}
+	mockStore.EXPECT().RepoActivity(gomock.Any(), store.StatsFilter{ExcludeOrphaned: true, ExcludeBots: true, Since: now.Add(-2 * time.Hour)}, 150*time.Second).
+		Return([]*store.RepoActivityRow{{Repo: "o/r", Bucket: now.Add(-10 * time.Minute), Pushes: 2, Commits: 3}}, nil)
+	mockStore.EXPECT().RecentCommits(gomock.Any(), store.StatsFilter{ExcludeOrphaned: true, ExcludeBots: true, Since: now.Add(-time.Hour), Repo: "o/r"}, Samples).
+		Return([]*store.CommitStatsRow{{Sha: "abc", Author: "dev", CommittedAt: now.Add(-5 * time.Minute), Additions: 7, Deletions: 1}}, nil)
+	mockStore.EXPECT().SaveTrending(gomock.Any(), time.Hour, gomock.Any()).DoAndReturn(func(_ context.Context, _ time.Duration, rows []*store.TrendingRow) error {
+		if len(rows) != 1 || rows[0].Repo != "o/r" || rows[0].Rank != 1 || len(rows[0].Samples) != 1 || rows[0].Samples[0].Sha != "abc" || rows[0].Samples[0].Additions != 7 {
+			t.Errorf("unexpected snapshot %+v", rows)
+		}
+		return nil
+	})
+	mockStore.EXPECT().RepoActivity(gomock.Any(), gomock.Any(), time.Hour).Return(nil, nil)
+	mockStore.EXPECT().SaveTrending(gomock.Any(), 24*time.Hour, gomock.Len(0)).Return(nil)
+
+	job := NewJob(mockStore, defaults, []time.Duration{time.Hour, 24 * time.Hour}, 0)
+	job.now = func() time.Time { return now }
+	if err := job.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJob_RunOnce_StopsOnStoreError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := store.NewMockStore(ctrl)
+	mockStore.EXPECT().RepoActivity(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("boom"))
+
+	if err := NewJob(mockStore, store.StatsFilter{}, DefaultWindows, 0).RunOnce(context.Background()); err == nil {
+		t.Fatal("want error")
+	}
+}